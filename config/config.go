@@ -17,13 +17,18 @@ limitations under the License.
 package config
 
 import (
+	"crypto/tls"
+	"net"
+	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
 	authorizerd "github.com/yahoojapan/athenz-authorizer/v5"
 
 	"github.com/pkg/errors"
+	"golang.org/x/net/http/httpguts"
 	yaml "gopkg.in/yaml.v2"
 )
 
@@ -51,6 +56,35 @@ type Config struct {
 
 	// Log represents the logger configuration.
 	Log Log `yaml:"log"`
+
+	// Tracing represents the OpenTelemetry tracing configuration.
+	Tracing Tracing `yaml:"tracing,omitempty"`
+
+	// Audit represents the audit log configuration of the authorization decisions.
+	Audit Audit `yaml:"audit,omitempty"`
+
+	// Reload represents the reload of the configuration file without restart.
+	Reload Reload `yaml:"reload,omitempty"`
+}
+
+// Reload represents the reload of the configuration file without restart. SIGHUP always reloads the file.
+type Reload struct {
+	// Enable represents whether to reload the configuration file when it changes.
+	Enable bool `yaml:"enable"`
+
+	// Period represents the interval to check the configuration file for changes. Default is 10s.
+	Period string `yaml:"period,omitempty"`
+}
+
+// Validate returns an error if the reload configuration is invalid.
+func (r Reload) Validate() error {
+	if !r.Enable || r.Period == "" {
+		return nil
+	}
+	if d, err := time.ParseDuration(r.Period); err != nil || d <= 0 {
+		return errors.Errorf("invalid period: %s", r.Period)
+	}
+	return nil
 }
 
 // Server represents the authorization proxy and the health check server configuration.
@@ -58,9 +92,24 @@ type Server struct {
 	// Port represents the server listening port.
 	Port int `yaml:"port"`
 
-	// Timeout represents the maximum request handling duration.
+	// Listener represents the listener of the authorization proxy server, which overrides the port.
+	Listener Listener `yaml:"listener,omitempty"`
+
+	// Listeners represents the additional listeners of the authorization proxy server, each with its own TLS configuration.
+	Listeners []ProxyListener `yaml:"listeners,omitempty"`
+
+	// ProxyProtocol represents the PROXY protocol configuration of the authorization proxy listener.
+	ProxyProtocol ProxyProtocol `yaml:"proxyProtocol,omitempty"`
+
+	// HTTP3 represents the HTTP/3 (QUIC) listener of the authorization proxy server.
+	HTTP3 HTTP3 `yaml:"http3,omitempty"`
+
+	// Timeout represents the maximum request handling duration of the debug server.
 	Timeout string `yaml:"timeout"`
 
+	// Timeouts represents the timeouts and the limits of the authorization proxy, health check and debug servers.
+	Timeouts ServerTimeouts `yaml:"timeouts,omitempty"`
+
 	// ShutdownTimeout represents the duration before force shutdown.
 	ShutdownTimeout string `yaml:"shutdownTimeout"`
 
@@ -75,6 +124,314 @@ type Server struct {
 
 	// Debug represents the debug server configuration.
 	Debug Debug `yaml:"debug"`
+
+	// GRPC represents the gRPC server parameters of the authorization proxy.
+	GRPC GRPCServer `yaml:"grpc,omitempty"`
+
+	// Metrics represents the Prometheus metrics endpoint configuration.
+	Metrics Metrics `yaml:"metrics,omitempty"`
+
+	// Overload represents the connection and concurrency limits of the authorization proxy server.
+	Overload Overload `yaml:"overload,omitempty"`
+}
+
+// Listener represents the listener of a server. Default is TCP on all interfaces with the port of the server.
+type Listener struct {
+	// Network represents the type of the listener, "tcp", "tcp4", "tcp6", "unix" or "fd". Default is "tcp", which is dual-stack on the unspecified address.
+	Network string `yaml:"network,omitempty"`
+
+	// Address represents "host:port" for tcp, the socket file path for unix,
+	// and the file descriptor number or the name in LISTEN_FDNAMES of the systemd socket activation for fd.
+	Address string `yaml:"address,omitempty"`
+
+	// Mode represents the permission of the unix socket file in octal, e.g. "0660". Default is decided by the umask.
+	Mode string `yaml:"mode,omitempty"`
+
+	// Owner represents the owner of the unix socket file, "user", "user:group" or ":group", by the names or the IDs.
+	Owner string `yaml:"owner,omitempty"`
+}
+
+const (
+	// ListenerTCP represents the TCP listener.
+	ListenerTCP = "tcp"
+	// ListenerTCP4 represents the TCP listener on IPv4 only.
+	ListenerTCP4 = "tcp4"
+	// ListenerTCP6 represents the TCP listener on IPv6 only.
+	ListenerTCP6 = "tcp6"
+	// ListenerUnix represents the Unix domain socket listener.
+	ListenerUnix = "unix"
+	// ListenerFD represents the listener of an inherited file descriptor, e.g. by the systemd socket activation.
+	ListenerFD = "fd"
+)
+
+// Enabled returns whether the listener is configured instead of the port.
+func (l Listener) Enabled() bool {
+	return l.Address != ""
+}
+
+// Validate returns an error if the listener configuration is invalid.
+func (l Listener) Validate() error {
+	switch l.Network {
+	case "", ListenerTCP, ListenerTCP4, ListenerTCP6:
+		if l.Address != "" {
+			if _, _, err := net.SplitHostPort(l.Address); err != nil {
+				return errors.Wrapf(err, "invalid tcp address: %s", l.Address)
+			}
+		}
+	case ListenerUnix, ListenerFD:
+		if l.Address == "" {
+			return errors.Errorf("address is required for %s listener", l.Network)
+		}
+	default:
+		return errors.Errorf("invalid network: %s", l.Network)
+	}
+	if l.Network != ListenerUnix && (l.Mode != "" || l.Owner != "") {
+		return errors.New("mode and owner are only available for unix listener")
+	}
+	if l.Mode != "" {
+		if m, err := strconv.ParseUint(l.Mode, 8, 32); err != nil || m > 0777 {
+			return errors.Errorf("invalid mode: %s", l.Mode)
+		}
+	}
+	return nil
+}
+
+// ProxyListener represents an additional listener of the authorization proxy server.
+type ProxyListener struct {
+	// Listener represents the address of the listener, which is required.
+	Listener `yaml:",inline"`
+
+	// TLS represents the TLS configuration of the listener, which is independent of server.tls. Plaintext if not enabled.
+	TLS TLS `yaml:"tls,omitempty"`
+}
+
+// Validate returns an error if the additional listener configuration is invalid.
+func (p ProxyListener) Validate() error {
+	if !p.Listener.Enabled() {
+		return errors.New("address is required")
+	}
+	if err := p.Listener.Validate(); err != nil {
+		return err
+	}
+	if !p.TLS.Enable {
+		return nil
+	}
+	if p.TLS.CertPath == "" || p.TLS.KeyPath == "" {
+		return errors.New("tls.certPath and tls.keyPath are required")
+	}
+	return errors.Wrap(p.TLS.Validate(), "invalid tls")
+}
+
+// ProxyProtocol represents the PROXY protocol v1 and v2 configuration, which recovers the client address behind a L4 load balancer.
+type ProxyProtocol struct {
+	// Enable represents whether to accept the PROXY protocol header.
+	Enable bool `yaml:"enable"`
+
+	// TrustedCIDRs represents the source addresses allowed to send the header, e.g. the addresses of the load balancers.
+	// The connections from the other sources are served as is, and the connections on a Unix socket are always trusted.
+	TrustedCIDRs []string `yaml:"trustedCIDRs"`
+
+	// Required represents whether to reject the connections from the trusted sources without the header. Default is false.
+	Required bool `yaml:"required,omitempty"`
+
+	// HeaderTimeout represents the maximum duration to read the header. Default is 5s.
+	HeaderTimeout string `yaml:"headerTimeout,omitempty"`
+}
+
+// Validate returns an error if the PROXY protocol configuration is invalid.
+func (p ProxyProtocol) Validate() error {
+	if !p.Enable {
+		return nil
+	}
+	if len(p.TrustedCIDRs) == 0 {
+		return errors.New("trustedCIDRs is required")
+	}
+	for _, c := range p.TrustedCIDRs {
+		if _, _, err := net.ParseCIDR(c); err != nil {
+			return errors.Errorf("invalid trusted CIDR: %s", c)
+		}
+	}
+	if p.HeaderTimeout != "" {
+		if d, err := time.ParseDuration(p.HeaderTimeout); err != nil || d <= 0 {
+			return errors.Errorf("invalid headerTimeout: %s", p.HeaderTimeout)
+		}
+	}
+	return nil
+}
+
+// HTTP3 represents the HTTP/3 (QUIC) listener of the authorization proxy server, which shares the TLS configuration of the server.
+type HTTP3 struct {
+	// Enable represents whether to serve HTTP/3 and advertise it by the Alt-Svc header on the TLS responses.
+	Enable bool `yaml:"enable"`
+
+	// Address represents "host:port" of the UDP listener. Default is the address of the TCP listener of the server.
+	Address string `yaml:"address,omitempty"`
+
+	// AltSvcPort represents the port advertised by the Alt-Svc header, e.g. when the UDP traffic is redirected by a L4 load balancer. Default is the listening port.
+	AltSvcPort int `yaml:"altSvcPort,omitempty"`
+}
+
+// Validate returns an error if the HTTP/3 configuration is invalid.
+func (h HTTP3) Validate() error {
+	if !h.Enable {
+		return nil
+	}
+	if h.Address != "" {
+		if _, _, err := net.SplitHostPort(h.Address); err != nil {
+			return errors.Errorf("invalid address: %s", h.Address)
+		}
+	}
+	if h.AltSvcPort < 0 || h.AltSvcPort > 65535 {
+		return errors.Errorf("invalid altSvcPort: %d", h.AltSvcPort)
+	}
+	return nil
+}
+
+// Overload represents the connection and concurrency limits of the authorization proxy server, which shed the requests beyond the limits. 0 disables the limit.
+type Overload struct {
+	// Enable represents whether to enable the limits.
+	Enable bool `yaml:"enable"`
+
+	// MaxConnections represents the maximum number of open connections of all the proxy listeners. The connections beyond the limit are closed on accept.
+	MaxConnections int `yaml:"maxConnections,omitempty"`
+
+	// MaxConcurrentRequests represents the maximum number of in-flight HTTP requests and gRPC streams of the server.
+	MaxConcurrentRequests int `yaml:"maxConcurrentRequests,omitempty"`
+
+	// Upstreams represents the maximum number of in-flight requests per upstream.
+	Upstreams OverloadUpstreams `yaml:"upstreams,omitempty"`
+
+	// QueueSize represents the maximum number of requests waiting for a free slot when a limit is reached. Default is 0, i.e. shed immediately.
+	QueueSize int `yaml:"queueSize,omitempty"`
+
+	// QueueTimeout represents the maximum duration to wait in the queue. Default is 100ms.
+	QueueTimeout string `yaml:"queueTimeout,omitempty"`
+
+	// RetryAfter represents the duration sent by the Retry-After header of the shed responses, rounded up to seconds. Default is 1s.
+	RetryAfter string `yaml:"retryAfter,omitempty"`
+
+	// Adaptive represents the upstream limits adjusted by the observed upstream latency.
+	Adaptive AdaptiveLimit `yaml:"adaptive,omitempty"`
+}
+
+// OverloadUpstreams represents the maximum number of in-flight requests per upstream. 0 disables the limit.
+type OverloadUpstreams struct {
+	// HTTP represents the limit of the HTTP upstream.
+	HTTP int `yaml:"http,omitempty"`
+
+	// GRPC represents the limit of the gRPC upstream.
+	GRPC int `yaml:"grpc,omitempty"`
+}
+
+// AdaptiveLimit represents the upstream limit which decreases when the upstream latency increases, and increases up to the configured limit otherwise.
+type AdaptiveLimit struct {
+	// Enable represents whether to adapt the upstream limits.
+	Enable bool `yaml:"enable"`
+
+	// MinLimit represents the lower bound of the adapted limit. Default is 1.
+	MinLimit int `yaml:"minLimit,omitempty"`
+
+	// LatencyTolerance represents the ratio to the minimum observed latency, above which the limit decreases. Default is 2.
+	LatencyTolerance float64 `yaml:"latencyTolerance,omitempty"`
+}
+
+// Validate returns an error if the overload configuration is invalid.
+func (o Overload) Validate() error {
+	if !o.Enable {
+		return nil
+	}
+	for _, l := range []struct {
+		name  string
+		value int
+	}{
+		{"maxConnections", o.MaxConnections},
+		{"maxConcurrentRequests", o.MaxConcurrentRequests},
+		{"upstreams.http", o.Upstreams.HTTP},
+		{"upstreams.grpc", o.Upstreams.GRPC},
+		{"queueSize", o.QueueSize},
+	} {
+		if l.value < 0 {
+			return errors.Errorf("%s must not be negative", l.name)
+		}
+	}
+	for _, d := range []struct {
+		name, value string
+	}{
+		{"queueTimeout", o.QueueTimeout},
+		{"retryAfter", o.RetryAfter},
+	} {
+		if d.value == "" {
+			continue
+		}
+		if v, err := time.ParseDuration(d.value); err != nil || v < 0 {
+			return errors.Errorf("invalid %s: %s", d.name, d.value)
+		}
+	}
+	if !o.Adaptive.Enable {
+		return nil
+	}
+	if o.Upstreams.HTTP == 0 && o.Upstreams.GRPC == 0 {
+		return errors.New("adaptive requires upstreams.http or upstreams.grpc")
+	}
+	if o.Adaptive.MinLimit < 0 {
+		return errors.New("adaptive.minLimit must not be negative")
+	}
+	if o.Adaptive.LatencyTolerance != 0 && o.Adaptive.LatencyTolerance <= 1 {
+		return errors.Errorf("adaptive.latencyTolerance must be greater than 1: %v", o.Adaptive.LatencyTolerance)
+	}
+	return nil
+}
+
+// ServerTimeouts represents the timeouts and the limits of the HTTP servers. 0 disables the timeout.
+type ServerTimeouts struct {
+	// ReadHeaderTimeout represents the maximum duration to read the request headers. Default is 10s.
+	ReadHeaderTimeout string `yaml:"readHeaderTimeout,omitempty"`
+
+	// ReadTimeout represents the maximum duration to read the entire request, including the body. Default is 0.
+	ReadTimeout string `yaml:"readTimeout,omitempty"`
+
+	// WriteTimeout represents the maximum duration from the end of the request headers to the end of the response. Default is 0.
+	WriteTimeout string `yaml:"writeTimeout,omitempty"`
+
+	// IdleTimeout represents the maximum duration to wait for the next request on a keep-alive connection. Default is 2m.
+	IdleTimeout string `yaml:"idleTimeout,omitempty"`
+
+	// MaxHeaderBytes represents the maximum size of the request headers in bytes. Default is 1MB.
+	MaxHeaderBytes int `yaml:"maxHeaderBytes,omitempty"`
+
+	// RequestTimeout represents the end-to-end deadline of each proxied HTTP request, and 504 is returned if the upstream does not respond in time. Default is 0.
+	RequestTimeout string `yaml:"requestTimeout,omitempty"`
+}
+
+// Validate returns an error if the server timeouts configuration is invalid.
+func (s ServerTimeouts) Validate() error {
+	durations := make(map[string]time.Duration, 5)
+	for _, d := range []struct {
+		name, value string
+	}{
+		{"readHeaderTimeout", s.ReadHeaderTimeout},
+		{"readTimeout", s.ReadTimeout},
+		{"writeTimeout", s.WriteTimeout},
+		{"idleTimeout", s.IdleTimeout},
+		{"requestTimeout", s.RequestTimeout},
+	} {
+		if d.value == "" {
+			continue
+		}
+		v, err := time.ParseDuration(d.value)
+		if err != nil || v < 0 {
+			return errors.Errorf("invalid %s: %s", d.name, d.value)
+		}
+		durations[d.name] = v
+	}
+	if s.MaxHeaderBytes < 0 {
+		return errors.New("maxHeaderBytes must not be negative")
+	}
+	// the response of the request timeout cannot be written after the write timeout
+	if w, r := durations["writeTimeout"], durations["requestTimeout"]; w > 0 && r >= w {
+		return errors.Errorf("requestTimeout must be shorter than writeTimeout: %s >= %s", s.RequestTimeout, s.WriteTimeout)
+	}
+	return nil
 }
 
 // TLS represents the TLS configuration of the authorization proxy.
@@ -90,6 +447,273 @@ type TLS struct {
 
 	// CAPath represents the CA certificate chain file path for verifying client certificates.
 	CAPath string `yaml:"caPath"`
+
+	// ReloadPeriod represents the period to check the certificate, key and CA files for changes, and reload them when they change. Default is 1m, and 0 disables the reload.
+	ReloadPeriod string `yaml:"reloadPeriod,omitempty"`
+
+	// MinVersion represents the minimum TLS version, "1.0", "1.1", "1.2" or "1.3". Default is 1.2.
+	MinVersion string `yaml:"minVersion,omitempty"`
+
+	// MaxVersion represents the maximum TLS version. Default is the maximum version supported by Go.
+	MaxVersion string `yaml:"maxVersion,omitempty"`
+
+	// CipherSuites represents the enabled cipher suites of TLS 1.0-1.2 by the IANA names, e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256. Default is the secure cipher suites of Go.
+	// The cipher suites of TLS 1.3 are not configurable.
+	CipherSuites []string `yaml:"cipherSuites,omitempty"`
+
+	// Curves represents the elliptic curves for the key exchange in preference order, "P256", "P384", "P521" or "X25519". Default is P521, P384, P256 and X25519.
+	Curves []string `yaml:"curves,omitempty"`
+
+	// SessionTickets represents whether to enable the session ticket resumption. Default is false.
+	SessionTickets bool `yaml:"sessionTickets,omitempty"`
+
+	// ALPNProtocols represents the application protocols in preference order, e.g. h2 and http/1.1. Default is decided by the server.
+	// HTTP/2 is disabled on the HTTP server if h2 is not included, except in the gRPC mixed mode.
+	ALPNProtocols []string `yaml:"alpnProtocols,omitempty"`
+
+	// ClientAuth represents the client certificate authentication mode, "none", "request", "require-any", "verify-if-given" or "require".
+	// Default is "require" if caPath is set, otherwise "none".
+	ClientAuth string `yaml:"clientAuth,omitempty"`
+
+	// AllowInsecure represents whether to allow the insecure settings, i.e. TLS 1.0 and 1.1, the insecure cipher suites, and the client authentication modes without verification.
+	AllowInsecure bool `yaml:"allowInsecure,omitempty"`
+
+	// Revocation represents the revocation check of the client certificates.
+	Revocation Revocation `yaml:"revocation,omitempty"`
+}
+
+// Revocation represents the revocation check of the client certificates by CRL and OCSP.
+type Revocation struct {
+	// CRLPaths represents the file paths of the CRLs in PEM or DER format.
+	CRLPaths []string `yaml:"crlPaths,omitempty"`
+
+	// ReloadPeriod represents the period to check the CRL files for changes. Default is 1m.
+	ReloadPeriod string `yaml:"reloadPeriod,omitempty"`
+
+	// OCSP represents the OCSP check of the client certificates.
+	OCSP OCSP `yaml:"ocsp,omitempty"`
+
+	// FailOpen represents whether to accept the client certificate when the revocation status is unknown, e.g. the CRL is expired or the OCSP responder is unreachable.
+	// The revoked certificates are always rejected.
+	FailOpen bool `yaml:"failOpen,omitempty"`
+}
+
+// OCSP represents the OCSP check of the client certificates.
+type OCSP struct {
+	// Enable represents whether to check the client certificates by OCSP.
+	Enable bool `yaml:"enable"`
+
+	// Responder represents the OCSP responder URL, which overrides the URL in the certificates.
+	Responder string `yaml:"responder,omitempty"`
+
+	// Timeout represents the timeout of the OCSP request. Default is 5s.
+	Timeout string `yaml:"timeout,omitempty"`
+
+	// CacheTTL represents the maximum duration to cache the OCSP response, which is also limited by the next update of the response. Default is 1h.
+	CacheTTL string `yaml:"cacheTTL,omitempty"`
+}
+
+// Enabled returns whether any revocation check is enabled.
+func (r Revocation) Enabled() bool {
+	return len(r.CRLPaths) > 0 || r.OCSP.Enable
+}
+
+// Validate returns an error if the revocation check configuration is invalid.
+func (r Revocation) Validate() error {
+	for _, d := range []struct {
+		name, value string
+	}{
+		{"reloadPeriod", r.ReloadPeriod},
+		{"ocsp.timeout", r.OCSP.Timeout},
+		{"ocsp.cacheTTL", r.OCSP.CacheTTL},
+	} {
+		if d.value == "" {
+			continue
+		}
+		if v, err := time.ParseDuration(d.value); err != nil || v <= 0 {
+			return errors.Errorf("invalid %s: %s", d.name, d.value)
+		}
+	}
+	if r.OCSP.Responder != "" {
+		if u, err := url.Parse(r.OCSP.Responder); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.Errorf("invalid ocsp.responder: %s", r.OCSP.Responder)
+		}
+	}
+	return nil
+}
+
+const (
+	// TLSClientAuthNone represents the client authentication mode, which does not request the client certificate.
+	TLSClientAuthNone = "none"
+	// TLSClientAuthRequest represents the client authentication mode, which requests the client certificate but does not verify it.
+	TLSClientAuthRequest = "request"
+	// TLSClientAuthRequireAny represents the client authentication mode, which requires the client certificate but does not verify it.
+	TLSClientAuthRequireAny = "require-any"
+	// TLSClientAuthVerifyIfGiven represents the client authentication mode, which verifies the client certificate if it is sent.
+	TLSClientAuthVerifyIfGiven = "verify-if-given"
+	// TLSClientAuthRequire represents the client authentication mode, which requires and verifies the client certificate.
+	TLSClientAuthRequire = "require"
+)
+
+var (
+	tlsVersions = map[string]uint16{
+		"1.0": tls.VersionTLS10,
+		"1.1": tls.VersionTLS11,
+		"1.2": tls.VersionTLS12,
+		"1.3": tls.VersionTLS13,
+	}
+	tlsCurves = map[string]tls.CurveID{
+		"P256":   tls.CurveP256,
+		"P384":   tls.CurveP384,
+		"P521":   tls.CurveP521,
+		"X25519": tls.X25519,
+	}
+	tlsClientAuths = map[string]tls.ClientAuthType{
+		TLSClientAuthNone:          tls.NoClientCert,
+		TLSClientAuthRequest:       tls.RequestClientCert,
+		TLSClientAuthRequireAny:    tls.RequireAnyClientCert,
+		TLSClientAuthVerifyIfGiven: tls.VerifyClientCertIfGiven,
+		TLSClientAuthRequire:       tls.RequireAndVerifyClientCert,
+	}
+)
+
+// TLSVersion returns the TLS version of the name, e.g. "1.2".
+func TLSVersion(name string) (uint16, bool) {
+	v, ok := tlsVersions[name]
+	return v, ok
+}
+
+// TLSCurve returns the elliptic curve of the name, e.g. "P256".
+func TLSCurve(name string) (tls.CurveID, bool) {
+	c, ok := tlsCurves[name]
+	return c, ok
+}
+
+// TLSClientAuth returns the client authentication type of the mode, e.g. "require".
+func TLSClientAuth(mode string) (tls.ClientAuthType, bool) {
+	c, ok := tlsClientAuths[mode]
+	return c, ok
+}
+
+// TLSCipherSuite returns the cipher suite of the IANA name supported by Go, and whether it is insecure.
+func TLSCipherSuite(name string) (suite *tls.CipherSuite, insecure bool) {
+	for _, c := range tls.CipherSuites() {
+		if c.Name == name {
+			return c, false
+		}
+	}
+	for _, c := range tls.InsecureCipherSuites() {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// VerifiesClientCert returns whether the client certificate is verified against caPath when it is sent.
+func (t TLS) VerifiesClientCert() bool {
+	if !t.Enable || t.CAPath == "" {
+		return false
+	}
+	if t.ClientAuth == "" {
+		// caPath without clientAuth requires and verifies the client certificate
+		return true
+	}
+	ca, ok := TLSClientAuth(t.ClientAuth)
+	return ok && ca >= tls.VerifyClientCertIfGiven
+}
+
+// Validate returns an error if the TLS configuration is invalid, or insecure without allowInsecure.
+func (t TLS) Validate() error {
+	if t.ReloadPeriod != "" {
+		if v, err := time.ParseDuration(t.ReloadPeriod); err != nil || v < 0 {
+			return errors.Errorf("invalid reloadPeriod: %s", t.ReloadPeriod)
+		}
+	}
+
+	minVer, maxVer := uint16(tls.VersionTLS12), uint16(tls.VersionTLS13)
+	if t.MinVersion != "" {
+		v, ok := TLSVersion(t.MinVersion)
+		if !ok {
+			return errors.Errorf("invalid minVersion: %s", t.MinVersion)
+		}
+		if v < tls.VersionTLS12 && !t.AllowInsecure {
+			return errors.Errorf("insecure minVersion: %s, set allowInsecure to use it", t.MinVersion)
+		}
+		minVer = v
+	}
+	if t.MaxVersion != "" {
+		v, ok := TLSVersion(t.MaxVersion)
+		if !ok {
+			return errors.Errorf("invalid maxVersion: %s", t.MaxVersion)
+		}
+		if v < tls.VersionTLS12 && !t.AllowInsecure {
+			return errors.Errorf("insecure maxVersion: %s, set allowInsecure to use it", t.MaxVersion)
+		}
+		maxVer = v
+	}
+	if minVer > maxVer {
+		return errors.Errorf("minVersion must not be greater than maxVersion: %s > %s", t.MinVersion, t.MaxVersion)
+	}
+
+	if len(t.CipherSuites) > 0 && minVer == tls.VersionTLS13 {
+		return errors.New("cipherSuites are not configurable for TLS 1.3")
+	}
+	for _, name := range t.CipherSuites {
+		c, insecure := TLSCipherSuite(name)
+		if c == nil {
+			return errors.Errorf("unsupported cipher suite: %s", name)
+		}
+		if len(c.SupportedVersions) == 1 && c.SupportedVersions[0] == tls.VersionTLS13 {
+			return errors.Errorf("cipher suite of TLS 1.3 is not configurable: %s", name)
+		}
+		if insecure && !t.AllowInsecure {
+			return errors.Errorf("insecure cipher suite: %s, set allowInsecure to use it", name)
+		}
+	}
+
+	for _, name := range t.Curves {
+		if _, ok := TLSCurve(name); !ok {
+			return errors.Errorf("unsupported curve: %s", name)
+		}
+	}
+
+	for _, p := range t.ALPNProtocols {
+		if p == "" || len(p) > 255 {
+			return errors.Errorf("invalid alpnProtocols: %q", p)
+		}
+	}
+
+	if t.ClientAuth != "" {
+		ca, ok := TLSClientAuth(t.ClientAuth)
+		if !ok {
+			return errors.Errorf("invalid clientAuth: %s", t.ClientAuth)
+		}
+		switch ca {
+		case tls.RequestClientCert, tls.RequireAnyClientCert:
+			// the unverified client certificate must not be trusted, the role certificate requires VerifiesClientCert
+			if !t.AllowInsecure {
+				return errors.Errorf("insecure clientAuth: %s, set allowInsecure to use it", t.ClientAuth)
+			}
+		case tls.VerifyClientCertIfGiven, tls.RequireAndVerifyClientCert:
+			if t.CAPath == "" {
+				return errors.Errorf("caPath is required for clientAuth: %s", t.ClientAuth)
+			}
+		}
+	}
+
+	if err := t.Revocation.Validate(); err != nil {
+		return errors.Wrap(err, "invalid revocation")
+	}
+	if t.Revocation.Enabled() {
+		if t.CAPath == "" {
+			return errors.New("caPath is required for the revocation check")
+		}
+		if ca, _ := TLSClientAuth(t.ClientAuth); t.ClientAuth != "" && ca < tls.VerifyClientCertIfGiven {
+			return errors.Errorf("revocation check requires the verified clientAuth: %s", t.ClientAuth)
+		}
+	}
+	return nil
 }
 
 // HealthCheck represents the health check server configuration.
@@ -97,8 +721,116 @@ type HealthCheck struct {
 	// Port represents the server listening port.
 	Port int `yaml:"port"`
 
-	// Endpoint represents the health check endpoint (pattern).
+	// Listener represents the listener of the health check server, which overrides the port.
+	Listener Listener `yaml:"listener,omitempty"`
+
+	// Endpoint represents the health check endpoint (pattern), which is used as the liveness check.
+	Endpoint string `yaml:"endpoint"`
+
+	// Readiness represents the readiness check configuration.
+	Readiness Readiness `yaml:"readiness"`
+
+	// Upstream represents the deep health check of the proxy destination, which is served on a separated endpoint.
+	Upstream UpstreamHealthCheck `yaml:"upstream,omitempty"`
+}
+
+// UpstreamHealthCheck represents the deep health check of the proxy destination.
+type UpstreamHealthCheck struct {
+	// Enable represents whether to serve the upstream health check.
+	Enable bool `yaml:"enable"`
+
+	// Endpoint represents the upstream health check endpoint (pattern). Default is "/healthz/upstream".
+	Endpoint string `yaml:"endpoint"`
+
+	// Type represents how to probe the proxy destination. Values: "http", "tcp", "grpc".
+	// Default is "grpc" if the proxy scheme is grpc, "http" if Path is set, otherwise "tcp".
+	Type string `yaml:"type"`
+
+	// Path represents the HTTP path of the proxy destination to probe, e.g. "/health". 2xx and 3xx responses are healthy.
+	Path string `yaml:"path"`
+
+	// ServiceName represents the service name in the grpc.health.v1 request. Empty means the overall server health.
+	ServiceName string `yaml:"serviceName"`
+
+	// Timeout represents the timeout of a probe. Default is 1s.
+	Timeout string `yaml:"timeout"`
+
+	// CacheTTL represents the duration to reuse the result of the last probe. Default is 5s.
+	CacheTTL string `yaml:"cacheTTL"`
+}
+
+const (
+	// UpstreamHTTP represents the upstream health check by an HTTP GET request.
+	UpstreamHTTP = "http"
+	// UpstreamTCP represents the upstream health check by a TCP connect.
+	UpstreamTCP = "tcp"
+	// UpstreamGRPC represents the upstream health check by grpc.health.v1.
+	UpstreamGRPC = "grpc"
+)
+
+// Validate returns an error if the upstream health check configuration is invalid.
+func (u UpstreamHealthCheck) Validate() error {
+	if !u.Enable {
+		return nil
+	}
+	if u.Endpoint != "" && !strings.HasPrefix(u.Endpoint, "/") {
+		return errors.Errorf("upstream endpoint must start with /: %s", u.Endpoint)
+	}
+	switch u.Type {
+	case "", UpstreamTCP, UpstreamGRPC:
+	case UpstreamHTTP:
+		if u.Path == "" {
+			return errors.New("path is required for http type")
+		}
+	default:
+		return errors.Errorf("invalid type: %s", u.Type)
+	}
+	if u.Path != "" && !strings.HasPrefix(u.Path, "/") {
+		return errors.Errorf("path must start with /: %s", u.Path)
+	}
+	for _, d := range []struct {
+		name, value string
+	}{
+		{"timeout", u.Timeout},
+		{"cacheTTL", u.CacheTTL},
+	} {
+		if d.value == "" {
+			continue
+		}
+		if v, err := time.ParseDuration(d.value); err != nil || v < 0 {
+			return errors.Errorf("invalid %s: %s", d.name, d.value)
+		}
+	}
+	return nil
+}
+
+// Readiness represents the readiness check configuration.
+type Readiness struct {
+	// Endpoint represents the readiness check endpoint (pattern). Default is "/readyz".
 	Endpoint string `yaml:"endpoint"`
+
+	// FailOnDegraded represents whether the readiness check fails when the cache of an authorizer component is older than the max age in authorization.status.
+	FailOnDegraded bool `yaml:"failOnDegraded"`
+}
+
+// Validate returns an error if the health check configuration is invalid.
+func (h HealthCheck) Validate() error {
+	if err := h.Upstream.Validate(); err != nil {
+		return err
+	}
+	if h.Upstream.Enable && h.Upstream.Endpoint != "" && (h.Upstream.Endpoint == h.Endpoint || h.Upstream.Endpoint == h.Readiness.Endpoint) {
+		return errors.Errorf("upstream endpoint must be different from the health check and readiness endpoints: %s", h.Upstream.Endpoint)
+	}
+	if h.Readiness.Endpoint == "" {
+		return nil
+	}
+	if !strings.HasPrefix(h.Readiness.Endpoint, "/") {
+		return errors.Errorf("readiness endpoint must start with /: %s", h.Readiness.Endpoint)
+	}
+	if h.Readiness.Endpoint == h.Endpoint {
+		return errors.Errorf("readiness endpoint must be different from the health check endpoint: %s", h.Endpoint)
+	}
+	return nil
 }
 
 // Debug represents the debug server configuration.
@@ -109,6 +841,9 @@ type Debug struct {
 	// Port represents debug server port.
 	Port int `yaml:"port"`
 
+	// Listener represents the listener of the debug server, which overrides the port.
+	Listener Listener `yaml:"listener,omitempty"`
+
 	// Dump represents whether to enable memory dump functionality.
 	Dump bool `yaml:"dump"`
 
@@ -116,6 +851,54 @@ type Debug struct {
 	Profiling bool `yaml:"profiling"`
 }
 
+// Metrics represents the Prometheus metrics endpoint configuration.
+type Metrics struct {
+	// Enable represents whether to enable the metrics endpoint.
+	Enable bool `yaml:"enable"`
+
+	// Server represents the server to expose the metrics endpoint, "healthCheck" or "debug". Default is "healthCheck".
+	Server string `yaml:"server"`
+
+	// Path represents the path of the metrics endpoint. Default is "/metrics".
+	Path string `yaml:"path"`
+
+	// Routes represents the URL path prefixes used as the route label of the request metrics.
+	// The longest matching prefix is used, and the requests not matching any prefix are labeled as "other".
+	Routes []string `yaml:"routes"`
+
+	// GRPCMethods represents the gRPC full method names or prefixes used as the method label of the call metrics, e.g. "/package.Service/".
+	// The longest matching prefix is used, and the calls not matching any prefix are labeled as "other".
+	GRPCMethods []string `yaml:"grpcMethods,omitempty"`
+}
+
+const (
+	// MetricsOnHealthCheck represents the metrics endpoint is exposed on the health check server.
+	MetricsOnHealthCheck = "healthCheck"
+	// MetricsOnDebug represents the metrics endpoint is exposed on the debug server.
+	MetricsOnDebug = "debug"
+)
+
+// Validate returns an error if the metrics configuration is invalid.
+func (m Metrics) Validate() error {
+	if !m.Enable {
+		return nil
+	}
+	switch m.Server {
+	case "", MetricsOnHealthCheck, MetricsOnDebug:
+	default:
+		return errors.Errorf("invalid server: %s", m.Server)
+	}
+	if m.Path != "" && !strings.HasPrefix(m.Path, "/") {
+		return errors.Errorf("path must start with /: %s", m.Path)
+	}
+	for _, method := range m.GRPCMethods {
+		if !strings.HasPrefix(method, "/") {
+			return errors.Errorf("grpcMethods must start with /: %s", method)
+		}
+	}
+	return nil
+}
+
 // Athenz represents the Athenz server connection configuration.
 type Athenz struct {
 	// URL represents the Athenz (ZMS or ZTS) API URL.
@@ -155,6 +938,45 @@ type Proxy struct {
 
 	// Transport exposes http.Transport parameters
 	Transport Transport `yaml:"transport,omitempty"`
+
+	// GRPC represents the gRPC proxy destination configuration when serving HTTP and gRPC on the same listener.
+	// It is ignored when Scheme is grpc, i.e. the whole listener is in gRPC mode.
+	GRPC GRPCProxy `yaml:"grpc,omitempty"`
+
+	// GRPCClient exposes the gRPC client parameters for connecting to the gRPC proxy destination.
+	GRPCClient GRPCClient `yaml:"grpcClient,omitempty"`
+
+	// RequestID represents the request ID configuration of the proxied requests.
+	RequestID RequestID `yaml:"requestID,omitempty"`
+}
+
+// RequestID represents the request ID configuration. A request ID is assigned to every proxied HTTP request and gRPC call, forwarded to the upstream and returned in the response.
+type RequestID struct {
+	// Header represents the header name of the request ID, which is also used as the gRPC metadata key in lower case. Default is "X-Request-ID".
+	Header string `yaml:"header"`
+
+	// TrustIncoming represents whether to use the request ID of the incoming request instead of generating one. Enable it only when the clients are trusted, e.g. behind a trusted load balancer.
+	TrustIncoming bool `yaml:"trustIncoming"`
+}
+
+// Validate returns an error if the request ID configuration is invalid.
+func (r RequestID) Validate() error {
+	if r.Header != "" && !httpguts.ValidHeaderFieldName(r.Header) {
+		return errors.Errorf("invalid header: %s", r.Header)
+	}
+	return nil
+}
+
+// GRPCProxy represents the gRPC proxy destination configuration in mixed mode.
+type GRPCProxy struct {
+	// Enable represents whether to route gRPC requests (HTTP/2 with content-type application/grpc) to the gRPC destination.
+	Enable bool `yaml:"enable"`
+
+	// Host represents the gRPC proxy destination host, for example, localhost.
+	Host string `yaml:"host"`
+
+	// Port represents the gRPC proxy destination port number.
+	Port uint16 `yaml:"port"`
 }
 
 // Authorization represents the detail authorization configuration.
@@ -176,6 +998,56 @@ type Authorization struct {
 
 	// RoleToken represents the configuration to control role token verification.
 	RoleToken RoleToken `yaml:"roleToken"`
+
+	// RoleCertificate represents the configuration to control role certificate verification.
+	RoleCertificate RoleCertificate `yaml:"roleCertificate"`
+
+	// GRPCStream represents the configuration to control the authorization of active gRPC streams.
+	GRPCStream GRPCStream `yaml:"grpcStream"`
+
+	// Status represents the thresholds to warn the unhealthy authorizer components.
+	Status AuthorizerStatus `yaml:"status,omitempty"`
+}
+
+// AuthorizerStatus represents the thresholds to warn the unhealthy authorizer components, i.e. policyd, pubkeyd and jwkd.
+type AuthorizerStatus struct {
+	// FailureThreshold represents the number of the consecutive fetch failures of a component to warn. Default is 3.
+	FailureThreshold int `yaml:"failureThreshold"`
+
+	// PolicyMaxAge represents the maximum age of the policy cache to warn. Default is 3 times the policy refresh period.
+	PolicyMaxAge string `yaml:"policyMaxAge"`
+
+	// PubkeyMaxAge represents the maximum age of the public key cache to warn. Default is 3 times the public key refresh period.
+	PubkeyMaxAge string `yaml:"pubkeyMaxAge"`
+
+	// JWKMaxAge represents the maximum age of the JWK cache to warn. Default is 3 times the JWK refresh period.
+	JWKMaxAge string `yaml:"jwkMaxAge"`
+
+	// CheckPeriod represents the period to check the cache age. Default is 1m.
+	CheckPeriod string `yaml:"checkPeriod"`
+}
+
+// Validate returns an error if the authorizer status configuration is invalid.
+func (a AuthorizerStatus) Validate() error {
+	if a.FailureThreshold < 0 {
+		return errors.New("failureThreshold must not be negative")
+	}
+	for _, d := range []struct {
+		name, value string
+	}{
+		{"policyMaxAge", a.PolicyMaxAge},
+		{"pubkeyMaxAge", a.PubkeyMaxAge},
+		{"jwkMaxAge", a.JWKMaxAge},
+		{"checkPeriod", a.CheckPeriod},
+	} {
+		if d.value == "" {
+			continue
+		}
+		if v, err := time.ParseDuration(d.value); err != nil || v <= 0 {
+			return errors.Errorf("invalid %s: %s", d.name, d.value)
+		}
+	}
+	return nil
 }
 
 // PublicKey represents the configuration to fetch Athenz public keys.
@@ -262,13 +1134,298 @@ type RoleToken struct {
 	RoleAuthHeader string `yaml:"roleAuthHeader"`
 }
 
+// RoleCertificate represents the configuration to control role certificate verification.
+// The role certificate is read from the client certificate on mTLS, so server.tls.caPath should be set.
+type RoleCertificate struct {
+	// Enable decides whether to verify role certificate.
+	Enable bool `yaml:"enable"`
+
+	// URIPrefix represents the prefix of the SAN URI to read the roles from, in the format of <prefix><domain>/<role>. Default is "athenz://role/".
+	// The roles are also read from the subject common name in the format of <domain>:role.<role>.
+	URIPrefix string `yaml:"uriPrefix"`
+}
+
+// GRPCStream represents the configuration to control the authorization of active gRPC streams.
+// Active streams are always terminated when the role token expires.
+type GRPCStream struct {
+	// ReauthorizeOnPolicyChange represents whether to re-authorize the active streams when the policy cache changes, and terminate the streams which are no longer authorized.
+	ReauthorizeOnPolicyChange bool `yaml:"reauthorizeOnPolicyChange"`
+
+	// PolicyCheckPeriod represents the duration of the period to check the policy cache changes. Default is 1m.
+	PolicyCheckPeriod string `yaml:"policyCheckPeriod"`
+}
+
 // Log represents the logger configuration.
 type Log struct {
 	// Level represents the logger output level. Values: "debug", "info", "warn", "error", "fatal".
 	Level string `yaml:"level"`
 
-	// Color represents whether to print ANSI escape code.
+	// Color represents whether to print ANSI escape code. It is only applied to the text format written to the standard output or error.
 	Color bool `yaml:"color"`
+
+	// Format represents the log format. Values: "text", "json". Default is "text".
+	Format string `yaml:"format"`
+
+	// Output represents the log destination. Values: "stdout", "stderr", or a file path.
+	// By default, the error and fatal logs are written to the standard error, and the others to the standard output.
+	Output string `yaml:"output"`
+
+	// Rotation represents the rotation of the log file, only used when the output is a file path.
+	Rotation LogRotation `yaml:"rotation"`
+
+	// Packages represents the log level overrides per package. The key is the import path prefix of the package, and the longest matching prefix is applied.
+	// e.g. "github.com/yahoojapan/athenz-authorizer/v5": "warn"
+	Packages map[string]string `yaml:"packages"`
+
+	// AccessLog represents the per-request access log configuration.
+	AccessLog AccessLog `yaml:"accessLog,omitempty"`
+}
+
+// LogRotation represents the rotation of the log file.
+type LogRotation struct {
+	// MaxSize represents the maximum size in megabytes of the log file before it is rotated. Default is 100.
+	MaxSize int `yaml:"maxSize"`
+
+	// MaxAge represents the maximum duration to write a log file before it is rotated, e.g. "24h". The file is not rotated by age if it is empty.
+	MaxAge string `yaml:"maxAge"`
+
+	// MaxBackups represents the maximum number of the rotated files to keep. All rotated files are kept if it is 0.
+	MaxBackups int `yaml:"maxBackups"`
+}
+
+const (
+	// LogText represents the log format of the glg style text.
+	LogText = "text"
+	// LogJSON represents the log format of a JSON object per line.
+	LogJSON = "json"
+	// LogStdout represents the log written to the standard output.
+	LogStdout = "stdout"
+	// LogStderr represents the log written to the standard error.
+	LogStderr = "stderr"
+)
+
+// logLevels represents the valid log levels, the empty level disables logging.
+var logLevels = map[string]bool{
+	"":      true,
+	"debug": true,
+	"info":  true,
+	"warn":  true,
+	"error": true,
+	"fatal": true,
+}
+
+// ValidLogLevel returns whether the log level is valid. The empty level disables logging.
+func ValidLogLevel(level string) bool {
+	return logLevels[level]
+}
+
+// Validate returns an error if the log configuration is invalid.
+func (l Log) Validate() error {
+	if !ValidLogLevel(l.Level) {
+		return errors.New("invalid log level")
+	}
+	switch l.Format {
+	case "", LogText, LogJSON:
+	default:
+		return errors.Errorf("invalid format: %s", l.Format)
+	}
+	for pkg, level := range l.Packages {
+		if pkg == "" || !ValidLogLevel(level) {
+			return errors.Errorf("invalid package log level: %s: %s", pkg, level)
+		}
+	}
+	if l.Rotation.MaxSize < 0 || l.Rotation.MaxBackups < 0 {
+		return errors.New("maxSize and maxBackups must not be negative")
+	}
+	if l.Rotation.MaxAge != "" {
+		if d, err := time.ParseDuration(l.Rotation.MaxAge); err != nil || d <= 0 {
+			return errors.Errorf("invalid maxAge: %s", l.Rotation.MaxAge)
+		}
+	}
+	return nil
+}
+
+// AccessLog represents the per-request access log configuration.
+type AccessLog struct {
+	// Enable represents whether to write the access log.
+	Enable bool `yaml:"enable"`
+
+	// Format represents the output format of the entries. Values: "json", "logfmt". Default is "json".
+	Format string `yaml:"format"`
+
+	// Path represents the output file path. The entries are written to the standard output if it is empty or "stdout".
+	Path string `yaml:"path"`
+
+	// Sampling represents the sampling rates of the routes. The rate of the longest matching path prefix is applied, and the requests not matching any prefix are always logged.
+	// Denied requests are always logged regardless of the rate.
+	Sampling []AccessLogSampling `yaml:"sampling"`
+}
+
+// AccessLogSampling represents the sampling rate of the requests under the path prefix.
+type AccessLogSampling struct {
+	// Path represents the path prefix of the route.
+	Path string `yaml:"path"`
+
+	// Rate represents the ratio of the requests to be logged, from 0 to 1.
+	Rate float64 `yaml:"rate"`
+}
+
+const (
+	// AccessLogJSON represents the access log format of a JSON object per line.
+	AccessLogJSON = "json"
+	// AccessLogLogfmt represents the access log format of key=value pairs per line.
+	AccessLogLogfmt = "logfmt"
+	// AccessLogStdout represents the access log written to the standard output.
+	AccessLogStdout = "stdout"
+)
+
+// Validate returns an error if the access log configuration is invalid.
+func (a AccessLog) Validate() error {
+	if !a.Enable {
+		return nil
+	}
+	switch a.Format {
+	case "", AccessLogJSON, AccessLogLogfmt:
+	default:
+		return errors.Errorf("invalid format: %s", a.Format)
+	}
+	for _, s := range a.Sampling {
+		if !strings.HasPrefix(s.Path, "/") {
+			return errors.Errorf("sampling path must start with /: %s", s.Path)
+		}
+		if s.Rate < 0 || s.Rate > 1 {
+			return errors.Errorf("sampling rate must be between 0 and 1: %s", s.Path)
+		}
+	}
+	return nil
+}
+
+// Tracing represents the OpenTelemetry tracing configuration.
+type Tracing struct {
+	// Enable represents whether to enable tracing.
+	Enable bool `yaml:"enable"`
+
+	// Exporter represents the span exporter. Values: "otlpgrpc", "otlphttp", "stdout", "file". Default is "otlpgrpc".
+	Exporter string `yaml:"exporter"`
+
+	// Endpoint represents the OTLP collector endpoint in host:port format. Default is localhost:4317 for "otlpgrpc", and localhost:4318 for "otlphttp".
+	Endpoint string `yaml:"endpoint"`
+
+	// Insecure represents whether to disable TLS to connect to the OTLP collector.
+	Insecure bool `yaml:"insecure"`
+
+	// Headers represents the additional headers sent to the OTLP collector.
+	Headers map[string]string `yaml:"headers"`
+
+	// Path represents the output file path of the "file" exporter.
+	Path string `yaml:"path"`
+
+	// ServiceName represents the service name of the spans. Default is "authorization-proxy".
+	ServiceName string `yaml:"serviceName"`
+
+	// SampleRatio represents the ratio of the root spans to be sampled, from 0 to 1. The sampling decision of the parent span is respected. Default is 0, which samples all spans.
+	SampleRatio float64 `yaml:"sampleRatio"`
+}
+
+const (
+	// TracingOTLPGRPC represents the OTLP exporter over gRPC.
+	TracingOTLPGRPC = "otlpgrpc"
+	// TracingOTLPHTTP represents the OTLP exporter over HTTP.
+	TracingOTLPHTTP = "otlphttp"
+	// TracingStdout represents the exporter printing to the standard output.
+	TracingStdout = "stdout"
+	// TracingFile represents the exporter writing to a local file.
+	TracingFile = "file"
+)
+
+// Validate returns an error if the tracing configuration is invalid.
+func (t Tracing) Validate() error {
+	if !t.Enable {
+		return nil
+	}
+	switch t.Exporter {
+	case "", TracingOTLPGRPC, TracingOTLPHTTP, TracingStdout:
+	case TracingFile:
+		if t.Path == "" {
+			return errors.New("path is required for file exporter")
+		}
+	default:
+		return errors.Errorf("invalid exporter: %s", t.Exporter)
+	}
+	if t.SampleRatio < 0 || t.SampleRatio > 1 {
+		return errors.New("sampleRatio must be between 0 and 1")
+	}
+	return nil
+}
+
+// Audit represents the audit log configuration of the authorization decisions.
+// The audit records are hash-chained, and written separately from the application log.
+type Audit struct {
+	// Enable represents whether to write the audit log.
+	Enable bool `yaml:"enable"`
+
+	// Output represents the output of the audit records. Values: "file", "syslog". Default is "file".
+	Output string `yaml:"output"`
+
+	// Path represents the output file path of the "file" output.
+	Path string `yaml:"path"`
+
+	// MaxSize represents the maximum size in megabytes of the audit log file before it is rotated. Default is 100.
+	MaxSize int `yaml:"maxSize"`
+
+	// MaxBackups represents the maximum number of the rotated files to retain. Default is 0, which retains all files.
+	MaxBackups int `yaml:"maxBackups"`
+
+	// Syslog represents the syslog destination of the "syslog" output.
+	Syslog AuditSyslog `yaml:"syslog"`
+
+	// HMACKeyPath represents the path of the key file to chain the records with HMAC-SHA256 instead of SHA-256.
+	HMACKeyPath string `yaml:"hmacKeyPath"`
+
+	// Resources represents the resource prefixes to audit, i.e. the URL paths or the gRPC methods. All resources are audited if it is empty.
+	Resources []string `yaml:"resources"`
+}
+
+// AuditSyslog represents the syslog destination of the audit log.
+type AuditSyslog struct {
+	// Network represents the network of the syslog server, e.g. "udp", "tcp". The local syslog server is used if it is empty.
+	Network string `yaml:"network"`
+
+	// Address represents the address of the syslog server.
+	Address string `yaml:"address"`
+
+	// Tag represents the syslog tag. Default is "authorization-proxy-audit".
+	Tag string `yaml:"tag"`
+}
+
+const (
+	// AuditFile represents the audit records written to a rotating local file.
+	AuditFile = "file"
+	// AuditSyslogOutput represents the audit records sent to syslog.
+	AuditSyslogOutput = "syslog"
+)
+
+// Validate returns an error if the audit configuration is invalid.
+func (a Audit) Validate() error {
+	if !a.Enable {
+		return nil
+	}
+	switch a.Output {
+	case "", AuditFile:
+		if a.Path == "" {
+			return errors.New("path is required for file output")
+		}
+	case AuditSyslogOutput:
+		if a.Syslog.Network != "" && a.Syslog.Address == "" {
+			return errors.New("syslog address is required for network " + a.Syslog.Network)
+		}
+	default:
+		return errors.Errorf("invalid output: %s", a.Output)
+	}
+	if a.MaxSize < 0 || a.MaxBackups < 0 {
+		return errors.New("maxSize and maxBackups must not be negative")
+	}
+	return nil
 }
 
 // Transport exposes a subset of Transport parameters. reference: https://github.com/golang/go/blob/master/src/net/http/transport.go#L95
@@ -288,6 +1445,179 @@ type Transport struct {
 	ForceAttemptHTTP2      bool          `yaml:"forceAttemptHTTP2,omitempty"`
 }
 
+// GRPCServer exposes the gRPC server parameters. Zero value means the gRPC default.
+// In mixed mode, the connection level parameters are applied on the HTTP/2 server when possible, and the keepalive parameters are not supported.
+type GRPCServer struct {
+	// MaxRecvMsgSize represents the maximum message size in bytes the server can receive. gRPC default is 4MB.
+	MaxRecvMsgSize int `yaml:"maxRecvMsgSize,omitempty"`
+
+	// MaxSendMsgSize represents the maximum message size in bytes the server can send. gRPC default is math.MaxInt32.
+	MaxSendMsgSize int `yaml:"maxSendMsgSize,omitempty"`
+
+	// MaxConcurrentStreams represents the maximum number of concurrent streams of each connection.
+	MaxConcurrentStreams uint32 `yaml:"maxConcurrentStreams,omitempty"`
+
+	// InitialWindowSize represents the initial window size of a stream. It must be at least 64KB.
+	InitialWindowSize int32 `yaml:"initialWindowSize,omitempty"`
+
+	// InitialConnWindowSize represents the initial window size of a connection. It must be at least 64KB.
+	InitialConnWindowSize int32 `yaml:"initialConnWindowSize,omitempty"`
+
+	// ConnectionTimeout represents the timeout for the connection establishment, including the TLS handshake.
+	ConnectionTimeout time.Duration `yaml:"connectionTimeout,omitempty"`
+
+	// MaxConnectionIdle represents the duration before an idle connection is closed by sending a GOAWAY.
+	MaxConnectionIdle time.Duration `yaml:"maxConnectionIdle,omitempty"`
+
+	// MaxConnectionAge represents the maximum duration a connection may exist before it is closed by sending a GOAWAY.
+	MaxConnectionAge time.Duration `yaml:"maxConnectionAge,omitempty"`
+
+	// MaxConnectionAgeGrace represents the additional duration after MaxConnectionAge before the connection is forcibly closed.
+	MaxConnectionAgeGrace time.Duration `yaml:"maxConnectionAgeGrace,omitempty"`
+
+	// KeepaliveTime represents the duration without activity after which the server pings the client.
+	KeepaliveTime time.Duration `yaml:"keepaliveTime,omitempty"`
+
+	// KeepaliveTimeout represents the duration the server waits for the ping ack before closing the connection.
+	KeepaliveTimeout time.Duration `yaml:"keepaliveTimeout,omitempty"`
+
+	// KeepaliveMinTime represents the minimum duration a client should wait before sending a keepalive ping (enforcement policy).
+	KeepaliveMinTime time.Duration `yaml:"keepaliveMinTime,omitempty"`
+
+	// KeepalivePermitWithoutStream represents whether the client is allowed to send keepalive pings without active streams (enforcement policy).
+	KeepalivePermitWithoutStream bool `yaml:"keepalivePermitWithoutStream,omitempty"`
+}
+
+// GRPCClient exposes the gRPC client parameters for connecting to the gRPC proxy destination. Zero value means the gRPC default.
+type GRPCClient struct {
+	// MaxRecvMsgSize represents the maximum message size in bytes the client can receive. gRPC default is 4MB.
+	MaxRecvMsgSize int `yaml:"maxRecvMsgSize,omitempty"`
+
+	// MaxSendMsgSize represents the maximum message size in bytes the client can send. gRPC default is math.MaxInt32.
+	MaxSendMsgSize int `yaml:"maxSendMsgSize,omitempty"`
+
+	// InitialWindowSize represents the initial window size of a stream. It must be at least 64KB.
+	InitialWindowSize int32 `yaml:"initialWindowSize,omitempty"`
+
+	// InitialConnWindowSize represents the initial window size of a connection. It must be at least 64KB.
+	InitialConnWindowSize int32 `yaml:"initialConnWindowSize,omitempty"`
+
+	// KeepaliveTime represents the duration without activity after which the client pings the server. It must be at least 10s.
+	KeepaliveTime time.Duration `yaml:"keepaliveTime,omitempty"`
+
+	// KeepaliveTimeout represents the duration the client waits for the ping ack before closing the connection.
+	KeepaliveTimeout time.Duration `yaml:"keepaliveTimeout,omitempty"`
+
+	// KeepalivePermitWithoutStream represents whether to send keepalive pings without active streams.
+	KeepalivePermitWithoutStream bool `yaml:"keepalivePermitWithoutStream,omitempty"`
+
+	// CallTimeout represents the maximum duration of each proxied call, including streaming calls.
+	CallTimeout time.Duration `yaml:"callTimeout,omitempty"`
+
+	// Target represents the gRPC name resolver target of the destination, for example, dns:///backend.default.svc:50051.
+	// It overrides the destination host and port.
+	Target string `yaml:"target,omitempty"`
+
+	// Addresses represents a static list of destination addresses. It overrides Target, and the destination host and port.
+	Addresses []GRPCAddress `yaml:"addresses,omitempty"`
+
+	// LoadBalancingPolicy represents the load balancing policy among the resolved addresses. Values: "pick_first" (default), "round_robin", "weighted".
+	LoadBalancingPolicy string `yaml:"loadBalancingPolicy,omitempty"`
+
+	// HealthCheck represents the destination health checking configuration using grpc.health.v1.
+	HealthCheck GRPCHealthCheck `yaml:"healthCheck,omitempty"`
+}
+
+// GRPCAddress represents a static gRPC destination address.
+type GRPCAddress struct {
+	// Address represents the destination address, for example, 10.0.0.1:50051.
+	Address string `yaml:"address"`
+
+	// Weight represents the weight of the address when the load balancing policy is "weighted". Default is 1.
+	Weight uint32 `yaml:"weight,omitempty"`
+}
+
+// GRPCHealthCheck represents the destination health checking configuration using grpc.health.v1.
+type GRPCHealthCheck struct {
+	// Enable represents whether to skip the destination addresses reporting unhealthy status. It requires "round_robin" or "weighted" load balancing policy.
+	Enable bool `yaml:"enable"`
+
+	// ServiceName represents the service name in the health check request. Empty means the overall server health.
+	ServiceName string `yaml:"serviceName"`
+}
+
+const (
+	// grpcMinWindowSize represents the minimum window size accepted by gRPC.
+	grpcMinWindowSize = 64 * 1024
+
+	// grpcMinClientKeepaliveTime represents the minimum client keepalive time accepted by gRPC.
+	grpcMinClientKeepaliveTime = 10 * time.Second
+
+	// GRPCPickFirst represents the pick_first load balancing policy.
+	GRPCPickFirst = "pick_first"
+
+	// GRPCRoundRobin represents the round_robin load balancing policy.
+	GRPCRoundRobin = "round_robin"
+
+	// GRPCWeighted represents the weighted round robin load balancing policy.
+	GRPCWeighted = "weighted"
+)
+
+// Validate returns an error if the gRPC server parameters are invalid.
+func (g GRPCServer) Validate() error {
+	switch {
+	case g.MaxRecvMsgSize < 0:
+		return errors.New("maxRecvMsgSize must not be negative")
+	case g.MaxSendMsgSize < 0:
+		return errors.New("maxSendMsgSize must not be negative")
+	case g.InitialWindowSize != 0 && g.InitialWindowSize < grpcMinWindowSize:
+		return errors.Errorf("initialWindowSize must be at least %d", grpcMinWindowSize)
+	case g.InitialConnWindowSize != 0 && g.InitialConnWindowSize < grpcMinWindowSize:
+		return errors.Errorf("initialConnWindowSize must be at least %d", grpcMinWindowSize)
+	case g.ConnectionTimeout < 0, g.MaxConnectionIdle < 0, g.MaxConnectionAge < 0, g.MaxConnectionAgeGrace < 0,
+		g.KeepaliveTime < 0, g.KeepaliveTimeout < 0, g.KeepaliveMinTime < 0:
+		return errors.New("durations must not be negative")
+	case g.MaxConnectionAgeGrace > 0 && g.MaxConnectionAge == 0:
+		return errors.New("maxConnectionAgeGrace requires maxConnectionAge")
+	}
+	return nil
+}
+
+// Validate returns an error if the gRPC client parameters are invalid.
+func (g GRPCClient) Validate() error {
+	switch {
+	case g.MaxRecvMsgSize < 0:
+		return errors.New("maxRecvMsgSize must not be negative")
+	case g.MaxSendMsgSize < 0:
+		return errors.New("maxSendMsgSize must not be negative")
+	case g.InitialWindowSize != 0 && g.InitialWindowSize < grpcMinWindowSize:
+		return errors.Errorf("initialWindowSize must be at least %d", grpcMinWindowSize)
+	case g.InitialConnWindowSize != 0 && g.InitialConnWindowSize < grpcMinWindowSize:
+		return errors.Errorf("initialConnWindowSize must be at least %d", grpcMinWindowSize)
+	case g.KeepaliveTime < 0, g.KeepaliveTimeout < 0, g.CallTimeout < 0:
+		return errors.New("durations must not be negative")
+	case g.KeepaliveTime != 0 && g.KeepaliveTime < grpcMinClientKeepaliveTime:
+		return errors.Errorf("keepaliveTime must be at least %s", grpcMinClientKeepaliveTime)
+	case g.Target != "" && len(g.Addresses) > 0:
+		return errors.New("target and addresses cannot be set at the same time")
+	}
+	for _, a := range g.Addresses {
+		if a.Address == "" {
+			return errors.New("address must not be empty")
+		}
+	}
+	switch g.LoadBalancingPolicy {
+	case "", GRPCPickFirst:
+		if g.HealthCheck.Enable {
+			return errors.Errorf("healthCheck requires %s or %s load balancing policy", GRPCRoundRobin, GRPCWeighted)
+		}
+	case GRPCRoundRobin, GRPCWeighted:
+	default:
+		return errors.Errorf("invalid loadBalancingPolicy: %s", g.LoadBalancingPolicy)
+	}
+	return nil
+}
+
 // New returns the decoded configuration YAML file as *Config struct. Returns non-nil error if any.
 func New(path string) (*Config, error) {
 	f, err := os.OpenFile(path, os.O_RDONLY, 0o600)
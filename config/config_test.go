@@ -128,6 +128,11 @@ func TestNew(t *testing.T) {
 						ReadBufferSize:         0,
 						ForceAttemptHTTP2:      true,
 					},
+					GRPC: GRPCProxy{
+						Enable: false,
+						Host:   "localhost",
+						Port:   50051,
+					},
 				},
 				Authorization: Authorization{
 					PublicKey: PublicKey{
@@ -191,6 +196,14 @@ func TestNew(t *testing.T) {
 						Enable:         true,
 						RoleAuthHeader: "Athenz-Role-Auth",
 					},
+					RoleCertificate: RoleCertificate{
+						Enable:    false,
+						URIPrefix: "athenz://role/",
+					},
+					GRPCStream: GRPCStream{
+						ReauthorizeOnPolicyChange: false,
+						PolicyCheckPeriod:         "1m",
+					},
 				},
 				Log: Log{
 					Level: "debug",
@@ -312,58 +325,1509 @@ func TestGetActualValue(t *testing.T) {
 	}
 }
 
-func TestCheckPrefixAndSuffix(t *testing.T) {
-	type args struct {
-		str  string
-		pref string
-		suf  string
+func TestServerTimeouts_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     ServerTimeouts
+		wantErr string
+	}{
+		{
+			name: "Check default timeouts",
+			cfg:  ServerTimeouts{},
+		},
+		{
+			name: "Check timeouts",
+			cfg: ServerTimeouts{
+				ReadHeaderTimeout: "5s",
+				ReadTimeout:       "30s",
+				WriteTimeout:      "1m",
+				IdleTimeout:       "0",
+				MaxHeaderBytes:    8192,
+				RequestTimeout:    "50s",
+			},
+		},
+		{
+			name: "Check invalid read header timeout",
+			cfg: ServerTimeouts{
+				ReadHeaderTimeout: "5",
+			},
+			wantErr: "invalid readHeaderTimeout: 5",
+		},
+		{
+			name: "Check negative idle timeout",
+			cfg: ServerTimeouts{
+				IdleTimeout: "-1s",
+			},
+			wantErr: "invalid idleTimeout: -1s",
+		},
+		{
+			name: "Check negative max header bytes",
+			cfg: ServerTimeouts{
+				MaxHeaderBytes: -1,
+			},
+			wantErr: "maxHeaderBytes must not be negative",
+		},
+		{
+			name: "Check request timeout longer than write timeout",
+			cfg: ServerTimeouts{
+				WriteTimeout:   "10s",
+				RequestTimeout: "10s",
+			},
+			wantErr: "requestTimeout must be shorter than writeTimeout: 10s >= 10s",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if (err == nil && tt.wantErr != "") || (err != nil && err.Error() != tt.wantErr) {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTLS_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     TLS
+		wantErr string
+	}{
+		{
+			name: "Check default reload period",
+			cfg:  TLS{},
+		},
+		{
+			name: "Check reload period",
+			cfg: TLS{
+				ReloadPeriod: "30s",
+			},
+		},
+		{
+			name: "Check reload disabled",
+			cfg: TLS{
+				ReloadPeriod: "0",
+			},
+		},
+		{
+			name: "Check invalid reload period",
+			cfg: TLS{
+				ReloadPeriod: "1",
+			},
+			wantErr: "invalid reloadPeriod: 1",
+		},
+		{
+			name: "Check negative reload period",
+			cfg: TLS{
+				ReloadPeriod: "-1m",
+			},
+			wantErr: "invalid reloadPeriod: -1m",
+		},
+		{
+			name: "Check TLS policy",
+			cfg: TLS{
+				CAPath:         "ca.pem",
+				MinVersion:     "1.2",
+				MaxVersion:     "1.3",
+				CipherSuites:   []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"},
+				Curves:         []string{"X25519", "P256"},
+				SessionTickets: true,
+				ALPNProtocols:  []string{"h2", "http/1.1"},
+				ClientAuth:     TLSClientAuthVerifyIfGiven,
+			},
+		},
+		{
+			name: "Check invalid min version",
+			cfg: TLS{
+				MinVersion: "1.4",
+			},
+			wantErr: "invalid minVersion: 1.4",
+		},
+		{
+			name: "Check invalid max version",
+			cfg: TLS{
+				MaxVersion: "TLS1.2",
+			},
+			wantErr: "invalid maxVersion: TLS1.2",
+		},
+		{
+			name: "Check insecure min version",
+			cfg: TLS{
+				MinVersion: "1.0",
+			},
+			wantErr: "insecure minVersion: 1.0, set allowInsecure to use it",
+		},
+		{
+			name: "Check insecure max version",
+			cfg: TLS{
+				MaxVersion: "1.1",
+			},
+			wantErr: "insecure maxVersion: 1.1, set allowInsecure to use it",
+		},
+		{
+			name: "Check insecure versions allowed",
+			cfg: TLS{
+				MinVersion:    "1.0",
+				MaxVersion:    "1.1",
+				AllowInsecure: true,
+			},
+		},
+		{
+			name: "Check min version greater than max version",
+			cfg: TLS{
+				MinVersion: "1.3",
+				MaxVersion: "1.2",
+			},
+			wantErr: "minVersion must not be greater than maxVersion: 1.3 > 1.2",
+		},
+		{
+			name: "Check cipher suites with TLS 1.3 only",
+			cfg: TLS{
+				MinVersion:   "1.3",
+				CipherSuites: []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"},
+			},
+			wantErr: "cipherSuites are not configurable for TLS 1.3",
+		},
+		{
+			name: "Check unsupported cipher suite",
+			cfg: TLS{
+				CipherSuites: []string{"TLS_FOO"},
+			},
+			wantErr: "unsupported cipher suite: TLS_FOO",
+		},
+		{
+			name: "Check TLS 1.3 cipher suite",
+			cfg: TLS{
+				CipherSuites: []string{"TLS_AES_128_GCM_SHA256"},
+			},
+			wantErr: "cipher suite of TLS 1.3 is not configurable: TLS_AES_128_GCM_SHA256",
+		},
+		{
+			name: "Check insecure cipher suite",
+			cfg: TLS{
+				CipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"},
+			},
+			wantErr: "insecure cipher suite: TLS_RSA_WITH_RC4_128_SHA, set allowInsecure to use it",
+		},
+		{
+			name: "Check unsupported curve",
+			cfg: TLS{
+				Curves: []string{"P224"},
+			},
+			wantErr: "unsupported curve: P224",
+		},
+		{
+			name: "Check empty ALPN protocol",
+			cfg: TLS{
+				ALPNProtocols: []string{""},
+			},
+			wantErr: `invalid alpnProtocols: ""`,
+		},
+		{
+			name: "Check invalid client auth",
+			cfg: TLS{
+				ClientAuth: "optional",
+			},
+			wantErr: "invalid clientAuth: optional",
+		},
+		{
+			name: "Check insecure client auth",
+			cfg: TLS{
+				ClientAuth: TLSClientAuthRequest,
+			},
+			wantErr: "insecure clientAuth: request, set allowInsecure to use it",
+		},
+		{
+			name: "Check client auth without CA",
+			cfg: TLS{
+				ClientAuth: TLSClientAuthRequire,
+			},
+			wantErr: "caPath is required for clientAuth: require",
+		},
+		{
+			name: "Check revocation",
+			cfg: TLS{
+				CAPath: "ca.pem",
+				Revocation: Revocation{
+					CRLPaths:     []string{"ca.crl"},
+					ReloadPeriod: "10m",
+					OCSP: OCSP{
+						Enable:    true,
+						Responder: "http://127.0.0.1:8888/ocsp",
+						Timeout:   "1s",
+						CacheTTL:  "30m",
+					},
+				},
+			},
+		},
+		{
+			name: "Check revocation without CA",
+			cfg: TLS{
+				Revocation: Revocation{
+					CRLPaths: []string{"ca.crl"},
+				},
+			},
+			wantErr: "caPath is required for the revocation check",
+		},
+		{
+			name: "Check revocation without verified client auth",
+			cfg: TLS{
+				CAPath:        "ca.pem",
+				ClientAuth:    TLSClientAuthRequireAny,
+				AllowInsecure: true,
+				Revocation: Revocation{
+					OCSP: OCSP{
+						Enable: true,
+					},
+				},
+			},
+			wantErr: "revocation check requires the verified clientAuth: require-any",
+		},
+		{
+			name: "Check invalid OCSP responder",
+			cfg: TLS{
+				CAPath: "ca.pem",
+				Revocation: Revocation{
+					OCSP: OCSP{
+						Enable:    true,
+						Responder: "ocsp.example.com",
+					},
+				},
+			},
+			wantErr: "invalid revocation: invalid ocsp.responder: ocsp.example.com",
+		},
+		{
+			name: "Check invalid OCSP timeout",
+			cfg: TLS{
+				CAPath: "ca.pem",
+				Revocation: Revocation{
+					OCSP: OCSP{
+						Enable:  true,
+						Timeout: "0s",
+					},
+				},
+			},
+			wantErr: "invalid revocation: invalid ocsp.timeout: 0s",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if (err == nil && tt.wantErr != "") || (err != nil && err.Error() != tt.wantErr) {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
 	}
+}
+
+func TestTLS_VerifiesClientCert(t *testing.T) {
 	tests := []struct {
 		name string
-		args args
+		cfg  TLS
 		want bool
 	}{
 		{
-			name: "Check true prefix and suffix",
-			args: args{
-				str:  "_dummy_",
-				pref: "_",
-				suf:  "_",
+			name: "disabled",
+			cfg: TLS{
+				CAPath: "ca.pem",
+			},
+		},
+		{
+			name: "caPath is not set",
+			cfg: TLS{
+				Enable:     true,
+				ClientAuth: TLSClientAuthRequire,
+			},
+		},
+		{
+			name: "caPath without clientAuth",
+			cfg: TLS{
+				Enable: true,
+				CAPath: "ca.pem",
 			},
 			want: true,
 		},
 		{
-			name: "Check false prefix and suffix",
-			args: args{
-				str:  "dummy",
-				pref: "_",
-				suf:  "_",
+			name: "verify-if-given",
+			cfg: TLS{
+				Enable:     true,
+				CAPath:     "ca.pem",
+				ClientAuth: TLSClientAuthVerifyIfGiven,
 			},
-			want: false,
+			want: true,
 		},
 		{
-			name: "Check true prefix but false suffix",
-			args: args{
-				str:  "_dummy",
-				pref: "_",
-				suf:  "_",
+			name: "require-any with allowInsecure",
+			cfg: TLS{
+				Enable:        true,
+				CAPath:        "ca.pem",
+				ClientAuth:    TLSClientAuthRequireAny,
+				AllowInsecure: true,
 			},
-			want: false,
 		},
 		{
-			name: "Check false prefix but true suffix",
-			args: args{
-				str:  "dummy_",
-				pref: "_",
-				suf:  "_",
+			name: "request with allowInsecure",
+			cfg: TLS{
+				Enable:        true,
+				CAPath:        "ca.pem",
+				ClientAuth:    TLSClientAuthRequest,
+				AllowInsecure: true,
 			},
-			want: false,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := checkPrefixAndSuffix(tt.args.str, tt.args.pref, tt.args.suf); got != tt.want {
-				t.Errorf("GetVersion() = %v, want %v", got, tt.want)
+			if got := tt.cfg.VerifiesClientCert(); got != tt.want {
+				t.Errorf("VerifiesClientCert() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHealthCheck_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     HealthCheck
+		wantErr string
+	}{
+		{
+			name: "Check default readiness endpoint is valid",
+			cfg: HealthCheck{
+				Endpoint: "/healthz",
+			},
+		},
+		{
+			name: "Check valid readiness endpoint",
+			cfg: HealthCheck{
+				Endpoint: "/healthz",
+				Readiness: Readiness{
+					Endpoint: "/ready",
+				},
+			},
+		},
+		{
+			name: "Check valid upstream health check",
+			cfg: HealthCheck{
+				Endpoint: "/healthz",
+				Upstream: UpstreamHealthCheck{
+					Enable:   true,
+					Endpoint: "/healthz/backend",
+					Type:     UpstreamHTTP,
+					Path:     "/health",
+					Timeout:  "500ms",
+					CacheTTL: "10s",
+				},
+			},
+		},
+		{
+			name: "Check http upstream health check without path",
+			cfg: HealthCheck{
+				Upstream: UpstreamHealthCheck{
+					Enable: true,
+					Type:   UpstreamHTTP,
+				},
+			},
+			wantErr: "path is required for http type",
+		},
+		{
+			name: "Check invalid upstream health check type",
+			cfg: HealthCheck{
+				Upstream: UpstreamHealthCheck{
+					Enable: true,
+					Type:   "udp",
+				},
+			},
+			wantErr: "invalid type: udp",
+		},
+		{
+			name: "Check invalid upstream health check timeout",
+			cfg: HealthCheck{
+				Upstream: UpstreamHealthCheck{
+					Enable:  true,
+					Timeout: "1",
+				},
+			},
+			wantErr: "invalid timeout: 1",
+		},
+		{
+			name: "Check upstream endpoint same as health check endpoint",
+			cfg: HealthCheck{
+				Endpoint: "/healthz",
+				Upstream: UpstreamHealthCheck{
+					Enable:   true,
+					Endpoint: "/healthz",
+				},
+			},
+			wantErr: "upstream endpoint must be different from the health check and readiness endpoints: /healthz",
+		},
+		{
+			name: "Check disabled upstream health check is not validated",
+			cfg: HealthCheck{
+				Upstream: UpstreamHealthCheck{
+					Type: "udp",
+				},
+			},
+		},
+		{
+			name: "Check readiness endpoint without slash",
+			cfg: HealthCheck{
+				Readiness: Readiness{
+					Endpoint: "ready",
+				},
+			},
+			wantErr: "readiness endpoint must start with /: ready",
+		},
+		{
+			name: "Check readiness endpoint same as health check endpoint",
+			cfg: HealthCheck{
+				Endpoint: "/healthz",
+				Readiness: Readiness{
+					Endpoint: "/healthz",
+				},
+			},
+			wantErr: "readiness endpoint must be different from the health check endpoint: /healthz",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if (err == nil && tt.wantErr != "") || (err != nil && err.Error() != tt.wantErr) {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGRPCServer_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     GRPCServer
+		wantErr string
+	}{
+		{
+			name: "Check zero value is valid",
+			cfg:  GRPCServer{},
+		},
+		{
+			name: "Check valid parameters",
+			cfg: GRPCServer{
+				MaxRecvMsgSize:        1024,
+				MaxConcurrentStreams:  100,
+				InitialWindowSize:     1024 * 1024,
+				MaxConnectionAge:      time.Hour,
+				MaxConnectionAgeGrace: time.Minute,
+				KeepaliveMinTime:      time.Minute,
+			},
+		},
+		{
+			name: "Check negative message size",
+			cfg: GRPCServer{
+				MaxSendMsgSize: -1,
+			},
+			wantErr: "maxSendMsgSize must not be negative",
+		},
+		{
+			name: "Check too small window size",
+			cfg: GRPCServer{
+				InitialConnWindowSize: 1024,
+			},
+			wantErr: "initialConnWindowSize must be at least 65536",
+		},
+		{
+			name: "Check negative duration",
+			cfg: GRPCServer{
+				KeepaliveTime: -time.Second,
+			},
+			wantErr: "durations must not be negative",
+		},
+		{
+			name: "Check grace without connection age",
+			cfg: GRPCServer{
+				MaxConnectionAgeGrace: time.Second,
+			},
+			wantErr: "maxConnectionAgeGrace requires maxConnectionAge",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if (err == nil && tt.wantErr != "") || (err != nil && err.Error() != tt.wantErr) {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGRPCClient_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     GRPCClient
+		wantErr string
+	}{
+		{
+			name: "Check zero value is valid",
+			cfg:  GRPCClient{},
+		},
+		{
+			name: "Check valid parameters",
+			cfg: GRPCClient{
+				MaxRecvMsgSize: 1024,
+				KeepaliveTime:  time.Minute,
+				CallTimeout:    time.Second,
+			},
+		},
+		{
+			name: "Check negative message size",
+			cfg: GRPCClient{
+				MaxRecvMsgSize: -1,
+			},
+			wantErr: "maxRecvMsgSize must not be negative",
+		},
+		{
+			name: "Check too small window size",
+			cfg: GRPCClient{
+				InitialWindowSize: 1024,
+			},
+			wantErr: "initialWindowSize must be at least 65536",
+		},
+		{
+			name: "Check negative call timeout",
+			cfg: GRPCClient{
+				CallTimeout: -time.Second,
+			},
+			wantErr: "durations must not be negative",
+		},
+		{
+			name: "Check too short keepalive time",
+			cfg: GRPCClient{
+				KeepaliveTime: time.Second,
+			},
+			wantErr: "keepaliveTime must be at least 10s",
+		},
+		{
+			name: "Check weighted static addresses with health check",
+			cfg: GRPCClient{
+				Addresses: []GRPCAddress{
+					{Address: "127.0.0.1:50051", Weight: 3},
+					{Address: "127.0.0.1:50052"},
+				},
+				LoadBalancingPolicy: GRPCWeighted,
+				HealthCheck: GRPCHealthCheck{
+					Enable: true,
+				},
+			},
+		},
+		{
+			name: "Check target and addresses",
+			cfg: GRPCClient{
+				Target: "dns:///localhost:50051",
+				Addresses: []GRPCAddress{
+					{Address: "127.0.0.1:50051"},
+				},
+			},
+			wantErr: "target and addresses cannot be set at the same time",
+		},
+		{
+			name: "Check empty address",
+			cfg: GRPCClient{
+				Addresses: []GRPCAddress{
+					{Weight: 1},
+				},
+			},
+			wantErr: "address must not be empty",
+		},
+		{
+			name: "Check health check with pick first",
+			cfg: GRPCClient{
+				HealthCheck: GRPCHealthCheck{
+					Enable: true,
+				},
+			},
+			wantErr: "healthCheck requires round_robin or weighted load balancing policy",
+		},
+		{
+			name: "Check invalid load balancing policy",
+			cfg: GRPCClient{
+				LoadBalancingPolicy: "random",
+			},
+			wantErr: "invalid loadBalancingPolicy: random",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if (err == nil && tt.wantErr != "") || (err != nil && err.Error() != tt.wantErr) {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMetrics_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Metrics
+		wantErr string
+	}{
+		{
+			name: "Check disabled metrics is valid",
+			cfg: Metrics{
+				Server: "invalid",
+			},
+		},
+		{
+			name: "Check valid metrics on debug server",
+			cfg: Metrics{
+				Enable: true,
+				Server: MetricsOnDebug,
+				Path:   "/metrics",
+				Routes: []string{"/api"},
+			},
+		},
+		{
+			name: "Check invalid server",
+			cfg: Metrics{
+				Enable: true,
+				Server: "api",
+			},
+			wantErr: "invalid server: api",
+		},
+		{
+			name: "Check invalid path",
+			cfg: Metrics{
+				Enable: true,
+				Path:   "metrics",
+			},
+			wantErr: "path must start with /: metrics",
+		},
+		{
+			name: "Check invalid grpcMethods",
+			cfg: Metrics{
+				Enable:      true,
+				GRPCMethods: []string{"pkg.Service/"},
+			},
+			wantErr: "grpcMethods must start with /: pkg.Service/",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if (err == nil && tt.wantErr != "") || (err != nil && err.Error() != tt.wantErr) {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTracing_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Tracing
+		wantErr string
+	}{
+		{
+			name: "Check disabled tracing is valid",
+			cfg: Tracing{
+				Exporter: "invalid",
+			},
+		},
+		{
+			name: "Check default exporter is valid",
+			cfg: Tracing{
+				Enable: true,
+			},
+		},
+		{
+			name: "Check valid file exporter",
+			cfg: Tracing{
+				Enable:      true,
+				Exporter:    TracingFile,
+				Path:        "/var/log/traces.json",
+				SampleRatio: 0.5,
+			},
+		},
+		{
+			name: "Check file exporter without path",
+			cfg: Tracing{
+				Enable:   true,
+				Exporter: TracingFile,
+			},
+			wantErr: "path is required for file exporter",
+		},
+		{
+			name: "Check invalid exporter",
+			cfg: Tracing{
+				Enable:   true,
+				Exporter: "jaeger",
+			},
+			wantErr: "invalid exporter: jaeger",
+		},
+		{
+			name: "Check invalid sample ratio",
+			cfg: Tracing{
+				Enable:      true,
+				SampleRatio: 2,
+			},
+			wantErr: "sampleRatio must be between 0 and 1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if (err == nil && tt.wantErr != "") || (err != nil && err.Error() != tt.wantErr) {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLog_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Log
+		wantErr string
+	}{
+		{
+			name: "Check disabled logging is valid",
+			cfg:  Log{},
+		},
+		{
+			name: "Check valid configuration",
+			cfg: Log{
+				Level:  "info",
+				Format: LogJSON,
+				Output: "/var/log/authorization-proxy.log",
+				Rotation: LogRotation{
+					MaxSize:    10,
+					MaxAge:     "24h",
+					MaxBackups: 7,
+				},
+				Packages: map[string]string{
+					"github.com/yahoojapan/athenz-authorizer/v5": "warn",
+				},
+			},
+		},
+		{
+			name: "Check invalid level",
+			cfg: Log{
+				Level: "verbose",
+			},
+			wantErr: "invalid log level",
+		},
+		{
+			name: "Check invalid format",
+			cfg: Log{
+				Level:  "info",
+				Format: "logfmt",
+			},
+			wantErr: "invalid format: logfmt",
+		},
+		{
+			name: "Check invalid package level",
+			cfg: Log{
+				Level: "info",
+				Packages: map[string]string{
+					"github.com/yahoojapan/athenz-authorizer/v5": "trace",
+				},
+			},
+			wantErr: "invalid package log level: github.com/yahoojapan/athenz-authorizer/v5: trace",
+		},
+		{
+			name: "Check negative max backups",
+			cfg: Log{
+				Level: "info",
+				Rotation: LogRotation{
+					MaxBackups: -1,
+				},
+			},
+			wantErr: "maxSize and maxBackups must not be negative",
+		},
+		{
+			name: "Check invalid max age",
+			cfg: Log{
+				Level: "info",
+				Rotation: LogRotation{
+					MaxAge: "1d",
+				},
+			},
+			wantErr: "invalid maxAge: 1d",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if (err == nil && tt.wantErr != "") || (err != nil && err.Error() != tt.wantErr) {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAccessLog_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     AccessLog
+		wantErr string
+	}{
+		{
+			name: "Check disabled access log is valid",
+			cfg: AccessLog{
+				Format: "invalid",
+			},
+		},
+		{
+			name: "Check valid access log",
+			cfg: AccessLog{
+				Enable: true,
+				Format: AccessLogLogfmt,
+				Path:   "/var/log/access.log",
+				Sampling: []AccessLogSampling{
+					{
+						Path: "/healthz",
+						Rate: 0.01,
+					},
+				},
+			},
+		},
+		{
+			name: "Check invalid format",
+			cfg: AccessLog{
+				Enable: true,
+				Format: "xml",
+			},
+			wantErr: "invalid format: xml",
+		},
+		{
+			name: "Check invalid sampling path",
+			cfg: AccessLog{
+				Enable: true,
+				Sampling: []AccessLogSampling{
+					{
+						Path: "healthz",
+						Rate: 0.5,
+					},
+				},
+			},
+			wantErr: "sampling path must start with /: healthz",
+		},
+		{
+			name: "Check invalid sampling rate",
+			cfg: AccessLog{
+				Enable: true,
+				Sampling: []AccessLogSampling{
+					{
+						Path: "/healthz",
+						Rate: 1.5,
+					},
+				},
+			},
+			wantErr: "sampling rate must be between 0 and 1: /healthz",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if (err == nil && tt.wantErr != "") || (err != nil && err.Error() != tt.wantErr) {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRequestID_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     RequestID
+		wantErr string
+	}{
+		{
+			name: "Check default header is valid",
+			cfg:  RequestID{},
+		},
+		{
+			name: "Check custom header is valid",
+			cfg: RequestID{
+				Header:        "X-Correlation-ID",
+				TrustIncoming: true,
+			},
+		},
+		{
+			name: "Check invalid header",
+			cfg: RequestID{
+				Header: "X Request ID",
+			},
+			wantErr: "invalid header: X Request ID",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if (err == nil && tt.wantErr != "") || (err != nil && err.Error() != tt.wantErr) {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAudit_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Audit
+		wantErr string
+	}{
+		{
+			name: "Check disabled audit is valid",
+			cfg: Audit{
+				Output: "invalid",
+			},
+		},
+		{
+			name: "Check valid file output",
+			cfg: Audit{
+				Enable:     true,
+				Path:       "/var/log/audit.log",
+				MaxSize:    10,
+				MaxBackups: 5,
+			},
+		},
+		{
+			name: "Check valid syslog output",
+			cfg: Audit{
+				Enable: true,
+				Output: AuditSyslogOutput,
+				Syslog: AuditSyslog{
+					Network: "udp",
+					Address: "localhost:514",
+				},
+			},
+		},
+		{
+			name: "Check file output without path",
+			cfg: Audit{
+				Enable: true,
+			},
+			wantErr: "path is required for file output",
+		},
+		{
+			name: "Check syslog network without address",
+			cfg: Audit{
+				Enable: true,
+				Output: AuditSyslogOutput,
+				Syslog: AuditSyslog{
+					Network: "tcp",
+				},
+			},
+			wantErr: "syslog address is required for network tcp",
+		},
+		{
+			name: "Check invalid output",
+			cfg: Audit{
+				Enable: true,
+				Output: "kafka",
+			},
+			wantErr: "invalid output: kafka",
+		},
+		{
+			name: "Check negative max size",
+			cfg: Audit{
+				Enable:  true,
+				Path:    "/var/log/audit.log",
+				MaxSize: -1,
+			},
+			wantErr: "maxSize and maxBackups must not be negative",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if (err == nil && tt.wantErr != "") || (err != nil && err.Error() != tt.wantErr) {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAuthorizerStatus_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     AuthorizerStatus
+		wantErr string
+	}{
+		{
+			name: "Check empty configuration is valid",
+			cfg:  AuthorizerStatus{},
+		},
+		{
+			name: "Check valid configuration",
+			cfg: AuthorizerStatus{
+				FailureThreshold: 5,
+				PolicyMaxAge:     "1h",
+				PubkeyMaxAge:     "48h",
+				JWKMaxAge:        "48h",
+				CheckPeriod:      "30s",
+			},
+		},
+		{
+			name: "Check negative failure threshold",
+			cfg: AuthorizerStatus{
+				FailureThreshold: -1,
+			},
+			wantErr: "failureThreshold must not be negative",
+		},
+		{
+			name: "Check invalid max age",
+			cfg: AuthorizerStatus{
+				PubkeyMaxAge: "1day",
+			},
+			wantErr: "invalid pubkeyMaxAge: 1day",
+		},
+		{
+			name: "Check zero check period",
+			cfg: AuthorizerStatus{
+				CheckPeriod: "0s",
+			},
+			wantErr: "invalid checkPeriod: 0s",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if (err == nil && tt.wantErr != "") || (err != nil && err.Error() != tt.wantErr) {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckPrefixAndSuffix(t *testing.T) {
+	type args struct {
+		str  string
+		pref string
+		suf  string
+	}
+	tests := []struct {
+		name string
+		args args
+		want bool
+	}{
+		{
+			name: "Check true prefix and suffix",
+			args: args{
+				str:  "_dummy_",
+				pref: "_",
+				suf:  "_",
+			},
+			want: true,
+		},
+		{
+			name: "Check false prefix and suffix",
+			args: args{
+				str:  "dummy",
+				pref: "_",
+				suf:  "_",
+			},
+			want: false,
+		},
+		{
+			name: "Check true prefix but false suffix",
+			args: args{
+				str:  "_dummy",
+				pref: "_",
+				suf:  "_",
+			},
+			want: false,
+		},
+		{
+			name: "Check false prefix but true suffix",
+			args: args{
+				str:  "dummy_",
+				pref: "_",
+				suf:  "_",
+			},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := checkPrefixAndSuffix(tt.args.str, tt.args.pref, tt.args.suf); got != tt.want {
+				t.Errorf("GetVersion() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListener_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Listener
+		wantErr string
+	}{
+		{
+			name: "Check default listener",
+			cfg:  Listener{},
+		},
+		{
+			name: "Check tcp listener",
+			cfg: Listener{
+				Address: "[::1]:8082",
+			},
+		},
+		{
+			name: "Check unix listener",
+			cfg: Listener{
+				Network: ListenerUnix,
+				Address: "/run/authorization-proxy/health.sock",
+				Mode:    "0660",
+				Owner:   "root:proxy",
+			},
+		},
+		{
+			name: "Check fd listener",
+			cfg: Listener{
+				Network: ListenerFD,
+				Address: "proxy",
+			},
+		},
+		{
+			name: "Check invalid network",
+			cfg: Listener{
+				Network: "udp",
+			},
+			wantErr: "invalid network: udp",
+		},
+		{
+			name: "Check tcp address without port",
+			cfg: Listener{
+				Address: "127.0.0.1",
+			},
+			wantErr: "invalid tcp address: 127.0.0.1: address 127.0.0.1: missing port in address",
+		},
+		{
+			name: "Check unix listener without address",
+			cfg: Listener{
+				Network: ListenerUnix,
+			},
+			wantErr: "address is required for unix listener",
+		},
+		{
+			name: "Check mode of tcp listener",
+			cfg: Listener{
+				Address: ":8082",
+				Mode:    "0660",
+			},
+			wantErr: "mode and owner are only available for unix listener",
+		},
+		{
+			name: "Check invalid mode",
+			cfg: Listener{
+				Network: ListenerUnix,
+				Address: "/tmp/proxy.sock",
+				Mode:    "0999",
+			},
+			wantErr: "invalid mode: 0999",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if (err == nil && tt.wantErr != "") || (err != nil && err.Error() != tt.wantErr) {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestProxyProtocol_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     ProxyProtocol
+		wantErr string
+	}{
+		{
+			name: "Check disabled PROXY protocol",
+			cfg:  ProxyProtocol{},
+		},
+		{
+			name: "Check PROXY protocol",
+			cfg: ProxyProtocol{
+				Enable:        true,
+				TrustedCIDRs:  []string{"10.0.0.0/8", "2001:db8::/32"},
+				HeaderTimeout: "3s",
+			},
+		},
+		{
+			name: "Check PROXY protocol without trusted CIDRs",
+			cfg: ProxyProtocol{
+				Enable: true,
+			},
+			wantErr: "trustedCIDRs is required",
+		},
+		{
+			name: "Check invalid trusted CIDR",
+			cfg: ProxyProtocol{
+				Enable:       true,
+				TrustedCIDRs: []string{"10.0.0.1"},
+			},
+			wantErr: "invalid trusted CIDR: 10.0.0.1",
+		},
+		{
+			name: "Check invalid header timeout",
+			cfg: ProxyProtocol{
+				Enable:        true,
+				TrustedCIDRs:  []string{"10.0.0.0/8"},
+				HeaderTimeout: "0s",
+			},
+			wantErr: "invalid headerTimeout: 0s",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if (err == nil && tt.wantErr != "") || (err != nil && err.Error() != tt.wantErr) {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestProxyListener_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     ProxyListener
+		wantErr string
+	}{
+		{
+			name: "Check plaintext listener",
+			cfg: ProxyListener{
+				Listener: Listener{
+					Network: ListenerTCP6,
+					Address: "[::1]:8080",
+				},
+			},
+		},
+		{
+			name: "Check TLS listener",
+			cfg: ProxyListener{
+				Listener: Listener{
+					Address: ":8443",
+				},
+				TLS: TLS{
+					Enable:     true,
+					CertPath:   "server.crt",
+					KeyPath:    "server.key",
+					CAPath:     "ca.pem",
+					ClientAuth: "require",
+				},
+			},
+		},
+		{
+			name:    "Check listener without address",
+			cfg:     ProxyListener{},
+			wantErr: "address is required",
+		},
+		{
+			name: "Check TLS listener without certificate",
+			cfg: ProxyListener{
+				Listener: Listener{
+					Address: ":8443",
+				},
+				TLS: TLS{
+					Enable: true,
+				},
+			},
+			wantErr: "tls.certPath and tls.keyPath are required",
+		},
+		{
+			name: "Check TLS listener with invalid TLS",
+			cfg: ProxyListener{
+				Listener: Listener{
+					Address: ":8443",
+				},
+				TLS: TLS{
+					Enable:     true,
+					CertPath:   "server.crt",
+					KeyPath:    "server.key",
+					MinVersion: "2.0",
+				},
+			},
+			wantErr: "invalid tls: invalid minVersion: 2.0",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if (err == nil && tt.wantErr != "") || (err != nil && err.Error() != tt.wantErr) {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHTTP3_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     HTTP3
+		wantErr string
+	}{
+		{
+			name: "Check disabled HTTP/3",
+			cfg: HTTP3{
+				Address: "invalid",
+			},
+		},
+		{
+			name: "Check HTTP/3 with the address and the advertised port",
+			cfg: HTTP3{
+				Enable:     true,
+				Address:    "[::]:8443",
+				AltSvcPort: 443,
+			},
+		},
+		{
+			name: "Check HTTP/3 with invalid address",
+			cfg: HTTP3{
+				Enable:  true,
+				Address: "8443",
+			},
+			wantErr: "invalid address: 8443",
+		},
+		{
+			name: "Check HTTP/3 with invalid advertised port",
+			cfg: HTTP3{
+				Enable:     true,
+				AltSvcPort: 65536,
+			},
+			wantErr: "invalid altSvcPort: 65536",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if (err == nil && tt.wantErr != "") || (err != nil && err.Error() != tt.wantErr) {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOverload_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Overload
+		wantErr string
+	}{
+		{
+			name: "Check disabled overload",
+			cfg: Overload{
+				MaxConnections: -1,
+			},
+		},
+		{
+			name: "Check overload with the limits",
+			cfg: Overload{
+				Enable:                true,
+				MaxConnections:        10000,
+				MaxConcurrentRequests: 1000,
+				Upstreams: OverloadUpstreams{
+					HTTP: 800,
+					GRPC: 200,
+				},
+				QueueSize:    100,
+				QueueTimeout: "100ms",
+				RetryAfter:   "2s",
+				Adaptive: AdaptiveLimit{
+					Enable:           true,
+					MinLimit:         10,
+					LatencyTolerance: 1.5,
+				},
+			},
+		},
+		{
+			name: "Check overload with negative limit",
+			cfg: Overload{
+				Enable: true,
+				Upstreams: OverloadUpstreams{
+					GRPC: -1,
+				},
+			},
+			wantErr: "upstreams.grpc must not be negative",
+		},
+		{
+			name: "Check overload with invalid queue timeout",
+			cfg: Overload{
+				Enable:       true,
+				QueueTimeout: "100",
+			},
+			wantErr: "invalid queueTimeout: 100",
+		},
+		{
+			name: "Check adaptive limit without the upstream limits",
+			cfg: Overload{
+				Enable:                true,
+				MaxConcurrentRequests: 1000,
+				Adaptive: AdaptiveLimit{
+					Enable: true,
+				},
+			},
+			wantErr: "adaptive requires upstreams.http or upstreams.grpc",
+		},
+		{
+			name: "Check adaptive limit with invalid latency tolerance",
+			cfg: Overload{
+				Enable: true,
+				Upstreams: OverloadUpstreams{
+					HTTP: 100,
+				},
+				Adaptive: AdaptiveLimit{
+					Enable:           true,
+					LatencyTolerance: 0.5,
+				},
+			},
+			wantErr: "adaptive.latencyTolerance must be greater than 1: 0.5",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if (err == nil && tt.wantErr != "") || (err != nil && err.Error() != tt.wantErr) {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReload_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Reload
+		wantErr string
+	}{
+		{
+			name: "Check disabled reload",
+			cfg: Reload{
+				Period: "invalid",
+			},
+		},
+		{
+			name: "Check reload with the period",
+			cfg: Reload{
+				Enable: true,
+				Period: "30s",
+			},
+		},
+		{
+			name: "Check reload with invalid period",
+			cfg: Reload{
+				Enable: true,
+				Period: "0s",
+			},
+			wantErr: "invalid period: 0s",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if (err == nil && tt.wantErr != "") || (err != nil && err.Error() != tt.wantErr) {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
 	}
@@ -0,0 +1,136 @@
+/*
+Copyright (C)  2018 Yahoo Japan Corporation Athenz team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/yahoojapan/authorization-proxy/v4/service"
+)
+
+// NewAccessLogHandler returns a handler which writes the access log of the proxied requests.
+// It returns the given handler if the access log is disabled.
+func NewAccessLogHandler(h http.Handler, l *service.AccessLogger) http.Handler {
+	if !l.Enabled() {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ctx, o := withObservation(r.Context())
+		rw := newResponseRecorder(w)
+
+		req := r.WithContext(ctx)
+		var body *countingReader
+		if r.Body != nil && r.Body != http.NoBody {
+			body = &countingReader{ReadCloser: r.Body}
+			req.Body = body
+		}
+
+		h.ServeHTTP(rw, req)
+
+		if !l.Sampled(r.URL.Path, o.decision != service.DecisionAllowed && o.decision != service.DecisionSkipped) {
+			return
+		}
+		e := service.AccessLogEntry{
+			Time:      start,
+			RequestID: requestIDFrom(ctx),
+			ClientIP:  hostOf(r.RemoteAddr),
+			Protocol:  "http",
+			Method:    r.Method,
+			Path:      r.URL.Path,
+			Status:    rw.status,
+			BytesOut:  rw.written,
+			Latency:   time.Since(start),
+		}
+		if body != nil {
+			e.BytesIn = body.n
+		}
+		e.SetProxyHeader(service.ProxyHeaderFromContext(ctx))
+		o.entry(&e)
+		l.Log(e)
+	})
+}
+
+// withAccessLog returns a stream handler which writes the access log of the proxied gRPC calls.
+// The bytes of the messages are not recorded, since the frames are not decoded by the transparent proxy.
+func withAccessLog(h grpc.StreamHandler, l *service.AccessLogger) grpc.StreamHandler {
+	return func(srv interface{}, stream grpc.ServerStream) error {
+		start := time.Now()
+		ctx, o := withObservation(stream.Context())
+
+		err := h(srv, &serverStream{
+			ServerStream: stream,
+			ctx:          ctx,
+		})
+
+		code := status.Code(err)
+		o.grpcDone(code, err)
+
+		method, _ := grpc.MethodFromServerStream(stream)
+		if !l.Sampled(method, o.decision != service.DecisionAllowed) {
+			return err
+		}
+		e := service.AccessLogEntry{
+			Time:      start,
+			RequestID: requestIDFrom(ctx),
+			Protocol:  gRPC,
+			Method:    http.MethodPost,
+			Path:      method,
+			Status:    int(code),
+			Latency:   time.Since(start),
+		}
+		if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+			e.ClientIP = hostOf(p.Addr.String())
+		}
+		e.SetProxyHeader(service.ProxyHeaderFromContext(ctx))
+		o.entry(&e)
+		l.Log(e)
+		return err
+	}
+}
+
+// entry sets the authorization and upstream results to the access log entry.
+func (o *observation) entry(e *service.AccessLogEntry) {
+	if o == nil {
+		return
+	}
+	e.Decision = o.decision
+	// the request failed before the authorization
+	if e.Decision == "" {
+		e.Decision = service.DecisionDenied
+	}
+	e.Reason = o.reason
+	e.SetPrincipal(o.principal)
+	e.AuthzLatency = o.authzDuration
+	e.UpstreamStatus = o.upstreamStatus
+	e.UpstreamLatency = o.upstreamDuration
+}
+
+// hostOf returns the host part of the address, or the address itself if it has no port.
+func hostOf(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
@@ -0,0 +1,172 @@
+package handler
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	authorizerd "github.com/yahoojapan/athenz-authorizer/v5"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/yahoojapan/authorization-proxy/v4/config"
+	"github.com/yahoojapan/authorization-proxy/v4/service"
+)
+
+func newTestAccessLogger(t *testing.T, cfg config.AccessLog) (*service.AccessLogger, func() []string) {
+	t.Helper()
+	cfg.Enable = true
+	cfg.Path = filepath.Join(t.TempDir(), "access.log")
+	l, err := service.NewAccessLogger(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l, func() []string {
+		return closeTestLog(t, l, cfg.Path)
+	}
+}
+
+// closeTestLog closes the logger, and returns the lines of the log file.
+func closeTestLog(t *testing.T, l io.Closer, path string) []string {
+	t.Helper()
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSpace(string(b)), "\n")
+}
+
+func TestNewAccessLogHandler(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = ioutil.ReadAll(r.Body)
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = w.Write([]byte("accepted"))
+	}))
+	defer upstream.Close()
+	u, _ := url.Parse(upstream.URL)
+	port, _ := strconv.Atoi(u.Port())
+
+	l, lines := newTestAccessLogger(t, config.AccessLog{
+		Sampling: []config.AccessLogSampling{
+			{Path: "/healthz", Rate: 0},
+		},
+	})
+	h := NewRequestIDHandler(NewAccessLogHandler(New(config.Proxy{
+		Host:                   u.Hostname(),
+		Port:                   uint16(port),
+		OriginHealthCheckPaths: []string{"/healthz"},
+	}, nil, &service.AuthorizerdMock{
+		VerifyFunc: func(r *http.Request, act, res string) (authorizerd.Principal, error) {
+			if res == "/api/denied" {
+				return nil, errors.New("role token expired")
+			}
+			return &PrincipalMock{
+				NameFunc:       func() string { return "principal" },
+				RolesFunc:      func() []string { return []string{"reader", "writer"} },
+				DomainFunc:     func() string { return "domain" },
+				IssueTimeFunc:  func() int64 { return 0 },
+				ExpiryTimeFunc: func() int64 { return 0 },
+			}, nil
+		},
+	}), l), config.RequestID{
+		TrustIncoming: true,
+	})
+
+	for _, path := range []string{"/api/allowed", "/api/denied", "/healthz"} {
+		r := httptest.NewRequest(http.MethodPost, path, strings.NewReader("payload"))
+		r.Header.Set("X-Request-ID", "req-"+path)
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	got := lines()
+	if len(got) != 2 {
+		t.Fatalf("access log has %d lines, want 2: %v", len(got), got)
+	}
+	for i, want := range [][]string{
+		{
+			`"request_id":"req-/api/allowed"`,
+			`"client_ip":"192.0.2.1"`,
+			`"method":"POST"`,
+			`"status":202`,
+			`"principal":"principal"`,
+			`"domain":"domain"`,
+			`"roles":["reader","writer"]`,
+			`"credential_type":"role_token"`,
+			`"decision":"allowed"`,
+			`"upstream_status":202`,
+			`"bytes_in":7`,
+			`"bytes_out":8`,
+		},
+		{
+			`"path":"/api/denied"`,
+			`"status":401`,
+			`"decision":"denied"`,
+			`"reason":"role token expired"`,
+		},
+	} {
+		for _, w := range want {
+			if !strings.Contains(got[i], w) {
+				t.Errorf("access log %s does not contain %s", got[i], w)
+			}
+		}
+	}
+
+	var called bool
+	NewAccessLogHandler(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		called = true
+	}), nil).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if !called {
+		t.Error("NewAccessLogHandler() did not serve the handler when the access log is disabled")
+	}
+}
+
+func Test_withAccessLog(t *testing.T) {
+	l, lines := newTestAccessLogger(t, config.AccessLog{
+		Format: config.AccessLogLogfmt,
+	})
+	h := withRequestID(withAccessLog(func(srv interface{}, stream grpc.ServerStream) error {
+		o := observationFrom(stream.Context())
+		o.authorized(time.Now(), nil, errors.New("no credential"))
+		return status.Error(codes.Unauthenticated, "no credential")
+	}, l), config.RequestID{
+		TrustIncoming: true,
+	})
+
+	ctx := peer.NewContext(context.Background(), &peer.Peer{
+		Addr: &net.TCPAddr{IP: net.ParseIP("192.0.2.2"), Port: 50000},
+	})
+	ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("x-request-id", "req-1"))
+	if err := h(nil, &testServerStream{ctx: ctx}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("withAccessLog() error = %v", err)
+	}
+
+	got := lines()
+	for _, want := range []string{
+		"request_id=req-1",
+		"client_ip=192.0.2.2",
+		"protocol=grpc",
+		"status=16",
+		"decision=denied",
+		`reason="no credential"`,
+	} {
+		if !strings.Contains(got[0], want) {
+			t.Errorf("access log %s does not contain %s", got[0], want)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+/*
+Copyright (C)  2018 Yahoo Japan Corporation Athenz team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	authorizerd "github.com/yahoojapan/athenz-authorizer/v5"
+	"google.golang.org/grpc/peer"
+
+	"github.com/yahoojapan/authorization-proxy/v4/service"
+)
+
+// auditHTTP records the authorization decision of the HTTP request to the audit log.
+func auditHTTP(a *service.AuditLogger, r *http.Request, p authorizerd.Principal, err error) {
+	if !a.Audited(r.URL.Path) {
+		return
+	}
+	e := newAuditEvent("http", r.Method, r.URL.Path, p, err)
+	e.RequestID = requestIDFrom(r.Context())
+	e.ClientIP = hostOf(r.RemoteAddr)
+	a.Record(e)
+}
+
+// auditGRPC records the authorization decision of the gRPC call to the audit log.
+func auditGRPC(ctx context.Context, a *service.AuditLogger, fullMethodName string, p authorizerd.Principal, err error) {
+	if !a.Audited(fullMethodName) {
+		return
+	}
+	e := newAuditEvent(gRPC, gRPC, fullMethodName, p, err)
+	e.RequestID = requestIDFrom(ctx)
+	if pr, ok := peer.FromContext(ctx); ok && pr.Addr != nil {
+		e.ClientIP = hostOf(pr.Addr.String())
+	}
+	a.Record(e)
+}
+
+func newAuditEvent(protocol, act, res string, p authorizerd.Principal, err error) service.AuditEvent {
+	e := service.AuditEvent{
+		Time:     time.Now(),
+		Protocol: protocol,
+		Action:   act,
+		Resource: res,
+		Decision: service.DecisionAllowed,
+	}
+	if err != nil {
+		e.Decision = service.DecisionDenied
+		e.Reason = err.Error()
+		return e
+	}
+	e.SetPrincipal(p)
+	return e
+}
@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	authorizerd "github.com/yahoojapan/athenz-authorizer/v5"
+	"google.golang.org/grpc/peer"
+
+	"github.com/yahoojapan/authorization-proxy/v4/config"
+	"github.com/yahoojapan/authorization-proxy/v4/service"
+)
+
+func newTestAuditLogger(t *testing.T, cfg config.Audit) (*service.AuditLogger, func() []string) {
+	t.Helper()
+	cfg.Enable = true
+	cfg.Path = filepath.Join(t.TempDir(), "audit.log")
+	a, err := service.NewAuditLogger(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a, func() []string {
+		lines := closeTestLog(t, a, cfg.Path)
+		if err := service.NewAuditVerifier(nil).Verify(strings.NewReader(strings.Join(lines, "\n"))); err != nil {
+			t.Errorf("audit chain is broken: %v", err)
+		}
+		return lines
+	}
+}
+
+func TestNew_audit(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+	u, _ := url.Parse(upstream.URL)
+	port, _ := strconv.Atoi(u.Port())
+
+	a, records := newTestAuditLogger(t, config.Audit{
+		Resources: []string{"/admin"},
+	})
+	h := NewRequestIDHandler(New(config.Proxy{
+		Host:                   u.Hostname(),
+		Port:                   uint16(port),
+		OriginHealthCheckPaths: []string{"/admin/healthz"},
+	}, nil, &service.AuthorizerdMock{
+		VerifyFunc: func(r *http.Request, act, res string) (authorizerd.Principal, error) {
+			if res == "/admin/denied" {
+				return nil, errors.New("role token expired")
+			}
+			return &PrincipalMock{
+				NameFunc:       func() string { return "principal" },
+				RolesFunc:      func() []string { return []string{"admin"} },
+				DomainFunc:     func() string { return "domain" },
+				IssueTimeFunc:  func() int64 { return 0 },
+				ExpiryTimeFunc: func() int64 { return 0 },
+			}, nil
+		},
+	}, WithProxyAuditLogger(a)), config.RequestID{
+		TrustIncoming: true,
+	})
+
+	for _, path := range []string{"/admin/allowed", "/public", "/admin/denied", "/admin/healthz"} {
+		r := httptest.NewRequest(http.MethodDelete, path, nil)
+		r.Header.Set("X-Request-ID", "req-"+path)
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	got := records()
+	if len(got) != 2 {
+		t.Fatalf("audit log has %d records, want 2: %v", len(got), got)
+	}
+	for i, want := range [][]string{
+		{
+			`"seq":1`,
+			`"request_id":"req-/admin/allowed"`,
+			`"client_ip":"192.0.2.1"`,
+			`"action":"DELETE"`,
+			`"resource":"/admin/allowed"`,
+			`"principal":"principal"`,
+			`"roles":["admin"]`,
+			`"credential_type":"role_token"`,
+			`"decision":"allowed"`,
+		},
+		{
+			`"seq":2`,
+			`"resource":"/admin/denied"`,
+			`"decision":"denied"`,
+			`"reason":"role token expired"`,
+		},
+	} {
+		for _, w := range want {
+			if !strings.Contains(got[i], w) {
+				t.Errorf("audit record %s does not contain %s", got[i], w)
+			}
+		}
+	}
+}
+
+func Test_auditGRPC(t *testing.T) {
+	a, records := newTestAuditLogger(t, config.Audit{})
+	ctx := peer.NewContext(context.Background(), &peer.Peer{
+		Addr: &net.TCPAddr{IP: net.ParseIP("192.0.2.2"), Port: 50000},
+	})
+	ctx = context.WithValue(ctx, requestIDKey{}, "req-1")
+	auditGRPC(ctx, a, "/helloworld.Greeter/SayHello", nil, errors.New("no credential"))
+
+	got := records()
+	for _, want := range []string{
+		`"request_id":"req-1"`,
+		`"client_ip":"192.0.2.2"`,
+		`"protocol":"grpc"`,
+		`"action":"grpc"`,
+		`"resource":"/helloworld.Greeter/SayHello"`,
+		`"decision":"denied"`,
+		`"reason":"no credential"`,
+	} {
+		if !strings.Contains(got[0], want) {
+			t.Errorf("audit record %s does not contain %s", got[0], want)
+		}
+	}
+}
@@ -18,13 +18,14 @@ package handler
 
 // RFC7807Error represents the error message fulfilling RFC7807 standard.
 type RFC7807Error struct {
-	Type          string `json:"type"`
-	Title         string `json:"title"`
-	Status        int
+	Type          string         `json:"type"`
+	Title         string         `json:"title"`
+	Status        int            `json:"status"`
 	InvalidParams []InvalidParam `json:"invalid-params,omitempty"`
 	Detail        string         `json:"detail"`
 	Instance      string         `json:"instance"`
-	RoleToken     string         `json:"role_token"`
+	RoleToken     string         `json:"role_token,omitempty"`
+	RequestID     string         `json:"request_id,omitempty"`
 }
 
 // InvalidParam represents the invalid parameters requested by the user.
@@ -43,9 +44,30 @@ const (
 	// ErrMsgUnverified "unauthenticated/unauthorized"
 	ErrMsgUnverified = "unauthenticated/unauthorized"
 
+	// ErrMsgUpstreamFailed "upstream request failed"
+	ErrMsgUpstreamFailed = "upstream request failed"
+
+	// ErrMsgRequestCanceled "request canceled"
+	ErrMsgRequestCanceled = "request canceled"
+
+	// ErrMsgRequestTimeout "upstream request timed out"
+	ErrMsgRequestTimeout = "upstream request timed out"
+
+	// ErrMsgOverloaded "server overloaded"
+	ErrMsgOverloaded = "server overloaded"
+
 	// ErrGRPCMetadataNotFound "grpc metadata not found"
 	ErrGRPCMetadataNotFound = "grpc metadata not found"
 
 	// ErrRoleTokenNotFound "role token not found"
 	ErrRoleTokenNotFound = "role token not found"
+
+	// ErrRoleTokenExpired "role token expired"
+	ErrRoleTokenExpired = "role token expired"
+
+	// ErrRoleCertExpired "role certificate expired"
+	ErrRoleCertExpired = "role certificate expired"
+
+	// ErrAuthorizationRevoked "authorization revoked by policy update"
+	ErrAuthorizationRevoked = "authorization revoked by policy update"
 )
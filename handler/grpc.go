@@ -2,11 +2,13 @@ package handler
 
 import (
 	"context"
+	"crypto/x509"
 	"io"
 	"net"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/kpango/glg"
 	"github.com/mwitkow/grpc-proxy/proxy"
@@ -14,7 +16,10 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
 
 	authorizerd "github.com/yahoojapan/athenz-authorizer/v5"
@@ -24,14 +29,28 @@ import (
 
 const (
 	gRPC = "grpc"
+
+	// defaultPolicyCheckPeriod represents the default period to check the policy cache changes
+	defaultPolicyCheckPeriod = time.Minute
 )
 
 type GRPCHandler struct {
 	proxyCfg       config.Proxy
 	roleCfg        config.RoleToken
+	roleCertCfg    config.RoleCertificate
+	streamCfg      config.GRPCStream
 	authorizationd service.Authorizationd
+	streams        *StreamTracker
+	metrics        *service.Metrics
+	limiter        *service.Limiter
+	tracingCfg     config.Tracing
+	accessLogger   *service.AccessLogger
+	audit          *service.AuditLogger
 	connMap        sync.Map
 	group          singleflight.Group
+
+	// stops the policy cache watcher
+	cancel context.CancelFunc
 }
 
 func NewGRPC(opts ...GRPCOption) (grpc.StreamHandler, io.Closer) {
@@ -40,33 +59,44 @@ func NewGRPC(opts ...GRPCOption) (grpc.StreamHandler, io.Closer) {
 		opt(gh)
 	}
 
-	if !strings.EqualFold(gh.proxyCfg.Scheme, gRPC) {
+	target, ok := grpcTarget(gh.proxyCfg)
+	if !ok {
 		return nil, nil
 	}
 
-	dialOpts := []grpc.DialOption{
+	requestIDMDKey := strings.ToLower(requestIDHeader(gh.proxyCfg.RequestID))
+	dialOpts := append([]grpc.DialOption{
 		grpc.WithCodec(proxy.Codec()),
 		grpc.WithInsecure(),
-	}
+	}, grpcDialOptions(gh.proxyCfg.GRPCClient)...)
 
-	target := net.JoinHostPort(gh.proxyCfg.Host, strconv.Itoa(int(gh.proxyCfg.Port)))
+	if addrs := gh.proxyCfg.GRPCClient.Addresses; len(addrs) > 0 {
+		r := newStaticResolver(addrs)
+		dialOpts = append(dialOpts, grpc.WithResolvers(r))
+		target = r.Scheme() + ":///upstream"
+	}
+	glg.Infof("gRPC proxy destination: %s", target)
 
-	return proxy.TransparentHandler(func(ctx context.Context, fullMethodName string) (context.Context, *grpc.ClientConn, error) {
-		md, ok := metadata.FromIncomingContext(ctx)
-		if !ok {
-			return ctx, nil, status.Errorf(codes.Unauthenticated, ErrGRPCMetadataNotFound)
+	h := proxy.TransparentHandler(func(ctx context.Context, fullMethodName string) (context.Context, *grpc.ClientConn, error) {
+		o := observationFrom(ctx)
+		start := time.Now()
+		actx, span := startAuthorizationSpan(ctx, gRPC, fullMethodName)
+		p, cred, err := gh.authorize(actx, fullMethodName)
+		endAuthorizationSpan(span, p, err)
+		o.authorized(start, p, err)
+		auditGRPC(ctx, gh.audit, fullMethodName, p, err)
+		if err != nil {
+			return ctx, nil, err
 		}
 
-		rts := md.Get(gh.roleCfg.RoleAuthHeader)
-		if len(rts) == 0 {
-			return ctx, nil, status.Errorf(codes.Unauthenticated, ErrRoleTokenNotFound)
+		if gh.streams != nil {
+			gh.streams.track(ctx, cred, fullMethodName, p)
 		}
 
-		p, err := gh.authorizationd.AuthorizeRoleToken(ctx, rts[0], gRPC, fullMethodName)
-		if err != nil {
-			return ctx, nil, status.Errorf(codes.Unauthenticated, err.Error())
+		ctx = startGRPCUpstreamSpan(ctx, fullMethodName)
+		if id := requestIDFrom(ctx); id != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, requestIDMDKey, id)
 		}
-
 		ctx = metadata.AppendToOutgoingContext(ctx,
 			"X-Athenz-Principal", p.Name(),
 			"X-Athenz-Role", strings.Join(p.Roles(), ","),
@@ -78,12 +108,181 @@ func NewGRPC(opts ...GRPCOption) (grpc.StreamHandler, io.Closer) {
 			ctx = metadata.AppendToOutgoingContext(ctx, "X-Athenz-Client-ID", c.ClientID())
 		}
 
+		o.upstreamStarted()
 		conn, err := gh.dialContext(ctx, target, dialOpts...)
 		return ctx, conn, err
-	}), gh
+	})
+	if t := gh.proxyCfg.GRPCClient.CallTimeout; t > 0 {
+		h = withCallTimeout(h, t)
+	}
+	if gh.streams != nil {
+		h = gh.streams.wrap(h)
+
+		if gh.streamCfg.ReauthorizeOnPolicyChange {
+			period, err := time.ParseDuration(gh.streamCfg.PolicyCheckPeriod)
+			if err != nil || period <= 0 {
+				period = defaultPolicyCheckPeriod
+			}
+			var ctx context.Context
+			ctx, gh.cancel = context.WithCancel(context.Background())
+			go gh.watchPolicyCache(ctx, period)
+		}
+	}
+	if gh.limiter != nil {
+		h = withOverload(h, gh.limiter)
+	}
+	if gh.tracingCfg.Enable {
+		h = withTracing(h)
+	}
+	if gh.metrics != nil {
+		h = withMetrics(h, gh.metrics)
+	}
+	if gh.accessLogger.Enabled() {
+		h = withAccessLog(h, gh.accessLogger)
+	}
+	h = withRequestID(h, gh.proxyCfg.RequestID)
+	return h, gh
+}
+
+// authorize authorizes the gRPC call by the role certificate of the TLS peer if it is enabled, and then by the role token in the metadata.
+// It returns the principal and the credential used for the authorization.
+func (gh *GRPCHandler) authorize(ctx context.Context, fullMethodName string) (authorizerd.Principal, credential, error) {
+	if gh.roleCertCfg.Enable {
+		if certs := peerCertificates(ctx); len(certs) != 0 {
+			p, err := gh.authorizationd.AuthorizeRoleCert(ctx, certs, gRPC, fullMethodName)
+			if err == nil {
+				return p, credential{certs: certs}, nil
+			}
+			glg.Debugf("role certificate unauthorized, fallback to role token. method: %s, request_id: %s, error: %v", fullMethodName, requestIDFrom(ctx), err)
+		}
+	}
+
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil, credential{}, status.Errorf(codes.Unauthenticated, ErrGRPCMetadataNotFound)
+	}
+
+	rts := md.Get(gh.roleCfg.RoleAuthHeader)
+	if len(rts) == 0 {
+		return nil, credential{}, status.Errorf(codes.Unauthenticated, ErrRoleTokenNotFound)
+	}
+
+	p, err := gh.authorizationd.AuthorizeRoleToken(ctx, rts[0], gRPC, fullMethodName)
+	if err != nil {
+		return nil, credential{}, status.Errorf(codes.Unauthenticated, err.Error())
+	}
+	return p, credential{token: rts[0]}, nil
+}
+
+// peerCertificates returns the verified leaf certificate of the TLS peer of the gRPC call.
+func peerCertificates(ctx context.Context) []*x509.Certificate {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		return nil
+	}
+	return service.VerifiedPeerCertificates(&info.State)
+}
+
+// grpcDialOptions returns the gRPC dial options from the given parameters, and logs the effective values.
+// Zero value parameters are not set, so that the gRPC default is used.
+func grpcDialOptions(cfg config.GRPCClient) []grpc.DialOption {
+	var opts []grpc.DialOption
+	var callOpts []grpc.CallOption
+	if cfg.MaxRecvMsgSize > 0 {
+		callOpts = append(callOpts, grpc.MaxCallRecvMsgSize(cfg.MaxRecvMsgSize))
+	}
+	if cfg.MaxSendMsgSize > 0 {
+		callOpts = append(callOpts, grpc.MaxCallSendMsgSize(cfg.MaxSendMsgSize))
+	}
+	if len(callOpts) > 0 {
+		opts = append(opts, grpc.WithDefaultCallOptions(callOpts...))
+	}
+	if cfg.InitialWindowSize > 0 {
+		opts = append(opts, grpc.WithInitialWindowSize(cfg.InitialWindowSize))
+	}
+	if cfg.InitialConnWindowSize > 0 {
+		opts = append(opts, grpc.WithInitialConnWindowSize(cfg.InitialConnWindowSize))
+	}
+	if sc := grpcServiceConfig(cfg); sc != "" {
+		opts = append(opts, grpc.WithDefaultServiceConfig(sc))
+	}
+	if cfg.KeepaliveTime > 0 || cfg.KeepaliveTimeout > 0 || cfg.KeepalivePermitWithoutStream {
+		opts = append(opts, grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                cfg.KeepaliveTime,
+			Timeout:             cfg.KeepaliveTimeout,
+			PermitWithoutStream: cfg.KeepalivePermitWithoutStream,
+		}))
+	}
+
+	policy := cfg.LoadBalancingPolicy
+	if policy == "" {
+		policy = config.GRPCPickFirst
+	}
+	glg.Infof("gRPC client parameters: maxRecvMsgSize=%d maxSendMsgSize=%d initialWindowSize=%d initialConnWindowSize=%d keepaliveTime=%s keepaliveTimeout=%s keepalivePermitWithoutStream=%t callTimeout=%s loadBalancingPolicy=%s healthCheck=%t",
+		service.OrDefaultInt(cfg.MaxRecvMsgSize, service.DefaultGRPCMaxRecvMsgSize),
+		service.OrDefaultInt(cfg.MaxSendMsgSize, service.DefaultGRPCMaxSendMsgSize),
+		service.OrDefaultInt(int(cfg.InitialWindowSize), service.DefaultGRPCWindowSize),
+		service.OrDefaultInt(int(cfg.InitialConnWindowSize), service.DefaultGRPCWindowSize),
+		service.OrInfinity(cfg.KeepaliveTime),
+		service.OrDefaultDuration(cfg.KeepaliveTimeout, service.DefaultGRPCKeepaliveTimeout),
+		cfg.KeepalivePermitWithoutStream,
+		service.OrInfinity(cfg.CallTimeout),
+		policy,
+		cfg.HealthCheck.Enable)
+	return opts
+}
+
+// withCallTimeout returns a stream handler which cancels the proxied call when the timeout exceeds.
+func withCallTimeout(h grpc.StreamHandler, timeout time.Duration) grpc.StreamHandler {
+	return func(srv interface{}, stream grpc.ServerStream) error {
+		ctx, cancel := context.WithTimeout(stream.Context(), timeout)
+		defer cancel()
+		return h(srv, &serverStream{
+			ServerStream: stream,
+			ctx:          ctx,
+		})
+	}
+}
+
+// serverStream wraps grpc.ServerStream to override its context.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context returns the overridden context of the stream.
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// IsGRPCMixedMode returns whether HTTP and gRPC requests should be served on the same listener.
+func IsGRPCMixedMode(cfg config.Proxy) bool {
+	return !strings.EqualFold(cfg.Scheme, gRPC) && cfg.GRPC.Enable
+}
+
+// grpcTarget returns the gRPC proxy destination, and false if gRPC proxying is disabled.
+// The name resolver target in the gRPC client configuration overrides the destination host and port.
+func grpcTarget(cfg config.Proxy) (string, bool) {
+	switch {
+	case !strings.EqualFold(cfg.Scheme, gRPC) && !IsGRPCMixedMode(cfg):
+		return "", false
+	case cfg.GRPCClient.Target != "":
+		return cfg.GRPCClient.Target, true
+	case strings.EqualFold(cfg.Scheme, gRPC):
+		return net.JoinHostPort(cfg.Host, strconv.Itoa(int(cfg.Port))), true
+	default:
+		return net.JoinHostPort(cfg.GRPC.Host, strconv.Itoa(int(cfg.GRPC.Port))), true
+	}
 }
 
 func (gh *GRPCHandler) Close() error {
+	if gh.cancel != nil {
+		gh.cancel()
+	}
 	gh.connMap.Range(func(target, v interface{}) bool {
 		if conn, ok := v.(*grpc.ClientConn); ok {
 			if err := conn.Close(); err != nil {
@@ -0,0 +1,147 @@
+/*
+Copyright (C)  2018 Yahoo Japan Corporation Athenz team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"encoding/json"
+	"sync"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/balancer/weightedroundrobin"
+	_ "google.golang.org/grpc/health" // register the client side health checking function
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/resolver/manual"
+
+	"github.com/yahoojapan/authorization-proxy/v4/config"
+)
+
+const (
+	// staticScheme represents the resolver scheme of the static destination address list.
+	staticScheme = "authz-proxy-static"
+
+	// weightedBalancerName represents the name of the weighted round robin balancer of the proxy.
+	// It is not the grpc-go weighted round robin name, which is registered by grpc-go itself and balances by the server load reports.
+	weightedBalancerName = "authz_proxy_weighted_round_robin"
+)
+
+func init() {
+	// the balancer picks the addresses by the weights in the grpc-go weighted round robin address attributes
+	balancer.Register(base.NewBalancerBuilder(weightedBalancerName, &weightedPickerBuilder{}, base.Config{HealthCheck: true}))
+}
+
+// newStaticResolver returns a resolver builder which resolves the static destination address list.
+// The address weight is stored in the address attributes for the weighted load balancing policy.
+func newStaticResolver(addrs []config.GRPCAddress) *manual.Resolver {
+	state := resolver.State{
+		Addresses: make([]resolver.Address, 0, len(addrs)),
+	}
+	for _, a := range addrs {
+		w := a.Weight
+		if w == 0 {
+			w = 1
+		}
+		state.Addresses = append(state.Addresses, weightedroundrobin.SetAddrInfo(resolver.Address{Addr: a.Address}, weightedroundrobin.AddrInfo{Weight: w}))
+	}
+
+	r := manual.NewBuilderWithScheme(staticScheme)
+	r.InitialState(state)
+	return r
+}
+
+// grpcServiceConfig returns the default service config JSON of the load balancing policy and the health checking, or empty if the gRPC default is used.
+func grpcServiceConfig(cfg config.GRPCClient) string {
+	if cfg.LoadBalancingPolicy == "" && !cfg.HealthCheck.Enable {
+		return ""
+	}
+
+	policy := cfg.LoadBalancingPolicy
+	switch policy {
+	case "":
+		policy = config.GRPCPickFirst
+	case config.GRPCWeighted:
+		policy = weightedBalancerName
+	}
+
+	sc := map[string]interface{}{
+		"loadBalancingConfig": []map[string]interface{}{
+			{policy: struct{}{}},
+		},
+	}
+	if cfg.HealthCheck.Enable {
+		sc["healthCheckConfig"] = map[string]string{
+			"serviceName": cfg.HealthCheck.ServiceName,
+		}
+	}
+
+	b, _ := json.Marshal(sc)
+	return string(b)
+}
+
+// weightedPickerBuilder builds the picker picking the ready SubConns in smooth weighted round robin order.
+type weightedPickerBuilder struct{}
+
+type weightedSubConn struct {
+	sc      balancer.SubConn
+	weight  int64
+	current int64
+}
+
+type weightedPicker struct {
+	mu    sync.Mutex
+	scs   []*weightedSubConn
+	total int64
+}
+
+// Build implements base.PickerBuilder.
+func (*weightedPickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	}
+
+	p := &weightedPicker{
+		scs: make([]*weightedSubConn, 0, len(info.ReadySCs)),
+	}
+	for sc, sci := range info.ReadySCs {
+		w := int64(weightedroundrobin.GetAddrInfo(sci.Address).Weight)
+		if w <= 0 {
+			w = 1
+		}
+		p.scs = append(p.scs, &weightedSubConn{
+			sc:     sc,
+			weight: w,
+		})
+		p.total += w
+	}
+	return p
+}
+
+// Pick implements balancer.Picker, which selects the SubConn with the largest current weight (nginx smooth weighted round robin).
+func (p *weightedPicker) Pick(balancer.PickInfo) (balancer.PickResult, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var best *weightedSubConn
+	for _, wsc := range p.scs {
+		wsc.current += wsc.weight
+		if best == nil || wsc.current > best.current {
+			best = wsc
+		}
+	}
+	best.current -= p.total
+	return balancer.PickResult{SubConn: best.sc}, nil
+}
@@ -0,0 +1,203 @@
+package handler
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mwitkow/grpc-proxy/proxy"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/balancer/weightedroundrobin"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/yahoojapan/authorization-proxy/v4/config"
+)
+
+func Test_grpcServiceConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.GRPCClient
+		want string
+	}{
+		{
+			name: "return empty when gRPC default is used",
+			cfg:  config.GRPCClient{},
+			want: "",
+		},
+		{
+			name: "return round robin policy",
+			cfg: config.GRPCClient{
+				LoadBalancingPolicy: config.GRPCRoundRobin,
+			},
+			want: `{"loadBalancingConfig":[{"round_robin":{}}]}`,
+		},
+		{
+			name: "return weighted policy with health check",
+			cfg: config.GRPCClient{
+				LoadBalancingPolicy: config.GRPCWeighted,
+				HealthCheck: config.GRPCHealthCheck{
+					Enable:      true,
+					ServiceName: "svc",
+				},
+			},
+			want: `{"healthCheckConfig":{"serviceName":"svc"},"loadBalancingConfig":[{"authz_proxy_weighted_round_robin":{}}]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := grpcServiceConfig(tt.cfg); got != tt.want {
+				t.Errorf("grpcServiceConfig() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_weightedBalancerName(t *testing.T) {
+	if weightedBalancerName == weightedroundrobin.Name {
+		t.Errorf("weightedBalancerName = %v, want other than the grpc-go balancer name", weightedBalancerName)
+	}
+	if b := balancer.Get(weightedBalancerName); b == nil {
+		t.Errorf("balancer %v is not registered", weightedBalancerName)
+	}
+}
+
+type subConnMock struct {
+	balancer.SubConn
+	name string
+}
+
+func Test_weightedPicker_Pick(t *testing.T) {
+	a := &subConnMock{name: "a"}
+	b := &subConnMock{name: "b"}
+	p := (&weightedPickerBuilder{}).Build(base.PickerBuildInfo{
+		ReadySCs: map[balancer.SubConn]base.SubConnInfo{
+			a: {Address: weightedroundrobin.SetAddrInfo(resolver.Address{Addr: "a"}, weightedroundrobin.AddrInfo{Weight: 3})},
+			b: {Address: weightedroundrobin.SetAddrInfo(resolver.Address{Addr: "b"}, weightedroundrobin.AddrInfo{Weight: 1})},
+		},
+	})
+
+	counts := map[string]int{}
+	for i := 0; i < 8; i++ {
+		res, err := p.Pick(balancer.PickInfo{})
+		if err != nil {
+			t.Fatalf("Pick() error = %v", err)
+		}
+		counts[res.SubConn.(*subConnMock).name]++
+	}
+	if counts["a"] != 6 || counts["b"] != 2 {
+		t.Errorf("Pick() counts = %v, want a: 6, b: 2", counts)
+	}
+
+	if _, err := (&weightedPickerBuilder{}).Build(base.PickerBuildInfo{}).Pick(balancer.PickInfo{}); err != balancer.ErrNoSubConnAvailable {
+		t.Errorf("Pick() error = %v, want %v", err, balancer.ErrNoSubConnAvailable)
+	}
+}
+
+func TestGRPCHandler_dialContext_loadBalancing(t *testing.T) {
+	type backend struct {
+		addr string
+		hits int32
+		srv  *grpc.Server
+		hsrv *health.Server
+	}
+	startBackend := func(serving healthpb.HealthCheckResponse_ServingStatus) *backend {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		b := &backend{addr: l.Addr().String(), hsrv: health.NewServer()}
+		b.hsrv.SetServingStatus("", serving)
+		b.srv = grpc.NewServer(
+			grpc.CustomCodec(proxy.Codec()),
+			grpc.UnknownServiceHandler(func(srv interface{}, stream grpc.ServerStream) error {
+				atomic.AddInt32(&b.hits, 1)
+				return stream.SendMsg(new(emptypb.Empty))
+			}),
+		)
+		healthpb.RegisterHealthServer(b.srv, b.hsrv)
+		go b.srv.Serve(l)
+		return b
+	}
+
+	tests := []struct {
+		name      string
+		client    config.GRPCClient
+		serving   []healthpb.HealthCheckResponse_ServingStatus
+		checkHits func(hits []int32) bool
+	}{
+		{
+			name: "round robin spreads calls over static addresses",
+			client: config.GRPCClient{
+				LoadBalancingPolicy: config.GRPCRoundRobin,
+			},
+			serving: []healthpb.HealthCheckResponse_ServingStatus{healthpb.HealthCheckResponse_SERVING, healthpb.HealthCheckResponse_SERVING},
+			checkHits: func(hits []int32) bool {
+				return hits[0] == 5 && hits[1] == 5
+			},
+		},
+		{
+			name: "health check skips not serving addresses",
+			client: config.GRPCClient{
+				LoadBalancingPolicy: config.GRPCRoundRobin,
+				HealthCheck: config.GRPCHealthCheck{
+					Enable: true,
+				},
+			},
+			serving: []healthpb.HealthCheckResponse_ServingStatus{healthpb.HealthCheckResponse_SERVING, healthpb.HealthCheckResponse_NOT_SERVING},
+			checkHits: func(hits []int32) bool {
+				return hits[0] == 10 && hits[1] == 0
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backends := make([]*backend, 0, len(tt.serving))
+			for _, s := range tt.serving {
+				b := startBackend(s)
+				defer b.srv.Stop()
+				backends = append(backends, b)
+				tt.client.Addresses = append(tt.client.Addresses, config.GRPCAddress{Address: b.addr})
+			}
+
+			gh := &GRPCHandler{
+				proxyCfg: config.Proxy{
+					Scheme:     "grpc",
+					GRPCClient: tt.client,
+				},
+			}
+			r := newStaticResolver(tt.client.Addresses)
+			target := r.Scheme() + ":///upstream"
+			conn, err := gh.dialContext(context.Background(), target,
+				append([]grpc.DialOption{grpc.WithCodec(proxy.Codec()), grpc.WithInsecure(), grpc.WithResolvers(r)}, grpcDialOptions(tt.client)...)...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer gh.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+			defer cancel()
+			// wait for the health check results
+			time.Sleep(time.Millisecond * 200)
+			for i := 0; i < 10; i++ {
+				if err := conn.Invoke(ctx, "/method/", new(emptypb.Empty), new(emptypb.Empty), grpc.WaitForReady(true)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			hits := make([]int32, 0, len(backends))
+			for _, b := range backends {
+				hits = append(hits, atomic.LoadInt32(&b.hits))
+			}
+			if !tt.checkHits(hits) {
+				t.Errorf("unexpected backend hits: %v", hits)
+			}
+		})
+	}
+}
@@ -24,6 +24,62 @@ func WithRoleTokenConfig(cfg config.RoleToken) GRPCOption {
 	}
 }
 
+// WithRoleCertificateConfig returns a role certificate config functional option
+func WithRoleCertificateConfig(cfg config.RoleCertificate) GRPCOption {
+	return func(h *GRPCHandler) {
+		h.roleCertCfg = cfg
+	}
+}
+
+// WithGRPCStreamConfig returns a gRPC stream config functional option
+func WithGRPCStreamConfig(cfg config.GRPCStream) GRPCOption {
+	return func(h *GRPCHandler) {
+		h.streamCfg = cfg
+	}
+}
+
+// WithStreamTracker returns a stream tracker functional option
+func WithStreamTracker(t *StreamTracker) GRPCOption {
+	return func(h *GRPCHandler) {
+		h.streams = t
+	}
+}
+
+// WithMetrics returns a Prometheus metrics functional option
+func WithMetrics(m *service.Metrics) GRPCOption {
+	return func(h *GRPCHandler) {
+		h.metrics = m
+	}
+}
+
+// WithLimiter returns a overload limiter functional option
+func WithLimiter(l *service.Limiter) GRPCOption {
+	return func(h *GRPCHandler) {
+		h.limiter = l
+	}
+}
+
+// WithTracingConfig returns a tracing config functional option
+func WithTracingConfig(cfg config.Tracing) GRPCOption {
+	return func(h *GRPCHandler) {
+		h.tracingCfg = cfg
+	}
+}
+
+// WithAccessLogger returns a access logger functional option
+func WithAccessLogger(l *service.AccessLogger) GRPCOption {
+	return func(h *GRPCHandler) {
+		h.accessLogger = l
+	}
+}
+
+// WithAuditLogger returns a audit logger functional option
+func WithAuditLogger(a *service.AuditLogger) GRPCOption {
+	return func(h *GRPCHandler) {
+		h.audit = a
+	}
+}
+
 // WithAuthorizationd returns a authorizationd functional option
 func WithAuthorizationd(a service.Authorizationd) GRPCOption {
 	return func(h *GRPCHandler) {
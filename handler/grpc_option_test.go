@@ -89,6 +89,152 @@ func TestWithRoleTokenConfig(t *testing.T) {
 	}
 }
 
+func TestWithRoleCertificateConfig(t *testing.T) {
+	type args struct {
+		cfg config.RoleCertificate
+	}
+	type test struct {
+		name      string
+		args      args
+		checkFunc func(GRPCOption) error
+	}
+	tests := []test{
+		func() test {
+			cfg := config.RoleCertificate{
+				Enable:    true,
+				URIPrefix: "athenz://role/",
+			}
+			return test{
+				name: "set success",
+				args: args{
+					cfg: cfg,
+				},
+				checkFunc: func(o GRPCOption) error {
+					h := &GRPCHandler{}
+					o(h)
+					if !reflect.DeepEqual(h.roleCertCfg, cfg) {
+						return errors.New("config not match")
+					}
+					return nil
+				},
+			}
+		}(),
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := WithRoleCertificateConfig(tt.args.cfg)
+			if err := tt.checkFunc(got); err != nil {
+				t.Errorf("WithRoleCertificateConfig() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestWithTracingConfig(t *testing.T) {
+	type args struct {
+		cfg config.Tracing
+	}
+	type test struct {
+		name      string
+		args      args
+		checkFunc func(GRPCOption) error
+	}
+	tests := []test{
+		func() test {
+			cfg := config.Tracing{
+				Enable:   true,
+				Exporter: config.TracingStdout,
+			}
+			return test{
+				name: "set success",
+				args: args{
+					cfg: cfg,
+				},
+				checkFunc: func(o GRPCOption) error {
+					h := &GRPCHandler{}
+					o(h)
+					if !reflect.DeepEqual(h.tracingCfg, cfg) {
+						return errors.New("config not match")
+					}
+					return nil
+				},
+			}
+		}(),
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := WithTracingConfig(tt.args.cfg)
+			if err := tt.checkFunc(got); err != nil {
+				t.Errorf("WithTracingConfig() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestWithAccessLogger(t *testing.T) {
+	type args struct {
+		l *service.AccessLogger
+	}
+	type test struct {
+		name      string
+		args      args
+		checkFunc func(GRPCOption) error
+	}
+	tests := []test{
+		func() test {
+			l, _ := service.NewAccessLogger(config.AccessLog{
+				Enable: true,
+			})
+			return test{
+				name: "set success",
+				args: args{
+					l: l,
+				},
+				checkFunc: func(o GRPCOption) error {
+					h := &GRPCHandler{}
+					o(h)
+					if h.accessLogger != l {
+						return errors.New("access logger not match")
+					}
+					return nil
+				},
+			}
+		}(),
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := WithAccessLogger(tt.args.l)
+			if err := tt.checkFunc(got); err != nil {
+				t.Errorf("WithAccessLogger() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestWithAuditLogger(t *testing.T) {
+	a, _ := newTestAuditLogger(t, config.Audit{})
+	defer a.Close()
+
+	h := &GRPCHandler{}
+	WithAuditLogger(a)(h)
+	if h.audit != a {
+		t.Error("audit logger not match")
+	}
+}
+
+func TestWithLimiter(t *testing.T) {
+	l := service.NewLimiter(config.Overload{
+		Enable:                true,
+		MaxConcurrentRequests: 1,
+	}, nil)
+
+	h := &GRPCHandler{}
+	WithLimiter(l)(h)
+	if h.limiter != l {
+		t.Error("limiter not match")
+	}
+}
+
 func TestWithAuthorizationd(t *testing.T) {
 	type args struct {
 		a service.Authorizationd
@@ -126,3 +272,82 @@ func TestWithAuthorizationd(t *testing.T) {
 		})
 	}
 }
+
+func TestWithGRPCStreamConfig(t *testing.T) {
+	type args struct {
+		cfg config.GRPCStream
+	}
+	type test struct {
+		name      string
+		args      args
+		checkFunc func(GRPCOption) error
+	}
+	tests := []test{
+		func() test {
+			cfg := config.GRPCStream{
+				ReauthorizeOnPolicyChange: true,
+				PolicyCheckPeriod:         "10s",
+			}
+			return test{
+				name: "set success",
+				args: args{
+					cfg: cfg,
+				},
+				checkFunc: func(o GRPCOption) error {
+					h := &GRPCHandler{}
+					o(h)
+					if !reflect.DeepEqual(h.streamCfg, cfg) {
+						return errors.New("config not match")
+					}
+					return nil
+				},
+			}
+		}(),
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := WithGRPCStreamConfig(tt.args.cfg)
+			if err := tt.checkFunc(got); err != nil {
+				t.Errorf("WithGRPCStreamConfig() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestWithStreamTracker(t *testing.T) {
+	type args struct {
+		st *StreamTracker
+	}
+	type test struct {
+		name      string
+		args      args
+		checkFunc func(GRPCOption) error
+	}
+	tests := []test{
+		func() test {
+			st := NewStreamTracker()
+			return test{
+				name: "set success",
+				args: args{
+					st: st,
+				},
+				checkFunc: func(o GRPCOption) error {
+					h := &GRPCHandler{}
+					o(h)
+					if h.streams != st {
+						return errors.New("stream tracker not match")
+					}
+					return nil
+				},
+			}
+		}(),
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := WithStreamTracker(tt.args.st)
+			if err := tt.checkFunc(got); err != nil {
+				t.Errorf("WithStreamTracker() error = %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,209 @@
+/*
+Copyright (C)  2018 Yahoo Japan Corporation Athenz team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"context"
+	"crypto/x509"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kpango/glg"
+	authorizerd "github.com/yahoojapan/athenz-authorizer/v5"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// StreamTracker tracks the active gRPC streams, and terminates them when their authorization is no longer valid.
+type StreamTracker struct {
+	mu      sync.Mutex
+	streams map[*trackedStream]struct{}
+
+	// number of streams terminated by the tracker
+	forced uint64
+}
+
+// StreamStats represents the statistics of the active gRPC streams.
+type StreamStats struct {
+	Active              int    `json:"active"`
+	ForcedCancellations uint64 `json:"forced_cancellations"`
+}
+
+// credential represents the credential used to authorize the stream, either the role token or the role certificate.
+type credential struct {
+	token string
+	// certs has the verified leaf certificate only
+	certs []*x509.Certificate
+}
+
+type trackedStream struct {
+	cancel context.CancelFunc
+
+	// set when the stream is authorized
+	cred   credential
+	method string
+	timer  *time.Timer
+
+	mu     sync.Mutex
+	reason *status.Status
+}
+
+type trackedStreamKey struct{}
+
+// NewStreamTracker returns a new StreamTracker.
+func NewStreamTracker() *StreamTracker {
+	return &StreamTracker{
+		streams: make(map[*trackedStream]struct{}),
+	}
+}
+
+// Stats returns the current statistics of the tracked streams.
+func (t *StreamTracker) Stats() StreamStats {
+	t.mu.Lock()
+	active := len(t.streams)
+	t.mu.Unlock()
+	return StreamStats{
+		Active:              active,
+		ForcedCancellations: atomic.LoadUint64(&t.forced),
+	}
+}
+
+// wrap returns a stream handler which registers the stream context, so that the director can track the stream after authorization.
+// If the stream is terminated by the tracker, the termination status is returned to the client instead of the proxy error.
+func (t *StreamTracker) wrap(h grpc.StreamHandler) grpc.StreamHandler {
+	return func(srv interface{}, stream grpc.ServerStream) error {
+		ctx, cancel := context.WithCancel(stream.Context())
+		defer cancel()
+
+		ts := &trackedStream{cancel: cancel}
+		defer t.untrack(ts)
+
+		err := h(srv, &serverStream{
+			ServerStream: stream,
+			ctx:          context.WithValue(ctx, trackedStreamKey{}, ts),
+		})
+		if st := ts.terminated(); st != nil {
+			return st.Err()
+		}
+		return err
+	}
+}
+
+// track starts tracking the stream in the context with its authorized principal, and schedules the termination on the principal expiry.
+func (t *StreamTracker) track(ctx context.Context, cred credential, method string, p authorizerd.Principal) {
+	ts, ok := ctx.Value(trackedStreamKey{}).(*trackedStream)
+	if !ok {
+		return
+	}
+
+	ts.cred = cred
+	ts.method = method
+	if exp := p.ExpiryTime(); exp > 0 {
+		reason := ErrRoleTokenExpired
+		if len(cred.certs) != 0 {
+			reason = ErrRoleCertExpired
+		}
+		ts.timer = time.AfterFunc(time.Until(time.Unix(exp, 0)), func() {
+			glg.Infof("gRPC stream terminated, %s. method: %s, principal: %s", reason, method, p.Name())
+			t.terminate(ts, status.New(codes.Unauthenticated, reason))
+		})
+	}
+
+	t.mu.Lock()
+	t.streams[ts] = struct{}{}
+	t.mu.Unlock()
+}
+
+func (t *StreamTracker) untrack(ts *trackedStream) {
+	if ts.timer != nil {
+		ts.timer.Stop()
+	}
+	t.mu.Lock()
+	delete(t.streams, ts)
+	t.mu.Unlock()
+}
+
+// terminate cancels the stream with the given status, only the first termination is counted.
+func (t *StreamTracker) terminate(ts *trackedStream, st *status.Status) {
+	ts.mu.Lock()
+	if ts.reason != nil {
+		ts.mu.Unlock()
+		return
+	}
+	ts.reason = st
+	ts.mu.Unlock()
+
+	atomic.AddUint64(&t.forced, 1)
+	ts.cancel()
+}
+
+func (ts *trackedStream) terminated() *status.Status {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	return ts.reason
+}
+
+// reauthorize checks the authorization of all active streams, and terminates the streams which are no longer authorized.
+func (t *StreamTracker) reauthorize(authorize func(cred credential, method string) error) {
+	t.mu.Lock()
+	streams := make([]*trackedStream, 0, len(t.streams))
+	for ts := range t.streams {
+		streams = append(streams, ts)
+	}
+	t.mu.Unlock()
+
+	for _, ts := range streams {
+		if err := authorize(ts.cred, ts.method); err != nil {
+			glg.Infof("gRPC stream terminated, authorization revoked. method: %s, error: %v", ts.method, err)
+			t.terminate(ts, status.New(codes.PermissionDenied, ErrAuthorizationRevoked))
+		}
+	}
+}
+
+// watchPolicyCache re-authorizes the active streams whenever the policy cache changes, until the context is canceled.
+func (gh *GRPCHandler) watchPolicyCache(ctx context.Context, period time.Duration) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	last := gh.authorizationd.GetPolicyCache(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			cur := gh.authorizationd.GetPolicyCache(ctx)
+			if reflect.DeepEqual(last, cur) {
+				continue
+			}
+			last = cur
+
+			glg.Info("policy cache changed, re-authorizing active gRPC streams")
+			gh.streams.reauthorize(func(cred credential, method string) error {
+				var err error
+				if len(cred.certs) != 0 {
+					_, err = gh.authorizationd.AuthorizeRoleCert(ctx, cred.certs, gRPC, method)
+				} else {
+					_, err = gh.authorizationd.AuthorizeRoleToken(ctx, cred.token, gRPC, method)
+				}
+				return err
+			})
+		}
+	}
+}
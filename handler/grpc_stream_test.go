@@ -0,0 +1,146 @@
+package handler
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	authorizerd "github.com/yahoojapan/athenz-authorizer/v5"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/yahoojapan/authorization-proxy/v4/service"
+)
+
+func TestStreamTracker_wrap(t *testing.T) {
+	type test struct {
+		name     string
+		h        func(st *StreamTracker) grpc.StreamHandler
+		wantCode codes.Code
+		want     StreamStats
+	}
+	tests := []test{
+		{
+			name: "return handler result when the stream is not terminated",
+			h: func(st *StreamTracker) grpc.StreamHandler {
+				return func(srv interface{}, stream grpc.ServerStream) error {
+					st.track(stream.Context(), credential{token: "token"}, "/method", &PrincipalMock{
+						ExpiryTimeFunc: func() int64 {
+							return time.Now().Add(time.Hour).Unix()
+						},
+					})
+					if got := st.Stats().Active; got != 1 {
+						return errors.Errorf("active streams = %d, want 1", got)
+					}
+					return nil
+				}
+			},
+			wantCode: codes.OK,
+			want: StreamStats{
+				Active:              0,
+				ForcedCancellations: 0,
+			},
+		},
+		{
+			name: "return unauthenticated when the role token expires",
+			h: func(st *StreamTracker) grpc.StreamHandler {
+				return func(srv interface{}, stream grpc.ServerStream) error {
+					st.track(stream.Context(), credential{token: "token"}, "/method", &PrincipalMock{
+						NameFunc: func() string {
+							return "principal"
+						},
+						ExpiryTimeFunc: func() int64 {
+							return time.Now().Unix()
+						},
+					})
+					<-stream.Context().Done()
+					return status.Error(codes.Canceled, stream.Context().Err().Error())
+				}
+			},
+			wantCode: codes.Unauthenticated,
+			want: StreamStats{
+				Active:              0,
+				ForcedCancellations: 1,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := NewStreamTracker()
+			err := st.wrap(tt.h(st))(nil, &serverStream{ctx: context.Background()})
+			if got := status.Code(err); got != tt.wantCode {
+				t.Errorf("wrap() code = %v, want %v, err: %v", got, tt.wantCode, err)
+			}
+			if got := st.Stats(); got != tt.want {
+				t.Errorf("Stats() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStreamTracker_reauthorize(t *testing.T) {
+	st := NewStreamTracker()
+	allowed := &trackedStream{cancel: func() {}, cred: credential{token: "allowed"}, method: "/method"}
+	revoked := &trackedStream{cancel: func() {}, cred: credential{token: "revoked"}, method: "/method"}
+	st.streams[allowed] = struct{}{}
+	st.streams[revoked] = struct{}{}
+
+	st.reauthorize(func(cred credential, method string) error {
+		if cred.token == "revoked" {
+			return errors.New("denied")
+		}
+		return nil
+	})
+
+	if got := allowed.terminated(); got != nil {
+		t.Errorf("reauthorize() terminated allowed stream: %v", got)
+	}
+	if got := revoked.terminated(); got == nil || got.Code() != codes.PermissionDenied {
+		t.Errorf("reauthorize() revoked stream status = %v, want %v", got, codes.PermissionDenied)
+	}
+	if got := st.Stats().ForcedCancellations; got != 1 {
+		t.Errorf("reauthorize() forced cancellations = %d, want 1", got)
+	}
+}
+
+func TestGRPCHandler_watchPolicyCache(t *testing.T) {
+	var version int32
+	var authorized int32
+	gh := &GRPCHandler{
+		streams: NewStreamTracker(),
+		authorizationd: &service.AuthorizerdMock{
+			GetPolicyCacheFunc: func(ctx context.Context) map[string]interface{} {
+				return map[string]interface{}{
+					"version": atomic.LoadInt32(&version),
+				}
+			},
+			VerifyRoleTokenFunc: func(ctx context.Context, tok, act, res string) (authorizerd.Principal, error) {
+				atomic.AddInt32(&authorized, 1)
+				return nil, errors.New("denied")
+			},
+		},
+	}
+	ts := &trackedStream{cancel: func() {}, cred: credential{token: "token"}, method: "/method"}
+	gh.streams.streams[ts] = struct{}{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go gh.watchPolicyCache(ctx, time.Millisecond*10)
+
+	time.Sleep(time.Millisecond * 50)
+	if got := atomic.LoadInt32(&authorized); got != 0 {
+		t.Errorf("watchPolicyCache() re-authorized %d times without policy change", got)
+	}
+
+	atomic.StoreInt32(&version, 1)
+	time.Sleep(time.Millisecond * 50)
+	if got := atomic.LoadInt32(&authorized); got != 1 {
+		t.Errorf("watchPolicyCache() re-authorized %d times, want 1", got)
+	}
+	if ts.terminated() == nil {
+		t.Error("watchPolicyCache() did not terminate the revoked stream")
+	}
+}
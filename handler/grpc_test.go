@@ -3,6 +3,8 @@ package handler
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"io"
 	"net"
 	"reflect"
@@ -19,7 +21,9 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/emptypb"
 )
@@ -674,6 +678,298 @@ func TestGRPCHandler_dialContext(t *testing.T) {
 	}
 }
 
+func Test_grpcTarget(t *testing.T) {
+	type args struct {
+		cfg config.Proxy
+	}
+	tests := []struct {
+		name  string
+		args  args
+		want  string
+		want1 bool
+	}{
+		{
+			name: "return proxy destination when scheme is gRPC",
+			args: args{
+				cfg: config.Proxy{
+					Scheme: "grpc",
+					Host:   "127.0.0.1",
+					Port:   8080,
+					GRPC: config.GRPCProxy{
+						Enable: true,
+						Host:   "127.0.0.1",
+						Port:   50051,
+					},
+				},
+			},
+			want:  "127.0.0.1:8080",
+			want1: true,
+		},
+		{
+			name: "return gRPC destination in mixed mode",
+			args: args{
+				cfg: config.Proxy{
+					Scheme: "http",
+					Host:   "127.0.0.1",
+					Port:   8080,
+					GRPC: config.GRPCProxy{
+						Enable: true,
+						Host:   "127.0.0.1",
+						Port:   50051,
+					},
+				},
+			},
+			want:  "127.0.0.1:50051",
+			want1: true,
+		},
+		{
+			name: "return resolver target when it is configured",
+			args: args{
+				cfg: config.Proxy{
+					Scheme: "grpc",
+					Host:   "127.0.0.1",
+					Port:   8080,
+					GRPCClient: config.GRPCClient{
+						Target: "dns:///localhost:50051",
+					},
+				},
+			},
+			want:  "dns:///localhost:50051",
+			want1: true,
+		},
+		{
+			name: "return false when gRPC is disabled",
+			args: args{
+				cfg: config.Proxy{
+					Scheme: "http",
+					Host:   "127.0.0.1",
+					Port:   8080,
+				},
+			},
+			want:  "",
+			want1: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, got1 := grpcTarget(tt.args.cfg)
+			if got != tt.want {
+				t.Errorf("grpcTarget() got = %v, want %v", got, tt.want)
+			}
+			if got1 != tt.want1 {
+				t.Errorf("grpcTarget() got1 = %v, want %v", got1, tt.want1)
+			}
+		})
+	}
+}
+
+func TestGRPCHandler_authorize(t *testing.T) {
+	cert := &x509.Certificate{
+		Subject: pkix.Name{
+			CommonName: "domain:role.reader",
+		},
+	}
+	forged := &x509.Certificate{
+		Subject: pkix.Name{
+			CommonName: "victim:role.admin",
+		},
+	}
+	certCtx := peer.NewContext(context.Background(), &peer.Peer{
+		AuthInfo: credentials.TLSInfo{
+			State: tls.ConnectionState{
+				PeerCertificates: []*x509.Certificate{cert, forged},
+				VerifiedChains:   [][]*x509.Certificate{{cert}},
+			},
+		},
+	})
+	unverifiedCtx := peer.NewContext(context.Background(), &peer.Peer{
+		AuthInfo: credentials.TLSInfo{
+			State: tls.ConnectionState{
+				PeerCertificates: []*x509.Certificate{cert},
+			},
+		},
+	})
+	tokenCtx := func(ctx context.Context) context.Context {
+		return metadata.NewIncomingContext(ctx, metadata.Pairs("role-header", "token"))
+	}
+	newAuthorizationd := func(certErr error) service.Authorizationd {
+		return &service.AuthorizerdMock{
+			VerifyRoleCertFunc: func(ctx context.Context, peerCerts []*x509.Certificate, act, res string) (authorizerd.Principal, error) {
+				if certErr != nil {
+					return nil, certErr
+				}
+				return &PrincipalMock{NameFunc: func() string { return "cert" }}, nil
+			},
+			VerifyRoleTokenFunc: func(ctx context.Context, tok, act, res string) (authorizerd.Principal, error) {
+				return &PrincipalMock{NameFunc: func() string { return "token" }}, nil
+			},
+		}
+	}
+	tests := []struct {
+		name     string
+		gh       *GRPCHandler
+		ctx      context.Context
+		wantName string
+		wantCred credential
+		wantCode codes.Code
+	}{
+		{
+			name: "authorize by role certificate",
+			gh: &GRPCHandler{
+				roleCfg:        config.RoleToken{RoleAuthHeader: "role-header"},
+				roleCertCfg:    config.RoleCertificate{Enable: true},
+				authorizationd: newAuthorizationd(nil),
+			},
+			ctx:      tokenCtx(certCtx),
+			wantName: "cert",
+			wantCred: credential{certs: []*x509.Certificate{cert}},
+		},
+		{
+			name: "authorize by role token when role certificate is unauthorized",
+			gh: &GRPCHandler{
+				roleCfg:        config.RoleToken{RoleAuthHeader: "role-header"},
+				roleCertCfg:    config.RoleCertificate{Enable: true},
+				authorizationd: newAuthorizationd(errors.New("role certificates unauthorized")),
+			},
+			ctx:      tokenCtx(certCtx),
+			wantName: "token",
+			wantCred: credential{token: "token"},
+		},
+		{
+			name: "authorize by role token when peer certificate is not verified",
+			gh: &GRPCHandler{
+				roleCfg:        config.RoleToken{RoleAuthHeader: "role-header"},
+				roleCertCfg:    config.RoleCertificate{Enable: true},
+				authorizationd: newAuthorizationd(nil),
+			},
+			ctx:      tokenCtx(unverifiedCtx),
+			wantName: "token",
+			wantCred: credential{token: "token"},
+		},
+		{
+			name: "authorize by role token when role certificate is disabled",
+			gh: &GRPCHandler{
+				roleCfg:        config.RoleToken{RoleAuthHeader: "role-header"},
+				authorizationd: newAuthorizationd(nil),
+			},
+			ctx:      tokenCtx(certCtx),
+			wantName: "token",
+			wantCred: credential{token: "token"},
+		},
+		{
+			name: "return unauthenticated when role certificate is unauthorized and role token not found",
+			gh: &GRPCHandler{
+				roleCfg:        config.RoleToken{RoleAuthHeader: "role-header"},
+				roleCertCfg:    config.RoleCertificate{Enable: true},
+				authorizationd: newAuthorizationd(errors.New("role certificates unauthorized")),
+			},
+			ctx:      certCtx,
+			wantCode: codes.Unauthenticated,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, cred, err := tt.gh.authorize(tt.ctx, "/method")
+			if got := status.Code(err); got != tt.wantCode {
+				t.Errorf("authorize() code = %v, want %v", got, tt.wantCode)
+				return
+			}
+			if err != nil {
+				return
+			}
+			if p.Name() != tt.wantName {
+				t.Errorf("authorize() principal = %s, want %s", p.Name(), tt.wantName)
+			}
+			if !reflect.DeepEqual(cred, tt.wantCred) {
+				t.Errorf("authorize() credential = %+v, want %+v", cred, tt.wantCred)
+			}
+		})
+	}
+}
+
+func Test_grpcDialOptions(t *testing.T) {
+	type args struct {
+		cfg config.GRPCClient
+	}
+	tests := []struct {
+		name    string
+		args    args
+		wantLen int
+	}{
+		{
+			name: "return no option when all parameters are zero",
+			args: args{
+				cfg: config.GRPCClient{},
+			},
+			wantLen: 0,
+		},
+		{
+			name: "return options for all parameters",
+			args: args{
+				cfg: config.GRPCClient{
+					MaxRecvMsgSize:        1024,
+					MaxSendMsgSize:        1024,
+					InitialWindowSize:     1024 * 1024,
+					InitialConnWindowSize: 1024 * 1024,
+					KeepaliveTime:         time.Minute,
+					CallTimeout:           time.Second,
+				},
+			},
+			wantLen: 4,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := grpcDialOptions(tt.args.cfg); len(got) != tt.wantLen {
+				t.Errorf("grpcDialOptions() len = %v, want %v", len(got), tt.wantLen)
+			}
+		})
+	}
+}
+
+func Test_withCallTimeout(t *testing.T) {
+	type args struct {
+		h       grpc.StreamHandler
+		timeout time.Duration
+	}
+	tests := []struct {
+		name    string
+		args    args
+		wantErr error
+	}{
+		{
+			name: "return deadline exceeded when the call takes longer than the timeout",
+			args: args{
+				h: func(srv interface{}, stream grpc.ServerStream) error {
+					<-stream.Context().Done()
+					return stream.Context().Err()
+				},
+				timeout: time.Millisecond * 10,
+			},
+			wantErr: context.DeadlineExceeded,
+		},
+		{
+			name: "return handler result when the call finishes in time",
+			args: args{
+				h: func(srv interface{}, stream grpc.ServerStream) error {
+					return nil
+				},
+				timeout: time.Second,
+			},
+			wantErr: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := withCallTimeout(tt.args.h, tt.args.timeout)
+			err := got(nil, &serverStream{ctx: context.Background()})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("withCallTimeout() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func Test_isHealthy(t *testing.T) {
 	type args struct {
 		conn *grpc.ClientConn
@@ -18,11 +18,13 @@ package handler
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httputil"
+	"strconv"
 	"strings"
 	"time"
 
@@ -37,7 +39,7 @@ import (
 type Func func(http.ResponseWriter, *http.Request) error
 
 // New creates a handler for handling different HTTP requests based on the given services. It also contains a reverse proxy for handling proxy request.
-func New(cfg config.Proxy, bp httputil.BufferPool, prov service.Authorizationd) http.Handler {
+func New(cfg config.Proxy, bp httputil.BufferPool, prov service.Authorizationd, opts ...ProxyOption) http.Handler {
 	scheme := "http"
 	if cfg.Scheme != "" {
 		scheme = cfg.Scheme
@@ -45,20 +47,30 @@ func New(cfg config.Proxy, bp httputil.BufferPool, prov service.Authorizationd)
 
 	host := fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)
 
+	t := &transport{
+		prov:         prov,
+		RoundTripper: NewTransport(cfg.Transport),
+		cfg:          cfg,
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+
 	return &httputil.ReverseProxy{
 		BufferPool: bp,
 		Director: func(r *http.Request) {
 			u := *r.URL
 			u.Scheme = scheme
 			u.Host = host
-			req, err := http.NewRequest(r.Method, u.String(), r.Body)
+			req, err := http.NewRequestWithContext(r.Context(), r.Method, u.String(), r.Body)
 			if err != nil {
-				glg.Error(errors.Wrap(err, "NewRequest returned error"))
+				glg.Errorf("%v, request_id: %s", errors.Wrap(err, "NewRequest returned error"), requestIDFrom(r.Context()))
 				r.URL.Scheme = scheme
 				return
 			}
 			req.Header = r.Header
 			req.TLS = r.TLS
+			req.RemoteAddr = r.RemoteAddr
 			if cfg.PreserveHost {
 				req.Host = r.Host
 				glg.Debugf("proxy.PreserveHost enabled, forward host header: %s\n", req.Host)
@@ -71,16 +83,18 @@ func New(cfg config.Proxy, bp httputil.BufferPool, prov service.Authorizationd)
 
 			*r = *req
 		},
-		Transport: &transport{
-			prov:         prov,
-			RoundTripper: transportFromCfg(cfg.Transport),
-			cfg:          cfg,
+		Transport: t,
+		// the request ID of the proxy is returned instead of the upstream one
+		ModifyResponse: func(res *http.Response) error {
+			res.Header.Del(requestIDHeader(cfg.RequestID))
+			return nil
 		},
 		ErrorHandler: handleError,
 	}
 }
 
-func transportFromCfg(cfg config.Transport) *http.Transport {
+// NewTransport returns the HTTP transport to the proxy destination by the given parameters.
+func NewTransport(cfg config.Transport) *http.Transport {
 	isZero := func(v interface{}) bool {
 		switch v.(type) {
 		case int:
@@ -147,14 +161,49 @@ func handleError(rw http.ResponseWriter, r *http.Request, err error) {
 		io.Copy(ioutil.Discard, r.Body)
 		r.Body.Close()
 	}
+	var id string
+	if r != nil {
+		id = requestIDFrom(r.Context())
+	}
 	status := http.StatusUnauthorized
+	detail := ErrMsgUnverified
 	if !strings.Contains(err.Error(), ErrMsgUnverified) {
-		glg.Warn("handleError: " + err.Error())
+		glg.Warnf("handleError: %s, request_id: %s", err.Error(), id)
 		status = http.StatusBadGateway
+		detail = ErrMsgUpstreamFailed
 	}
 	// request context canceled
 	if errors.Cause(err) == context.Canceled {
 		status = http.StatusRequestTimeout
+		detail = ErrMsgRequestCanceled
+	}
+	// request deadline exceeded, the dial error is not context.DeadlineExceeded but a timeout error
+	if status != http.StatusUnauthorized && (errors.Cause(err) == context.DeadlineExceeded || (r != nil && r.Context().Err() == context.DeadlineExceeded)) {
+		status = http.StatusGatewayTimeout
+		detail = ErrMsgRequestTimeout
 	}
-	rw.WriteHeader(status)
+	p := RFC7807Error{
+		Type:      "about:blank",
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    detail,
+		RequestID: id,
+	}
+	if r != nil {
+		p.Instance = r.URL.Path
+	}
+	writeProblem(rw, p)
+}
+
+// writeProblem writes the RFC 7807 problem details as the error response.
+func writeProblem(rw http.ResponseWriter, p RFC7807Error) {
+	b, err := json.Marshal(p)
+	if err != nil {
+		rw.WriteHeader(p.Status)
+		return
+	}
+	rw.Header().Set("Content-Type", ProblemJSONContentType)
+	rw.Header().Set("Content-Length", strconv.Itoa(len(b)))
+	rw.WriteHeader(p.Status)
+	rw.Write(b)
 }
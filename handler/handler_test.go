@@ -545,7 +545,7 @@ func TestNew(t *testing.T) {
 	}
 }
 
-func Test_transportFromCfg(t *testing.T) {
+func TestNewTransport(t *testing.T) {
 	type args struct {
 		cfg config.Transport
 	}
@@ -599,8 +599,8 @@ func Test_transportFromCfg(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := transportFromCfg(tt.args.cfg); !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("transportFromCfg() = %v, want %v", got, tt.want)
+			if got := NewTransport(tt.args.cfg); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NewTransport() = %v, want %v", got, tt.want)
 			}
 		})
 	}
@@ -669,6 +669,46 @@ func Test_handleError(t *testing.T) {
 				},
 			}
 		}(),
+		func() test {
+			rw := httptest.NewRecorder()
+			return test{
+				name: "handleError status return gateway timeout",
+				args: args{
+					rw:  rw,
+					r:   httptest.NewRequest("GET", "http://127.0.0.1", bytes.NewBufferString("test")),
+					err: errors.Wrap(context.DeadlineExceeded, "upstream"),
+				},
+				checkFunc: func() error {
+					if rw.Code != http.StatusGatewayTimeout {
+						return errors.Errorf("invalid status code: %v", rw.Code)
+					}
+					var p RFC7807Error
+					if err := json.Unmarshal(rw.Body.Bytes(), &p); err != nil || p.Detail != ErrMsgRequestTimeout {
+						return errors.Errorf("invalid body: %s", rw.Body.String())
+					}
+					return nil
+				},
+			}
+		}(),
+		func() test {
+			rw := httptest.NewRecorder()
+			ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+			defer cancel()
+			return test{
+				name: "handleError status return gateway timeout when request deadline exceeded",
+				args: args{
+					rw:  rw,
+					r:   httptest.NewRequest("GET", "http://127.0.0.1", nil).WithContext(ctx),
+					err: errors.New("dial tcp 127.0.0.1:80: i/o timeout"),
+				},
+				checkFunc: func() error {
+					if rw.Code != http.StatusGatewayTimeout {
+						return errors.Errorf("invalid status code: %v", rw.Code)
+					}
+					return nil
+				},
+			}
+		}(),
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
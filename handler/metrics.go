@@ -0,0 +1,85 @@
+/*
+Copyright (C)  2018 Yahoo Japan Corporation Athenz team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+
+	"github.com/yahoojapan/authorization-proxy/v4/service"
+)
+
+// record records the observation to the metrics.
+func (o *observation) record(m *service.Metrics, protocol string) {
+	if o.decision != service.DecisionSkipped && o.decision != service.DecisionShed && o.decision != "" {
+		m.ObserveAuthorization(protocol, o.decision, o.authzDuration)
+	}
+	if o.upstream {
+		m.ObserveUpstream(protocol, o.upstreamDuration, o.upstreamFailed)
+	}
+}
+
+// NewMetricsHandler returns a handler which records the request metrics of the given proxy handler. It returns the given handler if the metrics are disabled.
+func NewMetricsHandler(h http.Handler, m *service.Metrics) http.Handler {
+	if m == nil {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ctx, o := withObservation(r.Context())
+		rw := newResponseRecorder(w)
+
+		h.ServeHTTP(rw, r.WithContext(ctx))
+
+		decision := o.decision
+		// the request failed before the authorization
+		if decision == "" {
+			decision = service.DecisionDenied
+		}
+		o.record(m, "http")
+		m.ObserveRequest(m.Route(r.URL.Path), decision, rw.status, time.Since(start))
+	})
+}
+
+// withMetrics returns a stream handler which records the gRPC call metrics.
+func withMetrics(h grpc.StreamHandler, m *service.Metrics) grpc.StreamHandler {
+	return func(srv interface{}, stream grpc.ServerStream) error {
+		start := time.Now()
+		ctx, o := withObservation(stream.Context())
+
+		err := h(srv, &serverStream{
+			ServerStream: stream,
+			ctx:          ctx,
+		})
+
+		code := status.Code(err)
+		o.grpcDone(code, err)
+		o.record(m, gRPC)
+
+		method, ok := grpc.MethodFromServerStream(stream)
+		if !ok {
+			method = "unknown"
+		} else {
+			method = m.GRPCMethod(method)
+		}
+		m.ObserveGRPCCall(method, code, time.Since(start))
+		return err
+	}
+}
@@ -0,0 +1,170 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	authorizerd "github.com/yahoojapan/athenz-authorizer/v5"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/yahoojapan/authorization-proxy/v4/config"
+	"github.com/yahoojapan/authorization-proxy/v4/service"
+)
+
+func scrape(t *testing.T, m *service.Metrics) string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	return w.Body.String()
+}
+
+func TestNewMetricsHandler(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer upstream.Close()
+	u, _ := url.Parse(upstream.URL)
+	port, _ := strconv.Atoi(u.Port())
+
+	m := service.NewMetrics(config.Metrics{
+		Enable: true,
+		Routes: []string{"/api"},
+	})
+	h := NewMetricsHandler(New(config.Proxy{
+		Host:                   u.Hostname(),
+		Port:                   uint16(port),
+		OriginHealthCheckPaths: []string{"/healthz"},
+	}, nil, &service.AuthorizerdMock{
+		VerifyFunc: func(r *http.Request, act, res string) (authorizerd.Principal, error) {
+			if res == "/api/denied" {
+				return nil, errors.New("denied")
+			}
+			return &PrincipalMock{
+				NameFunc:       func() string { return "principal" },
+				RolesFunc:      func() []string { return nil },
+				DomainFunc:     func() string { return "domain" },
+				IssueTimeFunc:  func() int64 { return 0 },
+				ExpiryTimeFunc: func() int64 { return 0 },
+			}, nil
+		},
+	}), m)
+
+	for _, path := range []string{"/api/allowed", "/api/denied", "/healthz"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	body := scrape(t, m)
+	for _, want := range []string{
+		`authz_proxy_http_requests_total{decision="allowed",route="/api",status="202"} 1`,
+		`authz_proxy_http_requests_total{decision="denied",route="/api",status="401"} 1`,
+		`authz_proxy_http_requests_total{decision="skipped",route="other",status="202"} 1`,
+		`authz_proxy_authorization_duration_seconds_count{decision="allowed",protocol="http"} 1`,
+		`authz_proxy_authorization_duration_seconds_count{decision="denied",protocol="http"} 1`,
+		`authz_proxy_upstream_duration_seconds_count{protocol="http"} 2`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics do not contain %s\n%s", want, body)
+		}
+	}
+
+	if got := NewMetricsHandler(h, nil); got == nil {
+		t.Error("NewMetricsHandler() returned nil when metrics are disabled")
+	}
+}
+
+// methodTransportStream represents the server transport stream of the gRPC method.
+type methodTransportStream struct {
+	grpc.ServerTransportStream
+	method string
+}
+
+func (s *methodTransportStream) Method() string {
+	return s.method
+}
+
+func Test_withMetrics(t *testing.T) {
+	m := service.NewMetrics(config.Metrics{
+		Enable:      true,
+		GRPCMethods: []string{"/pkg.Service/"},
+	})
+	tests := []struct {
+		name   string
+		method string
+		h      grpc.StreamHandler
+		want   []string
+	}{
+		{
+			name: "record authorized call with upstream failure",
+			h: func(srv interface{}, stream grpc.ServerStream) error {
+				o := observationFrom(stream.Context())
+				o.authorized(time.Now(), nil, nil)
+				o.upstreamStarted()
+				return status.Error(codes.Unavailable, "upstream unavailable")
+			},
+			want: []string{
+				`authz_proxy_grpc_calls_total{code="Unavailable",method="unknown"} 1`,
+				`authz_proxy_authorization_duration_seconds_count{decision="allowed",protocol="grpc"} 1`,
+				`authz_proxy_upstream_errors_total{protocol="grpc"} 1`,
+			},
+		},
+		{
+			name: "record denied call",
+			h: func(srv interface{}, stream grpc.ServerStream) error {
+				observationFrom(stream.Context()).authorized(time.Now(), nil, errors.New("denied"))
+				return status.Error(codes.Unauthenticated, "denied")
+			},
+			want: []string{
+				`authz_proxy_grpc_calls_total{code="Unauthenticated",method="unknown"} 1`,
+				`authz_proxy_authorization_duration_seconds_count{decision="denied",protocol="grpc"} 1`,
+			},
+		},
+		{
+			name:   "record the call of the configured method",
+			method: "/pkg.Service/Get",
+			h: func(srv interface{}, stream grpc.ServerStream) error {
+				return nil
+			},
+			want: []string{
+				`authz_proxy_grpc_calls_total{code="OK",method="/pkg.Service/"} 1`,
+			},
+		},
+		{
+			name:   "record the denied call of the unknown method as other",
+			method: "/random.Service/a8f3c1",
+			h: func(srv interface{}, stream grpc.ServerStream) error {
+				observationFrom(stream.Context()).authorized(time.Now(), nil, errors.New("denied"))
+				return status.Error(codes.Unauthenticated, "denied")
+			},
+			want: []string{
+				`authz_proxy_grpc_calls_total{code="Unauthenticated",method="other"} 1`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.method != "" {
+				ctx = grpc.NewContextWithServerTransportStream(ctx, &methodTransportStream{method: tt.method})
+			}
+			withMetrics(tt.h, m)(nil, &serverStream{ctx: ctx})
+			body := scrape(t, m)
+			for _, want := range tt.want {
+				if !strings.Contains(body, want) {
+					t.Errorf("metrics do not contain %s", want)
+				}
+			}
+			if strings.Contains(body, "a8f3c1") {
+				t.Error("metrics contain the method name not configured")
+			}
+		})
+	}
+}
@@ -0,0 +1,207 @@
+/*
+Copyright (C)  2018 Yahoo Japan Corporation Athenz team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	authorizerd "github.com/yahoojapan/athenz-authorizer/v5"
+	"google.golang.org/grpc/codes"
+
+	"github.com/yahoojapan/authorization-proxy/v4/service"
+)
+
+// observation holds the authorization and upstream results of a proxied request, which are recorded to the metrics and the access log when the request completes.
+// All methods are safe to call on a nil *observation, which does nothing.
+type observation struct {
+	decision      string
+	reason        string
+	principal     authorizerd.Principal
+	authzDuration time.Duration
+
+	upstream         bool
+	upstreamStart    time.Time
+	upstreamDuration time.Duration
+	upstreamStatus   int
+	upstreamFailed   bool
+	upstreamFinished bool
+}
+
+type observationKey struct{}
+
+// withObservation returns the context with the observation of the request, the existing observation is shared if the context already has one.
+func withObservation(ctx context.Context) (context.Context, *observation) {
+	if o := observationFrom(ctx); o != nil {
+		return ctx, o
+	}
+	o := new(observation)
+	return context.WithValue(ctx, observationKey{}, o), o
+}
+
+// observationFrom returns the observation of the request context, or nil if the request is not observed.
+func observationFrom(ctx context.Context) *observation {
+	o, _ := ctx.Value(observationKey{}).(*observation)
+	return o
+}
+
+// skipped records that the authorization is skipped.
+func (o *observation) skipped() {
+	if o == nil {
+		return
+	}
+	o.decision = service.DecisionSkipped
+}
+
+// shed records that the request is shed by the overload limits.
+func (o *observation) shed(err error) {
+	if o == nil {
+		return
+	}
+	o.decision = service.DecisionShed
+	o.reason = err.Error()
+}
+
+// authorized records the authorization result.
+func (o *observation) authorized(start time.Time, p authorizerd.Principal, err error) {
+	if o == nil {
+		return
+	}
+	o.authzDuration = time.Since(start)
+	if err != nil {
+		o.decision = service.DecisionDenied
+		o.reason = err.Error()
+		return
+	}
+	o.decision = service.DecisionAllowed
+	o.principal = p
+}
+
+// upstreamStarted records the start of the upstream request.
+func (o *observation) upstreamStarted() {
+	if o == nil {
+		return
+	}
+	o.upstream = true
+	o.upstreamStart = time.Now()
+}
+
+// upstreamDone records the result of the upstream request, only the first result is recorded.
+func (o *observation) upstreamDone(status int, err error) {
+	if o == nil || !o.upstream || o.upstreamFinished {
+		return
+	}
+	o.upstreamFinished = true
+	o.upstreamDuration = time.Since(o.upstreamStart)
+	o.upstreamStatus = status
+	if err != nil {
+		o.upstreamFailed = true
+		if o.reason == "" {
+			o.reason = err.Error()
+		}
+	}
+}
+
+// grpcDone records the result of the proxied gRPC call.
+func (o *observation) grpcDone(code codes.Code, err error) {
+	if !isUpstreamError(code) {
+		err = nil
+	}
+	o.upstreamDone(int(code), err)
+}
+
+// isUpstreamError returns whether the status code of the proxied call represents the upstream failure.
+func isUpstreamError(code codes.Code) bool {
+	switch code {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Internal, codes.Unknown:
+		return true
+	default:
+		return false
+	}
+}
+
+// countingReader counts the bytes read from the request body.
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+// Read reads from the underlying reader and counts the bytes.
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	atomic.AddInt64(&r.n, int64(n))
+	return n, err
+}
+
+func newResponseRecorder(w http.ResponseWriter) *responseRecorder {
+	return &responseRecorder{
+		ResponseWriter: w,
+		status:         http.StatusOK,
+	}
+}
+
+// responseRecorder records the status code and the bytes written to the http.ResponseWriter.
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	written     int64
+}
+
+// WriteHeader records the status code and writes it to the underlying writer.
+func (w *responseRecorder) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.status = code
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Write writes the data to the underlying writer.
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	n, err := w.ResponseWriter.Write(b)
+	w.written += int64(n)
+	return n, err
+}
+
+// Flush implements http.Flusher for the streaming responses.
+func (w *responseRecorder) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker for the protocol upgrade.
+func (w *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("http.Hijacker is not supported")
+	}
+	return h.Hijack()
+}
+
+// Unwrap returns the underlying writer for http.ResponseController.
+func (w *responseRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
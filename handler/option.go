@@ -0,0 +1,24 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/yahoojapan/authorization-proxy/v4/service"
+)
+
+// ProxyOption represents a functional option for the HTTP reverse proxy
+type ProxyOption func(*transport)
+
+// WithProxyAuditLogger returns a audit logger functional option of the HTTP reverse proxy
+func WithProxyAuditLogger(a *service.AuditLogger) ProxyOption {
+	return func(t *transport) {
+		t.audit = a
+	}
+}
+
+// WithProxyTransport returns a transport functional option of the HTTP reverse proxy, which replaces the transport of the proxy configuration
+func WithProxyTransport(rt *http.Transport) ProxyOption {
+	return func(t *transport) {
+		t.RoundTripper = rt
+	}
+}
@@ -0,0 +1,28 @@
+package handler
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/yahoojapan/authorization-proxy/v4/config"
+)
+
+func TestWithProxyAuditLogger(t *testing.T) {
+	a, _ := newTestAuditLogger(t, config.Audit{})
+	defer a.Close()
+
+	tr := &transport{}
+	WithProxyAuditLogger(a)(tr)
+	if tr.audit != a {
+		t.Error("audit logger not match")
+	}
+}
+
+func TestWithProxyTransport(t *testing.T) {
+	rt := &http.Transport{}
+	tr := &transport{}
+	WithProxyTransport(rt)(tr)
+	if tr.RoundTripper != rt {
+		t.Error("transport not match")
+	}
+}
@@ -0,0 +1,148 @@
+/*
+Copyright (C)  2018 Yahoo Japan Corporation Athenz team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/yahoojapan/authorization-proxy/v4/service"
+)
+
+// grpcRetryPushbackKey represents the trailer which tells the gRPC client when to retry the shed call.
+const grpcRetryPushbackKey = "grpc-retry-pushback-ms"
+
+// NewOverloadHandler returns a handler which limits the in-flight requests, or the given handler if the limiter is nil.
+// The shed requests are answered with 503 Service Unavailable and the Retry-After header before the authorization.
+func NewOverloadHandler(h http.Handler, l *service.Limiter) http.Handler {
+	if l == nil {
+		return h
+	}
+	retryAfter := retryAfterSeconds(l.RetryAfter())
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, o := withObservation(r.Context())
+		r = r.WithContext(ctx)
+		p, err := l.Acquire(ctx, service.UpstreamHTTP)
+		if err != nil {
+			if _, ok := err.(*service.ShedError); !ok {
+				handleError(w, r, err)
+				return
+			}
+			o.shed(err)
+			if retryAfter != "" {
+				w.Header().Set("Retry-After", retryAfter)
+			}
+			writeProblem(w, RFC7807Error{
+				Type:      "about:blank",
+				Title:     http.StatusText(http.StatusServiceUnavailable),
+				Status:    http.StatusServiceUnavailable,
+				Detail:    ErrMsgOverloaded,
+				Instance:  r.URL.Path,
+				RequestID: requestIDFrom(ctx),
+			})
+			return
+		}
+
+		// released on the panic too, e.g. http.ErrAbortHandler of the reverse proxy when the client goes away
+		defer func() {
+			p.Release(o.upstreamDuration, o.upstreamFailed)
+		}()
+		h.ServeHTTP(w, r)
+	})
+}
+
+// withOverload returns a stream handler which limits the in-flight calls.
+// The shed calls fail with codes.Unavailable, and the retry pushback trailer tells the client when to retry.
+func withOverload(h grpc.StreamHandler, l *service.Limiter) grpc.StreamHandler {
+	pushback := strconv.FormatInt(l.RetryAfter().Milliseconds(), 10)
+	return func(srv interface{}, stream grpc.ServerStream) error {
+		ctx, o := withObservation(stream.Context())
+		p, err := l.Acquire(ctx, service.UpstreamGRPC)
+		if err != nil {
+			if _, ok := err.(*service.ShedError); !ok {
+				return status.FromContextError(err).Err()
+			}
+			o.shed(err)
+			stream.SetTrailer(metadata.Pairs(grpcRetryPushbackKey, pushback))
+			return status.Error(codes.Unavailable, ErrMsgOverloaded)
+		}
+
+		cs := &countingStream{
+			serverStream: serverStream{
+				ServerStream: stream,
+				ctx:          ctx,
+			},
+		}
+		var latency time.Duration
+		defer func() {
+			p.Release(latency, o.upstreamFailed)
+		}()
+		err = h(srv, cs)
+		o.grpcDone(status.Code(err), err)
+		// the duration of the streams depends on the lifetime of the streams rather than the upstream load, so only the unary calls adjust the adaptive limit
+		if cs.unary() {
+			latency = o.upstreamDuration
+		}
+		return err
+	}
+}
+
+// countingStream counts the messages of the call, to tell the unary calls from the streams.
+type countingStream struct {
+	serverStream
+	recv int32
+	sent int32
+}
+
+// RecvMsg receives a message from the client and counts it.
+func (s *countingStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		atomic.AddInt32(&s.recv, 1)
+	}
+	return err
+}
+
+// SendMsg sends a message to the client and counts it.
+func (s *countingStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		atomic.AddInt32(&s.sent, 1)
+	}
+	return err
+}
+
+// unary returns whether the call has at most one request and one response message.
+func (s *countingStream) unary() bool {
+	return atomic.LoadInt32(&s.recv) <= 1 && atomic.LoadInt32(&s.sent) <= 1
+}
+
+// retryAfterSeconds returns the value of the Retry-After header rounded up to seconds, or empty if the duration is not positive.
+func retryAfterSeconds(d time.Duration) string {
+	if d <= 0 {
+		return ""
+	}
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,251 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/yahoojapan/authorization-proxy/v4/config"
+	"github.com/yahoojapan/authorization-proxy/v4/service"
+)
+
+func TestNewOverloadHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		cfg            config.Overload
+		wantStatus     int
+		wantRetryAfter string
+	}{
+		{
+			name: "serve the request within the limit",
+			cfg: config.Overload{
+				Enable:                true,
+				MaxConcurrentRequests: 2,
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "shed the request beyond the limit",
+			cfg: config.Overload{
+				Enable:                true,
+				MaxConcurrentRequests: 1,
+				RetryAfter:            "1500ms",
+			},
+			wantStatus:     http.StatusServiceUnavailable,
+			wantRetryAfter: "2",
+		},
+		{
+			name: "shed the request without Retry-After",
+			cfg: config.Overload{
+				Enable: true,
+				Upstreams: config.OverloadUpstreams{
+					HTTP: 1,
+				},
+				RetryAfter: "0s",
+			},
+			wantStatus: http.StatusServiceUnavailable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := service.NewLimiter(tt.cfg, nil)
+			// hold a slot by another request
+			p, err := l.Acquire(context.Background(), service.UpstreamHTTP)
+			if err != nil {
+				t.Fatalf("Acquire() error = %v", err)
+			}
+			defer p.Release(0, false)
+
+			var decision string
+			oh := NewOverloadHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}), l)
+			h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				ctx, o := withObservation(r.Context())
+				oh.ServeHTTP(w, r.WithContext(ctx))
+				decision = o.decision
+			})
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api", nil))
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get("Retry-After"); got != tt.wantRetryAfter {
+				t.Errorf("Retry-After = %q, want %q", got, tt.wantRetryAfter)
+			}
+			if tt.wantStatus != http.StatusServiceUnavailable {
+				return
+			}
+			if decision != service.DecisionShed {
+				t.Errorf("decision = %s, want %s", decision, service.DecisionShed)
+			}
+			var got RFC7807Error
+			if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+				t.Fatalf("decode error = %v", err)
+			}
+			if got.Detail != ErrMsgOverloaded || got.Instance != "/api" {
+				t.Errorf("problem = %+v", got)
+			}
+		})
+	}
+
+	t.Run("release the slot when the handler panics", func(t *testing.T) {
+		l := service.NewLimiter(config.Overload{
+			Enable:                true,
+			MaxConcurrentRequests: 1,
+		}, nil)
+		h := NewOverloadHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic(http.ErrAbortHandler)
+		}), l)
+		func() {
+			defer func() {
+				if r := recover(); r != http.ErrAbortHandler {
+					t.Errorf("recover() = %v, want %v", r, http.ErrAbortHandler)
+				}
+			}()
+			h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api", nil))
+		}()
+
+		p, err := l.Acquire(context.Background(), service.UpstreamHTTP)
+		if err != nil {
+			t.Fatalf("Acquire() error = %v, want the released slot", err)
+		}
+		p.Release(0, false)
+	})
+
+	h := http.NotFoundHandler()
+	if got := NewOverloadHandler(h, nil); got == nil {
+		t.Error("NewOverloadHandler() = nil, want the given handler")
+	}
+}
+
+func Test_withOverload(t *testing.T) {
+	l := service.NewLimiter(config.Overload{
+		Enable: true,
+		Upstreams: config.OverloadUpstreams{
+			GRPC: 1,
+		},
+		RetryAfter: "2s",
+	}, nil)
+	var inner grpc.ServerStream
+	h := withOverload(func(srv interface{}, stream grpc.ServerStream) error {
+		inner = stream
+		return nil
+	}, l)
+
+	if err := h(nil, &testServerStream{ctx: context.Background()}); err != nil {
+		t.Fatalf("withOverload() error = %v", err)
+	}
+	if observationFrom(inner.Context()) == nil {
+		t.Error("stream context does not have the observation")
+	}
+
+	p, _ := l.Acquire(context.Background(), service.UpstreamGRPC)
+	defer p.Release(0, false)
+	ss := &testServerStream{ctx: context.Background()}
+	err := h(nil, ss)
+	if got := status.Code(err); got != codes.Unavailable {
+		t.Errorf("withOverload() code = %v, want %v", got, codes.Unavailable)
+	}
+	if got := ss.trailer.Get(grpcRetryPushbackKey); len(got) != 1 || got[0] != "2000" {
+		t.Errorf("trailer %s = %v, want [2000]", grpcRetryPushbackKey, got)
+	}
+
+	// the slot is released when the handler panics
+	p.Release(0, false)
+	func() {
+		defer func() {
+			if r := recover(); r == nil {
+				t.Error("recover() = nil, want the panic")
+			}
+		}()
+		_ = withOverload(func(interface{}, grpc.ServerStream) error {
+			panic("stream handler panic")
+		}, l)(nil, &testServerStream{ctx: context.Background()})
+	}()
+	if p, err := l.Acquire(context.Background(), service.UpstreamGRPC); err != nil {
+		t.Errorf("Acquire() error = %v, want the released slot", err)
+	} else {
+		p.Release(0, false)
+	}
+
+	// the call canceled while waiting is not shed
+	l = service.NewLimiter(config.Overload{
+		Enable:                true,
+		MaxConcurrentRequests: 1,
+		QueueSize:             1,
+		QueueTimeout:          "1s",
+	}, nil)
+	p, _ = l.Acquire(context.Background(), service.UpstreamGRPC)
+	defer p.Release(0, false)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err = withOverload(func(interface{}, grpc.ServerStream) error { return nil }, l)(nil, &testServerStream{ctx: ctx})
+	if got := status.Code(err); got != codes.DeadlineExceeded {
+		t.Errorf("withOverload() code = %v, want %v", got, codes.DeadlineExceeded)
+	}
+}
+
+// msgServerStream represents the stream which sends and receives the messages successfully.
+type msgServerStream struct {
+	testServerStream
+}
+
+func (s *msgServerStream) RecvMsg(m interface{}) error {
+	return nil
+}
+
+func (s *msgServerStream) SendMsg(m interface{}) error {
+	return nil
+}
+
+func Test_withOverload_adaptive(t *testing.T) {
+	m := service.NewMetrics(config.Metrics{
+		Enable: true,
+	})
+	l := service.NewLimiter(config.Overload{
+		Enable: true,
+		Upstreams: config.OverloadUpstreams{
+			GRPC: 10,
+		},
+		Adaptive: config.AdaptiveLimit{
+			Enable: true,
+		},
+	}, m)
+	call := func(msgs int, d time.Duration) {
+		err := withOverload(func(srv interface{}, stream grpc.ServerStream) error {
+			observationFrom(stream.Context()).upstreamStarted()
+			for i := 0; i < msgs; i++ {
+				stream.RecvMsg(nil)
+				stream.SendMsg(nil)
+			}
+			time.Sleep(d)
+			return nil
+		}, l)(nil, &msgServerStream{testServerStream{ctx: context.Background()}})
+		if err != nil {
+			t.Fatalf("withOverload() error = %v", err)
+		}
+	}
+	limit := `authz_proxy_overload_limit{limit="grpc"} `
+
+	call(1, time.Millisecond)
+	// the long-lived stream does not decrease the limit
+	call(5, 50*time.Millisecond)
+	if body := scrape(t, m); !strings.Contains(body, limit+"10") {
+		t.Errorf("limit after the stream is not 10\n%s", body)
+	}
+	// the slow unary call decreases the limit
+	call(1, 50*time.Millisecond)
+	if body := scrape(t, m); !strings.Contains(body, limit+"9") {
+		t.Errorf("limit after the slow unary call is not 9\n%s", body)
+	}
+}
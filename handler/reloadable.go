@@ -0,0 +1,50 @@
+/*
+Copyright (C)  2018 Yahoo Japan Corporation Athenz team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+// ReloadableHandler serves the requests by the current handler, which can be replaced on the configuration reload.
+// The in-flight requests complete on the previous handler.
+type ReloadableHandler struct {
+	h atomic.Value // *handlerHolder
+}
+
+// handlerHolder holds the handler, since atomic.Value requires the same concrete type.
+type handlerHolder struct {
+	http.Handler
+}
+
+// NewReloadableHandler returns the ReloadableHandler serving the given handler.
+func NewReloadableHandler(h http.Handler) *ReloadableHandler {
+	r := new(ReloadableHandler)
+	r.Store(h)
+	return r
+}
+
+// Store replaces the current handler.
+func (r *ReloadableHandler) Store(h http.Handler) {
+	r.h.Store(&handlerHolder{h})
+}
+
+// ServeHTTP serves the request by the current handler.
+func (r *ReloadableHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.h.Load().(*handlerHolder).ServeHTTP(w, req)
+}
@@ -0,0 +1,24 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReloadableHandler(t *testing.T) {
+	status := func(code int) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(code)
+		})
+	}
+	h := NewReloadableHandler(status(http.StatusOK))
+	for _, want := range []int{http.StatusOK, http.StatusAccepted} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		if w.Code != want {
+			t.Errorf("status = %d, want %d", w.Code, want)
+		}
+		h.Store(status(http.StatusAccepted))
+	}
+}
@@ -0,0 +1,129 @@
+/*
+Copyright (C)  2018 Yahoo Japan Corporation Athenz team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/yahoojapan/authorization-proxy/v4/config"
+)
+
+const (
+	// DefaultRequestIDHeader represents the default header of the request ID.
+	DefaultRequestIDHeader = "X-Request-ID"
+
+	// maxRequestIDLength represents the maximum length of the trusted incoming request ID.
+	maxRequestIDLength = 128
+)
+
+type requestIDKey struct{}
+
+// requestIDFrom returns the request ID of the request context, or empty string if it is not assigned.
+func requestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// requestIDHeader returns the header name of the request ID.
+func requestIDHeader(cfg config.RequestID) string {
+	if cfg.Header == "" {
+		return DefaultRequestIDHeader
+	}
+	return cfg.Header
+}
+
+// NewRequestIDHandler returns a handler which assigns the request ID to the request.
+// The request ID is set to the request header forwarded to the upstream, and to the response header.
+func NewRequestIDHandler(h http.Handler, cfg config.RequestID) http.Handler {
+	header := requestIDHeader(cfg)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(header)
+		if !cfg.TrustIncoming || !validRequestID(id) {
+			id = newRequestID()
+		}
+		r.Header.Set(header, id)
+		w.Header().Set(header, id)
+
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// withRequestID returns a stream handler which assigns the request ID to the gRPC call.
+// The request ID is returned in the response header metadata, and the director forwards it to the upstream.
+func withRequestID(h grpc.StreamHandler, cfg config.RequestID) grpc.StreamHandler {
+	key := strings.ToLower(requestIDHeader(cfg))
+	return func(srv interface{}, stream grpc.ServerStream) error {
+		var id string
+		if md, ok := metadata.FromIncomingContext(stream.Context()); ok && cfg.TrustIncoming {
+			if ids := md.Get(key); len(ids) > 0 && validRequestID(ids[0]) {
+				id = ids[0]
+			}
+		}
+		if id == "" {
+			id = newRequestID()
+		}
+		_ = stream.SetHeader(metadata.Pairs(key, id))
+
+		return h(srv, &serverStream{
+			ServerStream: stream,
+			ctx:          context.WithValue(stream.Context(), requestIDKey{}, id),
+		})
+	}
+}
+
+// newRequestID returns a random UUID version 4.
+func newRequestID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		// crypto/rand never fails on the supported platforms
+		panic(err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+
+	buf := make([]byte, 36)
+	hex.Encode(buf[0:8], b[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], b[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], b[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], b[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], b[10:])
+	return string(buf)
+}
+
+// validRequestID returns whether the incoming request ID is safe to log and forward, i.e. not empty, not too long and only printable ASCII characters without spaces.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
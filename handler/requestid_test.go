@@ -0,0 +1,217 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/yahoojapan/authorization-proxy/v4/config"
+)
+
+// testServerStream is a grpc.ServerStream recording the header and trailer metadata.
+type testServerStream struct {
+	grpc.ServerStream
+	ctx     context.Context
+	header  metadata.MD
+	trailer metadata.MD
+}
+
+func (s *testServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *testServerStream) SetHeader(md metadata.MD) error {
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+
+func (s *testServerStream) SetTrailer(md metadata.MD) {
+	s.trailer = metadata.Join(s.trailer, md)
+}
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestNewRequestIDHandler(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      config.RequestID
+		incoming string
+		header   string
+		want     string
+	}{
+		{
+			name: "generate the request ID",
+		},
+		{
+			name:     "ignore the incoming request ID if it is not trusted",
+			incoming: "incoming-id",
+		},
+		{
+			name: "use the trusted incoming request ID",
+			cfg: config.RequestID{
+				TrustIncoming: true,
+			},
+			incoming: "incoming-id",
+			want:     "incoming-id",
+		},
+		{
+			name: "generate the request ID if the trusted incoming request ID is invalid",
+			cfg: config.RequestID{
+				TrustIncoming: true,
+			},
+			incoming: "incoming id\n",
+		},
+		{
+			name: "use the configured header",
+			cfg: config.RequestID{
+				Header:        "X-Correlation-ID",
+				TrustIncoming: true,
+			},
+			incoming: "incoming-id",
+			header:   "X-Correlation-ID",
+			want:     "incoming-id",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := tt.header
+			if header == "" {
+				header = DefaultRequestIDHeader
+			}
+			var gotCtx, gotHeader string
+			h := NewRequestIDHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotCtx = requestIDFrom(r.Context())
+				gotHeader = r.Header.Get(header)
+			}), tt.cfg)
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.incoming != "" {
+				r.Header.Set(header, tt.incoming)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if tt.want != "" && gotCtx != tt.want {
+				t.Errorf("request ID = %s, want %s", gotCtx, tt.want)
+			}
+			if tt.want == "" && !uuidPattern.MatchString(gotCtx) {
+				t.Errorf("request ID = %s, want a generated UUID", gotCtx)
+			}
+			if gotHeader != gotCtx || w.Header().Get(header) != gotCtx {
+				t.Errorf("request header = %s, response header = %s, want %s", gotHeader, w.Header().Get(header), gotCtx)
+			}
+		})
+	}
+}
+
+func Test_withRequestID(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      config.RequestID
+		incoming string
+		want     string
+	}{
+		{
+			name:     "generate the request ID",
+			incoming: "incoming-id",
+		},
+		{
+			name: "use the trusted incoming request ID",
+			cfg: config.RequestID{
+				TrustIncoming: true,
+			},
+			incoming: "incoming-id",
+			want:     "incoming-id",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			h := withRequestID(func(srv interface{}, stream grpc.ServerStream) error {
+				got = requestIDFrom(stream.Context())
+				return nil
+			}, tt.cfg)
+
+			stream := &testServerStream{
+				ctx: metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-request-id", tt.incoming)),
+			}
+			if err := h(nil, stream); err != nil {
+				t.Fatal(err)
+			}
+			if tt.want != "" && got != tt.want {
+				t.Errorf("request ID = %s, want %s", got, tt.want)
+			}
+			if tt.want == "" && !uuidPattern.MatchString(got) {
+				t.Errorf("request ID = %s, want a generated UUID", got)
+			}
+			if ids := stream.header.Get("x-request-id"); len(ids) != 1 || ids[0] != got {
+				t.Errorf("response header = %v, want %s", ids, got)
+			}
+		})
+	}
+}
+
+func TestNew_requestID(t *testing.T) {
+	var forwarded string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r.Header.Get(DefaultRequestIDHeader)
+		w.Header().Set(DefaultRequestIDHeader, "upstream-id")
+	}))
+	defer upstream.Close()
+	u, _ := url.Parse(upstream.URL)
+	port, _ := strconv.Atoi(u.Port())
+
+	h := NewRequestIDHandler(New(config.Proxy{
+		Host:                   u.Hostname(),
+		Port:                   uint16(port),
+		OriginHealthCheckPaths: []string{"/healthz"},
+	}, nil, nil), config.RequestID{})
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	got := w.Header().Values(DefaultRequestIDHeader)
+	if len(got) != 1 || got[0] != forwarded || !uuidPattern.MatchString(forwarded) {
+		t.Errorf("response request ID = %v, forwarded request ID = %s", got, forwarded)
+	}
+}
+
+func Test_handleError_problem(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/api", nil)
+	r = r.WithContext(context.WithValue(r.Context(), requestIDKey{}, "req-1"))
+	w := httptest.NewRecorder()
+	handleError(w, r, errors.New(ErrMsgUnverified))
+
+	if got := w.Header().Get("Content-Type"); got != ProblemJSONContentType {
+		t.Errorf("Content-Type = %s, want %s", got, ProblemJSONContentType)
+	}
+	var got RFC7807Error
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := RFC7807Error{
+		Type:      "about:blank",
+		Title:     "Unauthorized",
+		Status:    http.StatusUnauthorized,
+		Detail:    ErrMsgUnverified,
+		Instance:  "/api",
+		RequestID: "req-1",
+	}
+	if got.Type != want.Type || got.Title != want.Title || got.Status != want.Status || got.Detail != want.Detail ||
+		got.Instance != want.Instance || got.RequestID != want.RequestID {
+		t.Errorf("handleError() body = %+v, want %+v", got, want)
+	}
+	if strings.Contains(w.Body.String(), "role_token") {
+		t.Errorf("handleError() body contains the empty role token: %s", w.Body.String())
+	}
+}
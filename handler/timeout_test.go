@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	authorizerd "github.com/yahoojapan/athenz-authorizer/v5"
+
+	"github.com/yahoojapan/authorization-proxy/v4/config"
+	"github.com/yahoojapan/authorization-proxy/v4/infra"
+	"github.com/yahoojapan/authorization-proxy/v4/service"
+)
+
+func TestNewTimeoutHandler(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(time.Second):
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+	u, _ := url.Parse(backend.URL)
+	host, port := splitTestAddr(t, u.Host)
+
+	proxy := New(config.Proxy{
+		Host: host,
+		Port: port,
+	}, infra.NewBuffer(64), &service.AuthorizerdMock{
+		VerifyFunc: func(r *http.Request, act, res string) (authorizerd.Principal, error) {
+			return &PrincipalMock{
+				NameFunc: func() string {
+					return "principal"
+				},
+				RolesFunc: func() []string {
+					return []string{"role"}
+				},
+				DomainFunc: func() string {
+					return "domain"
+				},
+				IssueTimeFunc: func() int64 {
+					return 1595908257
+				},
+				ExpiryTimeFunc: func() int64 {
+					return 1595908265
+				},
+			}, nil
+		},
+	})
+
+	tests := []struct {
+		name       string
+		timeout    time.Duration
+		path       string
+		wantStatus int
+	}{
+		{
+			name:       "return the upstream response in time",
+			timeout:    time.Second,
+			path:       "/fast",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "return gateway timeout when the upstream is too slow",
+			timeout:    50 * time.Millisecond,
+			path:       "/slow",
+			wantStatus: http.StatusGatewayTimeout,
+		},
+		{
+			name:       "no deadline when the timeout is disabled",
+			timeout:    0,
+			path:       "/slow",
+			wantStatus: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewTimeoutHandler(proxy, tt.timeout)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://dummy.com"+tt.path, nil))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("ServeHTTP() status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusGatewayTimeout {
+				return
+			}
+			if ct := w.Header().Get("Content-Type"); ct != ProblemJSONContentType {
+				t.Errorf("ServeHTTP() content type = %s", ct)
+			}
+			var p RFC7807Error
+			if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil || p.Status != http.StatusGatewayTimeout || p.Detail != ErrMsgRequestTimeout || p.Instance != tt.path {
+				t.Errorf("ServeHTTP() body = %s", w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,197 @@
+/*
+Copyright (C)  2018 Yahoo Japan Corporation Athenz team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"context"
+	"net/http"
+
+	authorizerd "github.com/yahoojapan/athenz-authorizer/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/yahoojapan/authorization-proxy/v4/service"
+)
+
+const tracerName = "github.com/yahoojapan/authorization-proxy/v4/handler"
+
+// span attributes of the authorization result
+const (
+	attrPrincipal = attribute.Key("athenz.principal")
+	attrDomain    = attribute.Key("athenz.domain")
+	attrRoles     = attribute.Key("athenz.roles")
+	attrAction    = attribute.Key("athenz.action")
+	attrResource  = attribute.Key("athenz.resource")
+	attrDecision  = attribute.Key("athenz.decision")
+)
+
+func tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// NewTracingHandler returns a handler which starts the server span of the request, continuing the trace of the incoming W3C trace context.
+func NewTracingHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer().Start(ctx, "HTTP "+r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(semconv.HTTPServerAttributesFromHTTPRequest("", "", r)...))
+		defer span.End()
+
+		rw := newResponseRecorder(w)
+		h.ServeHTTP(rw, r.WithContext(ctx))
+
+		span.SetAttributes(semconv.HTTPStatusCodeKey.Int(rw.status))
+		span.SetStatus(semconv.SpanStatusFromHTTPStatusCodeAndSpanKind(rw.status, trace.SpanKindServer))
+	})
+}
+
+// startAuthorizationSpan starts the span of the authorization check.
+func startAuthorizationSpan(ctx context.Context, act, res string) (context.Context, trace.Span) {
+	return tracer().Start(ctx, "authorize", trace.WithAttributes(
+		attrAction.String(act),
+		attrResource.String(res),
+	))
+}
+
+// endAuthorizationSpan records the authorization result and ends the span.
+func endAuthorizationSpan(span trace.Span, p authorizerd.Principal, err error) {
+	defer span.End()
+	if err != nil {
+		span.SetAttributes(attrDecision.String(service.DecisionDenied))
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+		return
+	}
+	span.SetAttributes(attrDecision.String(service.DecisionAllowed))
+	if p != nil {
+		span.SetAttributes(
+			attrPrincipal.String(p.Name()),
+			attrDomain.String(p.Domain()),
+			attrRoles.StringSlice(p.Roles()),
+		)
+	}
+}
+
+// startUpstreamSpan starts the client span of the upstream request, and injects the trace context into the request header.
+func startUpstreamSpan(r *http.Request) (*http.Request, trace.Span) {
+	ctx, span := tracer().Start(r.Context(), "upstream "+r.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.HTTPClientAttributesFromHTTPRequest(r)...))
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(r.Header))
+	return r.WithContext(ctx), span
+}
+
+// endUpstreamSpan records the upstream response and ends the span.
+func endUpstreamSpan(span trace.Span, res *http.Response, err error) {
+	defer span.End()
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+		return
+	}
+	span.SetAttributes(semconv.HTTPStatusCodeKey.Int(res.StatusCode))
+	span.SetStatus(semconv.SpanStatusFromHTTPStatusCodeAndSpanKind(res.StatusCode, trace.SpanKindClient))
+}
+
+// upstreamSpanKey is the context key of the holder of the gRPC upstream span, which is started by the director and ended by the stream handler.
+type upstreamSpanKey struct{}
+
+// withTracing returns a stream handler which starts the server span of the gRPC call, continuing the trace of the incoming metadata.
+func withTracing(h grpc.StreamHandler) grpc.StreamHandler {
+	return func(srv interface{}, stream grpc.ServerStream) error {
+		method, _ := grpc.MethodFromServerStream(stream)
+		ctx := stream.Context()
+		md, _ := metadata.FromIncomingContext(ctx)
+		ctx = otel.GetTextMapPropagator().Extract(ctx, metadataCarrier(md))
+		ctx, span := tracer().Start(ctx, method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(semconv.RPCSystemKey.String(gRPC), semconv.RPCMethodKey.String(method)))
+		defer span.End()
+
+		var upstream trace.Span
+		err := h(srv, &serverStream{
+			ServerStream: stream,
+			ctx:          context.WithValue(ctx, upstreamSpanKey{}, &upstream),
+		})
+
+		st := status.Convert(err)
+		for _, s := range []trace.Span{upstream, span} {
+			if s == nil {
+				continue
+			}
+			s.SetAttributes(semconv.RPCGRPCStatusCodeKey.Int(int(st.Code())))
+			if err != nil {
+				s.SetStatus(otelcodes.Error, st.Message())
+			}
+		}
+		if upstream != nil {
+			upstream.End()
+		}
+		return err
+	}
+}
+
+// startGRPCUpstreamSpan starts the client span of the proxied gRPC call, and injects the trace context into the outgoing metadata.
+// The span is ended by the stream handler returned by withTracing.
+func startGRPCUpstreamSpan(ctx context.Context, method string) context.Context {
+	holder, ok := ctx.Value(upstreamSpanKey{}).(*trace.Span)
+	if !ok {
+		return ctx
+	}
+	sctx, span := tracer().Start(ctx, "upstream "+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.RPCSystemKey.String(gRPC), semconv.RPCMethodKey.String(method)))
+	*holder = span
+
+	md, _ := metadata.FromOutgoingContext(ctx)
+	md = md.Copy()
+	otel.GetTextMapPropagator().Inject(sctx, metadataCarrier(md))
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+// metadataCarrier adapts metadata.MD to propagation.TextMapCarrier.
+type metadataCarrier metadata.MD
+
+// Get returns the first value of the key.
+func (c metadataCarrier) Get(key string) string {
+	if v := metadata.MD(c).Get(key); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// Set sets the value of the key.
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+// Keys returns the keys of the metadata.
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
@@ -0,0 +1,171 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/pkg/errors"
+	authorizerd "github.com/yahoojapan/athenz-authorizer/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/yahoojapan/authorization-proxy/v4/config"
+	"github.com/yahoojapan/authorization-proxy/v4/service"
+)
+
+// setupTracing registers the span recorder as the global tracer provider, and restores the original one on cleanup.
+func setupTracing(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	sr := tracetest.NewSpanRecorder()
+	tp, prop := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	t.Cleanup(func() {
+		otel.SetTracerProvider(tp)
+		otel.SetTextMapPropagator(prop)
+	})
+	return sr
+}
+
+func spanAttrs(s sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	m := make(map[attribute.Key]attribute.Value)
+	for _, kv := range s.Attributes() {
+		m[kv.Key] = kv.Value
+	}
+	return m
+}
+
+func TestNewTracingHandler(t *testing.T) {
+	sr := setupTracing(t)
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	var upstreamTraceparent string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamTraceparent = r.Header.Get("traceparent")
+	}))
+	defer upstream.Close()
+	u, _ := url.Parse(upstream.URL)
+	port, _ := strconv.Atoi(u.Port())
+
+	h := NewTracingHandler(New(config.Proxy{
+		Host: u.Hostname(),
+		Port: uint16(port),
+	}, nil, &service.AuthorizerdMock{
+		VerifyFunc: func(r *http.Request, act, res string) (authorizerd.Principal, error) {
+			if res == "/denied" {
+				return nil, errors.New("denied")
+			}
+			return &PrincipalMock{
+				NameFunc:       func() string { return "client.service" },
+				RolesFunc:      func() []string { return []string{"reader"} },
+				DomainFunc:     func() string { return "domain" },
+				IssueTimeFunc:  func() int64 { return 0 },
+				ExpiryTimeFunc: func() int64 { return 0 },
+			}, nil
+		},
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/allowed", nil)
+	r.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	spans := sr.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("got %d spans, want 3", len(spans))
+	}
+	byName := make(map[string]sdktrace.ReadOnlySpan)
+	for _, s := range spans {
+		if s.SpanContext().TraceID().String() != traceID {
+			t.Errorf("span %s trace ID = %s, want %s", s.Name(), s.SpanContext().TraceID(), traceID)
+		}
+		byName[s.Name()] = s
+	}
+
+	authz, ok := byName["authorize"]
+	if !ok {
+		t.Fatal("authorize span not found")
+	}
+	attrs := spanAttrs(authz)
+	for k, want := range map[attribute.Key]string{
+		attrPrincipal: "client.service",
+		attrDomain:    "domain",
+		attrAction:    http.MethodGet,
+		attrResource:  "/allowed",
+		attrDecision:  service.DecisionAllowed,
+	} {
+		if got := attrs[k].AsString(); got != want {
+			t.Errorf("authorize span attribute %s = %s, want %s", k, got, want)
+		}
+	}
+
+	up, ok := byName["upstream GET"]
+	if !ok {
+		t.Fatal("upstream span not found")
+	}
+	if want := "00-" + traceID + "-" + up.SpanContext().SpanID().String() + "-01"; upstreamTraceparent != want {
+		t.Errorf("upstream traceparent = %s, want %s", upstreamTraceparent, want)
+	}
+	if _, ok := byName["HTTP GET"]; !ok {
+		t.Error("server span not found")
+	}
+
+	sr2 := setupTracing(t)
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/denied", nil))
+	for _, s := range sr2.Ended() {
+		if s.Name() == "authorize" {
+			if got := spanAttrs(s)[attrDecision].AsString(); got != service.DecisionDenied {
+				t.Errorf("authorize span decision = %s, want %s", got, service.DecisionDenied)
+			}
+			return
+		}
+	}
+	t.Error("authorize span of denied request not found")
+}
+
+func Test_withTracing(t *testing.T) {
+	sr := setupTracing(t)
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	var outgoing metadata.MD
+	h := withTracing(func(srv interface{}, stream grpc.ServerStream) error {
+		ctx := startGRPCUpstreamSpan(stream.Context(), "/svc/method")
+		outgoing, _ = metadata.FromOutgoingContext(ctx)
+		return status.Error(codes.Unavailable, "upstream unavailable")
+	})
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01"))
+	err := h(nil, &serverStream{ctx: ctx})
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("withTracing() error = %v", err)
+	}
+
+	spans := sr.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(spans))
+	}
+	for _, s := range spans {
+		if s.SpanContext().TraceID().String() != traceID {
+			t.Errorf("span %s trace ID = %s, want %s", s.Name(), s.SpanContext().TraceID(), traceID)
+		}
+		if s.SpanKind() == trace.SpanKindClient {
+			want := "00-" + traceID + "-" + s.SpanContext().SpanID().String() + "-01"
+			if got := outgoing.Get("traceparent"); len(got) != 1 || got[0] != want {
+				t.Errorf("outgoing traceparent = %v, want %s", got, want)
+			}
+		}
+		if got := spanAttrs(s)["rpc.grpc.status_code"].AsInt64(); got != int64(codes.Unavailable) {
+			t.Errorf("span %s status code = %d, want %d", s.Name(), got, codes.Unavailable)
+		}
+	}
+}
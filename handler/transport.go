@@ -20,6 +20,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	authorizerd "github.com/yahoojapan/athenz-authorizer/v5"
 
@@ -33,18 +34,21 @@ import (
 type transport struct {
 	http.RoundTripper
 
-	prov service.Authorizationd
-	cfg  config.Proxy
+	prov  service.Authorizationd
+	cfg   config.Proxy
+	audit *service.AuditLogger
 }
 
 // Based on the following.
 // https://github.com/golang/oauth2/blob/bf48bf16ab8d622ce64ec6ce98d2c98f916b6303/transport.go
 func (t *transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	o := observationFrom(r.Context())
 	for _, urlPath := range t.cfg.OriginHealthCheckPaths {
 		if urlPath == r.URL.Path {
-			glg.Info("Authorization checking skipped on: " + r.URL.Path)
+			glg.Infof("Authorization checking skipped on: %s, request_id: %s", r.URL.Path, requestIDFrom(r.Context()))
 			r.TLS = nil
-			return t.RoundTripper.RoundTrip(r)
+			o.skipped()
+			return t.roundTrip(o, r)
 		}
 	}
 
@@ -57,7 +61,12 @@ func (t *transport) RoundTrip(r *http.Request) (*http.Response, error) {
 		}()
 	}
 
-	p, err := t.prov.Authorize(r, r.Method, r.URL.Path)
+	start := time.Now()
+	ctx, span := startAuthorizationSpan(r.Context(), r.Method, r.URL.Path)
+	p, err := t.prov.Authorize(r.WithContext(ctx), r.Method, r.URL.Path)
+	endAuthorizationSpan(span, p, err)
+	o.authorized(start, p, err)
+	auditHTTP(t.audit, r, p, err)
 	if err != nil {
 		return nil, errors.Wrap(err, ErrMsgUnverified)
 	}
@@ -77,7 +86,21 @@ func (t *transport) RoundTrip(r *http.Request) (*http.Response, error) {
 	req2.TLS = nil
 	// req.Body is assumed to be closed by the base RoundTripper.
 	reqBodyClosed = true
-	return t.RoundTripper.RoundTrip(req2)
+	return t.roundTrip(o, req2)
+}
+
+// roundTrip sends the request to the upstream, and records the result in the observation.
+func (t *transport) roundTrip(o *observation, r *http.Request) (*http.Response, error) {
+	o.upstreamStarted()
+	r, span := startUpstreamSpan(r)
+	res, err := t.RoundTripper.RoundTrip(r)
+	endUpstreamSpan(span, res, err)
+	if err != nil {
+		o.upstreamDone(0, err)
+	} else {
+		o.upstreamDone(res.StatusCode, nil)
+	}
+	return res, err
 }
 
 // cloneRequest returns a clone of the provided *http.Request.
@@ -0,0 +1,239 @@
+/*
+Copyright (C)  2018 Yahoo Japan Corporation Athenz team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kpango/glg"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/yahoojapan/authorization-proxy/v4/config"
+	"github.com/yahoojapan/authorization-proxy/v4/service"
+)
+
+const (
+	// defaultUpstreamHealthTimeout represents the default timeout of an upstream probe.
+	defaultUpstreamHealthTimeout = time.Second
+	// defaultUpstreamHealthCacheTTL represents the default duration to reuse the result of the last upstream probe.
+	defaultUpstreamHealthCacheTTL = 5 * time.Second
+
+	// UpstreamUp represents that the proxy destination is healthy.
+	UpstreamUp = "up"
+	// UpstreamDown represents that the proxy destination is unhealthy or unreachable.
+	UpstreamDown = "down"
+)
+
+// UpstreamHealthResult represents the result of an upstream probe.
+type UpstreamHealthResult struct {
+	Status        string    `json:"status"`
+	Type          string    `json:"type"`
+	Target        string    `json:"target"`
+	LatencyMillis float64   `json:"latencyMs"`
+	Error         string    `json:"error,omitempty"`
+	CheckedAt     time.Time `json:"checkedAt"`
+}
+
+// upstreamHealth probes the proxy destination, and caches the result.
+type upstreamHealth struct {
+	typ     string
+	target  string
+	probe   func(ctx context.Context) error
+	timeout time.Duration
+	ttl     time.Duration
+
+	mu   sync.Mutex
+	last UpstreamHealthResult
+}
+
+// NewUpstreamHealthHandler returns the handler of the deep health check of the proxy destination, or nil if it is disabled.
+// It responds 200 OK if the destination is healthy, otherwise 503 Service Unavailable, with the result in JSON.
+func NewUpstreamHealthHandler(cfg config.Proxy, hc config.UpstreamHealthCheck) http.Handler {
+	if !hc.Enable {
+		return nil
+	}
+	u := &upstreamHealth{
+		typ:     hc.Type,
+		timeout: parseUpstreamDuration(hc.Timeout, defaultUpstreamHealthTimeout),
+		ttl:     parseUpstreamDuration(hc.CacheTTL, defaultUpstreamHealthCacheTTL),
+	}
+	if u.typ == "" {
+		switch {
+		case strings.EqualFold(cfg.Scheme, gRPC):
+			u.typ = config.UpstreamGRPC
+		case hc.Path != "":
+			u.typ = config.UpstreamHTTP
+		default:
+			u.typ = config.UpstreamTCP
+		}
+	}
+
+	addr := net.JoinHostPort(cfg.Host, strconv.Itoa(int(cfg.Port)))
+	switch u.typ {
+	case config.UpstreamHTTP:
+		scheme := cfg.Scheme
+		if scheme == "" || strings.EqualFold(scheme, gRPC) {
+			scheme = "http"
+		}
+		u.target = scheme + "://" + addr + hc.Path
+		u.probe = httpProbe(u.target, u.timeout)
+	case config.UpstreamGRPC:
+		var dialOpts []grpc.DialOption
+		u.target = addr
+		if t, ok := grpcTarget(cfg); ok {
+			u.target = t
+		}
+		if addrs := cfg.GRPCClient.Addresses; len(addrs) > 0 {
+			r := newStaticResolver(addrs)
+			dialOpts = append(dialOpts, grpc.WithResolvers(r))
+			u.target = r.Scheme() + ":///upstream"
+		}
+		u.probe = grpcProbe(u.target, hc.ServiceName, dialOpts...)
+	default:
+		u.target = addr
+		u.probe = tcpProbe(addr)
+	}
+	glg.Infof("upstream health check: type=%s target=%s timeout=%v cacheTTL=%v", u.typ, u.target, u.timeout, u.ttl)
+	return u
+}
+
+// ServeHTTP responds the cached result, or probes the proxy destination if the result is expired.
+func (u *upstreamHealth) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	res := u.check()
+	code := http.StatusOK
+	if res.Status != UpstreamUp {
+		code = http.StatusServiceUnavailable
+	}
+	w.Header().Set(service.ContentType, service.ApplicationJSON+";"+service.CharsetUTF8)
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		glg.Errorf("cannot encode upstream health: %v", err)
+	}
+}
+
+// check returns the result of the last probe if it is not expired, otherwise probes the proxy destination.
+// Concurrent checks wait for the same probe.
+// The probe does not use the context of the request, since the result is cached and shared by the other requests even if the client disconnects.
+func (u *upstreamHealth) check() UpstreamHealthResult {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if !u.last.CheckedAt.IsZero() && time.Since(u.last.CheckedAt) < u.ttl {
+		return u.last
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), u.timeout)
+	defer cancel()
+	start := time.Now()
+	err := u.probe(ctx)
+	res := UpstreamHealthResult{
+		Status:        UpstreamUp,
+		Type:          u.typ,
+		Target:        u.target,
+		LatencyMillis: float64(time.Since(start)) / float64(time.Millisecond),
+		CheckedAt:     start,
+	}
+	if err != nil {
+		res.Status = UpstreamDown
+		res.Error = err.Error()
+		if u.last.Status != UpstreamDown {
+			glg.Warnf("upstream health check failed, target: %s, error: %v", u.target, err)
+		}
+	} else if u.last.Status == UpstreamDown {
+		glg.Infof("upstream health check recovered, target: %s", u.target)
+	}
+	u.last = res
+	return res
+}
+
+// httpProbe returns the probe sending a GET request to the URL, which succeeds on 2xx and 3xx responses.
+func httpProbe(url string, timeout time.Duration) func(ctx context.Context) error {
+	c := &http.Client{
+		Timeout: timeout,
+		// the redirect is not followed, since 3xx is healthy
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		res, err := c.Do(req)
+		if err != nil {
+			return err
+		}
+		io.Copy(ioutil.Discard, res.Body)
+		res.Body.Close()
+		if res.StatusCode < http.StatusOK || res.StatusCode >= http.StatusBadRequest {
+			return errors.Errorf("unhealthy status: %s", res.Status)
+		}
+		return nil
+	}
+}
+
+// tcpProbe returns the probe connecting to the address.
+func tcpProbe(addr string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+}
+
+// grpcProbe returns the probe calling grpc.health.v1.Health/Check, which succeeds if the status is SERVING.
+func grpcProbe(target, service string, dialOpts ...grpc.DialOption) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		conn, err := grpc.DialContext(ctx, target, append(dialOpts, grpc.WithInsecure())...)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		res, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{
+			Service: service,
+		})
+		if err != nil {
+			return err
+		}
+		if res.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+			return errors.Errorf("unhealthy status: %s", res.GetStatus())
+		}
+		return nil
+	}
+}
+
+func parseUpstreamDuration(s string, def time.Duration) time.Duration {
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return def
+	}
+	return d
+}
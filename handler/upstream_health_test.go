@@ -0,0 +1,302 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/yahoojapan/authorization-proxy/v4/config"
+)
+
+// splitTestAddr returns the host and port of the test server address.
+func splitTestAddr(t *testing.T, addr string) (string, uint16) {
+	t.Helper()
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, _ := strconv.Atoi(port)
+	return host, uint16(p)
+}
+
+// closedTestAddr returns an address which refuses the connection.
+func closedTestAddr(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	return addr
+}
+
+func startTestHealthServer(t *testing.T, serving healthpb.HealthCheckResponse_ServingStatus) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hsrv := health.NewServer()
+	hsrv.SetServingStatus("", serving)
+	hsrv.SetServingStatus("backend.Service", healthpb.HealthCheckResponse_SERVING)
+	srv := grpc.NewServer()
+	healthpb.RegisterHealthServer(srv, hsrv)
+	go srv.Serve(l)
+	t.Cleanup(srv.Stop)
+	return l.Addr().String()
+}
+
+func TestNewUpstreamHealthHandler(t *testing.T) {
+	var hits int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		switch r.URL.Path {
+		case "/health":
+			w.WriteHeader(http.StatusOK)
+		case "/moved":
+			http.Redirect(w, r, "/health", http.StatusFound)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer backend.Close()
+	u, _ := url.Parse(backend.URL)
+	host, port := splitTestAddr(t, u.Host)
+	closedHost, closedPort := splitTestAddr(t, closedTestAddr(t))
+
+	servingHost, servingPort := splitTestAddr(t, startTestHealthServer(t, healthpb.HealthCheckResponse_SERVING))
+	notServingHost, notServingPort := splitTestAddr(t, startTestHealthServer(t, healthpb.HealthCheckResponse_NOT_SERVING))
+
+	tests := []struct {
+		name       string
+		cfg        config.Proxy
+		hc         config.UpstreamHealthCheck
+		wantStatus int
+		want       UpstreamHealthResult
+	}{
+		{
+			name: "http path is healthy",
+			cfg: config.Proxy{
+				Host: host,
+				Port: port,
+			},
+			hc: config.UpstreamHealthCheck{
+				Enable: true,
+				Path:   "/health",
+			},
+			wantStatus: http.StatusOK,
+			want: UpstreamHealthResult{
+				Status: UpstreamUp,
+				Type:   config.UpstreamHTTP,
+				Target: backend.URL + "/health",
+			},
+		},
+		{
+			name: "http redirect is healthy",
+			cfg: config.Proxy{
+				Scheme: "http",
+				Host:   host,
+				Port:   port,
+			},
+			hc: config.UpstreamHealthCheck{
+				Enable: true,
+				Type:   config.UpstreamHTTP,
+				Path:   "/moved",
+			},
+			wantStatus: http.StatusOK,
+			want: UpstreamHealthResult{
+				Status: UpstreamUp,
+				Type:   config.UpstreamHTTP,
+				Target: backend.URL + "/moved",
+			},
+		},
+		{
+			name: "http 500 is unhealthy",
+			cfg: config.Proxy{
+				Host: host,
+				Port: port,
+			},
+			hc: config.UpstreamHealthCheck{
+				Enable: true,
+				Path:   "/error",
+			},
+			wantStatus: http.StatusServiceUnavailable,
+			want: UpstreamHealthResult{
+				Status: UpstreamDown,
+				Type:   config.UpstreamHTTP,
+				Target: backend.URL + "/error",
+				Error:  "unhealthy status: 500 Internal Server Error",
+			},
+		},
+		{
+			name: "tcp connect is healthy",
+			cfg: config.Proxy{
+				Host: host,
+				Port: port,
+			},
+			hc: config.UpstreamHealthCheck{
+				Enable: true,
+			},
+			wantStatus: http.StatusOK,
+			want: UpstreamHealthResult{
+				Status: UpstreamUp,
+				Type:   config.UpstreamTCP,
+				Target: u.Host,
+			},
+		},
+		{
+			name: "tcp connection refused is unhealthy",
+			cfg: config.Proxy{
+				Host: closedHost,
+				Port: closedPort,
+			},
+			hc: config.UpstreamHealthCheck{
+				Enable: true,
+				Type:   config.UpstreamTCP,
+			},
+			wantStatus: http.StatusServiceUnavailable,
+			want: UpstreamHealthResult{
+				Status: UpstreamDown,
+				Type:   config.UpstreamTCP,
+				Target: net.JoinHostPort(closedHost, strconv.Itoa(int(closedPort))),
+			},
+		},
+		{
+			name: "grpc serving is healthy",
+			cfg: config.Proxy{
+				Scheme: gRPC,
+				Host:   servingHost,
+				Port:   servingPort,
+			},
+			hc: config.UpstreamHealthCheck{
+				Enable: true,
+			},
+			wantStatus: http.StatusOK,
+			want: UpstreamHealthResult{
+				Status: UpstreamUp,
+				Type:   config.UpstreamGRPC,
+				Target: net.JoinHostPort(servingHost, strconv.Itoa(int(servingPort))),
+			},
+		},
+		{
+			name: "grpc not serving is unhealthy",
+			cfg: config.Proxy{
+				Scheme: gRPC,
+				Host:   notServingHost,
+				Port:   notServingPort,
+			},
+			hc: config.UpstreamHealthCheck{
+				Enable: true,
+			},
+			wantStatus: http.StatusServiceUnavailable,
+			want: UpstreamHealthResult{
+				Status: UpstreamDown,
+				Type:   config.UpstreamGRPC,
+				Target: net.JoinHostPort(notServingHost, strconv.Itoa(int(notServingPort))),
+				Error:  "unhealthy status: NOT_SERVING",
+			},
+		},
+		{
+			name: "grpc service of static address is healthy in mixed mode",
+			cfg: config.Proxy{
+				Host: host,
+				Port: port,
+				GRPC: config.GRPCProxy{
+					Enable: true,
+				},
+				GRPCClient: config.GRPCClient{
+					Addresses: []config.GRPCAddress{
+						{Address: net.JoinHostPort(notServingHost, strconv.Itoa(int(notServingPort)))},
+					},
+				},
+			},
+			hc: config.UpstreamHealthCheck{
+				Enable:      true,
+				Type:        config.UpstreamGRPC,
+				ServiceName: "backend.Service",
+			},
+			wantStatus: http.StatusOK,
+			want: UpstreamHealthResult{
+				Status: UpstreamUp,
+				Type:   config.UpstreamGRPC,
+				Target: staticScheme + ":///upstream",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewUpstreamHealthHandler(tt.cfg, tt.hc)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz/upstream", nil))
+			if w.Code != tt.wantStatus {
+				t.Errorf("ServeHTTP() status = %d, want %d, body: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			var got UpstreamHealthResult
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("ServeHTTP() body = %s, error = %v", w.Body.String(), err)
+			}
+			if got.Status != tt.want.Status || got.Type != tt.want.Type || got.Target != tt.want.Target {
+				t.Errorf("ServeHTTP() = %+v, want %+v", got, tt.want)
+			}
+			if tt.want.Error != "" && got.Error != tt.want.Error {
+				t.Errorf("ServeHTTP() error = %s, want %s", got.Error, tt.want.Error)
+			}
+			if got.Status == UpstreamDown && got.Error == "" {
+				t.Error("ServeHTTP() error is empty")
+			}
+		})
+	}
+
+	t.Run("return nil when disabled", func(t *testing.T) {
+		if h := NewUpstreamHealthHandler(config.Proxy{}, config.UpstreamHealthCheck{}); h != nil {
+			t.Errorf("NewUpstreamHealthHandler() = %v, want nil", h)
+		}
+	})
+
+	t.Run("reuse the cached result", func(t *testing.T) {
+		h := NewUpstreamHealthHandler(config.Proxy{
+			Host: host,
+			Port: port,
+		}, config.UpstreamHealthCheck{
+			Enable:   true,
+			Path:     "/health",
+			CacheTTL: "1m",
+		})
+		atomic.StoreInt32(&hits, 0)
+		for i := 0; i < 3; i++ {
+			h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/healthz/upstream", nil))
+		}
+		if got := atomic.LoadInt32(&hits); got != 1 {
+			t.Errorf("probes = %d, want 1", got)
+		}
+	})
+
+	t.Run("probe regardless of the canceled request", func(t *testing.T) {
+		h := NewUpstreamHealthHandler(config.Proxy{
+			Host: host,
+			Port: port,
+		}, config.UpstreamHealthCheck{
+			Enable:   true,
+			Path:     "/health",
+			CacheTTL: "1m",
+		})
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz/upstream", nil).WithContext(ctx))
+		if w.Code != http.StatusOK {
+			t.Errorf("ServeHTTP() status = %d, want %d, body: %s", w.Code, http.StatusOK, w.Body.String())
+		}
+	})
+}
@@ -25,6 +25,18 @@ import (
 type buffer struct {
 	pool sync.Pool
 	size *uint64
+
+	gets   uint64
+	puts   uint64
+	allocs uint64
+}
+
+// BufferStats represents the statistics of the buffer pool.
+type BufferStats struct {
+	Gets        uint64
+	Puts        uint64
+	Allocations uint64
+	Size        uint64
 }
 
 // NewBuffer implements httputil.BufferPool for providing byte slices of same size.
@@ -39,6 +51,7 @@ func NewBuffer(size uint64) httputil.BufferPool {
 
 	b.pool = sync.Pool{
 		New: func() interface{} {
+			atomic.AddUint64(&b.allocs, 1)
 			return make([]byte, 0, atomic.LoadUint64(b.size))
 		},
 	}
@@ -48,12 +61,14 @@ func NewBuffer(size uint64) httputil.BufferPool {
 
 // Get returns a slice from the pool, and remove it from the pool. New slice may be created when needed.
 func (b *buffer) Get() []byte {
+	atomic.AddUint64(&b.gets, 1)
 	return b.pool.Get().([]byte)
 }
 
 // Put adds the given slice back to internal pool, but resets its length to 0.
 // If the given slice have capacity > current new buffer size in the pool, all newly created byte slices from Get() will have capacity which equals to the given slice. Capacity of slices already in the pool will not be affected.
 func (b *buffer) Put(buf []byte) {
+	atomic.AddUint64(&b.puts, 1)
 	size := atomic.LoadUint64(b.size)
 
 	// The maximum capacity for a slice is the size of the default integer on the target build.
@@ -76,6 +91,16 @@ func (b *buffer) Put(buf []byte) {
 	b.pool.Put(buf[:0])
 }
 
+// Stats returns the statistics of the buffer pool.
+func (b *buffer) Stats() BufferStats {
+	return BufferStats{
+		Gets:        atomic.LoadUint64(&b.gets),
+		Puts:        atomic.LoadUint64(&b.puts),
+		Allocations: atomic.LoadUint64(&b.allocs),
+		Size:        atomic.LoadUint64(b.size),
+	}
+}
+
 // max is copied from math.Max for uint64 type
 func max(x, y uint64) uint64 {
 	if x > y {
@@ -265,3 +265,21 @@ func Test_max(t *testing.T) {
 		})
 	}
 }
+
+func TestBuffer_Stats(t *testing.T) {
+	b := NewBuffer(8).(*buffer)
+
+	buf := b.Get()
+	b.Put(buf)
+	b.Put(make([]byte, 0, 16))
+
+	want := BufferStats{
+		Gets:        1,
+		Puts:        2,
+		Allocations: 1,
+		Size:        16,
+	}
+	if got := b.Stats(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+}
@@ -19,6 +19,8 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
+	"io"
 	"os"
 	"os/signal"
 	"path/filepath"
@@ -28,12 +30,16 @@ import (
 	"github.com/kpango/glg"
 	"github.com/pkg/errors"
 	"github.com/yahoojapan/authorization-proxy/v4/config"
+	"github.com/yahoojapan/authorization-proxy/v4/service"
 	"github.com/yahoojapan/authorization-proxy/v4/usecase"
 )
 
 // Version is set by the build command via LDFLAGS
 var Version string
 
+// verifyAuditCommand represents the subcommand to verify the hash chain of the audit log files.
+const verifyAuditCommand = "verify-audit"
+
 // params is the data model for Authorization Proxy command line arguments.
 type params struct {
 	configFilePath string
@@ -61,42 +67,54 @@ func parseParams() (*params, error) {
 	return p, nil
 }
 
-// run starts the daemon and listens for OS signal.
-func run(cfg config.Config) []error {
-	g := glg.Get().SetMode(glg.NONE)
-
-	switch cfg.Log.Level {
-	case "":
-		// disable logging
-	case "fatal":
-		g = g.SetLevelMode(glg.FATAL, glg.STD)
-	case "error":
-		g = g.SetLevelMode(glg.FATAL, glg.STD).
-			SetLevelMode(glg.ERR, glg.STD)
-	case "warn":
-		g = g.SetLevelMode(glg.FATAL, glg.STD).
-			SetLevelMode(glg.ERR, glg.STD).
-			SetLevelMode(glg.WARN, glg.STD)
-	case "info":
-		g = g.SetLevelMode(glg.FATAL, glg.STD).
-			SetLevelMode(glg.ERR, glg.STD).
-			SetLevelMode(glg.WARN, glg.STD).
-			SetLevelMode(glg.INFO, glg.STD)
-	case "debug":
-		g = g.SetLevelMode(glg.FATAL, glg.STD).
-			SetLevelMode(glg.ERR, glg.STD).
-			SetLevelMode(glg.WARN, glg.STD).
-			SetLevelMode(glg.INFO, glg.STD).
-			SetLevelMode(glg.DEBG, glg.STD)
-	default:
-		return []error{errors.New("invalid log level")}
-	}
-
-	if !cfg.Log.Color {
-		g.DisableColor()
-	}
-
-	daemon, err := usecase.New(cfg)
+// verifyAudit verifies the hash chain of the audit log files, which are given in the written order.
+func verifyAudit(args []string, w io.Writer) error {
+	f := flag.NewFlagSet(verifyAuditCommand, flag.ContinueOnError)
+	keyPath := f.String("key", "", "HMAC key file path of the audit chain")
+	allowRestarts := f.Bool("allow-restarts", false, "accept the new chains started in the middle, e.g. after the broken last record on restart")
+	if err := f.Parse(args); err != nil {
+		return errors.Wrap(err, "Parse Failed")
+	}
+	if f.NArg() == 0 {
+		return errors.New("audit log file path is required")
+	}
+
+	var key []byte
+	if *keyPath != "" {
+		var err error
+		key, err = service.ReadAuditKey(*keyPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	v := service.NewAuditVerifier(key)
+	v.AllowRestarts = *allowRestarts
+	for _, path := range f.Args() {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		err = v.Verify(file)
+		file.Close()
+		if err != nil {
+			return errors.Wrap(err, path)
+		}
+	}
+	fmt.Fprintf(w, "verified %d records from sequence %d, restarts: %d, last hash: %s\n", v.Records, v.First, v.Restarts, v.Last)
+	return nil
+}
+
+// run starts the daemon and listens for OS signal. The configuration file is reloaded on SIGHUP.
+func run(cfg config.Config, path string) []error {
+	// the log file is not closed, so that the errors returned from run are logged
+	logger, err := service.NewLogger(cfg.Log)
+	if err != nil {
+		return []error{err}
+	}
+	logger.Apply(glg.Get())
+
+	daemon, err := usecase.New(cfg, usecase.WithLogger(logger), usecase.WithConfigPath(path))
 	if err != nil {
 		return []error{errors.Wrap(err, "usecase returned error")}
 	}
@@ -116,11 +134,26 @@ func run(cfg config.Config) []error {
 		// close(ech)
 	}()
 
-	signal.Notify(sigCh, syscall.SIGTERM, syscall.SIGINT)
+	signal.Notify(sigCh, syscall.SIGTERM, syscall.SIGINT, syscall.SIGUSR1, syscall.SIGHUP)
 
 	for {
 		select {
-		case <-sigCh:
+		case sig := <-sigCh:
+			if sig == syscall.SIGUSR1 {
+				lv := logger.ToggleDebug()
+				glg.Warnf("Got log level toggle signal, level: %s, packages: %v", lv.Level, lv.Packages)
+				continue
+			}
+			if sig == syscall.SIGHUP {
+				glg.Warn("Got configuration reload signal...")
+				// the reload can take a while to initialize the authorizer, and the reloads are serialized
+				go func() {
+					if err := daemon.Reload(ctx); err != nil {
+						glg.Errorf("failed to reload configuration, keep the current one: %v", err)
+					}
+				}()
+				continue
+			}
 			cancel()
 			glg.Warn("Got authorization-proxy server shutdown signal...")
 		case errs := <-ech:
@@ -139,6 +172,13 @@ func main() {
 		}
 	}()
 
+	if len(os.Args) > 1 && os.Args[1] == verifyAuditCommand {
+		if err := verifyAudit(os.Args[2:], os.Stdout); err != nil {
+			glg.Fatal(errors.Wrap(err, "audit chain verification failed"))
+		}
+		return
+	}
+
 	p, err := parseParams()
 	if err != nil {
 		glg.Fatal(errors.Wrap(err, "parseParams returned error"))
@@ -163,7 +203,7 @@ func main() {
 		return
 	}
 
-	errs := run(*cfg)
+	errs := run(*cfg, p.configFilePath)
 	if len(errs) > 0 {
 		var emsg string
 		for _, err = range errs {
@@ -1,13 +1,19 @@
 package main
 
 import (
+	"bytes"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/kpango/glg"
 	"github.com/pkg/errors"
 	"github.com/yahoojapan/authorization-proxy/v4/config"
+	"github.com/yahoojapan/authorization-proxy/v4/service"
 )
 
 func TestParseParams(t *testing.T) {
@@ -87,7 +93,8 @@ func TestParseParams(t *testing.T) {
 
 func Test_run(t *testing.T) {
 	type args struct {
-		cfg config.Config
+		cfg  config.Config
+		path string
 	}
 	type test struct {
 		name      string
@@ -122,11 +129,11 @@ func Test_run(t *testing.T) {
 					g.GetCurrentMode(glg.DEBG),
 				}
 				want := []glg.MODE{
-					glg.NONE,
-					glg.NONE,
-					glg.NONE,
-					glg.NONE,
-					glg.NONE,
+					glg.WRITER,
+					glg.WRITER,
+					glg.WRITER,
+					glg.WRITER,
+					glg.WRITER,
 				}
 				if !reflect.DeepEqual(got, want) {
 					return errors.Errorf("got: %v, want: %v", got, want)
@@ -161,11 +168,11 @@ func Test_run(t *testing.T) {
 					g.GetCurrentMode(glg.DEBG),
 				}
 				want := []glg.MODE{
-					glg.STD,
-					glg.NONE,
-					glg.NONE,
-					glg.NONE,
-					glg.NONE,
+					glg.WRITER,
+					glg.WRITER,
+					glg.WRITER,
+					glg.WRITER,
+					glg.WRITER,
 				}
 				if !reflect.DeepEqual(got, want) {
 					return errors.Errorf("got: %v, want: %v", got, want)
@@ -200,11 +207,11 @@ func Test_run(t *testing.T) {
 					g.GetCurrentMode(glg.DEBG),
 				}
 				want := []glg.MODE{
-					glg.STD,
-					glg.STD,
-					glg.NONE,
-					glg.NONE,
-					glg.NONE,
+					glg.WRITER,
+					glg.WRITER,
+					glg.WRITER,
+					glg.WRITER,
+					glg.WRITER,
 				}
 				if !reflect.DeepEqual(got, want) {
 					return errors.Errorf("got: %v, want: %v", got, want)
@@ -239,11 +246,11 @@ func Test_run(t *testing.T) {
 					g.GetCurrentMode(glg.DEBG),
 				}
 				want := []glg.MODE{
-					glg.STD,
-					glg.STD,
-					glg.STD,
-					glg.NONE,
-					glg.NONE,
+					glg.WRITER,
+					glg.WRITER,
+					glg.WRITER,
+					glg.WRITER,
+					glg.WRITER,
 				}
 				if !reflect.DeepEqual(got, want) {
 					return errors.Errorf("got: %v, want: %v", got, want)
@@ -278,11 +285,11 @@ func Test_run(t *testing.T) {
 					g.GetCurrentMode(glg.DEBG),
 				}
 				want := []glg.MODE{
-					glg.STD,
-					glg.STD,
-					glg.STD,
-					glg.STD,
-					glg.NONE,
+					glg.WRITER,
+					glg.WRITER,
+					glg.WRITER,
+					glg.WRITER,
+					glg.WRITER,
 				}
 				if !reflect.DeepEqual(got, want) {
 					return errors.Errorf("got: %v, want: %v", got, want)
@@ -317,11 +324,11 @@ func Test_run(t *testing.T) {
 					g.GetCurrentMode(glg.DEBG),
 				}
 				want := []glg.MODE{
-					glg.STD,
-					glg.STD,
-					glg.STD,
-					glg.STD,
-					glg.STD,
+					glg.WRITER,
+					glg.WRITER,
+					glg.WRITER,
+					glg.WRITER,
+					glg.WRITER,
 				}
 				if !reflect.DeepEqual(got, want) {
 					return errors.Errorf("got: %v, want: %v", got, want)
@@ -423,7 +430,7 @@ func Test_run(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			gotErrs := run(tt.args.cfg)
+			gotErrs := run(tt.args.cfg, tt.args.path)
 			if err := tt.checkFunc(gotErrs); err != nil {
 				t.Errorf("run() fails: %v", err)
 			}
@@ -431,6 +438,91 @@ func Test_run(t *testing.T) {
 	}
 }
 
+func Test_verifyAudit(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "audit.log")
+	a, err := service.NewAuditLogger(config.Audit{
+		Enable: true,
+		Path:   path,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, res := range []string{"/a", "/b"} {
+		a.Record(service.AuditEvent{
+			Time:     time.Now(),
+			Protocol: "http",
+			Action:   "GET",
+			Resource: res,
+			Decision: service.DecisionAllowed,
+		})
+	}
+	a.Close()
+
+	b, _ := ioutil.ReadFile(path)
+	tampered := filepath.Join(dir, "tampered.log")
+	if err := ioutil.WriteFile(tampered, bytes.Replace(b, []byte(`"/b"`), []byte(`"/c"`), 1), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// the second record is replaced by a new chain
+	restarted := filepath.Join(dir, "restarted.log")
+	first := bytes.SplitAfter(b, []byte("\n"))[0]
+	if err := ioutil.WriteFile(restarted, append(append([]byte{}, first...), first...), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "verify the audit log",
+			args: []string{path},
+			want: "verified 2 records from sequence 1",
+		},
+		{
+			name:    "detect the tampered audit log",
+			args:    []string{tampered},
+			wantErr: true,
+		},
+		{
+			name:    "detect the new chain started in the middle",
+			args:    []string{restarted},
+			wantErr: true,
+		},
+		{
+			name: "verify the new chain when restarts are allowed",
+			args: []string{"-allow-restarts", restarted},
+			want: "verified 2 records from sequence 1, restarts: 1",
+		},
+		{
+			name:    "return error without the audit log file",
+			args:    []string{},
+			wantErr: true,
+		},
+		{
+			name:    "return error when the key cannot be read",
+			args:    []string{"-key", filepath.Join(dir, "not_exist"), path},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := new(bytes.Buffer)
+			err := verifyAudit(tt.args, w)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("verifyAudit() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !strings.Contains(w.String(), tt.want) {
+				t.Errorf("verifyAudit() output = %s, want %s", w.String(), tt.want)
+			}
+		})
+	}
+}
+
 func Test_getVersion(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -31,8 +31,8 @@ import (
 	"github.com/yahoojapan/authorization-proxy/v4/service"
 )
 
-// NewDebugRouter return the ServeMux with debug endpoints
-func NewDebugRouter(cfg config.Server, a service.Authorizationd) *http.ServeMux {
+// NewDebugRouter return the ServeMux with debug endpoints, the given routes are registered in addition to the default debug routes.
+func NewDebugRouter(cfg config.Server, a service.Authorizationd, routes ...Route) *http.ServeMux {
 	http.DefaultTransport.(*http.Transport).MaxIdleConnsPerHost = 32
 	mux := http.NewServeMux()
 
@@ -41,7 +41,7 @@ func NewDebugRouter(cfg config.Server, a service.Authorizationd) *http.ServeMux
 		dur = time.Second * 3
 	}
 
-	for _, route := range NewDebugRoutes(cfg.Debug, a) {
+	for _, route := range append(NewDebugRoutes(cfg.Debug, a), routes...) {
 		mux.Handle(route.Pattern, routing(route.Methods, dur, route.HandlerFunc))
 	}
 
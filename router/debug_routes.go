@@ -131,6 +131,86 @@ func NewDebugRoutes(cfg config.Debug, a service.Authorizationd) []Route {
 	return routes
 }
 
+// NewGRPCStreamRoutes returns the debug endpoint of the active gRPC stream statistics. The endpoint is included only if Dump flag is enabled.
+func NewGRPCStreamRoutes(cfg config.Debug, st *handler.StreamTracker) []Route {
+	if !cfg.Dump || st == nil {
+		return nil
+	}
+	return []Route{
+		{
+			"GetGRPCStreamStats",
+			[]string{
+				http.MethodGet,
+			},
+			"/debug/grpc/streams",
+			NewGRPCStreamStatsHandler(st),
+		},
+	}
+}
+
+// NewGRPCStreamStatsHandler returns the handler function to handle get active gRPC stream statistics request.
+func NewGRPCStreamStatsHandler(st *handler.StreamTracker) func(w http.ResponseWriter, r *http.Request) error {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		w.Header().Set("Content-Type", fmt.Sprintf("%s;%s", "application/json", "charset=UTF-8"))
+		w.WriteHeader(http.StatusOK)
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		return e.Encode(st.Stats())
+	}
+}
+
+// NewMetricsRoutes returns the Prometheus metrics endpoint. The endpoint is included only if the metrics are exposed on the debug server.
+func NewMetricsRoutes(m *service.Metrics) []Route {
+	if !m.OnServer(config.MetricsOnDebug) {
+		return nil
+	}
+	return []Route{
+		{
+			"GetMetrics",
+			[]string{
+				http.MethodGet,
+			},
+			m.Path(),
+			toHandler(m.Handler().ServeHTTP),
+		},
+	}
+}
+
+// NewAuthorizerStatusRoutes returns the debug endpoint of the live status of the authorizer components.
+func NewAuthorizerStatusRoutes(st *service.AuthorizerStatus) []Route {
+	if st == nil {
+		return nil
+	}
+	return []Route{
+		{
+			"GetAuthorizerStatus",
+			[]string{
+				http.MethodGet,
+			},
+			"/debug/authorizer/status",
+			toHandler(st.Handler().ServeHTTP),
+		},
+	}
+}
+
+// NewLogLevelRoutes returns the debug endpoint to get and change the log levels at runtime.
+func NewLogLevelRoutes(l *service.Logger) []Route {
+	if l == nil {
+		return nil
+	}
+	return []Route{
+		{
+			"LogLevel",
+			[]string{
+				http.MethodGet,
+				http.MethodPut,
+			},
+			"/debug/log/level",
+			toHandler(l.Handler().ServeHTTP),
+		},
+	}
+}
+
 // NewPolicyCacheHandler returns the handler function to handle get policy cache request.
 func NewPolicyCacheHandler(authd service.Authorizationd) func(w http.ResponseWriter, r *http.Request) error {
 	return func(w http.ResponseWriter, r *http.Request) error {
@@ -4,11 +4,14 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/http/httptest"
 	"net/http/pprof"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/yahoojapan/authorization-proxy/v4/config"
+	"github.com/yahoojapan/authorization-proxy/v4/handler"
 	"github.com/yahoojapan/authorization-proxy/v4/service"
 )
 
@@ -303,3 +306,240 @@ func TestNewDebugRoutes(t *testing.T) {
 		})
 	}
 }
+
+func TestNewGRPCStreamRoutes(t *testing.T) {
+	type args struct {
+		cfg config.Debug
+		st  *handler.StreamTracker
+	}
+	tests := []struct {
+		name      string
+		args      args
+		checkFunc func(got []Route) error
+	}{
+		{
+			name: "return stream stats route when dump is enabled",
+			args: args{
+				cfg: config.Debug{
+					Dump: true,
+				},
+				st: handler.NewStreamTracker(),
+			},
+			checkFunc: func(got []Route) error {
+				if len(got) != 1 || got[0].Pattern != "/debug/grpc/streams" {
+					return fmt.Errorf("got: %v", got)
+				}
+				w := httptest.NewRecorder()
+				if err := got[0].HandlerFunc(w, httptest.NewRequest(http.MethodGet, "/debug/grpc/streams", nil)); err != nil {
+					return err
+				}
+				if body := w.Body.String(); !strings.Contains(body, `"active": 0`) || !strings.Contains(body, `"forced_cancellations": 0`) {
+					return fmt.Errorf("unexpected body: %s", body)
+				}
+				return nil
+			},
+		},
+		{
+			name: "return nil when dump is disabled",
+			args: args{
+				cfg: config.Debug{
+					Dump: false,
+				},
+				st: handler.NewStreamTracker(),
+			},
+			checkFunc: func(got []Route) error {
+				if got != nil {
+					return fmt.Errorf("got: %v, want: nil", got)
+				}
+				return nil
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NewGRPCStreamRoutes(tt.args.cfg, tt.args.st)
+			if err := tt.checkFunc(got); err != nil {
+				t.Errorf("NewGRPCStreamRoutes() error: %v", err)
+			}
+		})
+	}
+}
+
+func TestNewMetricsRoutes(t *testing.T) {
+	type args struct {
+		m *service.Metrics
+	}
+	tests := []struct {
+		name      string
+		args      args
+		checkFunc func(got []Route) error
+	}{
+		{
+			name: "return metrics route when metrics are exposed on debug server",
+			args: args{
+				m: service.NewMetrics(config.Metrics{
+					Enable: true,
+					Server: config.MetricsOnDebug,
+					Path:   "/debug/metrics",
+				}),
+			},
+			checkFunc: func(got []Route) error {
+				if len(got) != 1 || got[0].Pattern != "/debug/metrics" {
+					return fmt.Errorf("got: %v", got)
+				}
+				w := httptest.NewRecorder()
+				if err := got[0].HandlerFunc(w, httptest.NewRequest(http.MethodGet, "/debug/metrics", nil)); err != nil {
+					return err
+				}
+				if body := w.Body.String(); !strings.Contains(body, "go_goroutines") {
+					return fmt.Errorf("unexpected body: %s", body)
+				}
+				return nil
+			},
+		},
+		{
+			name: "return nil when metrics are exposed on health check server",
+			args: args{
+				m: service.NewMetrics(config.Metrics{
+					Enable: true,
+				}),
+			},
+			checkFunc: func(got []Route) error {
+				if got != nil {
+					return fmt.Errorf("got: %v, want: nil", got)
+				}
+				return nil
+			},
+		},
+		{
+			name: "return nil when metrics are disabled",
+			args: args{
+				m: nil,
+			},
+			checkFunc: func(got []Route) error {
+				if got != nil {
+					return fmt.Errorf("got: %v, want: nil", got)
+				}
+				return nil
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NewMetricsRoutes(tt.args.m)
+			if err := tt.checkFunc(got); err != nil {
+				t.Errorf("NewMetricsRoutes() error: %v", err)
+			}
+		})
+	}
+}
+
+func TestNewAuthorizerStatusRoutes(t *testing.T) {
+	type args struct {
+		st *service.AuthorizerStatus
+	}
+	tests := []struct {
+		name      string
+		args      args
+		checkFunc func(got []Route) error
+	}{
+		{
+			name: "return authorizer status route",
+			args: args{
+				st: service.NewAuthorizerStatus(config.Authorization{}),
+			},
+			checkFunc: func(got []Route) error {
+				if len(got) != 1 || got[0].Pattern != "/debug/authorizer/status" {
+					return fmt.Errorf("got: %v", got)
+				}
+				w := httptest.NewRecorder()
+				if err := got[0].HandlerFunc(w, httptest.NewRequest(http.MethodGet, "/debug/authorizer/status", nil)); err != nil {
+					return err
+				}
+				if body := w.Body.String(); !strings.Contains(body, `"pubkeyd"`) {
+					return fmt.Errorf("unexpected body: %s", body)
+				}
+				return nil
+			},
+		},
+		{
+			name: "return nil when the status is not tracked",
+			args: args{
+				st: nil,
+			},
+			checkFunc: func(got []Route) error {
+				if got != nil {
+					return fmt.Errorf("got: %v, want: nil", got)
+				}
+				return nil
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NewAuthorizerStatusRoutes(tt.args.st)
+			if err := tt.checkFunc(got); err != nil {
+				t.Errorf("NewAuthorizerStatusRoutes() error: %v", err)
+			}
+		})
+	}
+}
+
+func TestNewLogLevelRoutes(t *testing.T) {
+	type args struct {
+		l *service.Logger
+	}
+	tests := []struct {
+		name      string
+		args      args
+		checkFunc func(got []Route) error
+	}{
+		{
+			name: "return log level route",
+			args: args{
+				l: func() *service.Logger {
+					l, _ := service.NewLogger(config.Log{
+						Level: "info",
+					})
+					return l
+				}(),
+			},
+			checkFunc: func(got []Route) error {
+				if len(got) != 1 || got[0].Pattern != "/debug/log/level" {
+					return fmt.Errorf("got: %v", got)
+				}
+				if !reflect.DeepEqual(got[0].Methods, []string{http.MethodGet, http.MethodPut}) {
+					return fmt.Errorf("unexpected methods: %v", got[0].Methods)
+				}
+				w := httptest.NewRecorder()
+				if err := got[0].HandlerFunc(w, httptest.NewRequest(http.MethodGet, "/debug/log/level", nil)); err != nil {
+					return err
+				}
+				if body := w.Body.String(); !strings.Contains(body, `"level":"info"`) {
+					return fmt.Errorf("unexpected body: %s", body)
+				}
+				return nil
+			},
+		},
+		{
+			name: "return nil when the logger is not given",
+			args: args{
+				l: nil,
+			},
+			checkFunc: func(got []Route) error {
+				if got != nil {
+					return fmt.Errorf("got: %v, want: nil", got)
+				}
+				return nil
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NewLogLevelRoutes(tt.args.l)
+			if err := tt.checkFunc(got); err != nil {
+				t.Errorf("NewLogLevelRoutes() error: %v", err)
+			}
+		})
+	}
+}
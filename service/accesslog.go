@@ -0,0 +1,309 @@
+/*
+Copyright (C)  2018 Yahoo Japan Corporation Athenz team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kpango/glg"
+	"github.com/pkg/errors"
+	authorizerd "github.com/yahoojapan/athenz-authorizer/v5"
+
+	"github.com/yahoojapan/authorization-proxy/v4/config"
+)
+
+const (
+	// CredentialRoleToken represents the request is authorized by the role token.
+	CredentialRoleToken = "role_token"
+	// CredentialAccessToken represents the request is authorized by the OAuth2 access token.
+	CredentialAccessToken = "access_token"
+	// CredentialRoleCertificate represents the request is authorized by the role certificate on mTLS.
+	CredentialRoleCertificate = "role_certificate"
+)
+
+// AccessLogEntry represents an entry of the access log.
+type AccessLogEntry struct {
+	Time      time.Time
+	RequestID string
+	ClientIP  string
+	Protocol  string
+	Method    string
+	Path      string
+	Status    int
+
+	// authorization context, empty if the request is not authorized
+	Principal      string
+	Domain         string
+	Roles          []string
+	ClientID       string
+	CredentialType string
+	Decision       string
+	Reason         string
+
+	// TLS connection terminated by the load balancer, empty if the PROXY protocol header does not have it
+	ProxyAuthority   string
+	ProxyTLSVersion  string
+	ProxyTLSCipher   string
+	ProxyTLSClientCN string
+
+	UpstreamStatus int
+	BytesIn        int64
+	BytesOut       int64
+
+	Latency         time.Duration
+	AuthzLatency    time.Duration
+	UpstreamLatency time.Duration
+}
+
+// SetPrincipal sets the authorization context of the principal to the entry.
+func (e *AccessLogEntry) SetPrincipal(p authorizerd.Principal) {
+	if p == nil {
+		return
+	}
+	e.Principal, e.Domain, e.Roles, e.ClientID = principalOf(p)
+	e.CredentialType = CredentialType(p)
+}
+
+// SetProxyHeader sets the TLS connection terminated by the load balancer in the PROXY protocol header to the entry.
+func (e *AccessLogEntry) SetProxyHeader(h *ProxyHeader) {
+	if h == nil {
+		return
+	}
+	e.ProxyAuthority = h.Authority
+	if h.TLS != nil {
+		e.ProxyTLSVersion, e.ProxyTLSCipher, e.ProxyTLSClientCN = h.TLS.Version, h.TLS.CipherSuite, h.TLS.CommonName
+	}
+}
+
+// field represents a key-value pair of the entry in the output order.
+type field struct {
+	key   string
+	value interface{}
+}
+
+// fields returns the non-empty fields of the entry in the output order.
+func (e *AccessLogEntry) fields() []field {
+	fs := make([]field, 0, 20)
+	add := func(key string, value interface{}, empty bool) {
+		if !empty {
+			fs = append(fs, field{key: key, value: value})
+		}
+	}
+	add("time", e.Time.Format(time.RFC3339Nano), false)
+	add("request_id", e.RequestID, e.RequestID == "")
+	add("client_ip", e.ClientIP, e.ClientIP == "")
+	add("protocol", e.Protocol, e.Protocol == "")
+	add("method", e.Method, false)
+	add("path", e.Path, false)
+	add("status", e.Status, false)
+	add("principal", e.Principal, e.Principal == "")
+	add("domain", e.Domain, e.Domain == "")
+	add("roles", e.Roles, len(e.Roles) == 0)
+	add("client_id", e.ClientID, e.ClientID == "")
+	add("credential_type", e.CredentialType, e.CredentialType == "")
+	add("decision", e.Decision, e.Decision == "")
+	add("reason", e.Reason, e.Reason == "")
+	add("proxy_authority", e.ProxyAuthority, e.ProxyAuthority == "")
+	add("proxy_tls_version", e.ProxyTLSVersion, e.ProxyTLSVersion == "")
+	add("proxy_tls_cipher", e.ProxyTLSCipher, e.ProxyTLSCipher == "")
+	add("proxy_tls_client_cn", e.ProxyTLSClientCN, e.ProxyTLSClientCN == "")
+	add("upstream_status", e.UpstreamStatus, e.UpstreamStatus == 0)
+	add("bytes_in", e.BytesIn, false)
+	add("bytes_out", e.BytesOut, false)
+	add("latency_ms", milliseconds(e.Latency), false)
+	add("authz_latency_ms", milliseconds(e.AuthzLatency), false)
+	add("upstream_latency_ms", milliseconds(e.UpstreamLatency), false)
+	return fs
+}
+
+// AccessLogger writes the access log entries.
+// All methods are safe to call on a nil *AccessLogger, which does nothing.
+type AccessLogger struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer
+	logfmt bool
+
+	// sampling rates sorted by the path prefix length in descending order
+	sampling []config.AccessLogSampling
+}
+
+// NewAccessLogger creates the access logger from the configuration.
+// It returns nil if the access log is disabled.
+func NewAccessLogger(cfg config.AccessLog) (*AccessLogger, error) {
+	if !cfg.Enable {
+		return nil, nil
+	}
+
+	l := &AccessLogger{
+		w:        os.Stdout,
+		logfmt:   cfg.Format == config.AccessLogLogfmt,
+		sampling: make([]config.AccessLogSampling, len(cfg.Sampling)),
+	}
+	if cfg.Path != "" && cfg.Path != config.AccessLogStdout {
+		f, err := os.OpenFile(cfg.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot open access log file")
+		}
+		l.w = f
+		l.closer = f
+	}
+	copy(l.sampling, cfg.Sampling)
+	sort.SliceStable(l.sampling, func(i, j int) bool {
+		return len(l.sampling[i].Path) > len(l.sampling[j].Path)
+	})
+
+	return l, nil
+}
+
+// Enabled returns whether the access log is enabled.
+func (l *AccessLogger) Enabled() bool {
+	return l != nil
+}
+
+// Sampled returns whether the request to the path should be logged. Denied requests are always logged.
+func (l *AccessLogger) Sampled(path string, denied bool) bool {
+	if l == nil {
+		return false
+	}
+	if denied {
+		return true
+	}
+	for _, s := range l.sampling {
+		if strings.HasPrefix(path, s.Path) {
+			return s.Rate >= 1 || rand.Float64() < s.Rate
+		}
+	}
+	return true
+}
+
+// Log writes the entry as a line.
+func (l *AccessLogger) Log(e AccessLogEntry) {
+	if l == nil {
+		return
+	}
+
+	buf := new(bytes.Buffer)
+	if l.logfmt {
+		encodeLogfmt(buf, e.fields())
+	} else {
+		encodeJSON(buf, e.fields())
+	}
+	buf.WriteByte('\n')
+
+	l.mu.Lock()
+	_, err := l.w.Write(buf.Bytes())
+	l.mu.Unlock()
+	if err != nil {
+		glg.Warnf("cannot write access log: %v", err)
+	}
+}
+
+// Close closes the access log file.
+func (l *AccessLogger) Close() error {
+	if l == nil || l.closer == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.closer.Close()
+}
+
+// CredentialType returns the type of the credential which the principal is authorized by.
+func CredentialType(p authorizerd.Principal) string {
+	switch p.(type) {
+	case nil:
+		return ""
+	case authorizerd.OAuthAccessToken:
+		return CredentialAccessToken
+	case *roleCertPrincipal:
+		return CredentialRoleCertificate
+	default:
+		return CredentialRoleToken
+	}
+}
+
+// principalOf returns the name, domain, roles and client ID of the principal.
+func principalOf(p authorizerd.Principal) (name, domain string, roles []string, clientID string) {
+	if c, ok := p.(authorizerd.OAuthAccessToken); ok {
+		clientID = c.ClientID()
+	}
+	return p.Name(), p.Domain(), p.Roles(), clientID
+}
+
+func encodeJSON(buf *bytes.Buffer, fs []field) {
+	buf.WriteByte('{')
+	for i, f := range fs {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, _ := json.Marshal(f.key)
+		v, err := json.Marshal(f.value)
+		if err != nil {
+			v, _ = json.Marshal(err.Error())
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+}
+
+func encodeLogfmt(buf *bytes.Buffer, fs []field) {
+	for i, f := range fs {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(f.key)
+		buf.WriteByte('=')
+
+		var v string
+		switch val := f.value.(type) {
+		case string:
+			v = val
+		case []string:
+			v = strings.Join(val, ",")
+		case int:
+			v = strconv.Itoa(val)
+		case int64:
+			v = strconv.FormatInt(val, 10)
+		case float64:
+			v = strconv.FormatFloat(val, 'f', -1, 64)
+		}
+		if v == "" || strings.ContainsAny(v, " =\"\\") || strings.IndexFunc(v, isControl) >= 0 {
+			v = strconv.Quote(v)
+		}
+		buf.WriteString(v)
+	}
+}
+
+func isControl(r rune) bool {
+	return r < ' ' || r == 0x7f
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
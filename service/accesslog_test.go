@@ -0,0 +1,276 @@
+package service
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	authorizerd "github.com/yahoojapan/athenz-authorizer/v5"
+
+	"github.com/yahoojapan/authorization-proxy/v4/config"
+)
+
+type accessTokenMock struct {
+	authorizerd.Principal
+	clientID string
+}
+
+func (a *accessTokenMock) ClientID() string {
+	return a.clientID
+}
+
+func TestNewAccessLogger(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     func(dir string) config.AccessLog
+		wantNil bool
+		wantErr bool
+	}{
+		{
+			name: "return nil when the access log is disabled",
+			cfg: func(string) config.AccessLog {
+				return config.AccessLog{}
+			},
+			wantNil: true,
+		},
+		{
+			name: "return error when the output file cannot be opened",
+			cfg: func(dir string) config.AccessLog {
+				return config.AccessLog{
+					Enable: true,
+					Path:   filepath.Join(dir, "not_exist", "access.log"),
+				}
+			},
+			wantNil: true,
+			wantErr: true,
+		},
+		{
+			name: "create the logger to the standard output",
+			cfg: func(string) config.AccessLog {
+				return config.AccessLog{
+					Enable: true,
+					Path:   config.AccessLogStdout,
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewAccessLogger(tt.cfg(t.TempDir()))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewAccessLogger() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if (got == nil) != tt.wantNil {
+				t.Errorf("NewAccessLogger() = %v, wantNil %v", got, tt.wantNil)
+			}
+			if err := got.Close(); err != nil {
+				t.Errorf("Close() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestAccessLogger_Log(t *testing.T) {
+	e := AccessLogEntry{
+		Time:            time.Date(2022, 11, 1, 9, 0, 0, 0, time.UTC),
+		RequestID:       "req-1",
+		ClientIP:        "192.0.2.1",
+		Protocol:        "http",
+		Method:          "GET",
+		Path:            "/api",
+		Status:          401,
+		Decision:        DecisionDenied,
+		Reason:          `role token "expired"`,
+		BytesOut:        12,
+		Latency:         1500 * time.Microsecond,
+		AuthzLatency:    time.Millisecond,
+		UpstreamLatency: 0,
+	}
+	tests := []struct {
+		name   string
+		format string
+		want   string
+	}{
+		{
+			name:   "write the entry in JSON",
+			format: config.AccessLogJSON,
+			want:   `{"time":"2022-11-01T09:00:00Z","request_id":"req-1","client_ip":"192.0.2.1","protocol":"http","method":"GET","path":"/api","status":401,"decision":"denied","reason":"role token \"expired\"","bytes_in":0,"bytes_out":12,"latency_ms":1.5,"authz_latency_ms":1,"upstream_latency_ms":0}` + "\n",
+		},
+		{
+			name:   "write the entry in logfmt",
+			format: config.AccessLogLogfmt,
+			want:   `time=2022-11-01T09:00:00Z request_id=req-1 client_ip=192.0.2.1 protocol=http method=GET path=/api status=401 decision=denied reason="role token \"expired\"" bytes_in=0 bytes_out=12 latency_ms=1.5 authz_latency_ms=1 upstream_latency_ms=0` + "\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := new(bytes.Buffer)
+			l, _ := NewAccessLogger(config.AccessLog{
+				Enable: true,
+				Format: tt.format,
+			})
+			l.w = buf
+			l.Log(e)
+			if got := buf.String(); got != tt.want {
+				t.Errorf("Log() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAccessLogger_Log_file(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	l, err := NewAccessLogger(config.AccessLog{
+		Enable: true,
+		Path:   path,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Log(AccessLogEntry{Method: "GET", Path: "/first"})
+	l.Log(AccessLogEntry{Method: "GET", Path: "/second"})
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `"path":"/first"`) || !strings.Contains(lines[1], `"path":"/second"`) {
+		t.Errorf("unexpected access log: %s", b)
+	}
+}
+
+func TestAccessLogger_Sampled(t *testing.T) {
+	l, _ := NewAccessLogger(config.AccessLog{
+		Enable: true,
+		Sampling: []config.AccessLogSampling{
+			{Path: "/api", Rate: 1},
+			{Path: "/api/health", Rate: 0},
+		},
+	})
+	tests := []struct {
+		name   string
+		l      *AccessLogger
+		path   string
+		denied bool
+		want   bool
+	}{
+		{
+			name: "not sampled when the logger is nil",
+			path: "/api",
+			want: false,
+		},
+		{
+			name: "sampled when no prefix matches",
+			l:    l,
+			path: "/other",
+			want: true,
+		},
+		{
+			name: "the longest prefix is applied",
+			l:    l,
+			path: "/api/health/check",
+			want: false,
+		},
+		{
+			name: "the shorter prefix is applied",
+			l:    l,
+			path: "/api/users",
+			want: true,
+		},
+		{
+			name:   "denied request is always sampled",
+			l:      l,
+			path:   "/api/health",
+			denied: true,
+			want:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.l.Sampled(tt.path, tt.denied); got != tt.want {
+				t.Errorf("Sampled() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAccessLogEntry_SetPrincipal(t *testing.T) {
+	tests := []struct {
+		name string
+		p    authorizerd.Principal
+		want AccessLogEntry
+	}{
+		{
+			name: "nil principal is ignored",
+		},
+		{
+			name: "set the role certificate principal",
+			p: &roleCertPrincipal{
+				name:   "user",
+				domain: "domain",
+				roles:  []string{"admin"},
+			},
+			want: AccessLogEntry{
+				Principal:      "user",
+				Domain:         "domain",
+				Roles:          []string{"admin"},
+				CredentialType: CredentialRoleCertificate,
+			},
+		},
+		{
+			name: "set the access token principal",
+			p: &accessTokenMock{
+				Principal: &roleCertPrincipal{
+					name:   "client",
+					domain: "domain",
+				},
+				clientID: "client-id",
+			},
+			want: AccessLogEntry{
+				Principal:      "client",
+				Domain:         "domain",
+				ClientID:       "client-id",
+				CredentialType: CredentialAccessToken,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got AccessLogEntry
+			got.SetPrincipal(tt.p)
+			if got.Principal != tt.want.Principal || got.Domain != tt.want.Domain || strings.Join(got.Roles, ",") != strings.Join(tt.want.Roles, ",") ||
+				got.ClientID != tt.want.ClientID || got.CredentialType != tt.want.CredentialType {
+				t.Errorf("SetPrincipal() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAccessLogEntry_SetProxyHeader(t *testing.T) {
+	e := AccessLogEntry{}
+	e.SetProxyHeader(nil)
+	if e.ProxyAuthority != "" || e.ProxyTLSVersion != "" {
+		t.Errorf("SetProxyHeader(nil) = %+v", e)
+	}
+
+	e.SetProxyHeader(&ProxyHeader{
+		Version:   2,
+		Authority: "proxy.example.com",
+		TLS: &ProxyTLS{
+			Version:     "TLSv1.3",
+			CipherSuite: "TLS_AES_128_GCM_SHA256",
+			CommonName:  "client",
+		},
+	})
+	if e.ProxyAuthority != "proxy.example.com" || e.ProxyTLSVersion != "TLSv1.3" || e.ProxyTLSCipher != "TLS_AES_128_GCM_SHA256" || e.ProxyTLSClientCN != "client" {
+		t.Errorf("SetProxyHeader() = %+v", e)
+	}
+}
@@ -0,0 +1,333 @@
+/*
+Copyright (C)  2018 Yahoo Japan Corporation Athenz team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kpango/glg"
+	"github.com/pkg/errors"
+	authorizerd "github.com/yahoojapan/athenz-authorizer/v5"
+
+	"github.com/yahoojapan/authorization-proxy/v4/config"
+)
+
+// GenesisAuditHash represents the previous hash of the first record of an audit chain.
+var GenesisAuditHash = strings.Repeat("0", sha256.Size*2)
+
+// auditHashField represents the trailing field of the audit record, the hash is computed over the record before it.
+const auditHashField = `,"hash":"`
+
+// AuditEvent represents an authorization decision to be audited.
+type AuditEvent struct {
+	Time      time.Time
+	RequestID string
+	ClientIP  string
+	Protocol  string
+	Action    string
+	Resource  string
+
+	Principal      string
+	Domain         string
+	Roles          []string
+	ClientID       string
+	CredentialType string
+
+	Decision string
+	Reason   string
+}
+
+// SetPrincipal sets the authorized principal to the event.
+func (e *AuditEvent) SetPrincipal(p authorizerd.Principal) {
+	if p == nil {
+		return
+	}
+	e.Principal, e.Domain, e.Roles, e.ClientID = principalOf(p)
+	e.CredentialType = CredentialType(p)
+}
+
+// auditRecord represents an audit record written as a JSON line, followed by the hash field.
+type auditRecord struct {
+	Seq            uint64   `json:"seq"`
+	Time           string   `json:"time"`
+	RequestID      string   `json:"request_id,omitempty"`
+	ClientIP       string   `json:"client_ip,omitempty"`
+	Protocol       string   `json:"protocol"`
+	Action         string   `json:"action"`
+	Resource       string   `json:"resource"`
+	Principal      string   `json:"principal,omitempty"`
+	Domain         string   `json:"domain,omitempty"`
+	Roles          []string `json:"roles,omitempty"`
+	ClientID       string   `json:"client_id,omitempty"`
+	CredentialType string   `json:"credential_type,omitempty"`
+	Decision       string   `json:"decision"`
+	Reason         string   `json:"reason,omitempty"`
+	Prev           string   `json:"prev"`
+}
+
+// auditSink represents the output of the audit records.
+type auditSink interface {
+	// Write writes a record line without the trailing newline.
+	Write(line []byte) error
+	Close() error
+}
+
+// AuditLogger writes the hash-chained audit records of the authorization decisions.
+// All methods are safe to call on a nil *AuditLogger, which does nothing.
+type AuditLogger struct {
+	mu   sync.Mutex
+	sink auditSink
+	key  []byte
+	seq  uint64
+	prev string
+
+	resources []string
+}
+
+// NewAuditLogger creates the audit logger from the configuration.
+// The chain is continued from the last record of the audit log file if it exists.
+// It returns nil if the audit log is disabled.
+func NewAuditLogger(cfg config.Audit) (*AuditLogger, error) {
+	if !cfg.Enable {
+		return nil, nil
+	}
+
+	a := &AuditLogger{
+		prev:      GenesisAuditHash,
+		resources: cfg.Resources,
+	}
+	if cfg.HMACKeyPath != "" {
+		key, err := ReadAuditKey(cfg.HMACKeyPath)
+		if err != nil {
+			return nil, err
+		}
+		a.key = key
+	}
+
+	var err error
+	if cfg.Output == config.AuditSyslogOutput {
+		a.sink, err = newAuditSyslog(cfg.Syslog)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot connect to syslog")
+		}
+		glg.Info("audit log enabled, output: syslog")
+		return a, nil
+	}
+
+	f, last, err := newAuditFile(cfg.Path, cfg.MaxSize, cfg.MaxBackups)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot open audit log file")
+	}
+	a.sink = f
+	if last != nil {
+		seq, h, _, err := a.parseRecord(last)
+		if err != nil {
+			glg.Warnf("cannot continue the audit chain, a new chain is started: %v", err)
+		} else {
+			a.seq, a.prev = seq, h
+		}
+	}
+	glg.Infof("audit log enabled, output: %s, sequence: %d", cfg.Path, a.seq)
+	return a, nil
+}
+
+// Audited returns whether the decisions on the resource are audited.
+func (a *AuditLogger) Audited(resource string) bool {
+	if a == nil {
+		return false
+	}
+	if len(a.resources) == 0 {
+		return true
+	}
+	for _, r := range a.resources {
+		if strings.HasPrefix(resource, r) {
+			return true
+		}
+	}
+	return false
+}
+
+// Record writes the event as the next record of the chain.
+func (a *AuditLogger) Record(e AuditEvent) {
+	if !a.Audited(e.Resource) {
+		return
+	}
+
+	r := auditRecord{
+		Time:           e.Time.UTC().Format(time.RFC3339Nano),
+		RequestID:      e.RequestID,
+		ClientIP:       e.ClientIP,
+		Protocol:       e.Protocol,
+		Action:         e.Action,
+		Resource:       e.Resource,
+		Principal:      e.Principal,
+		Domain:         e.Domain,
+		Roles:          e.Roles,
+		ClientID:       e.ClientID,
+		CredentialType: e.CredentialType,
+		Decision:       e.Decision,
+		Reason:         e.Reason,
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	r.Seq = a.seq + 1
+	r.Prev = a.prev
+	b, err := json.Marshal(r)
+	if err != nil {
+		glg.Errorf("cannot encode audit record: %v", err)
+		return
+	}
+	body := b[:len(b)-1]
+	h := a.hash(body)
+	line := make([]byte, 0, len(body)+len(auditHashField)+len(h)+2)
+	line = append(append(append(append(line, body...), auditHashField...), h...), '"', '}')
+	if err := a.sink.Write(line); err != nil {
+		glg.Errorf("cannot write audit record: %v", err)
+		return
+	}
+	a.seq, a.prev = r.Seq, h
+}
+
+// Close closes the audit log output.
+func (a *AuditLogger) Close() error {
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.sink.Close()
+}
+
+func (a *AuditLogger) hash(body []byte) string {
+	var h hash.Hash
+	if a.key != nil {
+		h = hmac.New(sha256.New, a.key)
+	} else {
+		h = sha256.New()
+	}
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// parseRecord verifies the hash of the record line, and returns its sequence number, hash and previous hash.
+func (a *AuditLogger) parseRecord(line []byte) (seq uint64, h, prev string, err error) {
+	// skip the prefix added by the output, e.g. syslog header
+	if i := bytes.IndexByte(line, '{'); i > 0 {
+		line = line[i:]
+	}
+	i := bytes.LastIndex(line, []byte(auditHashField))
+	if i < 0 || !bytes.HasSuffix(line, []byte(`"}`)) {
+		return 0, "", "", errors.New("hash field not found")
+	}
+	body := line[:i]
+	h = string(line[i+len(auditHashField) : len(line)-2])
+	if !hmac.Equal([]byte(a.hash(body)), []byte(h)) {
+		return 0, "", "", errors.New("hash mismatch")
+	}
+
+	var r auditRecord
+	if err := json.Unmarshal(append(body, '}'), &r); err != nil {
+		return 0, "", "", errors.Wrap(err, "invalid record")
+	}
+	return r.Seq, h, r.Prev, nil
+}
+
+// AuditVerifier verifies the hash chain of the audit records.
+// The records of the rotated files should be verified in the order they were written, by calling Verify for each file.
+type AuditVerifier struct {
+	a *AuditLogger
+
+	// Records represents the number of the verified records.
+	Records uint64
+	// AllowRestarts represents whether to accept the new chains started in the middle.
+	// A new chain is indistinguishable from the records removed before a forged first record, therefore it is rejected by default.
+	AllowRestarts bool
+	// Restarts represents the number of the new chains started in the middle, e.g. when the chain cannot be continued on restart.
+	Restarts uint64
+	// First represents the sequence number of the first verified record. It is greater than 1 if the earlier records are not verified.
+	First uint64
+	// Last represents the hash of the last verified record.
+	Last string
+
+	seq uint64
+}
+
+// NewAuditVerifier returns an AuditVerifier. The key should be the HMAC key used to write the records, or nil if HMAC is not used.
+func NewAuditVerifier(key []byte) *AuditVerifier {
+	return &AuditVerifier{
+		a: &AuditLogger{key: key},
+	}
+}
+
+// Verify verifies the records read from r, continuing the chain verified so far.
+// It returns an error indicating the line of the first broken record.
+func (v *AuditVerifier) Verify(r io.Reader) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; sc.Scan(); n++ {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		seq, h, prev, err := v.a.parseRecord(line)
+		if err != nil {
+			return errors.Wrapf(err, "line %d", n)
+		}
+		switch {
+		case v.Records == 0:
+			v.First = seq
+		case seq == 1 && prev == GenesisAuditHash:
+			if !v.AllowRestarts {
+				return errors.Errorf("line %d: new chain started after the record %d", n, v.seq)
+			}
+			v.Restarts++
+		case seq != v.seq+1:
+			return errors.Errorf("line %d: sequence %d does not follow %d", n, seq, v.seq)
+		case prev != v.Last:
+			return errors.Errorf("line %d: previous hash does not match the record %d", n, v.seq)
+		}
+		v.Records++
+		v.seq = seq
+		v.Last = h
+	}
+	return sc.Err()
+}
+
+// ReadAuditKey reads the HMAC key of the audit chain from the file.
+func ReadAuditKey(path string) ([]byte, error) {
+	key, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot read audit HMAC key")
+	}
+	key = bytes.TrimSpace(key)
+	if len(key) == 0 {
+		return nil, errors.New("audit HMAC key is empty")
+	}
+	return key, nil
+}
@@ -0,0 +1,130 @@
+/*
+Copyright (C)  2018 Yahoo Japan Corporation Athenz team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"bytes"
+	"io"
+	"log/syslog"
+	"os"
+
+	"github.com/kpango/glg"
+
+	"github.com/yahoojapan/authorization-proxy/v4/config"
+)
+
+const (
+	// defaultAuditMaxSize represents the default maximum size in megabytes of the audit log file.
+	defaultAuditMaxSize = 100
+
+	// defaultAuditSyslogTag represents the default syslog tag of the audit records.
+	defaultAuditSyslogTag = "authorization-proxy-audit"
+
+	// auditTailSize represents the size of the file tail read to find the last record.
+	auditTailSize = 64 * 1024
+)
+
+// auditFile writes the audit records to a local file, and rotates the file by size.
+type auditFile struct {
+	*rotatingFile
+}
+
+// newAuditFile opens the audit log file for appending, and returns the last record line of the current file or the latest rotated file.
+func newAuditFile(path string, maxSize, maxBackups int) (*auditFile, []byte, error) {
+	if maxSize == 0 {
+		maxSize = defaultAuditMaxSize
+	}
+	f, err := newRotatingFile(path, 0o600, maxSize, 0, maxBackups, func(format string, args ...interface{}) {
+		glg.Warnf(format, args...)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	a := &auditFile{f}
+
+	last, err := lastLine(path)
+	if err == nil && last == nil {
+		if backups := a.backups(); len(backups) > 0 {
+			last, err = lastLine(backups[len(backups)-1])
+		}
+	}
+	if err != nil {
+		a.Close()
+		return nil, nil, err
+	}
+	return a, last, nil
+}
+
+// Write writes the line. If the rotation fails, the line is written to the current file to keep the chain.
+func (a *auditFile) Write(line []byte) error {
+	_, err := a.rotatingFile.Write(append(line, '\n'))
+	return err
+}
+
+// lastLine returns the last non-empty line of the file, or nil if the file is empty.
+func lastLine(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	off := fi.Size() - auditTailSize
+	if off < 0 {
+		off = 0
+	}
+	b := make([]byte, fi.Size()-off)
+	if _, err := f.ReadAt(b, off); err != nil && err != io.EOF {
+		return nil, err
+	}
+	b = bytes.TrimRight(b, "\n")
+	if len(b) == 0 {
+		return nil, nil
+	}
+	return b[bytes.LastIndexByte(b, '\n')+1:], nil
+}
+
+// auditSyslog sends the audit records to syslog.
+type auditSyslog struct {
+	w *syslog.Writer
+}
+
+func newAuditSyslog(cfg config.AuditSyslog) (*auditSyslog, error) {
+	tag := cfg.Tag
+	if tag == "" {
+		tag = defaultAuditSyslogTag
+	}
+	w, err := syslog.Dial(cfg.Network, cfg.Address, syslog.LOG_INFO|syslog.LOG_AUTH, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &auditSyslog{w: w}, nil
+}
+
+// Write sends the line as a syslog message.
+func (a *auditSyslog) Write(line []byte) error {
+	return a.w.Info(string(line))
+}
+
+// Close closes the connection to syslog.
+func (a *auditSyslog) Close() error {
+	return a.w.Close()
+}
@@ -0,0 +1,309 @@
+package service
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yahoojapan/authorization-proxy/v4/config"
+)
+
+func newTestAuditEvent(resource, decision string) AuditEvent {
+	return AuditEvent{
+		Time:     time.Date(2022, 11, 1, 9, 0, 0, 0, time.UTC),
+		Protocol: "http",
+		Action:   "GET",
+		Resource: resource,
+		Decision: decision,
+	}
+}
+
+func verifyAuditFiles(key []byte, paths ...string) (*AuditVerifier, error) {
+	v := NewAuditVerifier(key)
+	for _, path := range paths {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := v.Verify(bytes.NewReader(b)); err != nil {
+			return v, err
+		}
+	}
+	return v, nil
+}
+
+func TestNewAuditLogger(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     func(dir string) config.Audit
+		wantNil bool
+		wantErr bool
+	}{
+		{
+			name: "return nil when the audit log is disabled",
+			cfg: func(string) config.Audit {
+				return config.Audit{}
+			},
+			wantNil: true,
+		},
+		{
+			name: "return error when the output file cannot be opened",
+			cfg: func(dir string) config.Audit {
+				return config.Audit{
+					Enable: true,
+					Path:   filepath.Join(dir, "not_exist", "audit.log"),
+				}
+			},
+			wantNil: true,
+			wantErr: true,
+		},
+		{
+			name: "return error when the HMAC key cannot be read",
+			cfg: func(dir string) config.Audit {
+				return config.Audit{
+					Enable:      true,
+					Path:        filepath.Join(dir, "audit.log"),
+					HMACKeyPath: filepath.Join(dir, "not_exist"),
+				}
+			},
+			wantNil: true,
+			wantErr: true,
+		},
+		{
+			name: "create the logger to the file",
+			cfg: func(dir string) config.Audit {
+				return config.Audit{
+					Enable: true,
+					Path:   filepath.Join(dir, "audit.log"),
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewAuditLogger(tt.cfg(t.TempDir()))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewAuditLogger() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if (got == nil) != tt.wantNil {
+				t.Errorf("NewAuditLogger() = %v, wantNil %v", got, tt.wantNil)
+			}
+			if err := got.Close(); err != nil {
+				t.Errorf("Close() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestAuditLogger_Record(t *testing.T) {
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "key")
+	if err := ioutil.WriteFile(keyPath, []byte("secret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "audit.log")
+	cfg := config.Audit{
+		Enable:      true,
+		Path:        path,
+		HMACKeyPath: keyPath,
+		Resources:   []string{"/admin"},
+	}
+
+	a, err := NewAuditLogger(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Record(newTestAuditEvent("/admin/users", DecisionAllowed))
+	a.Record(newTestAuditEvent("/public", DecisionAllowed))
+	a.Record(newTestAuditEvent("/admin/users", DecisionDenied))
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the chain is continued after restart
+	a, err = NewAuditLogger(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Record(newTestAuditEvent("/admin/roles", DecisionAllowed))
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("audit log has %d records, want 3: %s", len(lines), b)
+	}
+	if want := `{"seq":1,"time":"2022-11-01T09:00:00Z","protocol":"http","action":"GET","resource":"/admin/users","decision":"allowed","prev":"` + GenesisAuditHash + `","hash":"`; !strings.HasPrefix(lines[0], want) {
+		t.Errorf("first record = %s, want prefix %s", lines[0], want)
+	}
+
+	v, err := verifyAuditFiles([]byte("secret"), path)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if v.Records != 3 || v.First != 1 || v.Restarts != 0 {
+		t.Errorf("Verify() records = %d, first = %d, restarts = %d", v.Records, v.First, v.Restarts)
+	}
+
+	if _, err := verifyAuditFiles(nil, path); err == nil {
+		t.Error("Verify() without the HMAC key succeeded")
+	}
+}
+
+func TestAuditLogger_Record_rotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	a, err := NewAuditLogger(config.Audit{
+		Enable:     true,
+		Path:       path,
+		MaxBackups: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// rotate every 2 records
+	a.sink.(*auditFile).maxSize = 600
+	for i := 0; i < 8; i++ {
+		a.Record(newTestAuditEvent("/api", DecisionAllowed))
+	}
+	backups := a.sink.(*auditFile).backups()
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(backups) != 2 {
+		t.Fatalf("rotated files = %v, want 2 files", backups)
+	}
+	v, err := verifyAuditFiles(nil, append(backups, path)...)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if v.Records != 6 || v.First != 3 {
+		t.Errorf("Verify() records = %d, first = %d, want 6 records from 3", v.Records, v.First)
+	}
+}
+
+func TestAuditVerifier_Verify(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	a, err := NewAuditLogger(config.Audit{
+		Enable: true,
+		Path:   path,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, res := range []string{"/a", "/b", "/c"} {
+		a.Record(newTestAuditEvent(res, DecisionDenied))
+	}
+	a.Close()
+	b, _ := ioutil.ReadFile(path)
+	lines := strings.SplitAfter(strings.TrimSpace(string(b)), "\n")
+
+	// another chain, e.g. forged without the HMAC key
+	forgedPath := filepath.Join(t.TempDir(), "audit.log")
+	forger, err := NewAuditLogger(config.Audit{
+		Enable: true,
+		Path:   forgedPath,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	forger.Record(newTestAuditEvent("/forged", DecisionAllowed))
+	forger.Close()
+	forged, _ := ioutil.ReadFile(forgedPath)
+
+	tests := []struct {
+		name          string
+		records       string
+		allowRestarts bool
+		wantRestarts  uint64
+		wantErr       string
+	}{
+		{
+			name:    "verify the chain",
+			records: string(b),
+		},
+		{
+			name:    "verify the chain started in the middle",
+			records: lines[1] + lines[2],
+		},
+		{
+			name:    "detect the modified record",
+			records: lines[0] + strings.Replace(lines[1], `"decision":"denied"`, `"decision":"allowed"`, 1) + lines[2],
+			wantErr: "line 2: hash mismatch",
+		},
+		{
+			name:    "detect the removed record",
+			records: lines[0] + lines[2],
+			wantErr: "line 2: sequence 3 does not follow 1",
+		},
+		{
+			name:    "detect the records truncated before a new chain",
+			records: lines[0] + lines[1] + lines[0],
+			wantErr: "line 3: new chain started after the record 2",
+		},
+		{
+			name:    "detect the forged chain appended after the truncation",
+			records: lines[0] + string(forged),
+			wantErr: "line 2: new chain started after the record 1",
+		},
+		{
+			name:          "verify the new chain when restarts are allowed",
+			records:       lines[0] + string(forged),
+			allowRestarts: true,
+			wantRestarts:  1,
+		},
+		{
+			name:    "detect the record without hash",
+			records: `{"seq":1}`,
+			wantErr: "line 1: hash field not found",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := NewAuditVerifier(nil)
+			v.AllowRestarts = tt.allowRestarts
+			err := v.Verify(strings.NewReader(tt.records))
+			if (err == nil && tt.wantErr != "") || (err != nil && err.Error() != tt.wantErr) {
+				t.Errorf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if v.Restarts != tt.wantRestarts {
+				t.Errorf("Verify() restarts = %d, want %d", v.Restarts, tt.wantRestarts)
+			}
+		})
+	}
+}
+
+func TestAuditLogger_restart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	cfg := config.Audit{
+		Enable: true,
+		Path:   path,
+	}
+	a, _ := NewAuditLogger(cfg)
+	a.Record(newTestAuditEvent("/a", DecisionAllowed))
+	a.Close()
+
+	// the last record is broken, a new chain is started
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	f.WriteString("broken\n")
+	f.Close()
+	a, err := NewAuditLogger(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.seq != 0 || a.prev != GenesisAuditHash {
+		t.Errorf("NewAuditLogger() seq = %d, prev = %s, want a new chain", a.seq, a.prev)
+	}
+	a.Close()
+}
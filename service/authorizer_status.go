@@ -0,0 +1,483 @@
+/*
+Copyright (C)  2018 Yahoo Japan Corporation Athenz team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kpango/glg"
+
+	"github.com/yahoojapan/authorization-proxy/v4/config"
+)
+
+const (
+	// ComponentPolicyd represents the authorizer component fetching the policies.
+	ComponentPolicyd = "policyd"
+	// ComponentPubkeyd represents the authorizer component fetching the public keys.
+	ComponentPubkeyd = "pubkeyd"
+	// ComponentJwkd represents the authorizer component fetching the JWK.
+	ComponentJwkd = "jwkd"
+
+	// AuthorizerStatusPath represents the path of the authorizer status on the health check server.
+	AuthorizerStatusPath = "/status/authorizer"
+
+	// defaultFailureThreshold represents the default number of the consecutive fetch failures to warn.
+	defaultFailureThreshold = 3
+	// defaultMaxAgeFactor represents the default maximum cache age as the multiple of the refresh period.
+	defaultMaxAgeFactor = 3
+	// defaultStatusCheckPeriod represents the default period to check the cache age.
+	defaultStatusCheckPeriod = time.Minute
+	// defaultSysAuthDomain represents the default domain of the Athenz public keys.
+	defaultSysAuthDomain = "sys.auth"
+)
+
+// pubkeyEnvs represents the Athenz environments whose public keys are fetched by pubkeyd.
+var pubkeyEnvs = []string{"zts", "zms"}
+
+// defaultRefreshPeriods represents the default refresh periods of the athenz-authorizer components.
+var defaultRefreshPeriods = map[string]time.Duration{
+	ComponentPolicyd: 30 * time.Minute,
+	ComponentPubkeyd: 24 * time.Hour,
+	ComponentJwkd:    24 * time.Hour,
+}
+
+// AuthorizerStatus tracks the live status of the authorizer components, and logs a warning when a component crosses the thresholds.
+// The status is updated by the fetches from Athenz and the errors reported by the authorizer.
+// All methods are safe to call on a nil *AuthorizerStatus, which does nothing.
+type AuthorizerStatus struct {
+	mu               sync.Mutex
+	started          time.Time
+	failureThreshold int
+	checkPeriod      time.Duration
+	components       map[string]*componentState
+}
+
+// componentState represents the internal state of an authorizer component.
+type componentState struct {
+	maxAge        time.Duration
+	targets       map[string]*targetState
+	lastError     string
+	lastErrorTime time.Time
+	errors        uint64
+
+	// whether all targets are fetched successfully once
+	loaded bool
+	// whether the component is reported as unhealthy
+	unhealthy bool
+}
+
+// targetState represents the fetch state of a domain, or a JWK host.
+type targetState struct {
+	lastSuccess         time.Time
+	lastFailure         time.Time
+	lastError           string
+	consecutiveFailures int
+}
+
+// ComponentStatus represents the status of an authorizer component.
+type ComponentStatus struct {
+	Healthy             bool                    `json:"healthy"`
+	Loaded              bool                    `json:"loaded"`
+	LastSuccess         *time.Time              `json:"lastSuccess,omitempty"`
+	LastError           string                  `json:"lastError,omitempty"`
+	LastErrorTime       *time.Time              `json:"lastErrorTime,omitempty"`
+	ConsecutiveFailures int                     `json:"consecutiveFailures"`
+	CacheAgeSeconds     float64                 `json:"cacheAgeSeconds"`
+	MaxAgeSeconds       float64                 `json:"maxAgeSeconds"`
+	Errors              uint64                  `json:"errors"`
+	Targets             map[string]TargetStatus `json:"targets,omitempty"`
+}
+
+// TargetStatus represents the fetch status of a domain, or a JWK host.
+type TargetStatus struct {
+	LastSuccess         *time.Time `json:"lastSuccess,omitempty"`
+	LastFailure         *time.Time `json:"lastFailure,omitempty"`
+	LastError           string     `json:"lastError,omitempty"`
+	ConsecutiveFailures int        `json:"consecutiveFailures"`
+	CacheAgeSeconds     float64    `json:"cacheAgeSeconds"`
+}
+
+// AuthorizerStatusReport represents the status of all authorizer components.
+type AuthorizerStatusReport struct {
+	Healthy    bool                       `json:"healthy"`
+	Components map[string]ComponentStatus `json:"components"`
+}
+
+// NewAuthorizerStatus returns the status tracker of the authorizer components enabled in the configuration.
+func NewAuthorizerStatus(cfg config.Authorization) *AuthorizerStatus {
+	st := &AuthorizerStatus{
+		started:          time.Now(),
+		failureThreshold: cfg.Status.FailureThreshold,
+		checkPeriod:      parseDuration(cfg.Status.CheckPeriod, defaultStatusCheckPeriod),
+		components:       make(map[string]*componentState, 3),
+	}
+	if st.failureThreshold == 0 {
+		st.failureThreshold = defaultFailureThreshold
+	}
+
+	pc := st.add(ComponentPubkeyd, cfg.Status.PubkeyMaxAge, cfg.PublicKey.RefreshPeriod)
+	sysAuthDomain := cfg.PublicKey.SysAuthDomain
+	if sysAuthDomain == "" {
+		sysAuthDomain = defaultSysAuthDomain
+	}
+	for _, env := range pubkeyEnvs {
+		pc.targets[pubkeyTarget(sysAuthDomain, env)] = new(targetState)
+	}
+	if !cfg.Policy.Disable {
+		c := st.add(ComponentPolicyd, cfg.Status.PolicyMaxAge, cfg.Policy.RefreshPeriod)
+		for _, d := range cfg.AthenzDomains {
+			c.targets[d] = new(targetState)
+		}
+	}
+	if cfg.AccessToken.Enable {
+		st.add(ComponentJwkd, cfg.Status.JWKMaxAge, cfg.JWK.RefreshPeriod)
+	}
+	return st
+}
+
+// Reconfigure syncs the components, the maximum cache ages, the policy domains and the public key domain with the reloaded configuration.
+// The state of the kept components and domains is preserved, and the removed domains are no longer tracked.
+func (st *AuthorizerStatus) Reconfigure(cfg config.Authorization) {
+	if st == nil {
+		return
+	}
+	next := NewAuthorizerStatus(cfg)
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for name, nc := range next.components {
+		c, ok := st.components[name]
+		if !ok {
+			st.components[name] = nc
+			continue
+		}
+		c.maxAge = nc.maxAge
+		// the JWK hosts are tracked as fetched
+		if name == ComponentJwkd {
+			continue
+		}
+		for d := range c.targets {
+			if _, ok := nc.targets[d]; !ok {
+				delete(c.targets, d)
+			}
+		}
+		for d, t := range nc.targets {
+			if _, ok := c.targets[d]; !ok {
+				c.targets[d] = t
+			}
+		}
+		c.loaded = c.loaded || allFetched(c)
+	}
+	for name := range st.components {
+		if _, ok := next.components[name]; !ok {
+			delete(st.components, name)
+		}
+	}
+	st.checkLocked()
+}
+
+func (st *AuthorizerStatus) add(name, maxAge, refreshPeriod string) *componentState {
+	refresh := parseDuration(refreshPeriod, defaultRefreshPeriods[name])
+	if refresh == 0 {
+		// the zero refresh period is not valid for the authorizer
+		refresh = defaultRefreshPeriods[name]
+	}
+	c := &componentState{
+		maxAge:  parseDuration(maxAge, defaultMaxAgeFactor*refresh),
+		targets: make(map[string]*targetState),
+	}
+	st.components[name] = c
+	return c
+}
+
+// Start checks the cache age of the components periodically until the context is canceled.
+func (st *AuthorizerStatus) Start(ctx context.Context) {
+	if st == nil {
+		return
+	}
+	ticker := time.NewTicker(st.checkPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			st.check()
+		}
+	}
+}
+
+// RoundTripper returns the http.RoundTripper which records the policy, public key and JWK fetches from Athenz.
+func (st *AuthorizerStatus) RoundTripper(rt http.RoundTripper) http.RoundTripper {
+	if st == nil {
+		return rt
+	}
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	return &statusRoundTripper{
+		RoundTripper: rt,
+		st:           st,
+	}
+}
+
+type statusRoundTripper struct {
+	http.RoundTripper
+	st *AuthorizerStatus
+}
+
+func (rt *statusRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	res, err := rt.RoundTripper.RoundTrip(r)
+	if r.Context().Err() != nil {
+		// canceled by the daemon, e.g. the previous authorizer stopped on the configuration reload
+		return res, err
+	}
+
+	typ, target := refreshTarget(r)
+	if typ == refreshPubkey {
+		target = pubkeyTarget(target, path.Base(r.URL.Path))
+	}
+	switch {
+	case err != nil:
+		rt.st.fetched(refreshComponent(typ), target, err.Error())
+	// 304 Not Modified is returned when the cached data is still valid
+	case res.StatusCode >= http.StatusBadRequest:
+		rt.st.fetched(refreshComponent(typ), target, res.Status)
+	default:
+		rt.st.fetched(refreshComponent(typ), target, "")
+	}
+	return res, err
+}
+
+// fetched records the result of the fetch, errMsg is empty if the fetch succeeded.
+func (st *AuthorizerStatus) fetched(component, target, errMsg string) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	c, ok := st.components[component]
+	if !ok {
+		return
+	}
+	t, ok := c.targets[target]
+	if !ok {
+		t = new(targetState)
+		c.targets[target] = t
+	}
+
+	now := time.Now()
+	if errMsg == "" {
+		t.lastSuccess = now
+		t.consecutiveFailures = 0
+	} else {
+		t.lastFailure = now
+		t.lastError = errMsg
+		t.consecutiveFailures++
+		c.lastError = target + ": " + errMsg
+		c.lastErrorTime = now
+	}
+	if !c.loaded {
+		c.loaded = allFetched(c)
+	}
+	st.checkComponent(component, c, now)
+}
+
+// AuthorizerError records the error reported by the authorizer.
+func (st *AuthorizerStatus) AuthorizerError(err error) {
+	if st == nil || err == nil {
+		return
+	}
+	component := errorComponent(err)
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	c, ok := st.components[component]
+	if !ok {
+		return
+	}
+	c.errors++
+	c.lastError = err.Error()
+	c.lastErrorTime = time.Now()
+}
+
+// Report returns the current status of the components.
+func (st *AuthorizerStatus) Report() AuthorizerStatusReport {
+	r := AuthorizerStatusReport{
+		Healthy:    true,
+		Components: make(map[string]ComponentStatus),
+	}
+	if st == nil {
+		return r
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	now := time.Now()
+	for name, c := range st.components {
+		cs := st.status(c, now)
+		r.Components[name] = cs
+		r.Healthy = r.Healthy && cs.Healthy
+	}
+	return r
+}
+
+// Handler returns the handler serving the status of the components in JSON.
+// It always responds 200 OK, since the proxy keeps serving with the cached data while Athenz is unavailable.
+func (st *AuthorizerStatus) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(ContentType, ApplicationJSON+";"+CharsetUTF8)
+		w.WriteHeader(http.StatusOK)
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		if err := e.Encode(st.Report()); err != nil {
+			glg.Errorf("cannot encode authorizer status: %v", err)
+		}
+	})
+}
+
+// check logs the components crossing the thresholds.
+func (st *AuthorizerStatus) check() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.checkLocked()
+}
+
+// checkLocked logs the components crossing the thresholds. It must be called with the lock.
+func (st *AuthorizerStatus) checkLocked() {
+	now := time.Now()
+	names := make([]string, 0, len(st.components))
+	for name := range st.components {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		st.checkComponent(name, st.components[name], now)
+	}
+}
+
+func (st *AuthorizerStatus) checkComponent(name string, c *componentState, now time.Time) {
+	cs := st.status(c, now)
+	switch {
+	case !cs.Healthy && !c.unhealthy:
+		c.unhealthy = true
+		glg.Warnf("authorizer %s is unhealthy, consecutive failures: %d, cache age: %s, last error: %s",
+			name, cs.ConsecutiveFailures, time.Duration(cs.CacheAgeSeconds*float64(time.Second)).Truncate(time.Second), cs.LastError)
+	case cs.Healthy && c.unhealthy:
+		c.unhealthy = false
+		glg.Infof("authorizer %s is recovered", name)
+	}
+}
+
+// status returns the status of the component. The cache age is the age of the oldest target, or the uptime if a target is never fetched.
+func (st *AuthorizerStatus) status(c *componentState, now time.Time) ComponentStatus {
+	cs := ComponentStatus{
+		Loaded:          c.loaded,
+		LastError:       c.lastError,
+		LastErrorTime:   timePtr(c.lastErrorTime),
+		MaxAgeSeconds:   c.maxAge.Seconds(),
+		Errors:          c.errors,
+		CacheAgeSeconds: now.Sub(st.started).Seconds(),
+		Targets:         make(map[string]TargetStatus, len(c.targets)),
+	}
+	var lastSuccess time.Time
+	var maxAge time.Duration
+	for name, t := range c.targets {
+		age := now.Sub(st.started)
+		if !t.lastSuccess.IsZero() {
+			age = now.Sub(t.lastSuccess)
+		}
+		cs.Targets[name] = TargetStatus{
+			LastSuccess:         timePtr(t.lastSuccess),
+			LastFailure:         timePtr(t.lastFailure),
+			LastError:           t.lastError,
+			ConsecutiveFailures: t.consecutiveFailures,
+			CacheAgeSeconds:     age.Seconds(),
+		}
+		if t.consecutiveFailures > cs.ConsecutiveFailures {
+			cs.ConsecutiveFailures = t.consecutiveFailures
+		}
+		if t.lastSuccess.After(lastSuccess) {
+			lastSuccess = t.lastSuccess
+		}
+		if age > maxAge {
+			maxAge = age
+		}
+	}
+	if len(c.targets) > 0 {
+		cs.CacheAgeSeconds = maxAge.Seconds()
+	}
+	cs.LastSuccess = timePtr(lastSuccess)
+	cs.Healthy = cs.ConsecutiveFailures < st.failureThreshold && cs.CacheAgeSeconds <= cs.MaxAgeSeconds
+	return cs
+}
+
+// allFetched returns whether all targets of the component are fetched successfully at least once.
+func allFetched(c *componentState) bool {
+	if len(c.targets) == 0 {
+		return false
+	}
+	for _, t := range c.targets {
+		if t.lastSuccess.IsZero() {
+			return false
+		}
+	}
+	return true
+}
+
+// pubkeyTarget returns the target of the public keys of the environment, e.g. "sys.auth/zts".
+func pubkeyTarget(domain, env string) string {
+	return domain + "/" + env
+}
+
+// refreshComponent returns the authorizer component of the fetch type.
+func refreshComponent(typ string) string {
+	switch typ {
+	case refreshPolicy:
+		return ComponentPolicyd
+	case refreshPubkey:
+		return ComponentPubkeyd
+	default:
+		return ComponentJwkd
+	}
+}
+
+// errorComponent returns the authorizer component of the error reported by athenz-authorizer, which wraps the error with the component.
+func errorComponent(err error) string {
+	msg := err.Error()
+	switch {
+	case strings.HasPrefix(msg, "update policy error"):
+		return ComponentPolicyd
+	case strings.HasPrefix(msg, "update pubkey error"):
+		return ComponentPubkeyd
+	case strings.HasPrefix(msg, "update jwk error"):
+		return ComponentJwkd
+	default:
+		return ""
+	}
+}
+
+func timePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
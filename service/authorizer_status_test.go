@@ -0,0 +1,432 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/yahoojapan/authorization-proxy/v4/config"
+)
+
+func TestNewAuthorizerStatus(t *testing.T) {
+	tests := []struct {
+		name           string
+		cfg            config.Authorization
+		wantComponents []string
+		wantMaxAge     map[string]time.Duration
+	}{
+		{
+			name:           "register pubkeyd and policyd by default",
+			cfg:            config.Authorization{},
+			wantComponents: []string{ComponentPolicyd, ComponentPubkeyd},
+			wantMaxAge: map[string]time.Duration{
+				ComponentPolicyd: 90 * time.Minute,
+				ComponentPubkeyd: 72 * time.Hour,
+			},
+		},
+		{
+			name: "register jwkd when access token is enabled, and policyd is disabled",
+			cfg: config.Authorization{
+				Policy: config.Policy{
+					Disable: true,
+				},
+				AccessToken: config.AccessToken{
+					Enable: true,
+				},
+				JWK: config.JWK{
+					RefreshPeriod: "1h",
+				},
+				Status: config.AuthorizerStatus{
+					PubkeyMaxAge: "2h",
+				},
+			},
+			wantComponents: []string{ComponentJwkd, ComponentPubkeyd},
+			wantMaxAge: map[string]time.Duration{
+				ComponentJwkd:    3 * time.Hour,
+				ComponentPubkeyd: 2 * time.Hour,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NewAuthorizerStatus(tt.cfg)
+			if len(got.components) != len(tt.wantComponents) {
+				t.Fatalf("NewAuthorizerStatus() components = %v, want %v", got.components, tt.wantComponents)
+			}
+			for _, name := range tt.wantComponents {
+				c, ok := got.components[name]
+				if !ok {
+					t.Fatalf("NewAuthorizerStatus() component %s is not registered", name)
+				}
+				if c.maxAge != tt.wantMaxAge[name] {
+					t.Errorf("NewAuthorizerStatus() %s maxAge = %v, want %v", name, c.maxAge, tt.wantMaxAge[name])
+				}
+			}
+			if got.failureThreshold != defaultFailureThreshold {
+				t.Errorf("NewAuthorizerStatus() failureThreshold = %d, want %d", got.failureThreshold, defaultFailureThreshold)
+			}
+		})
+	}
+}
+
+func TestAuthorizerStatus_fetched(t *testing.T) {
+	tests := []struct {
+		name        string
+		fetches     []string
+		wantHealthy bool
+		wantFails   int
+	}{
+		{
+			name:        "healthy after success",
+			fetches:     []string{""},
+			wantHealthy: true,
+		},
+		{
+			name:        "healthy below the failure threshold",
+			fetches:     []string{"", "500 Internal Server Error", "500 Internal Server Error"},
+			wantHealthy: true,
+			wantFails:   2,
+		},
+		{
+			name:        "unhealthy when the failure threshold is reached",
+			fetches:     []string{"", "500 Internal Server Error", "500 Internal Server Error", "500 Internal Server Error"},
+			wantHealthy: false,
+			wantFails:   3,
+		},
+		{
+			name:        "recovered after success",
+			fetches:     []string{"timeout", "timeout", "timeout", ""},
+			wantHealthy: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := NewAuthorizerStatus(config.Authorization{
+				Policy: config.Policy{
+					Disable: true,
+				},
+			})
+			for _, errMsg := range tt.fetches {
+				st.fetched(ComponentPubkeyd, "sys.auth/zts", errMsg)
+			}
+			got := st.Report()
+			cs := got.Components[ComponentPubkeyd]
+			if got.Healthy != tt.wantHealthy || cs.Healthy != tt.wantHealthy {
+				t.Errorf("Report() healthy = %v, component healthy = %v, want %v", got.Healthy, cs.Healthy, tt.wantHealthy)
+			}
+			if cs.ConsecutiveFailures != tt.wantFails {
+				t.Errorf("Report() consecutive failures = %d, want %d", cs.ConsecutiveFailures, tt.wantFails)
+			}
+			if cs.LastSuccess == nil && tt.fetches[len(tt.fetches)-1] == "" {
+				t.Error("Report() last success is not recorded")
+			}
+			if st.components[ComponentPubkeyd].unhealthy == tt.wantHealthy {
+				t.Errorf("unhealthy = %v, want %v", st.components[ComponentPubkeyd].unhealthy, !tt.wantHealthy)
+			}
+		})
+	}
+}
+
+func TestAuthorizerStatus_fetched_pubkey(t *testing.T) {
+	st := NewAuthorizerStatus(config.Authorization{
+		Policy: config.Policy{
+			Disable: true,
+		},
+	})
+	// the public keys of ZTS and ZMS are tracked separately
+	st.fetched(ComponentPubkeyd, "sys.auth/zts", "")
+	if st.Report().Components[ComponentPubkeyd].Loaded {
+		t.Error("pubkeyd is loaded before the ZMS public keys are fetched")
+	}
+	st.fetched(ComponentPubkeyd, "sys.auth/zms", "")
+	if !st.Report().Components[ComponentPubkeyd].Loaded {
+		t.Error("pubkeyd is not loaded after the ZTS and ZMS public keys are fetched")
+	}
+}
+
+func TestAuthorizerStatus_Reconfigure(t *testing.T) {
+	st := NewAuthorizerStatus(config.Authorization{
+		AthenzDomains: []string{"dom1", "dom2"},
+		Policy: config.Policy{
+			RefreshPeriod: "1m",
+		},
+	})
+	st.fetched(ComponentPolicyd, "dom1", "")
+	st.fetched(ComponentPolicyd, "dom2", "")
+
+	st.Reconfigure(config.Authorization{
+		AthenzDomains: []string{"dom1", "dom3"},
+		Policy: config.Policy{
+			RefreshPeriod: "2m",
+		},
+		AccessToken: config.AccessToken{
+			Enable: true,
+		},
+	})
+
+	got := st.Report()
+	cs := got.Components[ComponentPolicyd]
+	if _, ok := cs.Targets["dom2"]; ok {
+		t.Error("Reconfigure() keeps the removed domain")
+	}
+	if _, ok := cs.Targets["dom3"]; !ok {
+		t.Error("Reconfigure() does not add the domain")
+	}
+	if cs.Targets["dom1"].LastSuccess == nil {
+		t.Error("Reconfigure() does not keep the state of the domain")
+	}
+	if !cs.Loaded {
+		t.Error("Reconfigure() resets the loaded state")
+	}
+	if cs.MaxAgeSeconds != 360 {
+		t.Errorf("Reconfigure() max age = %v, want 360", cs.MaxAgeSeconds)
+	}
+	if _, ok := got.Components[ComponentJwkd]; !ok {
+		t.Error("Reconfigure() does not add the enabled component")
+	}
+
+	var nilStatus *AuthorizerStatus
+	nilStatus.Reconfigure(config.Authorization{})
+}
+
+func TestAuthorizerStatus_Report(t *testing.T) {
+	tests := []struct {
+		name      string
+		st        func() *AuthorizerStatus
+		checkFunc func(AuthorizerStatusReport) error
+	}{
+		{
+			name: "policy domain never fetched is unhealthy after max age",
+			st: func() *AuthorizerStatus {
+				st := NewAuthorizerStatus(config.Authorization{
+					AthenzDomains: []string{"dummy.domain"},
+					Status: config.AuthorizerStatus{
+						PolicyMaxAge: "1h",
+					},
+				})
+				st.started = time.Now().Add(-2 * time.Hour)
+				st.fetched(ComponentPubkeyd, "sys.auth/zts", "")
+				return st
+			},
+			checkFunc: func(r AuthorizerStatusReport) error {
+				if r.Healthy {
+					return errors.New("report is healthy")
+				}
+				cs := r.Components[ComponentPolicyd]
+				if cs.Healthy || cs.CacheAgeSeconds < time.Hour.Seconds() || cs.LastSuccess != nil {
+					return fmt.Errorf("unexpected policyd status: %+v", cs)
+				}
+				if _, ok := cs.Targets["dummy.domain"]; !ok {
+					return fmt.Errorf("domain is not reported: %+v", cs.Targets)
+				}
+				if !r.Components[ComponentPubkeyd].Healthy {
+					return fmt.Errorf("unexpected pubkeyd status: %+v", r.Components[ComponentPubkeyd])
+				}
+				return nil
+			},
+		},
+		{
+			name: "authorizer errors are counted",
+			st: func() *AuthorizerStatus {
+				st := NewAuthorizerStatus(config.Authorization{})
+				st.AuthorizerError(errors.New("update policy error: fetch policy error"))
+				st.AuthorizerError(errors.New("update policy error: fetch policy error"))
+				st.AuthorizerError(errors.New("unknown error"))
+				return st
+			},
+			checkFunc: func(r AuthorizerStatusReport) error {
+				cs := r.Components[ComponentPolicyd]
+				if cs.Errors != 2 || cs.LastError != "update policy error: fetch policy error" || cs.LastErrorTime == nil {
+					return fmt.Errorf("unexpected policyd status: %+v", cs)
+				}
+				if r.Components[ComponentPubkeyd].Errors != 0 {
+					return fmt.Errorf("unexpected pubkeyd status: %+v", r.Components[ComponentPubkeyd])
+				}
+				return nil
+			},
+		},
+		{
+			name: "nil status is healthy",
+			st: func() *AuthorizerStatus {
+				return nil
+			},
+			checkFunc: func(r AuthorizerStatusReport) error {
+				if !r.Healthy || len(r.Components) != 0 {
+					return fmt.Errorf("unexpected report: %+v", r)
+				}
+				return nil
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.checkFunc(tt.st().Report()); err != nil {
+				t.Errorf("Report() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestAuthorizerStatus_Handler(t *testing.T) {
+	st := NewAuthorizerStatus(config.Authorization{
+		Policy: config.Policy{
+			Disable: true,
+		},
+		Status: config.AuthorizerStatus{
+			FailureThreshold: 1,
+		},
+	})
+	st.fetched(ComponentPubkeyd, "sys.auth/zts", "503 Service Unavailable")
+
+	w := httptest.NewRecorder()
+	st.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, AuthorizerStatusPath, nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Handler() status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if ct := w.Header().Get(ContentType); ct != ApplicationJSON+";"+CharsetUTF8 {
+		t.Errorf("Handler() content type = %s", ct)
+	}
+	var got AuthorizerStatusReport
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("Handler() body = %s, error = %v", w.Body.String(), err)
+	}
+	cs := got.Components[ComponentPubkeyd]
+	if got.Healthy || cs.Healthy || cs.ConsecutiveFailures != 1 || cs.Targets["sys.auth/zts"].LastError != "503 Service Unavailable" {
+		t.Errorf("Handler() body = %s", w.Body.String())
+	}
+}
+
+func TestAuthorizerStatus_RoundTripper(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		path      string
+		component string
+		target    string
+		wantFails int
+	}{
+		{
+			name:      "policy fetch succeeded",
+			status:    http.StatusOK,
+			path:      "/zts/v1/domain/dummy.domain/signed_policy_data",
+			component: ComponentPolicyd,
+			target:    "dummy.domain",
+		},
+		{
+			name:      "policy not modified",
+			status:    http.StatusNotModified,
+			path:      "/zts/v1/domain/dummy.domain/signed_policy_data",
+			component: ComponentPolicyd,
+			target:    "dummy.domain",
+		},
+		{
+			name:      "public key fetch failed",
+			status:    http.StatusInternalServerError,
+			path:      "/zts/v1/domain/sys.auth/service/zms",
+			component: ComponentPubkeyd,
+			target:    "sys.auth/zms",
+			wantFails: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+
+			st := NewAuthorizerStatus(config.Authorization{})
+			c := &http.Client{
+				Transport: st.RoundTripper(nil),
+			}
+			res, err := c.Get(srv.URL + tt.path)
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			res.Body.Close()
+
+			ts, ok := st.Report().Components[tt.component].Targets[tt.target]
+			if !ok {
+				t.Fatalf("target %s of %s is not recorded", tt.target, tt.component)
+			}
+			if ts.ConsecutiveFailures != tt.wantFails {
+				t.Errorf("consecutive failures = %d, want %d", ts.ConsecutiveFailures, tt.wantFails)
+			}
+			if (ts.LastSuccess != nil) != (tt.wantFails == 0) {
+				t.Errorf("last success = %v", ts.LastSuccess)
+			}
+		})
+	}
+
+	t.Run("canceled fetch is not recorded", func(t *testing.T) {
+		st := NewAuthorizerStatus(config.Authorization{})
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		r := httptest.NewRequest(http.MethodGet, "http://127.0.0.1/zts/v1/domain/dummy.domain/signed_policy_data", nil).WithContext(ctx)
+		if _, err := st.RoundTripper(nil).RoundTrip(r); err == nil {
+			t.Fatal("RoundTrip() error = nil, want canceled")
+		}
+		if ts, ok := st.Report().Components[ComponentPolicyd].Targets["dummy.domain"]; ok {
+			t.Errorf("canceled fetch is recorded: %+v", ts)
+		}
+	})
+}
+
+func TestAuthorizerStatus_Start(t *testing.T) {
+	st := NewAuthorizerStatus(config.Authorization{
+		Policy: config.Policy{
+			Disable: true,
+		},
+		Status: config.AuthorizerStatus{
+			PubkeyMaxAge: "10ms",
+			CheckPeriod:  "5ms",
+		},
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		st.Start(ctx)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		st.mu.Lock()
+		unhealthy := st.components[ComponentPubkeyd].unhealthy
+		st.mu.Unlock()
+		if unhealthy {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Start() does not check the cache age")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	<-done
+}
+
+func Test_errorComponent(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{errors.New("update policy error: fetch policy error"), ComponentPolicyd},
+		{errors.New("update pubkey error: error fetch public key entries"), ComponentPubkeyd},
+		{errors.New("update jwk error: error fetch jwk"), ComponentJwkd},
+		{errors.New("unknown error"), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			if got := errorComponent(tt.err); got != tt.want {
+				t.Errorf("errorComponent() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
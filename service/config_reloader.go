@@ -0,0 +1,119 @@
+/*
+Copyright (C)  2018 Yahoo Japan Corporation Athenz team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/kpango/glg"
+	"github.com/pkg/errors"
+
+	"github.com/yahoojapan/authorization-proxy/v4/config"
+)
+
+const defaultConfigReloadPeriod = 10 * time.Second
+
+// ConfigReloader reloads the configuration file on request, e.g. SIGHUP, and when the file changes if enabled.
+// The reloads are serialized, and the loaded configuration is passed to the apply function.
+type ConfigReloader struct {
+	path    string
+	period  time.Duration
+	apply   func(context.Context, config.Config) error
+	metrics *Metrics
+
+	mu     sync.Mutex
+	stamps map[string]fileStamp
+}
+
+// NewConfigReloader returns the ConfigReloader of the configuration file, or nil if the path is empty.
+func NewConfigReloader(path string, cfg config.Reload, m *Metrics, apply func(context.Context, config.Config) error) *ConfigReloader {
+	if path == "" {
+		return nil
+	}
+	r := &ConfigReloader{
+		path:    path,
+		apply:   apply,
+		metrics: m,
+		stamps:  statFiles(path),
+	}
+	if cfg.Enable {
+		r.period = parseDuration(cfg.Period, defaultConfigReloadPeriod)
+	}
+	return r
+}
+
+// Start checks the configuration file for changes periodically if enabled, and returns when the context is done.
+func (r *ConfigReloader) Start(ctx context.Context) {
+	if r == nil || r.period <= 0 {
+		return
+	}
+	ticker := time.NewTicker(r.period)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !r.changed() {
+				continue
+			}
+			if err := r.Reload(ctx); err != nil {
+				glg.Errorf("failed to reload configuration, keep the current one: %v", err)
+			}
+		}
+	}
+}
+
+// Reload loads the configuration file and applies it. The current configuration is kept if the file is invalid or the apply fails.
+func (r *ConfigReloader) Reload(ctx context.Context) error {
+	if r == nil {
+		return errors.New("configuration file path is not set")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// the failed file is not retried until it changes again
+	r.stamps = statFiles(r.path)
+
+	err := r.reload(ctx)
+	r.metrics.ObserveConfigReload(err)
+	if err != nil {
+		return err
+	}
+	glg.Infof("configuration reloaded from %s", r.path)
+	return nil
+}
+
+func (r *ConfigReloader) reload(ctx context.Context) error {
+	cfg, err := config.New(r.path)
+	if err != nil {
+		return errors.Wrap(err, "config.New(path)")
+	}
+	if cfg.Version != config.GetVersion() {
+		return errors.Errorf("invalid configuration version: %s", cfg.Version)
+	}
+	return r.apply(ctx, *cfg)
+}
+
+// changed returns whether the configuration file has changed since the last reload.
+func (r *ConfigReloader) changed() bool {
+	stamps := statFiles(r.path)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return stampsChanged(r.stamps, stamps)
+}
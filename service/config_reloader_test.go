@@ -0,0 +1,115 @@
+package service
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/yahoojapan/authorization-proxy/v4/config"
+)
+
+func TestConfigReloader_Reload(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		applyErr error
+		wantErr  bool
+		wantPort int
+	}{
+		{
+			name:     "apply the configuration",
+			content:  "version: " + config.GetVersion() + "\nserver:\n  port: 8082\n",
+			wantPort: 8082,
+		},
+		{
+			name:    "return error when the file is invalid",
+			content: "version: [",
+			wantErr: true,
+		},
+		{
+			name:    "return error when the version is different",
+			content: "version: v0.0.0\n",
+			wantErr: true,
+		},
+		{
+			name:     "return error when the apply fails",
+			content:  "version: " + config.GetVersion() + "\n",
+			applyErr: errors.New("invalid configuration"),
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			if err := ioutil.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			var applied *config.Config
+			r := NewConfigReloader(path, config.Reload{}, nil, func(_ context.Context, cfg config.Config) error {
+				applied = &cfg
+				return tt.applyErr
+			})
+			err := r.Reload(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Reload() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantPort != 0 && (applied == nil || applied.Server.Port != tt.wantPort) {
+				t.Errorf("applied configuration = %+v, want port %d", applied, tt.wantPort)
+			}
+		})
+	}
+
+	var r *ConfigReloader
+	if err := r.Reload(context.Background()); err == nil {
+		t.Error("Reload() error = nil, want the path is not set")
+	}
+}
+
+func TestConfigReloader_Start(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := "version: " + config.GetVersion() + "\n"
+	if err := ioutil.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	applied := make(chan config.Config, 1)
+	r := NewConfigReloader(path, config.Reload{
+		Enable: true,
+		Period: "5ms",
+	}, nil, func(_ context.Context, cfg config.Config) error {
+		applied <- cfg
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		r.Start(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	select {
+	case <-applied:
+		t.Fatal("configuration is reloaded without change")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := ioutil.WriteFile(path, []byte(content+"server:\n  port: 8082\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case cfg := <-applied:
+		if cfg.Server.Port != 8082 {
+			t.Errorf("applied port = %d, want 8082", cfg.Server.Port)
+		}
+	case <-time.After(time.Second):
+		t.Error("configuration is not reloaded on change")
+	}
+}
@@ -0,0 +1,330 @@
+/*
+Copyright (C)  2018 Yahoo Japan Corporation Athenz team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kpango/glg"
+	"github.com/pkg/errors"
+	"golang.org/x/net/http/httpguts"
+	"google.golang.org/grpc"
+)
+
+const (
+	// DrainReportInterval represents the interval to log the drain progress during shutdown.
+	DrainReportInterval = time.Second
+
+	// drainPollInterval represents the interval to check whether the in-flight requests are completed.
+	drainPollInterval = 50 * time.Millisecond
+)
+
+// drainer tracks the in-flight HTTP requests, gRPC streams and upgraded connections of the authorization proxy server.
+// Once draining starts, the responses ask the clients to close the connection, i.e. "Connection: close" for HTTP/1.1 and GOAWAY for HTTP/2.
+type drainer struct {
+	draining int32
+	requests int64
+	streams  int64
+	upgrades int64
+
+	// upgraded and h2c connections, which are not closed by http.Server.Shutdown
+	mu    sync.Mutex
+	conns map[*upgradedConn]struct{}
+}
+
+// drainStatus represents the number of the in-flight requests.
+type drainStatus struct {
+	Requests int64
+	Streams  int64
+	Upgrades int64
+}
+
+// newDrainer returns the drainer which is not draining.
+func newDrainer() *drainer {
+	return &drainer{
+		conns: make(map[*upgradedConn]struct{}),
+	}
+}
+
+// Start starts draining. It is safe to call more than once.
+func (d *drainer) Start() {
+	if d == nil {
+		return
+	}
+	if atomic.CompareAndSwapInt32(&d.draining, 0, 1) {
+		glg.Infof("authorization proxy starts draining, %s", d.Status())
+	}
+}
+
+// Draining returns whether draining has started.
+func (d *drainer) Draining() bool {
+	return d != nil && atomic.LoadInt32(&d.draining) == 1
+}
+
+// Status returns the number of the in-flight requests.
+func (d *drainer) Status() drainStatus {
+	if d == nil {
+		return drainStatus{}
+	}
+	return drainStatus{
+		Requests: atomic.LoadInt64(&d.requests),
+		Streams:  atomic.LoadInt64(&d.streams),
+		Upgrades: atomic.LoadInt64(&d.upgrades),
+	}
+}
+
+// String returns the drain status for logging.
+func (st drainStatus) String() string {
+	return fmt.Sprintf("in-flight requests: %d, gRPC streams: %d, upgraded connections: %d", st.Requests, st.Streams, st.Upgrades)
+}
+
+// Idle returns whether there are no in-flight requests.
+func (st drainStatus) Idle() bool {
+	return st == drainStatus{}
+}
+
+// Handler returns the handler which tracks the in-flight HTTP requests and the upgraded connections,
+// and sets "Connection: close" to the responses once draining starts.
+// The gRPC requests in mixed mode are tracked by the stream interceptor instead.
+func (d *drainer) Handler(h http.Handler) http.Handler {
+	if d == nil {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upgrade := httpguts.HeaderValuesContainsToken(r.Header["Connection"], "upgrade")
+		if d.Draining() && !upgrade && r.ProtoMajor < 3 {
+			// for HTTP/2, the server sends GOAWAY and removes the header. HTTP/3 does not allow the header
+			w.Header().Set("Connection", "close")
+		}
+		if isGRPCRequest(r) {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		atomic.AddInt64(&d.requests, 1)
+		if !upgrade {
+			defer atomic.AddInt64(&d.requests, -1)
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		dw := &drainWriter{
+			ResponseWriter: w,
+			d:              d,
+		}
+		defer func() {
+			if !dw.hijacked {
+				atomic.AddInt64(&d.requests, -1)
+			}
+		}()
+		h.ServeHTTP(dw, r)
+	})
+}
+
+// H2CHandler returns the handler which tracks the connections hijacked by the h2c handler in plaintext mixed mode.
+// The gRPC streams on the connections are tracked by the stream interceptor, therefore the connections are not counted as in-flight.
+func (d *drainer) H2CHandler(h http.Handler) http.Handler {
+	if d == nil {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(&h2cWriter{
+			ResponseWriter: w,
+			d:              d,
+		}, r)
+	})
+}
+
+// StreamInterceptor returns the gRPC stream interceptor which tracks the in-flight streams.
+func (d *drainer) StreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		atomic.AddInt64(&d.streams, 1)
+		defer atomic.AddInt64(&d.streams, -1)
+		return handler(srv, ss)
+	}
+}
+
+// Report logs the drain progress at the interval until the context is done or the in-flight requests are completed.
+func (d *drainer) Report(ctx context.Context, interval time.Duration) {
+	if d == nil {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			st := d.Status()
+			if st.Idle() {
+				return
+			}
+			glg.Infof("authorization proxy draining, %s", st)
+		}
+	}
+}
+
+// Wait waits until the in-flight requests are completed, and returns the error if the context is done before.
+func (d *drainer) Wait(ctx context.Context) error {
+	if d == nil {
+		return nil
+	}
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for {
+		st := d.Status()
+		if st.Idle() {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return errors.Wrapf(ctx.Err(), "drain incomplete, %s", st)
+		case <-ticker.C:
+		}
+	}
+}
+
+// CloseUpgraded closes the remaining upgraded connections.
+func (d *drainer) CloseUpgraded() {
+	d.closeConns(false)
+}
+
+// CloseH2C closes the remaining h2c connections.
+func (d *drainer) CloseH2C() {
+	d.closeConns(true)
+}
+
+func (d *drainer) closeConns(h2c bool) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	conns := make([]*upgradedConn, 0, len(d.conns))
+	for c := range d.conns {
+		if c.h2c == h2c {
+			conns = append(conns, c)
+		}
+	}
+	d.mu.Unlock()
+	for _, c := range conns {
+		c.Close()
+	}
+}
+
+// drainWriter represents the response writer of the upgrade request, which tracks the hijacked connection.
+type drainWriter struct {
+	http.ResponseWriter
+	d        *drainer
+	hijacked bool
+}
+
+// Flush implements http.Flusher for the streaming responses.
+func (w *drainWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker for the protocol upgrade, and tracks the connection as upgraded until it is closed.
+func (w *drainWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("http.Hijacker is not supported")
+	}
+	conn, rw, err := h.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	w.hijacked = true
+	uc := &upgradedConn{
+		Conn: conn,
+		d:    w.d,
+	}
+	w.d.mu.Lock()
+	w.d.conns[uc] = struct{}{}
+	w.d.mu.Unlock()
+	atomic.AddInt64(&w.d.upgrades, 1)
+	atomic.AddInt64(&w.d.requests, -1)
+	return uc, rw, nil
+}
+
+// Unwrap returns the underlying writer for http.ResponseController.
+func (w *drainWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// h2cWriter represents the response writer of the h2c handler, which tracks the hijacked connection.
+type h2cWriter struct {
+	http.ResponseWriter
+	d *drainer
+}
+
+// Hijack implements http.Hijacker for the h2c handler, and tracks the connection until it is closed.
+func (w *h2cWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("http.Hijacker is not supported")
+	}
+	conn, rw, err := h.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	uc := &upgradedConn{
+		Conn: conn,
+		d:    w.d,
+		h2c:  true,
+	}
+	w.d.mu.Lock()
+	w.d.conns[uc] = struct{}{}
+	w.d.mu.Unlock()
+	return uc, rw, nil
+}
+
+// Unwrap returns the underlying writer for http.ResponseController.
+func (w *h2cWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// upgradedConn represents the hijacked connection, which is untracked when closed.
+type upgradedConn struct {
+	net.Conn
+	d *drainer
+	// h2c represents whether the connection is hijacked by the h2c handler, which is not counted as upgraded
+	h2c  bool
+	once sync.Once
+}
+
+// Close closes the connection and untracks it.
+func (c *upgradedConn) Close() error {
+	c.once.Do(func() {
+		c.d.mu.Lock()
+		delete(c.d.conns, c)
+		c.d.mu.Unlock()
+		if !c.h2c {
+			atomic.AddInt64(&c.d.upgrades, -1)
+		}
+	})
+	return c.Conn.Close()
+}
@@ -0,0 +1,294 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mwitkow/grpc-proxy/proxy"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+func Test_drainer_Handler(t *testing.T) {
+	tests := []struct {
+		name          string
+		draining      bool
+		header        http.Header
+		wantConnClose bool
+	}{
+		{
+			name: "keep the connection before draining",
+		},
+		{
+			name:          "close the connection while draining",
+			draining:      true,
+			wantConnClose: true,
+		},
+		{
+			name:     "keep the upgrade request while draining",
+			draining: true,
+			header: http.Header{
+				"Connection": []string{"Upgrade"},
+				"Upgrade":    []string{"websocket"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newDrainer()
+			if tt.draining {
+				d.Start()
+			}
+			var inFlight drainStatus
+			h := d.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				inFlight = d.Status()
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			for k, v := range tt.header {
+				r.Header[k] = v
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if got := w.Header().Get("Connection") == "close"; got != tt.wantConnClose {
+				t.Errorf("Connection: close = %v, want %v", got, tt.wantConnClose)
+			}
+			if inFlight.Requests != 1 {
+				t.Errorf("in-flight requests = %d, want 1", inFlight.Requests)
+			}
+			if st := d.Status(); !st.Idle() {
+				t.Errorf("Status() = %s, want idle", st)
+			}
+		})
+	}
+}
+
+func Test_drainer_upgraded(t *testing.T) {
+	d := newDrainer()
+	hijacked := make(chan struct{})
+	srv := httptest.NewServer(d.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("Hijack() error = %v", err)
+			return
+		}
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: test\r\n\r\n")
+		rw.Flush()
+		close(hijacked)
+		// keep the connection open until it is closed by the drainer
+		conn.Read(make([]byte, 1))
+		conn.Close()
+	})))
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "test")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request error = %v", err)
+	}
+	defer res.Body.Close()
+	<-hijacked
+
+	want := drainStatus{Upgrades: 1}
+	if got := d.Status(); got != want {
+		t.Errorf("Status() = %s, want %s", got, want)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := d.Wait(ctx); err == nil {
+		t.Error("Wait() error = nil, want drain incomplete")
+	}
+
+	d.CloseUpgraded()
+	if err := d.Wait(context.Background()); err != nil {
+		t.Errorf("Wait() error = %v", err)
+	}
+	if _, err := bufio.NewReader(res.Body).ReadByte(); err == nil {
+		t.Error("upgraded connection is not closed")
+	}
+}
+
+func Test_drainer_h2c(t *testing.T) {
+	d := newDrainer()
+	served := make(chan struct{})
+	h := d.H2CHandler(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), &http2.Server{}))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r)
+		if r.Method == "PRI" {
+			// the h2c handler returns when the connection is closed
+			close(served)
+		}
+	}))
+	defer srv.Close()
+
+	cl := &http.Client{
+		Transport: &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, network, addr)
+			},
+		},
+	}
+	res, err := cl.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("request error = %v", err)
+	}
+	res.Body.Close()
+
+	if st := d.Status(); !st.Idle() {
+		t.Errorf("Status() = %s, want idle", st)
+	}
+	d.mu.Lock()
+	conns := len(d.conns)
+	d.mu.Unlock()
+	if conns != 1 {
+		t.Errorf("tracked connections = %d, want 1", conns)
+	}
+
+	d.CloseUpgraded()
+	select {
+	case <-served:
+		t.Fatal("h2c connection is closed by CloseUpgraded()")
+	case <-time.After(50 * time.Millisecond):
+	}
+	d.CloseH2C()
+	select {
+	case <-served:
+	case <-time.After(time.Second):
+		t.Fatal("h2c connection is not closed")
+	}
+}
+
+func Test_drainer_StreamInterceptor(t *testing.T) {
+	d := newDrainer()
+	var inFlight drainStatus
+	err := d.StreamInterceptor()(nil, nil, &grpc.StreamServerInfo{}, func(srv interface{}, stream grpc.ServerStream) error {
+		inFlight = d.Status()
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("StreamInterceptor() error = %v", err)
+	}
+	if want := (drainStatus{Streams: 1}); inFlight != want {
+		t.Errorf("in-flight = %s, want %s", inFlight, want)
+	}
+	if st := d.Status(); !st.Idle() {
+		t.Errorf("Status() = %s, want idle", st)
+	}
+}
+
+func Test_server_apiShutdown_drain(t *testing.T) {
+	t.Run("close the keep-alive connections during the delay", func(t *testing.T) {
+		s := &server{
+			drainer: newDrainer(),
+			sdd:     300 * time.Millisecond,
+			sdt:     time.Second,
+		}
+		srv := httptest.NewServer(s.drainer.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+		defer srv.Close()
+		s.srv = srv.Config
+
+		echan := make(chan error, 1)
+		go func() {
+			echan <- s.apiShutdown(context.Background())
+		}()
+		time.Sleep(100 * time.Millisecond)
+
+		res, err := http.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("request error = %v", err)
+		}
+		res.Body.Close()
+		if !res.Close {
+			t.Error("response during the delay does not close the connection")
+		}
+		if err := <-echan; err != nil {
+			t.Errorf("apiShutdown() error = %v", err)
+		}
+	})
+
+	t.Run("close the in-flight requests after the timeout", func(t *testing.T) {
+		s := &server{
+			drainer: newDrainer(),
+			sdt:     200 * time.Millisecond,
+		}
+		started := make(chan struct{})
+		srv := httptest.NewServer(s.drainer.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			<-r.Context().Done()
+		})))
+		defer srv.Close()
+		s.srv = srv.Config
+
+		go http.Get(srv.URL)
+		<-started
+
+		if err := s.apiShutdown(context.Background()); err == nil {
+			t.Error("apiShutdown() error = nil, want timeout")
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		if err := s.drainer.Wait(ctx); err != nil {
+			t.Errorf("in-flight request is not closed: %v", err)
+		}
+	})
+}
+
+func Test_server_grpcShutdown_timeout(t *testing.T) {
+	d := newDrainer()
+	started := make(chan struct{})
+	grpcSrv := grpc.NewServer(
+		grpc.CustomCodec(proxy.Codec()),
+		grpc.UnknownServiceHandler(func(srv interface{}, stream grpc.ServerStream) error {
+			close(started)
+			<-stream.Context().Done()
+			return stream.Context().Err()
+		}),
+		grpc.ChainStreamInterceptor(d.StreamInterceptor()),
+	)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go grpcSrv.Serve(l)
+
+	conn, err := grpc.Dial(l.Addr().String(), grpc.WithCodec(proxy.Codec()), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	go conn.Invoke(context.Background(), "/method/", new(emptypb.Empty), new(emptypb.Empty))
+	<-started
+
+	s := &server{
+		grpcSrv: grpcSrv,
+		drainer: d,
+		sdt:     200 * time.Millisecond,
+	}
+	done := make(chan struct{})
+	go func() {
+		s.grpcShutdown()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("grpcShutdown() does not return after the timeout")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := d.Wait(ctx); err != nil {
+		t.Errorf("in-flight stream is not closed: %v", err)
+	}
+}
@@ -0,0 +1,145 @@
+/*
+Copyright (C)  2018 Yahoo Japan Corporation Athenz team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/kpango/glg"
+	"golang.org/x/net/http2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
+
+	"github.com/yahoojapan/authorization-proxy/v4/config"
+)
+
+const (
+	// the gRPC default values, used for logging the effective parameters of the server and the client
+	DefaultGRPCMaxRecvMsgSize    = 1024 * 1024 * 4
+	DefaultGRPCMaxSendMsgSize    = math.MaxInt32
+	DefaultGRPCWindowSize        = 64 * 1024
+	DefaultGRPCConnectionTimeout = 120 * time.Second
+	DefaultGRPCKeepaliveTime     = 2 * time.Hour
+	DefaultGRPCKeepaliveTimeout  = 20 * time.Second
+	DefaultGRPCKeepaliveMinTime  = 5 * time.Minute
+)
+
+// grpcServerOptions returns the gRPC server options from the given parameters, and logs the effective values.
+// Zero value parameters are not set, so that the gRPC default is used.
+func grpcServerOptions(cfg config.GRPCServer) []grpc.ServerOption {
+	var opts []grpc.ServerOption
+	if cfg.MaxRecvMsgSize > 0 {
+		opts = append(opts, grpc.MaxRecvMsgSize(cfg.MaxRecvMsgSize))
+	}
+	if cfg.MaxSendMsgSize > 0 {
+		opts = append(opts, grpc.MaxSendMsgSize(cfg.MaxSendMsgSize))
+	}
+	if cfg.MaxConcurrentStreams > 0 {
+		opts = append(opts, grpc.MaxConcurrentStreams(cfg.MaxConcurrentStreams))
+	}
+	if cfg.InitialWindowSize > 0 {
+		opts = append(opts, grpc.InitialWindowSize(cfg.InitialWindowSize))
+	}
+	if cfg.InitialConnWindowSize > 0 {
+		opts = append(opts, grpc.InitialConnWindowSize(cfg.InitialConnWindowSize))
+	}
+	if cfg.ConnectionTimeout > 0 {
+		opts = append(opts, grpc.ConnectionTimeout(cfg.ConnectionTimeout))
+	}
+
+	kp := keepalive.ServerParameters{
+		MaxConnectionIdle:     cfg.MaxConnectionIdle,
+		MaxConnectionAge:      cfg.MaxConnectionAge,
+		MaxConnectionAgeGrace: cfg.MaxConnectionAgeGrace,
+		Time:                  cfg.KeepaliveTime,
+		Timeout:               cfg.KeepaliveTimeout,
+	}
+	if kp != (keepalive.ServerParameters{}) {
+		opts = append(opts, grpc.KeepaliveParams(kp))
+	}
+	if cfg.KeepaliveMinTime > 0 || cfg.KeepalivePermitWithoutStream {
+		opts = append(opts, grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             OrDefaultDuration(cfg.KeepaliveMinTime, DefaultGRPCKeepaliveMinTime),
+			PermitWithoutStream: cfg.KeepalivePermitWithoutStream,
+		}))
+	}
+
+	glg.Infof("gRPC server parameters: maxRecvMsgSize=%d maxSendMsgSize=%d maxConcurrentStreams=%s initialWindowSize=%d initialConnWindowSize=%d connectionTimeout=%s maxConnectionIdle=%s maxConnectionAge=%s maxConnectionAgeGrace=%s keepaliveTime=%s keepaliveTimeout=%s keepaliveMinTime=%s keepalivePermitWithoutStream=%t",
+		OrDefaultInt(cfg.MaxRecvMsgSize, DefaultGRPCMaxRecvMsgSize),
+		OrDefaultInt(cfg.MaxSendMsgSize, DefaultGRPCMaxSendMsgSize),
+		OrUnlimited(uint64(cfg.MaxConcurrentStreams)),
+		OrDefaultInt(int(cfg.InitialWindowSize), DefaultGRPCWindowSize),
+		OrDefaultInt(int(cfg.InitialConnWindowSize), DefaultGRPCWindowSize),
+		OrDefaultDuration(cfg.ConnectionTimeout, DefaultGRPCConnectionTimeout),
+		OrInfinity(cfg.MaxConnectionIdle),
+		OrInfinity(cfg.MaxConnectionAge),
+		OrInfinity(cfg.MaxConnectionAgeGrace),
+		OrDefaultDuration(cfg.KeepaliveTime, DefaultGRPCKeepaliveTime),
+		OrDefaultDuration(cfg.KeepaliveTimeout, DefaultGRPCKeepaliveTimeout),
+		OrDefaultDuration(cfg.KeepaliveMinTime, DefaultGRPCKeepaliveMinTime),
+		cfg.KeepalivePermitWithoutStream)
+
+	return opts
+}
+
+// http2Server returns the HTTP/2 server serving gRPC requests in mixed mode.
+// The gRPC transport parameters are not used by grpc.Server.ServeHTTP, therefore the connection level parameters are applied on the HTTP/2 server instead.
+func http2Server(cfg config.GRPCServer) *http2.Server {
+	if cfg.KeepaliveTime > 0 || cfg.KeepaliveTimeout > 0 || cfg.KeepaliveMinTime > 0 || cfg.MaxConnectionAge > 0 {
+		glg.Warn("gRPC keepalive and connection age parameters are not supported in mixed mode")
+	}
+	return &http2.Server{
+		MaxConcurrentStreams:         cfg.MaxConcurrentStreams,
+		IdleTimeout:                  cfg.MaxConnectionIdle,
+		MaxUploadBufferPerStream:     cfg.InitialWindowSize,
+		MaxUploadBufferPerConnection: cfg.InitialConnWindowSize,
+	}
+}
+
+// OrDefaultInt returns the value, or the default value if the value is not positive.
+func OrDefaultInt(v, def int) int {
+	if v > 0 {
+		return v
+	}
+	return def
+}
+
+// OrDefaultDuration returns the duration, or the default duration if the duration is not positive.
+func OrDefaultDuration(v, def time.Duration) time.Duration {
+	if v > 0 {
+		return v
+	}
+	return def
+}
+
+// OrInfinity returns the duration string, or "infinity" if the duration is not positive.
+func OrInfinity(v time.Duration) string {
+	if v > 0 {
+		return v.String()
+	}
+	return "infinity"
+}
+
+// OrUnlimited returns the value string, or "unlimited" if the value is zero.
+func OrUnlimited(v uint64) string {
+	if v > 0 {
+		return strconv.FormatUint(v, 10)
+	}
+	return "unlimited"
+}
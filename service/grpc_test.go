@@ -0,0 +1,76 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/yahoojapan/authorization-proxy/v4/config"
+)
+
+func Test_grpcServerOptions(t *testing.T) {
+	type args struct {
+		cfg config.GRPCServer
+	}
+	tests := []struct {
+		name    string
+		args    args
+		wantLen int
+	}{
+		{
+			name: "return no option when all parameters are zero",
+			args: args{
+				cfg: config.GRPCServer{},
+			},
+			wantLen: 0,
+		},
+		{
+			name: "return options for all parameters",
+			args: args{
+				cfg: config.GRPCServer{
+					MaxRecvMsgSize:        1024,
+					MaxSendMsgSize:        1024,
+					MaxConcurrentStreams:  10,
+					InitialWindowSize:     1024 * 1024,
+					InitialConnWindowSize: 1024 * 1024,
+					ConnectionTimeout:     time.Second,
+					MaxConnectionIdle:     time.Minute,
+					KeepaliveMinTime:      time.Minute,
+				},
+			},
+			wantLen: 8,
+		},
+		{
+			name: "return enforcement policy option when only permit without stream is set",
+			args: args{
+				cfg: config.GRPCServer{
+					KeepalivePermitWithoutStream: true,
+				},
+			},
+			wantLen: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := grpcServerOptions(tt.args.cfg); len(got) != tt.wantLen {
+				t.Errorf("grpcServerOptions() len = %v, want %v", len(got), tt.wantLen)
+			}
+		})
+	}
+}
+
+func Test_http2Server(t *testing.T) {
+	got := http2Server(config.GRPCServer{
+		MaxConcurrentStreams: 10,
+		MaxConnectionIdle:    time.Minute,
+		InitialWindowSize:    1024 * 1024,
+	})
+	if got.MaxConcurrentStreams != 10 {
+		t.Errorf("http2Server() MaxConcurrentStreams = %v, want %v", got.MaxConcurrentStreams, 10)
+	}
+	if got.IdleTimeout != time.Minute {
+		t.Errorf("http2Server() IdleTimeout = %v, want %v", got.IdleTimeout, time.Minute)
+	}
+	if got.MaxUploadBufferPerStream != 1024*1024 {
+		t.Errorf("http2Server() MaxUploadBufferPerStream = %v, want %v", got.MaxUploadBufferPerStream, 1024*1024)
+	}
+}
@@ -0,0 +1,105 @@
+/*
+Copyright (C)  2018 Yahoo Japan Corporation Athenz team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+
+	"github.com/kpango/glg"
+	"github.com/pkg/errors"
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+
+	"github.com/yahoojapan/authorization-proxy/v4/config"
+)
+
+// newHTTP3Server returns the HTTP/3 server of the authorization proxy server, which serves the handler on the UDP address.
+// 0-RTT is disabled, since the early data can be replayed.
+func newHTTP3Server(addr string, cfg config.HTTP3, timeouts config.ServerTimeouts, h http.Handler) *http3.Server {
+	return &http3.Server{
+		Addr:    addr,
+		Port:    cfg.AltSvcPort,
+		Handler: h,
+		QuicConfig: &quic.Config{
+			MaxIdleTimeout: parseDuration(timeouts.IdleTimeout, DefaultIdleTimeout),
+		},
+		MaxHeaderBytes: timeouts.MaxHeaderBytes,
+	}
+}
+
+// http3Addr returns the UDP address of the HTTP/3 server, which is the address of the TCP listener by default.
+func http3Addr(cfg config.Server) string {
+	if cfg.HTTP3.Address != "" {
+		return cfg.HTTP3.Address
+	}
+	switch cfg.Listener.Network {
+	case "", config.ListenerTCP, config.ListenerTCP4, config.ListenerTCP6:
+		return listenAddr(cfg.Listener, cfg.Port)
+	}
+	return listenAddr(config.Listener{}, cfg.Port)
+}
+
+// http3Network returns the UDP network of the HTTP/3 server, which follows the address family of the TCP listener.
+func http3Network(cfg config.Server) string {
+	if cfg.HTTP3.Address == "" {
+		switch cfg.Listener.Network {
+		case config.ListenerTCP4:
+			return "udp4"
+		case config.ListenerTCP6:
+			return "udp6"
+		}
+	}
+	return "udp"
+}
+
+// altSvcHandler returns the handler which advertises HTTP/3 by the Alt-Svc header on the TLS responses, except while draining.
+func (s *server) altSvcHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil && !s.drainer.Draining() {
+			// ErrNoAltSvcPort is returned until the HTTP/3 server starts listening
+			_ = s.h3srv.SetQuicHeaders(w.Header())
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// serveHTTP3 returns any error occurred when start the HTTP/3 server, including any error when loading TLS certificate.
+func (s *server) serveHTTP3() error {
+	cfg, err := s.tlsConfig()
+	if err != nil {
+		return errors.Wrap(err, "cannot create TLS configuration of HTTP/3 server")
+	}
+	if cfg.SessionTicketsDisabled {
+		// the QUIC handshake always issues a session ticket, so the tickets are issued but never resumed instead
+		cfg.SessionTicketsDisabled = false
+		cfg.UnwrapSession = func([]byte, tls.ConnectionState) (*tls.SessionState, error) {
+			return nil, nil
+		}
+	}
+	s.h3srv.TLSConfig = cfg
+
+	conn, err := net.ListenPacket(http3Network(s.cfg), s.h3srv.Addr)
+	if err != nil {
+		return err
+	}
+	// http3.Server does not close the connection passed by Serve
+	defer conn.Close()
+	glg.Infof("authorization proxy HTTP/3 server listening on %s", conn.LocalAddr())
+	return s.h3srv.Serve(conn)
+}
@@ -0,0 +1,196 @@
+package service
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+
+	"github.com/yahoojapan/authorization-proxy/v4/config"
+)
+
+func TestNewServer_http3(t *testing.T) {
+	dir := t.TempDir()
+	cert, key := writeTestCert(t, dir, "localhost")
+	tests := []struct {
+		name       string
+		http3      config.HTTP3
+		wantAltSvc string
+	}{
+		{
+			name: "serve HTTP/3 on the address of the TCP listener",
+			http3: config.HTTP3{
+				Enable: true,
+			},
+			wantAltSvc: `h3=":18444"`,
+		},
+		{
+			name: "serve HTTP/3 on the address and advertise the port",
+			http3: config.HTTP3{
+				Enable:     true,
+				Address:    "127.0.0.1:18445",
+				AltSvcPort: 443,
+			},
+			wantAltSvc: `h3=":443"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, err := NewServer(
+				WithServerConfig(config.Server{
+					Listener: config.Listener{
+						Network: config.ListenerTCP4,
+						Address: "127.0.0.1:18444",
+					},
+					// the additional listener has its own TLS, which is not shared by HTTP/3
+					Listeners: []config.ProxyListener{
+						{
+							Listener: config.Listener{
+								Network: config.ListenerTCP4,
+								Address: "127.0.0.1:18446",
+							},
+							TLS: config.TLS{
+								Enable:       true,
+								CertPath:     cert,
+								KeyPath:      key,
+								ReloadPeriod: "0",
+							},
+						},
+					},
+					HTTP3:           tt.http3,
+					ShutdownTimeout: "1s",
+					TLS: config.TLS{
+						Enable:       true,
+						CertPath:     cert,
+						KeyPath:      key,
+						ReloadPeriod: "0",
+					},
+				}),
+				WithRestHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					fmt.Fprint(w, r.Proto)
+				})),
+			)
+			if err != nil {
+				t.Fatalf("NewServer() error = %v", err)
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			echan := srv.ListenAndServe(ctx)
+			defer func() {
+				cancel()
+				<-echan
+			}()
+			time.Sleep(100 * time.Millisecond)
+
+			tlsConfig := &tls.Config{InsecureSkipVerify: true}
+			client := &http.Client{
+				Transport: &http.Transport{TLSClientConfig: tlsConfig},
+			}
+			res, err := client.Get("https://127.0.0.1:18444")
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			res.Body.Close()
+			if got := res.Header.Get("Alt-Svc"); len(got) < len(tt.wantAltSvc) || got[:len(tt.wantAltSvc)] != tt.wantAltSvc {
+				t.Errorf("Alt-Svc = %s, want %s", got, tt.wantAltSvc)
+			}
+			res, err = client.Get("https://127.0.0.1:18446")
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			res.Body.Close()
+			if got := res.Header.Get("Alt-Svc"); got != "" {
+				t.Errorf("Alt-Svc of the additional listener = %s, want none", got)
+			}
+
+			addr := tt.http3.Address
+			if addr == "" {
+				addr = "127.0.0.1:18444"
+			}
+			rt := &http3.RoundTripper{TLSClientConfig: tlsConfig}
+			defer rt.Close()
+			h3client := &http.Client{
+				Transport: rt,
+				Timeout:   5 * time.Second,
+			}
+			res, err = h3client.Get("https://" + addr)
+			if err != nil {
+				t.Fatalf("HTTP/3 Get() error = %v", err)
+			}
+			body, _ := ioutil.ReadAll(res.Body)
+			res.Body.Close()
+			if string(body) != "HTTP/3.0" {
+				t.Errorf("HTTP/3 response = %s, want HTTP/3.0", body)
+			}
+		})
+	}
+}
+
+func Test_http3Addr(t *testing.T) {
+	tests := []struct {
+		name        string
+		cfg         config.Server
+		wantAddr    string
+		wantNetwork string
+	}{
+		{
+			name: "return the port of the server",
+			cfg: config.Server{
+				Port: 8443,
+			},
+			wantAddr:    ":8443",
+			wantNetwork: "udp",
+		},
+		{
+			name: "return the address of the TCP listener",
+			cfg: config.Server{
+				Listener: config.Listener{
+					Network: config.ListenerTCP6,
+					Address: "[::1]:8443",
+				},
+			},
+			wantAddr:    "[::1]:8443",
+			wantNetwork: "udp6",
+		},
+		{
+			name: "return the port of the server for the unix listener",
+			cfg: config.Server{
+				Port: 8443,
+				Listener: config.Listener{
+					Network: config.ListenerUnix,
+					Address: "/run/authorization-proxy.sock",
+				},
+			},
+			wantAddr:    ":8443",
+			wantNetwork: "udp",
+		},
+		{
+			name: "return the address of HTTP/3",
+			cfg: config.Server{
+				Listener: config.Listener{
+					Network: config.ListenerTCP4,
+					Address: "0.0.0.0:8443",
+				},
+				HTTP3: config.HTTP3{
+					Address: "[::]:443",
+				},
+			},
+			wantAddr:    "[::]:443",
+			wantNetwork: "udp",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := http3Addr(tt.cfg); got != tt.wantAddr {
+				t.Errorf("http3Addr() = %v, want %v", got, tt.wantAddr)
+			}
+			if got := http3Network(tt.cfg); got != tt.wantNetwork {
+				t.Errorf("http3Network() = %v, want %v", got, tt.wantNetwork)
+			}
+		})
+	}
+}
@@ -0,0 +1,197 @@
+/*
+Copyright (C)  2018 Yahoo Japan Corporation Athenz team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/pkg/errors"
+
+	"github.com/yahoojapan/authorization-proxy/v4/config"
+)
+
+// listenFDsStart represents the first file descriptor passed by the systemd socket activation.
+const listenFDsStart = 3
+
+var (
+	// systemdFDs represents the file descriptors passed by the systemd socket activation, keyed by the names in LISTEN_FDNAMES.
+	systemdFDs     map[string]int
+	systemdFDsErr  error
+	systemdFDsOnce sync.Once
+)
+
+// Listen returns the listener of the configuration, or the TCP listener on the address if the listener is not configured.
+func Listen(cfg config.Listener, addr string) (net.Listener, error) {
+	switch cfg.Network {
+	case config.ListenerUnix:
+		return listenUnix(cfg)
+	case config.ListenerFD:
+		return listenFD(cfg.Address)
+	default:
+		network := config.ListenerTCP
+		if cfg.Network != "" {
+			network = cfg.Network
+		}
+		if cfg.Enabled() {
+			addr = cfg.Address
+		}
+		return net.Listen(network, addr)
+	}
+}
+
+// listenAddr returns the address of the listener, or the address on all interfaces with the port if the listener is not configured.
+func listenAddr(cfg config.Listener, port int) string {
+	if cfg.Enabled() {
+		return cfg.Address
+	}
+	return fmt.Sprintf(":%d", port)
+}
+
+// listenUnix returns the Unix domain socket listener, and sets the permission and the owner of the socket file.
+// The stale socket file left by the previous process is removed, and the socket file is removed when the listener is closed.
+func listenUnix(cfg config.Listener) (net.Listener, error) {
+	if fi, err := os.Lstat(cfg.Address); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(cfg.Address); err != nil {
+			return nil, errors.Wrap(err, "cannot remove the stale socket file")
+		}
+	}
+	l, err := net.Listen("unix", cfg.Address)
+	if err != nil {
+		return nil, err
+	}
+	if err := chmodOwn(cfg); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// chmodOwn sets the permission and the owner of the socket file.
+func chmodOwn(cfg config.Listener) error {
+	if cfg.Mode != "" {
+		m, err := strconv.ParseUint(cfg.Mode, 8, 32)
+		if err != nil {
+			return errors.Wrapf(err, "invalid mode: %s", cfg.Mode)
+		}
+		if err := os.Chmod(cfg.Address, os.FileMode(m)); err != nil {
+			return errors.Wrap(err, "cannot change the mode of the socket file")
+		}
+	}
+	if cfg.Owner == "" {
+		return nil
+	}
+	uid, gid, err := lookupOwner(cfg.Owner)
+	if err != nil {
+		return err
+	}
+	return errors.Wrap(os.Chown(cfg.Address, uid, gid), "cannot change the owner of the socket file")
+}
+
+// lookupOwner returns the user ID and the group ID of "user", "user:group" or ":group". -1 is returned for the omitted one.
+func lookupOwner(owner string) (uid, gid int, err error) {
+	uid, gid = -1, -1
+	name, group, _ := strings.Cut(owner, ":")
+	if name != "" {
+		if uid, err = strconv.Atoi(name); err != nil {
+			u, err := user.Lookup(name)
+			if err != nil {
+				return -1, -1, errors.Wrapf(err, "cannot lookup the user: %s", name)
+			}
+			uid, _ = strconv.Atoi(u.Uid)
+		}
+	}
+	if group != "" {
+		if gid, err = strconv.Atoi(group); err != nil {
+			g, err := user.LookupGroup(group)
+			if err != nil {
+				return -1, -1, errors.Wrapf(err, "cannot lookup the group: %s", group)
+			}
+			gid, _ = strconv.Atoi(g.Gid)
+		}
+	}
+	return uid, gid, nil
+}
+
+// listenFD returns the listener of the inherited file descriptor, which is the number or the name in LISTEN_FDNAMES of the systemd socket activation.
+func listenFD(addr string) (net.Listener, error) {
+	fd, err := strconv.Atoi(addr)
+	if err != nil {
+		systemdFDsOnce.Do(func() {
+			systemdFDs, systemdFDsErr = parseListenFDs(os.Getenv("LISTEN_PID"), os.Getenv("LISTEN_FDS"), os.Getenv("LISTEN_FDNAMES"))
+			// the file descriptors must not be inherited by the child processes
+			for _, fd := range systemdFDs {
+				syscall.CloseOnExec(fd)
+			}
+		})
+		if systemdFDsErr != nil {
+			return nil, systemdFDsErr
+		}
+		var ok bool
+		if fd, ok = systemdFDs[addr]; !ok {
+			return nil, errors.Errorf("file descriptor not found in LISTEN_FDNAMES: %s", addr)
+		}
+	}
+	if fd < listenFDsStart {
+		return nil, errors.Errorf("invalid file descriptor: %d", fd)
+	}
+
+	// FileListener duplicates the file descriptor, the original one is closed
+	f := os.NewFile(uintptr(fd), addr)
+	defer f.Close()
+	l, err := net.FileListener(f)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot listen on the file descriptor: %s", addr)
+	}
+	return l, nil
+}
+
+// parseListenFDs returns the file descriptors of the systemd socket activation keyed by the names.
+// The descriptors without the names are keyed by "unknown" as systemd does, so only the first one of them can be referred.
+func parseListenFDs(pid, fds, names string) (map[string]int, error) {
+	if fds == "" {
+		return nil, errors.New("LISTEN_FDS is not set, the process is not socket activated")
+	}
+	if pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return nil, errors.Errorf("LISTEN_PID %s does not match the process %d", pid, os.Getpid())
+	}
+	n, err := strconv.Atoi(fds)
+	if err != nil || n < 0 {
+		return nil, errors.Errorf("invalid LISTEN_FDS: %s", fds)
+	}
+	var ns []string
+	if names != "" {
+		ns = strings.Split(names, ":")
+	}
+	m := make(map[string]int, n)
+	for i := 0; i < n; i++ {
+		name := "unknown"
+		if i < len(ns) && ns[i] != "" {
+			name = ns[i]
+		}
+		if _, ok := m[name]; !ok {
+			m[name] = listenFDsStart + i
+		}
+	}
+	return m, nil
+}
@@ -0,0 +1,236 @@
+package service
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/yahoojapan/authorization-proxy/v4/config"
+)
+
+func TestListen(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name        string
+		cfg         config.Listener
+		addr        string
+		wantNetwork string
+		checkFunc   func(l net.Listener) error
+	}{
+		{
+			name:        "listen tcp on the default address",
+			addr:        "127.0.0.1:0",
+			wantNetwork: "tcp",
+		},
+		{
+			name: "listen tcp on the address",
+			cfg: config.Listener{
+				Address: "127.0.0.1:0",
+			},
+			addr:        ":8082",
+			wantNetwork: "tcp",
+			checkFunc: func(l net.Listener) error {
+				if ip := l.Addr().(*net.TCPAddr).IP; !ip.IsLoopback() {
+					return errors.Errorf("unexpected address: %v", l.Addr())
+				}
+				return nil
+			},
+		},
+		{
+			name: "listen unix with the mode",
+			cfg: config.Listener{
+				Network: config.ListenerUnix,
+				Address: filepath.Join(dir, "proxy.sock"),
+				Mode:    "0600",
+			},
+			wantNetwork: "unix",
+			checkFunc: func(l net.Listener) error {
+				fi, err := os.Stat(filepath.Join(dir, "proxy.sock"))
+				if err != nil {
+					return err
+				}
+				if fi.Mode().Perm() != 0600 {
+					return errors.Errorf("unexpected mode: %v", fi.Mode().Perm())
+				}
+				return nil
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := Listen(tt.cfg, tt.addr)
+			if err != nil {
+				t.Fatalf("Listen() error = %v", err)
+			}
+			defer l.Close()
+			if l.Addr().Network() != tt.wantNetwork {
+				t.Errorf("Listen() network = %s, want %s", l.Addr().Network(), tt.wantNetwork)
+			}
+			if tt.checkFunc != nil {
+				if err := tt.checkFunc(l); err != nil {
+					t.Error(err)
+				}
+			}
+		})
+	}
+}
+
+func TestListen_unixStaleSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "proxy.sock")
+	cfg := config.Listener{
+		Network: config.ListenerUnix,
+		Address: path,
+	}
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// leave the socket file as a crashed process does
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	l, err := Listen(cfg, "")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	l.Close()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("socket file is not removed on close: %v", err)
+	}
+}
+
+func TestListen_fd(t *testing.T) {
+	tl, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tl.Close()
+	f, err := tl.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := Listen(config.Listener{
+		Network: config.ListenerFD,
+		Address: strconv.Itoa(int(f.Fd())),
+	}, "")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	defer l.Close()
+	if l.Addr().String() != tl.Addr().String() {
+		t.Errorf("Listen() address = %s, want %s", l.Addr(), tl.Addr())
+	}
+
+	if _, err := Listen(config.Listener{Network: config.ListenerFD, Address: "2"}, ""); err == nil {
+		t.Error("Listen() want error for the standard error")
+	}
+}
+
+func Test_parseListenFDs(t *testing.T) {
+	pid := strconv.Itoa(os.Getpid())
+	tests := []struct {
+		name    string
+		pid     string
+		fds     string
+		names   string
+		want    map[string]int
+		wantErr bool
+	}{
+		{
+			name:  "parse named file descriptors",
+			pid:   pid,
+			fds:   "3",
+			names: "proxy:health:debug",
+			want: map[string]int{
+				"proxy":  3,
+				"health": 4,
+				"debug":  5,
+			},
+		},
+		{
+			name: "parse unnamed file descriptors",
+			fds:  "2",
+			want: map[string]int{
+				"unknown": 3,
+			},
+		},
+		{
+			name:    "error when not socket activated",
+			wantErr: true,
+		},
+		{
+			name:    "error when the pid does not match",
+			pid:     "1",
+			fds:     "1",
+			wantErr: true,
+		},
+		{
+			name:    "error when the number is invalid",
+			pid:     pid,
+			fds:     "a",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseListenFDs(tt.pid, tt.fds, tt.names)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseListenFDs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseListenFDs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_lookupOwner(t *testing.T) {
+	tests := []struct {
+		name    string
+		owner   string
+		wantUID int
+		wantGID int
+		wantErr bool
+	}{
+		{
+			name:    "lookup user and group IDs",
+			owner:   "1000:1001",
+			wantUID: 1000,
+			wantGID: 1001,
+		},
+		{
+			name:    "lookup group only",
+			owner:   ":1001",
+			wantUID: -1,
+			wantGID: 1001,
+		},
+		{
+			name:    "lookup user by name",
+			owner:   "root",
+			wantUID: 0,
+			wantGID: -1,
+		},
+		{
+			name:    "error when the user is not found",
+			owner:   "no-such-user-for-test",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uid, gid, err := lookupOwner(tt.owner)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("lookupOwner() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (uid != tt.wantUID || gid != tt.wantGID) {
+				t.Errorf("lookupOwner() = %d, %d, want %d, %d", uid, gid, tt.wantUID, tt.wantGID)
+			}
+		})
+	}
+}
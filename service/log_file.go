@@ -0,0 +1,39 @@
+/*
+Copyright (C)  2018 Yahoo Japan Corporation Athenz team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/yahoojapan/authorization-proxy/v4/config"
+)
+
+// defaultLogMaxSize represents the default maximum size in megabytes of the log file.
+const defaultLogMaxSize = 100
+
+// newLogFile opens the log file for appending, which is rotated by size and age.
+// The rotation errors are written to stderr, since the logs of glg are written to the file.
+func newLogFile(path string, cfg config.LogRotation) (*rotatingFile, error) {
+	maxSize := cfg.MaxSize
+	if maxSize == 0 {
+		maxSize = defaultLogMaxSize
+	}
+	return newRotatingFile(path, 0o644, maxSize, parseDuration(cfg.MaxAge, 0), cfg.MaxBackups, func(format string, args ...interface{}) {
+		fmt.Fprintf(os.Stderr, format+"\n", args...)
+	})
+}
@@ -0,0 +1,388 @@
+/*
+Copyright (C)  2018 Yahoo Japan Corporation Athenz team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kpango/glg"
+	"github.com/pkg/errors"
+
+	"github.com/yahoojapan/authorization-proxy/v4/config"
+)
+
+const (
+	// logTimeFormat represents the timestamp format of the text log, which is the same as glg.
+	logTimeFormat = "2006-01-02 15:04:05"
+
+	// logDebugLevel represents the most verbose log level.
+	logDebugLevel = "debug"
+
+	// glgPackage represents the function name prefix of glg, used to find the caller of glg.
+	glgPackage = "github.com/kpango/glg."
+)
+
+// logLevelNames represents the log level names in the configuration of the glg levels.
+var logLevelNames = map[glg.LEVEL]string{
+	glg.DEBG:  "debug",
+	glg.INFO:  "info",
+	glg.WARN:  "warn",
+	glg.ERR:   "error",
+	glg.FATAL: "fatal",
+}
+
+// logLevelColors represents the colors of the glg levels, which are the same as glg.
+var logLevelColors = map[glg.LEVEL]func(string) string{
+	glg.DEBG:  glg.Purple,
+	glg.INFO:  glg.Green,
+	glg.WARN:  glg.Orange,
+	glg.ERR:   glg.Red,
+	glg.FATAL: glg.Red,
+}
+
+// LogLevels represents the log level and the log level overrides per package.
+type LogLevels struct {
+	Level    string            `json:"level"`
+	Packages map[string]string `json:"packages,omitempty"`
+}
+
+// logThresholds represents the parsed LogLevels.
+type logThresholds struct {
+	LogLevels
+	threshold glg.LEVEL
+	// packages sorted by the longest prefix first
+	packages []packageThreshold
+}
+
+type packageThreshold struct {
+	prefix    string
+	threshold glg.LEVEL
+}
+
+// Logger writes the glg logs in the configured format and destination.
+// The logs are filtered by the log level of the package calling glg, which can be changed at runtime.
+type Logger struct {
+	format string
+	color  bool
+
+	// out is the writer of the logs, and errOut is the writer of the error and fatal logs
+	out    io.Writer
+	errOut io.Writer
+	file   *rotatingFile
+	wmu    sync.Mutex
+
+	configured LogLevels
+	levels     atomic.Value // *logThresholds
+	mu         sync.Mutex
+}
+
+// NewLogger returns the Logger writing to the configured destination.
+func NewLogger(cfg config.Log) (*Logger, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	l := &Logger{
+		format: cfg.Format,
+		configured: LogLevels{
+			Level:    cfg.Level,
+			Packages: cfg.Packages,
+		},
+	}
+	if l.format == "" {
+		l.format = config.LogText
+	}
+	switch cfg.Output {
+	case "":
+		l.out, l.errOut = os.Stdout, os.Stderr
+		l.color = cfg.Color
+	case config.LogStdout:
+		l.out, l.errOut = os.Stdout, os.Stdout
+		l.color = cfg.Color
+	case config.LogStderr:
+		l.out, l.errOut = os.Stderr, os.Stderr
+		l.color = cfg.Color
+	default:
+		f, err := newLogFile(cfg.Output, cfg.Rotation)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot open log file")
+		}
+		l.file = f
+		l.out, l.errOut = f, f
+	}
+	if err := l.SetLevels(l.configured); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// Apply replaces the output of the debug, info, warn, error and fatal levels of glg with the Logger, and disables the other levels.
+func (l *Logger) Apply(g *glg.Glg) *glg.Glg {
+	g = g.SetMode(glg.NONE).
+		DisableTimestamp().
+		DisableColor().
+		SetLineTraceMode(glg.TraceLineNone)
+	for lev := range logLevelNames {
+		g = g.SetLevelMode(lev, glg.WRITER).
+			SetLevelWriter(lev, &levelWriter{
+				l:      l,
+				level:  lev,
+				prefix: []byte("[" + lev.String() + "]:\t"),
+			})
+	}
+	return g
+}
+
+// Levels returns the current log levels.
+func (l *Logger) Levels() LogLevels {
+	return l.levels.Load().(*logThresholds).LogLevels
+}
+
+// SetLevels changes the log levels.
+func (l *Logger) SetLevels(lv LogLevels) error {
+	t, err := newLogThresholds(lv)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	l.levels.Store(t)
+	l.mu.Unlock()
+	return nil
+}
+
+// Reconfigure changes the configured log levels, which are also restored by ToggleDebug, e.g. on the configuration reload.
+func (l *Logger) Reconfigure(lv LogLevels) error {
+	t, err := newLogThresholds(lv)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	l.configured = lv
+	l.levels.Store(t)
+	l.mu.Unlock()
+	return nil
+}
+
+// ToggleDebug changes the log level to debug, or restores the configured log levels if the log level is debug.
+func (l *Logger) ToggleDebug() LogLevels {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	lv := LogLevels{
+		Level: logDebugLevel,
+	}
+	if l.Levels().Level == logDebugLevel {
+		lv = l.configured
+	}
+	// the levels are valid, since the configured levels are validated in NewLogger
+	t, _ := newLogThresholds(lv)
+	l.levels.Store(t)
+	return lv
+}
+
+// Handler returns the handler to get the log levels by GET, and to change the log levels by PUT.
+func (l *Logger) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			var lv LogLevels
+			if err := json.NewDecoder(r.Body).Decode(&lv); err != nil {
+				http.Error(w, "invalid log levels: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := l.SetLevels(lv); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			glg.Infof("log levels are changed, level: %s, packages: %v", lv.Level, lv.Packages)
+		}
+		w.Header().Set(ContentType, ApplicationJSON+";"+CharsetUTF8)
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(l.Levels()); err != nil {
+			glg.Errorf("cannot encode log levels: %v", err)
+		}
+	})
+}
+
+// Close closes the log file.
+func (l *Logger) Close() error {
+	if l.file == nil {
+		return nil
+	}
+	return l.file.Close()
+}
+
+// levelWriter receives the logs of a glg level.
+type levelWriter struct {
+	l      *Logger
+	level  glg.LEVEL
+	prefix []byte
+}
+
+// Write writes the log line formatted by glg, which consists of the level tag and the message.
+func (w *levelWriter) Write(p []byte) (int, error) {
+	w.l.write(w.level, bytes.TrimSuffix(bytes.TrimPrefix(p, w.prefix), []byte("\n")))
+	return len(p), nil
+}
+
+func (l *Logger) write(level glg.LEVEL, msg []byte) {
+	t := l.levels.Load().(*logThresholds)
+	if len(t.packages) == 0 && level < t.threshold {
+		return
+	}
+
+	// the caller is only resolved if it is required, since it is costly
+	var caller runtime.Frame
+	if len(t.packages) > 0 || l.format == config.LogJSON || level >= glg.ERR {
+		caller = glgCaller()
+		if level < t.thresholdOf(packageOf(caller.Function)) {
+			return
+		}
+	}
+
+	b := new(bytes.Buffer)
+	now := time.Now()
+	if l.format == config.LogJSON {
+		err := json.NewEncoder(b).Encode(struct {
+			Time    string `json:"time"`
+			Level   string `json:"level"`
+			Package string `json:"package,omitempty"`
+			Caller  string `json:"caller,omitempty"`
+			Message string `json:"msg"`
+		}{
+			Time:    now.Format(time.RFC3339Nano),
+			Level:   logLevelNames[level],
+			Package: packageOf(caller.Function),
+			Caller:  callerOf(caller),
+			Message: string(msg),
+		})
+		if err != nil {
+			return
+		}
+	} else {
+		b.WriteString(now.Format(logTimeFormat) + "\t[" + level.String() + "]:\t")
+		if level >= glg.ERR {
+			b.WriteString("(" + callerOf(caller) + "):\t")
+		}
+		b.Write(msg)
+		if l.color {
+			s := logLevelColors[level](b.String())
+			b.Reset()
+			b.WriteString(s)
+		}
+		b.WriteByte('\n')
+	}
+
+	w := l.out
+	if level >= glg.ERR {
+		w = l.errOut
+	}
+	l.wmu.Lock()
+	w.Write(b.Bytes())
+	l.wmu.Unlock()
+}
+
+// newLogThresholds validates and parses the log levels.
+func newLogThresholds(lv LogLevels) (*logThresholds, error) {
+	if !config.ValidLogLevel(lv.Level) {
+		return nil, errors.New("invalid log level")
+	}
+	t := &logThresholds{
+		LogLevels: lv,
+		threshold: levelThreshold(lv.Level),
+		packages:  make([]packageThreshold, 0, len(lv.Packages)),
+	}
+	for pkg, level := range lv.Packages {
+		if pkg == "" || !config.ValidLogLevel(level) {
+			return nil, errors.Errorf("invalid package log level: %s: %s", pkg, level)
+		}
+		t.packages = append(t.packages, packageThreshold{
+			prefix:    pkg,
+			threshold: levelThreshold(level),
+		})
+	}
+	sort.Slice(t.packages, func(i, j int) bool {
+		return len(t.packages[i].prefix) > len(t.packages[j].prefix)
+	})
+	return t, nil
+}
+
+// thresholdOf returns the threshold of the package, or the global threshold if no package prefix matches.
+func (t *logThresholds) thresholdOf(pkg string) glg.LEVEL {
+	for _, p := range t.packages {
+		if pkg == p.prefix || strings.HasPrefix(pkg, p.prefix+"/") {
+			return p.threshold
+		}
+	}
+	return t.threshold
+}
+
+// levelThreshold returns the lowest glg level to log, the empty level disables logging.
+func levelThreshold(level string) glg.LEVEL {
+	for lev, name := range logLevelNames {
+		if name == level {
+			return lev
+		}
+	}
+	return glg.UNKNOWN
+}
+
+// glgCaller returns the frame calling glg.
+func glgCaller() runtime.Frame {
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs)])
+	inGlg := false
+	for {
+		f, more := frames.Next()
+		if strings.HasPrefix(f.Function, glgPackage) {
+			inGlg = true
+		} else if inGlg {
+			return f
+		}
+		if !more {
+			return runtime.Frame{}
+		}
+	}
+}
+
+// packageOf returns the package import path of the function name, e.g. "github.com/kpango/glg" of "github.com/kpango/glg.(*Glg).Infof".
+func packageOf(function string) string {
+	slash := strings.LastIndexByte(function, '/') + 1
+	if dot := strings.IndexByte(function[slash:], '.'); dot >= 0 {
+		return function[:slash+dot]
+	}
+	return function
+}
+
+// callerOf returns the file name and line of the frame, e.g. "handler/handler.go:80".
+func callerOf(f runtime.Frame) string {
+	if f.File == "" {
+		return ""
+	}
+	return filepath.Base(filepath.Dir(f.File)) + "/" + filepath.Base(f.File) + ":" + strconv.Itoa(f.Line)
+}
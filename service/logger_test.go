@@ -0,0 +1,372 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kpango/glg"
+	"github.com/pkg/errors"
+
+	"github.com/yahoojapan/authorization-proxy/v4/config"
+)
+
+const testPackage = "github.com/yahoojapan/authorization-proxy/v4/service"
+
+func newTestLogger(t *testing.T, cfg config.Log) (*Logger, *glg.Glg, *bytes.Buffer) {
+	t.Helper()
+	l, err := NewLogger(cfg)
+	if err != nil {
+		t.Fatalf("NewLogger() error = %v", err)
+	}
+	buf := new(bytes.Buffer)
+	l.out, l.errOut = buf, buf
+	return l, l.Apply(glg.New()), buf
+}
+
+func TestNewLogger(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		cfg     config.Log
+		wantErr string
+	}{
+		{
+			name: "create logger with the default output",
+			cfg: config.Log{
+				Level: "info",
+			},
+		},
+		{
+			name: "create logger with the file output",
+			cfg: config.Log{
+				Level:  "info",
+				Output: filepath.Join(dir, "authorization-proxy.log"),
+			},
+		},
+		{
+			name: "return error when the level is invalid",
+			cfg: config.Log{
+				Level: "verbose",
+			},
+			wantErr: "invalid log level",
+		},
+		{
+			name: "return error when the file cannot be opened",
+			cfg: config.Log{
+				Level:  "info",
+				Output: filepath.Join(dir, "not_exist", "authorization-proxy.log"),
+			},
+			wantErr: "cannot open log file: open " + filepath.Join(dir, "not_exist", "authorization-proxy.log") + ": no such file or directory",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewLogger(tt.cfg)
+			if (err == nil && tt.wantErr != "") || (err != nil && err.Error() != tt.wantErr) {
+				t.Errorf("NewLogger() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err == nil {
+				if lv := got.Levels(); lv.Level != tt.cfg.Level {
+					t.Errorf("NewLogger() level = %s, want %s", lv.Level, tt.cfg.Level)
+				}
+				got.Close()
+			}
+		})
+	}
+}
+
+func TestLogger_Apply(t *testing.T) {
+	tests := []struct {
+		name      string
+		cfg       config.Log
+		log       func(g *glg.Glg)
+		checkFunc func(string) error
+	}{
+		{
+			name: "write text log",
+			cfg: config.Log{
+				Level: "info",
+			},
+			log: func(g *glg.Glg) {
+				g.Infof("hello %s", "world")
+				g.Debug("hidden")
+			},
+			checkFunc: func(got string) error {
+				if !strings.HasSuffix(got, "\t[INFO]:\thello world\n") || strings.Count(got, "\n") != 1 {
+					return errors.Errorf("unexpected log: %q", got)
+				}
+				if _, err := time.Parse(logTimeFormat, got[:len(logTimeFormat)]); err != nil {
+					return err
+				}
+				return nil
+			},
+		},
+		{
+			name: "write text error log with caller",
+			cfg: config.Log{
+				Level: "error",
+			},
+			log: func(g *glg.Glg) {
+				g.Warn("hidden")
+				g.Error("failed")
+			},
+			checkFunc: func(got string) error {
+				if !strings.Contains(got, "\t[ERR]:\t(service/logger_test.go:") || !strings.HasSuffix(got, "):\tfailed\n") {
+					return errors.Errorf("unexpected log: %q", got)
+				}
+				return nil
+			},
+		},
+		{
+			name: "write colored text log",
+			cfg: config.Log{
+				Level: "warn",
+				Color: true,
+			},
+			log: func(g *glg.Glg) {
+				g.Warn("colored")
+			},
+			checkFunc: func(got string) error {
+				if !strings.HasPrefix(got, "\033[") || !strings.Contains(got, "colored") {
+					return errors.Errorf("unexpected log: %q", got)
+				}
+				return nil
+			},
+		},
+		{
+			name: "write json log",
+			cfg: config.Log{
+				Level:  "debug",
+				Format: config.LogJSON,
+			},
+			log: func(g *glg.Glg) {
+				g.Debugf("request_id: %s", "abc")
+			},
+			checkFunc: func(got string) error {
+				var e map[string]string
+				if err := json.Unmarshal([]byte(got), &e); err != nil {
+					return err
+				}
+				if e["level"] != "debug" || e["msg"] != "request_id: abc" || e["package"] != testPackage || !strings.HasPrefix(e["caller"], "service/logger_test.go:") {
+					return errors.Errorf("unexpected log: %q", got)
+				}
+				if _, err := time.Parse(time.RFC3339Nano, e["time"]); err != nil {
+					return err
+				}
+				return nil
+			},
+		},
+		{
+			name: "override the level of the package",
+			cfg: config.Log{
+				Level: "error",
+				Packages: map[string]string{
+					"github.com/yahoojapan/authorization-proxy/v4": "warn",
+					testPackage: "debug",
+				},
+			},
+			log: func(g *glg.Glg) {
+				g.Debug("shown")
+			},
+			checkFunc: func(got string) error {
+				if !strings.HasSuffix(got, "\t[DEBG]:\tshown\n") {
+					return errors.Errorf("unexpected log: %q", got)
+				}
+				return nil
+			},
+		},
+		{
+			name: "suppress the package logs",
+			cfg: config.Log{
+				Level: "debug",
+				Packages: map[string]string{
+					"github.com/yahoojapan": "",
+				},
+			},
+			log: func(g *glg.Glg) {
+				g.Error("hidden")
+			},
+			checkFunc: func(got string) error {
+				if got != "" {
+					return errors.Errorf("unexpected log: %q", got)
+				}
+				return nil
+			},
+		},
+		{
+			name: "disable logging",
+			cfg:  config.Log{},
+			log: func(g *glg.Glg) {
+				g.Error("hidden")
+			},
+			checkFunc: func(got string) error {
+				if got != "" {
+					return errors.Errorf("unexpected log: %q", got)
+				}
+				return nil
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, g, buf := newTestLogger(t, tt.cfg)
+			tt.log(g)
+			if err := tt.checkFunc(buf.String()); err != nil {
+				t.Errorf("Apply() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestLogger_ToggleDebug(t *testing.T) {
+	configured := LogLevels{
+		Level: "warn",
+		Packages: map[string]string{
+			testPackage: "error",
+		},
+	}
+	l, g, buf := newTestLogger(t, config.Log{
+		Level:    configured.Level,
+		Packages: configured.Packages,
+	})
+
+	if got := l.ToggleDebug(); !reflect.DeepEqual(got, LogLevels{Level: "debug"}) {
+		t.Errorf("ToggleDebug() = %v, want debug", got)
+	}
+	g.Debug("shown")
+	if !strings.Contains(buf.String(), "shown") {
+		t.Errorf("debug log is not written: %q", buf.String())
+	}
+
+	if got := l.ToggleDebug(); !reflect.DeepEqual(got, configured) {
+		t.Errorf("ToggleDebug() = %v, want %v", got, configured)
+	}
+	buf.Reset()
+	g.Warn("hidden")
+	if buf.Len() != 0 {
+		t.Errorf("warn log is written: %q", buf.String())
+	}
+}
+
+func TestLogger_Reconfigure(t *testing.T) {
+	l, g, buf := newTestLogger(t, config.Log{
+		Level: "warn",
+	})
+
+	if err := l.Reconfigure(LogLevels{Level: "invalid"}); err == nil {
+		t.Error("Reconfigure() error = nil, want invalid level")
+	}
+	reconfigured := LogLevels{
+		Level: "info",
+	}
+	if err := l.Reconfigure(reconfigured); err != nil {
+		t.Fatalf("Reconfigure() error = %v", err)
+	}
+	g.Info("shown")
+	if !strings.Contains(buf.String(), "shown") {
+		t.Errorf("info log is not written: %q", buf.String())
+	}
+
+	// the reconfigured levels are restored by the toggle
+	l.ToggleDebug()
+	if got := l.ToggleDebug(); !reflect.DeepEqual(got, reconfigured) {
+		t.Errorf("ToggleDebug() = %v, want %v", got, reconfigured)
+	}
+}
+
+func TestLogger_Handler(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		body       string
+		wantStatus int
+		wantLevels LogLevels
+	}{
+		{
+			name:       "get the log levels",
+			method:     http.MethodGet,
+			wantStatus: http.StatusOK,
+			wantLevels: LogLevels{
+				Level: "info",
+			},
+		},
+		{
+			name:       "change the log levels",
+			method:     http.MethodPut,
+			body:       `{"level":"warn","packages":{"github.com/yahoojapan/athenz-authorizer/v5":"debug"}}`,
+			wantStatus: http.StatusOK,
+			wantLevels: LogLevels{
+				Level: "warn",
+				Packages: map[string]string{
+					"github.com/yahoojapan/athenz-authorizer/v5": "debug",
+				},
+			},
+		},
+		{
+			name:       "reject the invalid log level",
+			method:     http.MethodPut,
+			body:       `{"level":"verbose"}`,
+			wantStatus: http.StatusBadRequest,
+			wantLevels: LogLevels{
+				Level: "info",
+			},
+		},
+		{
+			name:       "reject the invalid body",
+			method:     http.MethodPut,
+			body:       `level=debug`,
+			wantStatus: http.StatusBadRequest,
+			wantLevels: LogLevels{
+				Level: "info",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, _, _ := newTestLogger(t, config.Log{
+				Level: "info",
+			})
+			w := httptest.NewRecorder()
+			l.Handler().ServeHTTP(w, httptest.NewRequest(tt.method, "/debug/log/level", strings.NewReader(tt.body)))
+			if w.Code != tt.wantStatus {
+				t.Errorf("Handler() status = %d, want %d, body: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if got := l.Levels(); !reflect.DeepEqual(got, tt.wantLevels) {
+				t.Errorf("Levels() = %v, want %v", got, tt.wantLevels)
+			}
+			if tt.wantStatus == http.StatusOK {
+				var got LogLevels
+				if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil || !reflect.DeepEqual(got, tt.wantLevels) {
+					t.Errorf("Handler() body = %s, error = %v", w.Body.String(), err)
+				}
+			}
+		})
+	}
+}
+
+func Test_packageOf(t *testing.T) {
+	tests := []struct {
+		function string
+		want     string
+	}{
+		{"github.com/yahoojapan/authorization-proxy/v4/handler.(*transport).RoundTrip", "github.com/yahoojapan/authorization-proxy/v4/handler"},
+		{"github.com/yahoojapan/athenz-authorizer/v5/policy.(*policyd).Start.func1", "github.com/yahoojapan/athenz-authorizer/v5/policy"},
+		{"main.run", "main"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.function, func(t *testing.T) {
+			if got := packageOf(tt.function); got != tt.want {
+				t.Errorf("packageOf() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,533 @@
+/*
+Copyright (C)  2018 Yahoo Japan Corporation Athenz team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/stats"
+
+	"github.com/yahoojapan/authorization-proxy/v4/config"
+)
+
+const (
+	metricsNamespace = "authz_proxy"
+
+	// DefaultMetricsPath represents the default path of the metrics endpoint.
+	DefaultMetricsPath = "/metrics"
+
+	// DecisionAllowed represents the request is allowed by the authorizer.
+	DecisionAllowed = "allowed"
+	// DecisionDenied represents the request is denied by the authorizer.
+	DecisionDenied = "denied"
+	// DecisionSkipped represents the authorization is skipped, e.g. origin health check paths.
+	DecisionSkipped = "skipped"
+	// DecisionShed represents the request is shed by the overload limits before the authorization.
+	DecisionShed = "shed"
+
+	// otherRoute represents the route label of the requests not matching any configured route, and the method label of the gRPC calls not matching any configured method.
+	otherRoute = "other"
+
+	refreshPolicy = "policy"
+	refreshPubkey = "pubkey"
+	refreshJWK    = "jwk"
+)
+
+// Metrics represents the Prometheus metrics of the authorization proxy.
+// All methods are safe to call on a nil *Metrics, which does nothing.
+type Metrics struct {
+	cfg      config.Metrics
+	registry *prometheus.Registry
+
+	requests         *prometheus.CounterVec
+	requestDuration  *prometheus.HistogramVec
+	authzDuration    *prometheus.HistogramVec
+	upstreamDuration *prometheus.HistogramVec
+	upstreamErrors   *prometheus.CounterVec
+	grpcCalls        *prometheus.CounterVec
+	grpcDuration     *prometheus.HistogramVec
+	connections      *prometheus.GaugeVec
+	authorizerErrors prometheus.Counter
+	refreshes        *prometheus.CounterVec
+	refreshAge       *refreshAgeCollector
+	tlsReloads       *prometheus.CounterVec
+	tlsCertExpiry    prometheus.Gauge
+	shed             *prometheus.CounterVec
+	configReloads    *prometheus.CounterVec
+}
+
+// BufferPoolStats represents the statistics of the proxy buffer pool.
+type BufferPoolStats struct {
+	Gets        uint64
+	Puts        uint64
+	Allocations uint64
+	Size        uint64
+}
+
+// NewMetrics returns the Prometheus metrics of the authorization proxy, or nil if the metrics endpoint is disabled.
+func NewMetrics(cfg config.Metrics) *Metrics {
+	if !cfg.Enable {
+		return nil
+	}
+
+	m := &Metrics{
+		cfg:      cfg,
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_requests_total",
+			Help:      "Number of HTTP requests by route, authorization decision and response status.",
+		}, []string{"route", "decision", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Latency of HTTP requests by route, authorization decision and response status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "decision", "status"}),
+		authzDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "authorization_duration_seconds",
+			Help:      "Latency of the authorization check by protocol and decision.",
+			Buckets:   []float64{.0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1},
+		}, []string{"protocol", "decision"}),
+		upstreamDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "upstream_duration_seconds",
+			Help:      "Latency of the upstream requests by protocol.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"protocol"}),
+		upstreamErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "upstream_errors_total",
+			Help:      "Number of failed upstream requests by protocol.",
+		}, []string{"protocol"}),
+		grpcCalls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "grpc_calls_total",
+			Help:      "Number of gRPC calls by method and status code.",
+		}, []string{"method", "code"}),
+		grpcDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "grpc_call_duration_seconds",
+			Help:      "Latency of gRPC calls by method.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method"}),
+		connections: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "connections_in_flight",
+			Help:      "Number of open client connections by server.",
+		}, []string{"server"}),
+		authorizerErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "authorizer_errors_total",
+			Help:      "Number of errors reported by the authorizer daemon.",
+		}),
+		refreshes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "athenz_refresh_total",
+			Help:      "Number of policy, public key and JWK fetches from Athenz by type, domain and result.",
+		}, []string{"type", "domain", "result"}),
+		refreshAge: newRefreshAgeCollector(),
+		tlsReloads: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "tls_reloads_total",
+			Help:      "Number of server certificate reloads by result.",
+		}, []string{"result"}),
+		tlsCertExpiry: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "tls_certificate_expiry_timestamp_seconds",
+			Help:      "Expiry time of the loaded server certificate in Unix seconds.",
+		}),
+		shed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "overload_shed_total",
+			Help:      "Number of connections and requests shed by the overload limits by limit and reason.",
+		}, []string{"limit", "reason"}),
+		configReloads: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "config_reloads_total",
+			Help:      "Number of configuration reloads by result.",
+		}, []string{"result"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests,
+		m.requestDuration,
+		m.authzDuration,
+		m.upstreamDuration,
+		m.upstreamErrors,
+		m.grpcCalls,
+		m.grpcDuration,
+		m.connections,
+		m.authorizerErrors,
+		m.refreshes,
+		m.refreshAge,
+		m.tlsReloads,
+		m.tlsCertExpiry,
+		m.shed,
+		m.configReloads,
+	)
+	return m
+}
+
+// Handler returns the handler of the metrics endpoint.
+func (m *Metrics) Handler() http.Handler {
+	if m == nil {
+		return http.NotFoundHandler()
+	}
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Path returns the path of the metrics endpoint.
+func (m *Metrics) Path() string {
+	if m == nil || m.cfg.Path == "" {
+		return DefaultMetricsPath
+	}
+	return m.cfg.Path
+}
+
+// OnServer returns whether the metrics endpoint is exposed on the given server, "healthCheck" or "debug".
+func (m *Metrics) OnServer(server string) bool {
+	if m == nil {
+		return false
+	}
+	if m.cfg.Server == "" {
+		return server == config.MetricsOnHealthCheck
+	}
+	return m.cfg.Server == server
+}
+
+// Route returns the route label of the given URL path, which is the longest matching route prefix in the configuration.
+func (m *Metrics) Route(path string) string {
+	if m == nil {
+		return otherRoute
+	}
+	return longestPrefix(path, m.cfg.Routes)
+}
+
+// GRPCMethod returns the method label of the given gRPC full method name, which is the longest matching method prefix in the configuration.
+// The full method name is sent by the client before the authorization, so it is never used as the label as is.
+func (m *Metrics) GRPCMethod(method string) string {
+	if m == nil {
+		return otherRoute
+	}
+	return longestPrefix(method, m.cfg.GRPCMethods)
+}
+
+// longestPrefix returns the longest prefix of s in the prefixes, or "other" if no prefix matches.
+func longestPrefix(s string, prefixes []string) string {
+	label := otherRoute
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) && (label == otherRoute || len(p) > len(label)) {
+			label = p
+		}
+	}
+	return label
+}
+
+// ObserveRequest records the HTTP request result.
+func (m *Metrics) ObserveRequest(route, decision string, status int, d time.Duration) {
+	if m == nil {
+		return
+	}
+	code := strconv.Itoa(status)
+	m.requests.WithLabelValues(route, decision, code).Inc()
+	m.requestDuration.WithLabelValues(route, decision, code).Observe(d.Seconds())
+}
+
+// ObserveAuthorization records the authorization check result.
+func (m *Metrics) ObserveAuthorization(protocol, decision string, d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.authzDuration.WithLabelValues(protocol, decision).Observe(d.Seconds())
+}
+
+// ObserveUpstream records the upstream request result.
+func (m *Metrics) ObserveUpstream(protocol string, d time.Duration, failed bool) {
+	if m == nil {
+		return
+	}
+	m.upstreamDuration.WithLabelValues(protocol).Observe(d.Seconds())
+	if failed {
+		m.upstreamErrors.WithLabelValues(protocol).Inc()
+	}
+}
+
+// ObserveGRPCCall records the gRPC call result. The method must be the label returned by GRPCMethod.
+func (m *Metrics) ObserveGRPCCall(method string, code codes.Code, d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.grpcCalls.WithLabelValues(method, code.String()).Inc()
+	m.grpcDuration.WithLabelValues(method).Observe(d.Seconds())
+}
+
+// AuthorizerError records an error reported by the authorizer daemon.
+func (m *Metrics) AuthorizerError() {
+	if m == nil {
+		return
+	}
+	m.authorizerErrors.Inc()
+}
+
+// ObserveTLSReload records the server certificate reload result, and the expiry time of the loaded certificate on success.
+func (m *Metrics) ObserveTLSReload(err error, notAfter time.Time) {
+	if m == nil {
+		return
+	}
+	if err != nil {
+		m.tlsReloads.WithLabelValues("failure").Inc()
+		return
+	}
+	m.tlsReloads.WithLabelValues("success").Inc()
+	m.tlsCertExpiry.Set(float64(notAfter.Unix()))
+}
+
+// ObserveConfigReload records the configuration reload result.
+func (m *Metrics) ObserveConfigReload(err error) {
+	if m == nil {
+		return
+	}
+	if err != nil {
+		m.configReloads.WithLabelValues("failure").Inc()
+		return
+	}
+	m.configReloads.WithLabelValues("success").Inc()
+}
+
+// ObserveShed records a connection or a request shed by the overload limit.
+func (m *Metrics) ObserveShed(limit, reason string) {
+	if m == nil {
+		return
+	}
+	m.shed.WithLabelValues(limit, reason).Inc()
+}
+
+// RegisterLimiter registers the statistics of the concurrency limit with the given name.
+func (m *Metrics) RegisterLimiter(name string, stats func() LimiterStats) {
+	if m == nil || stats == nil {
+		return
+	}
+	labels := prometheus.Labels{"limit": name}
+	m.registry.MustRegister(
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace:   metricsNamespace,
+			Name:        "overload_in_flight",
+			Help:        "Number of in-flight requests holding a slot of the concurrency limit.",
+			ConstLabels: labels,
+		}, func() float64 { return float64(stats().InFlight) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace:   metricsNamespace,
+			Name:        "overload_queued",
+			Help:        "Number of requests waiting for a slot of the concurrency limit.",
+			ConstLabels: labels,
+		}, func() float64 { return float64(stats().Queued) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace:   metricsNamespace,
+			Name:        "overload_limit",
+			Help:        "Current value of the concurrency limit, which changes if the limit is adaptive.",
+			ConstLabels: labels,
+		}, func() float64 { return float64(stats().Limit) }),
+	)
+}
+
+// RegisterBufferPool registers the statistics of the proxy buffer pool.
+func (m *Metrics) RegisterBufferPool(stats func() BufferPoolStats) {
+	if m == nil || stats == nil {
+		return
+	}
+	m.registry.MustRegister(
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "buffer_pool_gets_total",
+			Help:      "Number of buffers taken from the proxy buffer pool.",
+		}, func() float64 { return float64(stats().Gets) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "buffer_pool_puts_total",
+			Help:      "Number of buffers returned to the proxy buffer pool.",
+		}, func() float64 { return float64(stats().Puts) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "buffer_pool_allocations_total",
+			Help:      "Number of buffers allocated by the proxy buffer pool.",
+		}, func() float64 { return float64(stats().Allocations) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "buffer_pool_buffer_size_bytes",
+			Help:      "Capacity of the buffers allocated by the proxy buffer pool.",
+		}, func() float64 { return float64(stats().Size) }),
+	)
+}
+
+// ConnState returns the http.Server ConnState hook which tracks the open connections of the given server.
+func (m *Metrics) ConnState(server string) func(net.Conn, http.ConnState) {
+	if m == nil {
+		return nil
+	}
+	g := m.connections.WithLabelValues(server)
+	return func(_ net.Conn, state http.ConnState) {
+		switch state {
+		case http.StateNew:
+			g.Inc()
+		case http.StateClosed, http.StateHijacked:
+			g.Dec()
+		}
+	}
+}
+
+// GRPCStatsHandler returns the gRPC stats handler which tracks the open connections of the gRPC server.
+func (m *Metrics) GRPCStatsHandler() stats.Handler {
+	if m == nil {
+		return nil
+	}
+	return &connStatsHandler{
+		g: m.connections.WithLabelValues("grpc"),
+	}
+}
+
+// RoundTripper returns the http.RoundTripper which records the policy, public key and JWK fetches from Athenz.
+func (m *Metrics) RoundTripper(rt http.RoundTripper) http.RoundTripper {
+	if m == nil {
+		return rt
+	}
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	return &refreshRoundTripper{
+		RoundTripper: rt,
+		m:            m,
+	}
+}
+
+type connStatsHandler struct {
+	g prometheus.Gauge
+}
+
+func (h *connStatsHandler) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (h *connStatsHandler) HandleRPC(context.Context, stats.RPCStats) {}
+
+func (h *connStatsHandler) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (h *connStatsHandler) HandleConn(_ context.Context, s stats.ConnStats) {
+	switch s.(type) {
+	case *stats.ConnBegin:
+		h.g.Inc()
+	case *stats.ConnEnd:
+		h.g.Dec()
+	}
+}
+
+type refreshRoundTripper struct {
+	http.RoundTripper
+	m *Metrics
+}
+
+func (rt *refreshRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	res, err := rt.RoundTripper.RoundTrip(r)
+
+	typ, domain := refreshTarget(r)
+	result := "success"
+	// 304 Not Modified is returned when the cached data is still valid
+	if err != nil || res.StatusCode >= http.StatusBadRequest {
+		result = "failure"
+	} else {
+		rt.m.refreshAge.succeeded(typ, domain)
+	}
+	rt.m.refreshes.WithLabelValues(typ, domain, result).Inc()
+	return res, err
+}
+
+// refreshTarget returns the type and the domain of the fetch from Athenz.
+// The athenz-authorizer fetches the policy from /domain/{domain}/signed_policy_data, the public key from /domain/{sys.auth}/service/{zms|zts},
+// and the JWK from the other URLs.
+func refreshTarget(r *http.Request) (string, string) {
+	p := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	for i := 0; i+2 < len(p); i++ {
+		if p[i] != "domain" {
+			continue
+		}
+		switch {
+		case p[i+2] == "signed_policy_data":
+			return refreshPolicy, p[i+1]
+		case p[i+2] == "service":
+			return refreshPubkey, p[i+1]
+		}
+	}
+	return refreshJWK, r.URL.Host
+}
+
+type refreshKey struct {
+	typ    string
+	domain string
+}
+
+// refreshAgeCollector collects the duration since the last successful fetch from Athenz.
+type refreshAgeCollector struct {
+	desc *prometheus.Desc
+
+	mu   sync.Mutex
+	last map[refreshKey]time.Time
+}
+
+func newRefreshAgeCollector() *refreshAgeCollector {
+	return &refreshAgeCollector{
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "", "athenz_refresh_age_seconds"),
+			"Duration since the last successful policy, public key and JWK fetch from Athenz by type and domain.",
+			[]string{"type", "domain"}, nil),
+		last: make(map[refreshKey]time.Time),
+	}
+}
+
+func (c *refreshAgeCollector) succeeded(typ, domain string) {
+	c.mu.Lock()
+	c.last[refreshKey{typ, domain}] = time.Now()
+	c.mu.Unlock()
+}
+
+// Describe implements prometheus.Collector.
+func (c *refreshAgeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+// Collect implements prometheus.Collector.
+func (c *refreshAgeCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, t := range c.last {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, time.Since(t).Seconds(), k.typ, k.domain)
+	}
+}
@@ -0,0 +1,250 @@
+package service
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc/codes"
+
+	"github.com/yahoojapan/authorization-proxy/v4/config"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestNewMetrics(t *testing.T) {
+	if got := NewMetrics(config.Metrics{}); got != nil {
+		t.Errorf("NewMetrics() = %v, want nil when disabled", got)
+	}
+
+	// nil metrics does nothing
+	var m *Metrics
+	m.ObserveRequest("/", DecisionAllowed, http.StatusOK, time.Second)
+	m.ObserveAuthorization("http", DecisionAllowed, time.Second)
+	m.ObserveUpstream("http", time.Second, true)
+	m.ObserveGRPCCall("/method", codes.OK, time.Second)
+	m.AuthorizerError()
+	m.ObserveTLSReload(nil, time.Now())
+	m.RegisterBufferPool(func() BufferPoolStats { return BufferPoolStats{} })
+	m.ObserveShed(LimitGlobal, ShedLimitReached)
+	m.ObserveConfigReload(nil)
+	m.RegisterLimiter(LimitGlobal, func() LimiterStats { return LimiterStats{} })
+	if m.ConnState("api") != nil || m.GRPCStatsHandler() != nil {
+		t.Error("nil Metrics returned hooks")
+	}
+	if m.OnServer(config.MetricsOnHealthCheck) {
+		t.Error("nil Metrics is exposed on the health check server")
+	}
+}
+
+func TestMetrics_Handler(t *testing.T) {
+	m := NewMetrics(config.Metrics{
+		Enable: true,
+	})
+	m.ObserveRequest("/api", DecisionAllowed, http.StatusOK, time.Millisecond)
+	m.ObserveRequest("/api", DecisionDenied, http.StatusUnauthorized, time.Millisecond)
+	m.ObserveAuthorization("http", DecisionAllowed, time.Millisecond)
+	m.ObserveUpstream("http", time.Millisecond, true)
+	m.ObserveGRPCCall("/svc/method", codes.PermissionDenied, time.Millisecond)
+	m.AuthorizerError()
+	m.ObserveTLSReload(nil, time.Unix(1700000000, 0))
+	m.ObserveTLSReload(errors.New("tls: failed to find any PEM data"), time.Time{})
+	m.RegisterBufferPool(func() BufferPoolStats {
+		return BufferPoolStats{Gets: 3, Puts: 2, Allocations: 1, Size: 4096}
+	})
+	m.ObserveShed(UpstreamHTTP, ShedQueueTimeout)
+	m.ObserveConfigReload(errors.New("invalid configuration version"))
+	m.RegisterLimiter(UpstreamHTTP, func() LimiterStats {
+		return LimiterStats{InFlight: 5, Queued: 2, Limit: 8}
+	})
+	cs := m.ConnState("api")
+	cs(nil, http.StateNew)
+	cs(nil, http.StateNew)
+	cs(nil, http.StateClosed)
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body, _ := ioutil.ReadAll(rec.Body)
+
+	for _, want := range []string{
+		`authz_proxy_http_requests_total{decision="allowed",route="/api",status="200"} 1`,
+		`authz_proxy_http_requests_total{decision="denied",route="/api",status="401"} 1`,
+		`authz_proxy_authorization_duration_seconds_count{decision="allowed",protocol="http"} 1`,
+		`authz_proxy_upstream_errors_total{protocol="http"} 1`,
+		`authz_proxy_grpc_calls_total{code="PermissionDenied",method="/svc/method"} 1`,
+		`authz_proxy_authorizer_errors_total 1`,
+		`authz_proxy_tls_reloads_total{result="success"} 1`,
+		`authz_proxy_tls_reloads_total{result="failure"} 1`,
+		`authz_proxy_tls_certificate_expiry_timestamp_seconds 1.7e+09`,
+		`authz_proxy_buffer_pool_gets_total 3`,
+		`authz_proxy_buffer_pool_buffer_size_bytes 4096`,
+		`authz_proxy_connections_in_flight{server="api"} 1`,
+		`authz_proxy_overload_shed_total{limit="http",reason="queue_timeout"} 1`,
+		`authz_proxy_overload_in_flight{limit="http"} 5`,
+		`authz_proxy_overload_queued{limit="http"} 2`,
+		`authz_proxy_overload_limit{limit="http"} 8`,
+		`authz_proxy_config_reloads_total{result="failure"} 1`,
+		`go_goroutines`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("Handler() output does not contain %s", want)
+		}
+	}
+}
+
+func TestMetrics_OnServer(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    config.Metrics
+		server string
+		want   bool
+	}{
+		{
+			name:   "default is health check server",
+			cfg:    config.Metrics{Enable: true},
+			server: config.MetricsOnHealthCheck,
+			want:   true,
+		},
+		{
+			name:   "not on debug server by default",
+			cfg:    config.Metrics{Enable: true},
+			server: config.MetricsOnDebug,
+			want:   false,
+		},
+		{
+			name:   "on debug server",
+			cfg:    config.Metrics{Enable: true, Server: config.MetricsOnDebug},
+			server: config.MetricsOnDebug,
+			want:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewMetrics(tt.cfg).OnServer(tt.server); got != tt.want {
+				t.Errorf("OnServer() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMetrics_Route(t *testing.T) {
+	m := NewMetrics(config.Metrics{
+		Enable: true,
+		Routes: []string{"/api", "/api/v2", "/healthz"},
+	})
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "/api/v1/users", want: "/api"},
+		{path: "/api/v2/users", want: "/api/v2"},
+		{path: "/healthz", want: "/healthz"},
+		{path: "/unknown", want: "other"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := m.Route(tt.path); got != tt.want {
+				t.Errorf("Route() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_refreshTarget(t *testing.T) {
+	tests := []struct {
+		url        string
+		wantType   string
+		wantDomain string
+	}{
+		{
+			url:        "https://athenz.io/zts/v1/domain/provider-domain/signed_policy_data",
+			wantType:   "policy",
+			wantDomain: "provider-domain",
+		},
+		{
+			url:        "https://athenz.io/zts/v1/domain/sys.auth/service/zts",
+			wantType:   "pubkey",
+			wantDomain: "sys.auth",
+		},
+		{
+			url:        "https://athenz.io/zts/v1/oauth2/keys?rfc=true",
+			wantType:   "jwk",
+			wantDomain: "athenz.io",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			typ, domain := refreshTarget(httptest.NewRequest(http.MethodGet, tt.url, nil))
+			if typ != tt.wantType || domain != tt.wantDomain {
+				t.Errorf("refreshTarget() = %s, %s, want %s, %s", typ, domain, tt.wantType, tt.wantDomain)
+			}
+		})
+	}
+}
+
+func TestMetrics_RoundTripper(t *testing.T) {
+	m := NewMetrics(config.Metrics{
+		Enable: true,
+	})
+	var status int
+	var err error
+	rt := m.RoundTripper(roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		if err != nil {
+			return nil, err
+		}
+		return &http.Response{StatusCode: status}, nil
+	}))
+	fetch := func() {
+		rt.RoundTrip(httptest.NewRequest(http.MethodGet, "https://athenz.io/zts/v1/domain/dom/signed_policy_data", nil))
+	}
+
+	status = http.StatusOK
+	fetch()
+	status = http.StatusNotModified
+	fetch()
+	status = http.StatusInternalServerError
+	fetch()
+	err = errors.New("connection refused")
+	fetch()
+
+	if got := testutil.ToFloat64(m.refreshes.WithLabelValues("policy", "dom", "success")); got != 2 {
+		t.Errorf("success count = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(m.refreshes.WithLabelValues("policy", "dom", "failure")); got != 2 {
+		t.Errorf("failure count = %v, want 2", got)
+	}
+	if got := testutil.CollectAndCount(m.refreshAge); got != 1 {
+		t.Errorf("refresh age series = %d, want 1", got)
+	}
+}
+
+func TestMetrics_GRPCMethod(t *testing.T) {
+	m := NewMetrics(config.Metrics{
+		Enable:      true,
+		GRPCMethods: []string{"/pkg.Service/", "/pkg.Service/Get"},
+	})
+	tests := []struct {
+		method string
+		want   string
+	}{
+		{method: "/pkg.Service/List", want: "/pkg.Service/"},
+		{method: "/pkg.Service/Get", want: "/pkg.Service/Get"},
+		{method: "/random.Service/a8f3c1", want: "other"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			if got := m.GRPCMethod(tt.method); got != tt.want {
+				t.Errorf("GRPCMethod() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
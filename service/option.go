@@ -46,9 +46,51 @@ func WithGRPCServer(srv *grpc.Server) Option {
 	}
 }
 
+// WithMixedMode returns a mixed mode functional option, which serves HTTP and gRPC requests on the same listener
+func WithMixedMode(enable bool) Option {
+	return func(s *server) {
+		s.mixedMode = enable
+	}
+}
+
+// WithMetrics returns a Prometheus metrics functional option
+func WithMetrics(m *Metrics) Option {
+	return func(s *server) {
+		s.metrics = m
+	}
+}
+
+// WithAuthorizerStatus returns a authorizer status functional option
+func WithAuthorizerStatus(st *AuthorizerStatus) Option {
+	return func(s *server) {
+		s.authzStatus = st
+	}
+}
+
+// WithUpstreamHealthHandler returns a upstream health check handler functional option
+func WithUpstreamHealthHandler(h http.Handler) Option {
+	return func(s *server) {
+		s.upstreamHealth = h
+	}
+}
+
 // WithDebugHandler returns a DebugHandler functional option
 func WithDebugHandler(h http.Handler) Option {
 	return func(s *server) {
 		s.dsHandler = h
 	}
 }
+
+// WithTLSReloader returns a TLS certificate reloader functional option
+func WithTLSReloader(r *TLSReloader) Option {
+	return func(s *server) {
+		s.tlsReloader = r
+	}
+}
+
+// WithRevocationChecker returns a client certificate revocation checker functional option
+func WithRevocationChecker(r *RevocationChecker) Option {
+	return func(s *server) {
+		s.revocation = r
+	}
+}
@@ -206,6 +206,130 @@ func TestWithGRPCServer(t *testing.T) {
 	}
 }
 
+func TestWithMixedMode(t *testing.T) {
+	type args struct {
+		enable bool
+	}
+	tests := []struct {
+		name      string
+		args      args
+		checkFunc func(Option) error
+	}{
+		{
+			name: "set success",
+			args: args{
+				enable: true,
+			},
+			checkFunc: func(o Option) error {
+				srv := &server{}
+				o(srv)
+				if !srv.mixedMode {
+					return errors.New("value cannot set")
+				}
+				return nil
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := WithMixedMode(tt.args.enable)
+			if err := tt.checkFunc(got); err != nil {
+				t.Errorf("WithMixedMode() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestWithMetrics(t *testing.T) {
+	type args struct {
+		m *Metrics
+	}
+	tests := []struct {
+		name      string
+		args      args
+		checkFunc func(Option) error
+	}{
+		func() struct {
+			name      string
+			args      args
+			checkFunc func(Option) error
+		} {
+			m := NewMetrics(config.Metrics{Enable: true})
+			return struct {
+				name      string
+				args      args
+				checkFunc func(Option) error
+			}{
+				name: "set success",
+				args: args{
+					m: m,
+				},
+				checkFunc: func(o Option) error {
+					srv := &server{}
+					o(srv)
+					if srv.metrics != m {
+						return errors.New("value cannot set")
+					}
+					return nil
+				},
+			}
+		}(),
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := WithMetrics(tt.args.m)
+			if err := tt.checkFunc(got); err != nil {
+				t.Errorf("WithMetrics() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestWithAuthorizerStatus(t *testing.T) {
+	type args struct {
+		st *AuthorizerStatus
+	}
+	tests := []struct {
+		name      string
+		args      args
+		checkFunc func(Option) error
+	}{
+		func() struct {
+			name      string
+			args      args
+			checkFunc func(Option) error
+		} {
+			st := NewAuthorizerStatus(config.Authorization{})
+			return struct {
+				name      string
+				args      args
+				checkFunc func(Option) error
+			}{
+				name: "set success",
+				args: args{
+					st: st,
+				},
+				checkFunc: func(o Option) error {
+					srv := &server{}
+					o(srv)
+					if srv.authzStatus != st {
+						return errors.New("value cannot set")
+					}
+					return nil
+				},
+			}
+		}(),
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := WithAuthorizerStatus(tt.args.st)
+			if err := tt.checkFunc(got); err != nil {
+				t.Errorf("WithAuthorizerStatus() error = %v", err)
+			}
+		})
+	}
+}
+
 func TestWithDebugHandler(t *testing.T) {
 	type args struct {
 		h http.Handler
@@ -247,3 +371,93 @@ func TestWithDebugHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestWithTLSReloader(t *testing.T) {
+	type args struct {
+		r *TLSReloader
+	}
+	tests := []struct {
+		name      string
+		args      args
+		checkFunc func(Option) error
+	}{
+		func() struct {
+			name      string
+			args      args
+			checkFunc func(Option) error
+		} {
+			r := &TLSReloader{}
+			return struct {
+				name      string
+				args      args
+				checkFunc func(Option) error
+			}{
+				name: "set success",
+				args: args{
+					r: r,
+				},
+				checkFunc: func(o Option) error {
+					srv := &server{}
+					o(srv)
+					if srv.tlsReloader != r {
+						return errors.New("value cannot set")
+					}
+					return nil
+				},
+			}
+		}(),
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := WithTLSReloader(tt.args.r)
+			if err := tt.checkFunc(got); err != nil {
+				t.Errorf("WithTLSReloader() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestWithRevocationChecker(t *testing.T) {
+	type args struct {
+		r *RevocationChecker
+	}
+	tests := []struct {
+		name      string
+		args      args
+		checkFunc func(Option) error
+	}{
+		func() struct {
+			name      string
+			args      args
+			checkFunc func(Option) error
+		} {
+			r := &RevocationChecker{}
+			return struct {
+				name      string
+				args      args
+				checkFunc func(Option) error
+			}{
+				name: "set success",
+				args: args{
+					r: r,
+				},
+				checkFunc: func(o Option) error {
+					srv := &server{}
+					o(srv)
+					if srv.revocation != r {
+						return errors.New("value cannot set")
+					}
+					return nil
+				},
+			}
+		}(),
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := WithRevocationChecker(tt.args.r)
+			if err := tt.checkFunc(got); err != nil {
+				t.Errorf("WithRevocationChecker() error = %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,399 @@
+/*
+Copyright (C)  2018 Yahoo Japan Corporation Athenz team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kpango/glg"
+
+	"github.com/yahoojapan/authorization-proxy/v4/config"
+)
+
+const (
+	// DefaultQueueTimeout represents the default maximum duration to wait for a free slot of the limits.
+	DefaultQueueTimeout = 100 * time.Millisecond
+
+	// DefaultRetryAfter represents the default duration sent by the Retry-After header of the shed responses.
+	DefaultRetryAfter = time.Second
+
+	// LimitConnections represents the connection limit of the listeners.
+	LimitConnections = "connections"
+	// LimitGlobal represents the concurrency limit of the server.
+	LimitGlobal = "global"
+	// UpstreamHTTP represents the HTTP upstream.
+	UpstreamHTTP = "http"
+	// UpstreamGRPC represents the gRPC upstream.
+	UpstreamGRPC = "grpc"
+
+	// ShedLimitReached represents the request is shed since the limit is reached and the queue is full.
+	ShedLimitReached = "limit_reached"
+	// ShedQueueTimeout represents the request is shed since no slot is freed before the queue timeout.
+	ShedQueueTimeout = "queue_timeout"
+
+	// defaultLatencyTolerance represents the default ratio to the minimum latency, above which the adaptive limit decreases.
+	defaultLatencyTolerance = 2
+
+	// adaptiveDecrease represents the ratio of the adaptive limit after a decrease.
+	adaptiveDecrease = 0.9
+
+	// adaptiveWindow represents the interval to reset the minimum latency, so that the limit follows the changes of the upstream.
+	adaptiveWindow = 30 * time.Second
+)
+
+// ShedError represents an error that the request is shed by the limit.
+type ShedError struct {
+	// Limit represents the name of the limit, "global" or the upstream.
+	Limit string
+
+	// Reason represents why the request is shed, "limit_reached" or "queue_timeout".
+	Reason string
+}
+
+// Error returns the error message.
+func (e *ShedError) Error() string {
+	return fmt.Sprintf("overloaded: %s limit %s", e.Limit, e.Reason)
+}
+
+// LimiterStats represents the statistics of a concurrency limit.
+type LimiterStats struct {
+	InFlight int
+	Queued   int
+	Limit    int
+}
+
+// Limiter limits the in-flight requests of the authorization proxy server, globally and per upstream.
+// The requests beyond the limits wait in a bounded FIFO queue, and are shed when the queue is full or the queue timeout expires.
+// All methods are safe to call on a nil *Limiter, which does not limit.
+type Limiter struct {
+	global       *limit
+	upstreams    map[string]*limit
+	queueTimeout time.Duration
+	retryAfter   time.Duration
+	metrics      *Metrics
+}
+
+// NewLimiter returns the limiter of the overload configuration, or nil if no request limit is configured.
+func NewLimiter(cfg config.Overload, m *Metrics) *Limiter {
+	if !cfg.Enable || (cfg.MaxConcurrentRequests == 0 && cfg.Upstreams.HTTP == 0 && cfg.Upstreams.GRPC == 0) {
+		return nil
+	}
+	l := &Limiter{
+		upstreams:    make(map[string]*limit, 2),
+		queueTimeout: parseDuration(cfg.QueueTimeout, DefaultQueueTimeout),
+		retryAfter:   parseDuration(cfg.RetryAfter, DefaultRetryAfter),
+		metrics:      m,
+	}
+	if cfg.MaxConcurrentRequests > 0 {
+		l.global = newLimit(LimitGlobal, cfg.MaxConcurrentRequests, cfg.QueueSize, config.AdaptiveLimit{})
+		m.RegisterLimiter(LimitGlobal, l.global.stats)
+	}
+	for name, max := range map[string]int{
+		UpstreamHTTP: cfg.Upstreams.HTTP,
+		UpstreamGRPC: cfg.Upstreams.GRPC,
+	} {
+		if max > 0 {
+			ul := newLimit(name, max, cfg.QueueSize, cfg.Adaptive)
+			l.upstreams[name] = ul
+			m.RegisterLimiter(name, ul.stats)
+		}
+	}
+	return l
+}
+
+// RetryAfter returns the duration sent by the Retry-After header of the shed responses.
+func (l *Limiter) RetryAfter() time.Duration {
+	if l == nil {
+		return DefaultRetryAfter
+	}
+	return l.retryAfter
+}
+
+// Acquire takes a slot of the upstream limit and the global limit, waiting in the queue up to the queue timeout.
+// It returns *ShedError if the request is shed, or the context error if the context is done while waiting.
+// The returned permit must be released when the request completes.
+func (l *Limiter) Acquire(ctx context.Context, upstream string) (*Permit, error) {
+	if l == nil {
+		return nil, nil
+	}
+	deadline := time.Now().Add(l.queueTimeout)
+	p := new(Permit)
+	// the upstream limit is taken first, so that a saturated upstream does not hold the global slots while waiting
+	for _, lim := range []*limit{l.upstreams[upstream], l.global} {
+		if lim == nil {
+			continue
+		}
+		if err := lim.acquire(ctx, deadline); err != nil {
+			p.Release(0, false)
+			if se, ok := err.(*ShedError); ok {
+				l.metrics.ObserveShed(se.Limit, se.Reason)
+				glg.Debugf("request shed: %v", se)
+			}
+			return nil, err
+		}
+		p.limits = append(p.limits, lim)
+	}
+	return p, nil
+}
+
+// Permit represents the slots taken by a request.
+type Permit struct {
+	limits []*limit
+	once   sync.Once
+}
+
+// Release returns the slots to the limits. The upstream latency adjusts the adaptive limits, and 0 skips the adjustment.
+// It is safe to call on a nil *Permit, and only the first call releases the slots.
+func (p *Permit) Release(latency time.Duration, failed bool) {
+	if p == nil {
+		return
+	}
+	p.once.Do(func() {
+		for _, lim := range p.limits {
+			if latency > 0 || failed {
+				lim.observe(latency, failed)
+			}
+			lim.release()
+		}
+	})
+}
+
+// limit represents a concurrency limit with the queue of the waiting requests.
+type limit struct {
+	name      string
+	max       int
+	queueSize int
+
+	mu       sync.Mutex
+	current  float64
+	inFlight int
+	waiters  list.List
+
+	// adaptive limit
+	adaptive     bool
+	minLimit     float64
+	tolerance    float64
+	minLatency   time.Duration
+	windowMin    time.Duration
+	windowStart  time.Time
+	lastDecrease time.Time
+}
+
+func newLimit(name string, max, queueSize int, cfg config.AdaptiveLimit) *limit {
+	l := &limit{
+		name:      name,
+		max:       max,
+		queueSize: queueSize,
+		current:   float64(max),
+		adaptive:  cfg.Enable,
+		minLimit:  math.Max(float64(cfg.MinLimit), 1),
+		tolerance: cfg.LatencyTolerance,
+	}
+	if l.tolerance == 0 {
+		l.tolerance = defaultLatencyTolerance
+	}
+	return l
+}
+
+// capacity returns the current limit.
+func (l *limit) capacity() int {
+	return int(l.current)
+}
+
+// acquire takes a slot, or waits in the queue until the slot is handed over by release.
+func (l *limit) acquire(ctx context.Context, deadline time.Time) error {
+	l.mu.Lock()
+	if l.inFlight < l.capacity() && l.waiters.Len() == 0 {
+		l.inFlight++
+		l.mu.Unlock()
+		return nil
+	}
+	if l.waiters.Len() >= l.queueSize {
+		l.mu.Unlock()
+		return &ShedError{Limit: l.name, Reason: ShedLimitReached}
+	}
+	ch := make(chan struct{})
+	e := l.waiters.PushBack(ch)
+	l.mu.Unlock()
+
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+	var err error
+	select {
+	case <-ch:
+		return nil
+	case <-timer.C:
+		err = &ShedError{Limit: l.name, Reason: ShedQueueTimeout}
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	l.mu.Lock()
+	select {
+	case <-ch:
+		// the slot is handed over concurrently
+		l.mu.Unlock()
+		l.release()
+		return err
+	default:
+		l.waiters.Remove(e)
+	}
+	l.mu.Unlock()
+	return err
+}
+
+// release returns the slot, and hands over the free slots to the waiting requests in order.
+func (l *limit) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inFlight--
+	l.handOver()
+}
+
+// handOver hands over the free slots to the waiting requests. It must be called with the lock.
+func (l *limit) handOver() {
+	for l.inFlight < l.capacity() && l.waiters.Len() > 0 {
+		ch := l.waiters.Remove(l.waiters.Front()).(chan struct{})
+		l.inFlight++
+		close(ch)
+	}
+}
+
+// observe adjusts the adaptive limit by the upstream latency.
+// The limit decreases multiplicatively at most once per the latency when the latency exceeds the tolerance of the minimum latency or the request failed,
+// and increases additively up to the configured limit while the slots are in use.
+func (l *limit) observe(latency time.Duration, failed bool) {
+	if !l.adaptive {
+		return
+	}
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if latency > 0 {
+		if now.Sub(l.windowStart) > adaptiveWindow {
+			l.minLatency, l.windowMin, l.windowStart = l.windowMin, 0, now
+		}
+		if l.windowMin == 0 || latency < l.windowMin {
+			l.windowMin = latency
+		}
+		if l.minLatency == 0 || latency < l.minLatency {
+			l.minLatency = latency
+		}
+	}
+
+	if failed || float64(latency) > float64(l.minLatency)*l.tolerance {
+		if now.Sub(l.lastDecrease) > latency {
+			l.current = math.Max(l.current*adaptiveDecrease, l.minLimit)
+			l.lastDecrease = now
+		}
+		return
+	}
+	if float64(l.inFlight) >= l.current/2 {
+		l.current = math.Min(l.current+1/l.current, float64(l.max))
+		l.handOver()
+	}
+}
+
+// stats returns the statistics of the limit.
+func (l *limit) stats() LimiterStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return LimiterStats{
+		InFlight: l.inFlight,
+		Queued:   l.waiters.Len(),
+		Limit:    l.capacity(),
+	}
+}
+
+// connLimit represents the maximum number of open connections shared by the listeners of the authorization proxy server.
+type connLimit struct {
+	max     int64
+	open    int64
+	metrics *Metrics
+}
+
+// newConnLimit returns the connection limit, or nil if the limit is disabled.
+func newConnLimit(cfg config.Overload, m *Metrics) *connLimit {
+	if !cfg.Enable || cfg.MaxConnections <= 0 {
+		return nil
+	}
+	return &connLimit{
+		max:     int64(cfg.MaxConnections),
+		metrics: m,
+	}
+}
+
+// connLimitListener closes the accepted connections beyond the maximum number of open connections.
+type connLimitListener struct {
+	net.Listener
+	limit *connLimit
+}
+
+// newConnLimitListener returns the listener which counts the open connections by the limit, or the given listener if the limit is nil.
+func newConnLimitListener(l net.Listener, limit *connLimit) net.Listener {
+	if limit == nil {
+		return l
+	}
+	return &connLimitListener{
+		Listener: l,
+		limit:    limit,
+	}
+}
+
+// Accept returns the next connection within the limit.
+// The connections beyond the limit are accepted and closed immediately, instead of being left in the backlog of the kernel.
+func (l *connLimitListener) Accept() (net.Conn, error) {
+	for {
+		c, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		if atomic.AddInt64(&l.limit.open, 1) <= l.limit.max {
+			return &limitedConn{
+				Conn:  c,
+				limit: l.limit,
+			}, nil
+		}
+		atomic.AddInt64(&l.limit.open, -1)
+		c.Close()
+		l.limit.metrics.ObserveShed(LimitConnections, ShedLimitReached)
+		glg.Debugf("connection shed: %s", c.RemoteAddr())
+	}
+}
+
+// limitedConn represents the connection counted by the connection limit.
+type limitedConn struct {
+	net.Conn
+	limit *connLimit
+	once  sync.Once
+}
+
+// Close closes the connection and frees the slot of the connection limit.
+func (c *limitedConn) Close() error {
+	c.once.Do(func() {
+		atomic.AddInt64(&c.limit.open, -1)
+	})
+	return c.Conn.Close()
+}
@@ -0,0 +1,331 @@
+package service
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yahoojapan/authorization-proxy/v4/config"
+)
+
+func TestNewLimiter(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.Overload
+		wantNil bool
+	}{
+		{
+			name: "return nil when disabled",
+			cfg: config.Overload{
+				MaxConcurrentRequests: 10,
+			},
+			wantNil: true,
+		},
+		{
+			name: "return nil with the connection limit only",
+			cfg: config.Overload{
+				Enable:         true,
+				MaxConnections: 10,
+			},
+			wantNil: true,
+		},
+		{
+			name: "return the limiter with the upstream limit",
+			cfg: config.Overload{
+				Enable: true,
+				Upstreams: config.OverloadUpstreams{
+					GRPC: 10,
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewLimiter(tt.cfg, nil); (got == nil) != tt.wantNil {
+				t.Errorf("NewLimiter() = %v, wantNil %v", got, tt.wantNil)
+			}
+		})
+	}
+
+	// nil limiter does not limit
+	var l *Limiter
+	p, err := l.Acquire(context.Background(), UpstreamHTTP)
+	if err != nil {
+		t.Errorf("Acquire() error = %v", err)
+	}
+	p.Release(time.Second, false)
+	if got := l.RetryAfter(); got != DefaultRetryAfter {
+		t.Errorf("RetryAfter() = %v, want %v", got, DefaultRetryAfter)
+	}
+}
+
+func TestLimiter_Acquire(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      config.Overload
+		upstream string
+		hold     int
+		wantErr  error
+		wantHTTP int
+	}{
+		{
+			name: "acquire within the limits",
+			cfg: config.Overload{
+				Enable:                true,
+				MaxConcurrentRequests: 2,
+				Upstreams: config.OverloadUpstreams{
+					HTTP: 2,
+				},
+			},
+			upstream: UpstreamHTTP,
+			hold:     1,
+			wantHTTP: 1,
+		},
+		{
+			name: "shed by the upstream limit without the queue",
+			cfg: config.Overload{
+				Enable:                true,
+				MaxConcurrentRequests: 10,
+				Upstreams: config.OverloadUpstreams{
+					HTTP: 1,
+				},
+			},
+			upstream: UpstreamHTTP,
+			hold:     1,
+			wantErr:  &ShedError{Limit: UpstreamHTTP, Reason: ShedLimitReached},
+			wantHTTP: 1,
+		},
+		{
+			name: "shed by the global limit after the queue timeout",
+			cfg: config.Overload{
+				Enable:                true,
+				MaxConcurrentRequests: 1,
+				Upstreams: config.OverloadUpstreams{
+					HTTP: 2,
+				},
+				QueueSize:    1,
+				QueueTimeout: "50ms",
+			},
+			upstream: UpstreamHTTP,
+			hold:     1,
+			wantErr:  &ShedError{Limit: LimitGlobal, Reason: ShedQueueTimeout},
+			// the slot of the upstream limit is returned when the global limit sheds the request
+			wantHTTP: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewLimiter(tt.cfg, nil)
+			for i := 0; i < tt.hold; i++ {
+				if _, err := l.Acquire(context.Background(), UpstreamHTTP); err != nil {
+					t.Fatalf("Acquire() error = %v", err)
+				}
+			}
+			p, err := l.Acquire(context.Background(), tt.upstream)
+			if (err == nil && tt.wantErr != nil) || (err != nil && (tt.wantErr == nil || err.Error() != tt.wantErr.Error())) {
+				t.Errorf("Acquire() error = %v, want %v", err, tt.wantErr)
+			}
+			p.Release(0, false)
+			if got := l.upstreams[UpstreamHTTP].stats().InFlight; got != tt.wantHTTP {
+				t.Errorf("http limit in-flight = %d, want %d", got, tt.wantHTTP)
+			}
+		})
+	}
+}
+
+func TestLimiter_Acquire_queue(t *testing.T) {
+	l := NewLimiter(config.Overload{
+		Enable:                true,
+		MaxConcurrentRequests: 1,
+		QueueSize:             2,
+		QueueTimeout:          "1s",
+	}, nil)
+	first, err := l.Acquire(context.Background(), UpstreamHTTP)
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+
+	// the queued requests acquire the slot in order
+	var mu sync.Mutex
+	var order []int
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			p, err := l.Acquire(context.Background(), UpstreamHTTP)
+			if err != nil {
+				t.Errorf("queued Acquire() error = %v", err)
+				return
+			}
+			mu.Lock()
+			order = append(order, i)
+			mu.Unlock()
+			p.Release(0, false)
+		}(i)
+		time.Sleep(20 * time.Millisecond)
+	}
+	if st := l.global.stats(); st.Queued != 2 {
+		t.Errorf("queued = %d, want 2", st.Queued)
+	}
+	if _, err := l.Acquire(context.Background(), UpstreamHTTP); err == nil {
+		t.Error("Acquire() error = nil, want queue full")
+	}
+
+	first.Release(0, false)
+	// release is idempotent
+	first.Release(0, false)
+	wg.Wait()
+	if len(order) != 2 || order[0] != 0 || order[1] != 1 {
+		t.Errorf("order = %v, want [0 1]", order)
+	}
+	if st := l.global.stats(); st.InFlight != 0 || st.Queued != 0 {
+		t.Errorf("stats() = %+v, want idle", st)
+	}
+
+	// the canceled request leaves the queue
+	first, _ = l.Acquire(context.Background(), UpstreamHTTP)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := l.Acquire(ctx, UpstreamHTTP); err != context.DeadlineExceeded {
+		t.Errorf("Acquire() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if st := l.global.stats(); st.Queued != 0 {
+		t.Errorf("queued = %d, want 0", st.Queued)
+	}
+	first.Release(0, false)
+}
+
+func Test_limit_observe(t *testing.T) {
+	l := newLimit(UpstreamHTTP, 10, 0, config.AdaptiveLimit{
+		Enable:   true,
+		MinLimit: 5,
+	})
+	l.inFlight = 10
+
+	l.observe(10*time.Millisecond, false)
+	if got := l.capacity(); got != 10 {
+		t.Errorf("capacity() = %d, want 10 under the tolerance", got)
+	}
+
+	// the limit decreases once per the latency
+	l.observe(50*time.Millisecond, false)
+	l.observe(50*time.Millisecond, false)
+	if got := l.capacity(); got != 9 {
+		t.Errorf("capacity() = %d, want 9 after the latency increase", got)
+	}
+
+	// the limit does not decrease below the minimum
+	for i := 0; i < 20; i++ {
+		l.lastDecrease = time.Time{}
+		l.observe(0, true)
+	}
+	if got := l.capacity(); got != 5 {
+		t.Errorf("capacity() = %d, want the minimum 5", got)
+	}
+
+	// the limit increases while the slots are in use
+	for i := 0; i < 100; i++ {
+		l.observe(10*time.Millisecond, false)
+	}
+	if got := l.capacity(); got != 10 {
+		t.Errorf("capacity() = %d, want the maximum 10", got)
+	}
+}
+
+func Test_connLimitListener(t *testing.T) {
+	m := NewMetrics(config.Metrics{Enable: true})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	limit := newConnLimit(config.Overload{
+		Enable:         true,
+		MaxConnections: 1,
+	}, m)
+	l := newConnLimitListener(ln, limit)
+	defer l.Close()
+
+	accepted := make(chan net.Conn, 2)
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- c
+		}
+	}()
+
+	c1, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c1.Close()
+	sc := <-accepted
+
+	// the connection beyond the limit is closed
+	c2, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c2.Close()
+	c2.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := c2.Read(make([]byte, 1)); err == nil {
+		t.Error("connection beyond the limit is not closed")
+	}
+
+	// the slot is freed when the connection is closed
+	sc.Close()
+	sc.Close()
+	c3, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c3.Close()
+	select {
+	case c := <-accepted:
+		c.Close()
+	case <-time.After(time.Second):
+		t.Error("connection is not accepted after the slot is freed")
+	}
+
+	// the other listener shares the limit
+	ln2, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l2 := newConnLimitListener(ln2, limit)
+	defer l2.Close()
+	go func() {
+		for {
+			c, err := l2.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- c
+		}
+	}()
+	c4, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c4.Close()
+	c := <-accepted
+	defer c.Close()
+	c5, err := net.Dial("tcp", ln2.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c5.Close()
+	c5.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := c5.Read(make([]byte, 1)); err == nil {
+		t.Error("connection beyond the limit shared with the other listener is not closed")
+	}
+
+	if got := newConnLimitListener(ln, newConnLimit(config.Overload{Enable: true}, nil)); got != ln {
+		t.Error("newConnLimitListener() wraps the listener without the limit")
+	}
+}
@@ -0,0 +1,143 @@
+/*
+Copyright (C)  2018 Yahoo Japan Corporation Athenz team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/http2"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/yahoojapan/authorization-proxy/v4/config"
+)
+
+// apiListener represents an additional listener of the authorization proxy server, which has its own TLS configuration.
+type apiListener struct {
+	cfg config.ProxyListener
+
+	// HTTP server of the listener, nil in gRPC mode
+	srv *http.Server
+
+	// transport credentials of the gRPC server on the listener, nil in HTTP and mixed mode
+	creds credentials.TransportCredentials
+
+	// reloader of the server certificate and revocation check of the client certificates, nil if disabled
+	reloader   *TLSReloader
+	revocation *RevocationChecker
+}
+
+// newAPIListener returns the additional listener which has loaded the TLS certificate if TLS is enabled.
+// The TLS reload metrics are not recorded, since they represent the certificate of server.tls.
+func newAPIListener(cfg config.ProxyListener) (*apiListener, error) {
+	l := &apiListener{
+		cfg: cfg,
+	}
+	if !cfg.TLS.Enable {
+		return l, nil
+	}
+	var err error
+	l.reloader, err = NewTLSReloader(cfg.TLS, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot load TLS certificate of the listener %s", cfg.Address)
+	}
+	l.revocation, err = NewRevocationChecker(cfg.TLS.Revocation)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot create revocation checker of the listener %s", cfg.Address)
+	}
+	return l, nil
+}
+
+// tlsConfig returns the TLS configuration of the listener.
+func (l *apiListener) tlsConfig() (*tls.Config, error) {
+	return newServerTLSConfig(l.cfg.TLS, l.reloader, l.revocation)
+}
+
+// grpcCredentials returns the transport credentials of the gRPC server on the listener.
+func (l *apiListener) grpcCredentials() (credentials.TransportCredentials, error) {
+	if !l.cfg.TLS.Enable {
+		return insecure.NewCredentials(), nil
+	}
+	cfg, err := l.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	if !containsString(cfg.NextProtos, http2.NextProtoTLS) {
+		cfg.NextProtos = append(cfg.NextProtos, http2.NextProtoTLS)
+	}
+	return credentials.NewTLS(cfg), nil
+}
+
+// newServerTLSConfig returns the TLS configuration of the listener, which serves the reloaded certificate if the reloader is set,
+// and checks the revocation of the client certificates if the revocation checker is set.
+func newServerTLSConfig(cfg config.TLS, r *TLSReloader, rc *RevocationChecker) (*tls.Config, error) {
+	t, err := NewTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	r.Apply(t)
+	rc.Apply(t)
+	return t, nil
+}
+
+// listenerCredentials represents the transport credentials of the gRPC server, which performs the handshake with the credentials of the listener.
+// The connections of the listeners without their own credentials use the embedded ones.
+type listenerCredentials struct {
+	credentials.TransportCredentials
+}
+
+// ServerHandshake performs the handshake with the credentials of the listener accepting the connection.
+func (c *listenerCredentials) ServerHandshake(conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	if cc, ok := conn.(*credsConn); ok {
+		return cc.creds.ServerHandshake(conn)
+	}
+	return c.TransportCredentials.ServerHandshake(conn)
+}
+
+// Clone returns a copy of the credentials.
+func (c *listenerCredentials) Clone() credentials.TransportCredentials {
+	return &listenerCredentials{
+		TransportCredentials: c.TransportCredentials.Clone(),
+	}
+}
+
+// credsListener represents the listener whose connections are handshaked with the credentials.
+type credsListener struct {
+	net.Listener
+	creds credentials.TransportCredentials
+}
+
+// Accept returns the connection with the credentials of the listener.
+func (l *credsListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &credsConn{
+		Conn:  c,
+		creds: l.creds,
+	}, nil
+}
+
+// credsConn represents the connection with the credentials of the listener.
+type credsConn struct {
+	net.Conn
+	creds credentials.TransportCredentials
+}
@@ -0,0 +1,175 @@
+package service
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/yahoojapan/authorization-proxy/v4/config"
+)
+
+func TestNewServer_listeners(t *testing.T) {
+	dir := t.TempDir()
+	cert, key := writeTestCert(t, dir, "listener")
+	cfg := config.Server{
+		Port:            18082,
+		ShutdownTimeout: "1s",
+		Listeners: []config.ProxyListener{
+			{
+				Listener: config.Listener{
+					Network: config.ListenerTCP4,
+					Address: "127.0.0.1:18443",
+				},
+				TLS: config.TLS{
+					Enable:       true,
+					CertPath:     cert,
+					KeyPath:      key,
+					ReloadPeriod: "0",
+				},
+			},
+		},
+	}
+
+	t.Run("serve HTTP on the listener and the additional TLS listener", func(t *testing.T) {
+		srv, err := NewServer(
+			WithServerConfig(cfg),
+			WithRestHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, r.TLS != nil)
+			})),
+		)
+		if err != nil {
+			t.Fatalf("NewServer() error = %v", err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		echan := srv.ListenAndServe(ctx)
+		defer func() {
+			cancel()
+			<-echan
+		}()
+		time.Sleep(100 * time.Millisecond)
+
+		client := &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			},
+		}
+		for url, want := range map[string]string{
+			"http://127.0.0.1:18082":  "false",
+			"https://127.0.0.1:18443": "true",
+		} {
+			res, err := client.Get(url)
+			if err != nil {
+				t.Fatalf("Get(%s) error = %v", url, err)
+			}
+			var body [8]byte
+			n, _ := res.Body.Read(body[:])
+			res.Body.Close()
+			if string(body[:n]) != want {
+				t.Errorf("Get(%s) = %s, want %s", url, body[:n], want)
+			}
+		}
+	})
+
+	t.Run("serve gRPC with the credentials of each listener", func(t *testing.T) {
+		srv, err := NewServer(
+			WithServerConfig(cfg),
+			WithGRPCHandler(func(srv interface{}, stream grpc.ServerStream) error {
+				return status.Error(codes.Unavailable, "handled")
+			}),
+		)
+		if err != nil {
+			t.Fatalf("NewServer() error = %v", err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		echan := srv.ListenAndServe(ctx)
+		defer func() {
+			cancel()
+			<-echan
+		}()
+		time.Sleep(100 * time.Millisecond)
+
+		for addr, creds := range map[string]credentials.TransportCredentials{
+			"127.0.0.1:18082": insecure.NewCredentials(),
+			"127.0.0.1:18443": credentials.NewTLS(&tls.Config{InsecureSkipVerify: true}),
+		} {
+			conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(creds))
+			if err != nil {
+				t.Fatalf("Dial(%s) error = %v", addr, err)
+			}
+			cctx, ccancel := context.WithTimeout(context.Background(), 3*time.Second)
+			err = conn.Invoke(cctx, "/test.Service/Method", &emptypb.Empty{}, &emptypb.Empty{})
+			ccancel()
+			conn.Close()
+			if st, _ := status.FromError(err); st.Code() != codes.Unavailable || st.Message() != "handled" {
+				t.Errorf("Invoke(%s) error = %v", addr, err)
+			}
+		}
+	})
+}
+
+func Test_newAPIListener(t *testing.T) {
+	tests := []struct {
+		name         string
+		cfg          config.ProxyListener
+		wantReloader bool
+		wantErr      bool
+	}{
+		{
+			name: "plaintext listener",
+			cfg: config.ProxyListener{
+				Listener: config.Listener{
+					Address: "127.0.0.1:8080",
+				},
+			},
+		},
+		{
+			name: "TLS listener with the certificate reloader",
+			cfg: config.ProxyListener{
+				Listener: config.Listener{
+					Address: ":8443",
+				},
+				TLS: config.TLS{
+					Enable:   true,
+					CertPath: "../test/data/dummyServer.crt",
+					KeyPath:  "../test/data/dummyServer.key",
+				},
+			},
+			wantReloader: true,
+		},
+		{
+			name: "error when the certificate is not found",
+			cfg: config.ProxyListener{
+				Listener: config.Listener{
+					Address: ":8443",
+				},
+				TLS: config.TLS{
+					Enable:   true,
+					CertPath: "not_exist.crt",
+					KeyPath:  "not_exist.key",
+				},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newAPIListener(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newAPIListener() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (got.reloader != nil) != tt.wantReloader {
+				t.Errorf("newAPIListener() reloader = %v, want %v", got.reloader, tt.wantReloader)
+			}
+		})
+	}
+}
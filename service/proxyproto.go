@@ -0,0 +1,442 @@
+/*
+Copyright (C)  2018 Yahoo Japan Corporation Athenz team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kpango/glg"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/peer"
+
+	"github.com/yahoojapan/authorization-proxy/v4/config"
+)
+
+const defaultProxyHeaderTimeout = 5 * time.Second
+
+var (
+	// proxyV1Signature represents the prefix of the PROXY protocol v1 header.
+	proxyV1Signature = []byte("PROXY ")
+
+	// proxyV2Signature represents the prefix of the PROXY protocol v2 header.
+	proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+	// ErrProxyHeaderRequired represents an error that the PROXY protocol header is not sent by the trusted source.
+	ErrProxyHeaderRequired = errors.New("PROXY protocol header is required")
+)
+
+const (
+	// proxyV1MaxLength represents the maximum length of the PROXY protocol v1 header including CRLF.
+	proxyV1MaxLength = 107
+
+	// the TLV types of the PROXY protocol v2 header
+	pp2TypeAuthority     = 0x02
+	pp2TypeSSL           = 0x20
+	pp2SubtypeSSLVersion = 0x21
+	pp2SubtypeSSLCN      = 0x22
+	pp2SubtypeSSLCipher  = 0x23
+
+	// the client flags of the PP2_TYPE_SSL TLV
+	pp2ClientSSL      = 0x01
+	pp2ClientCertConn = 0x02
+)
+
+// ProxyHeader represents the PROXY protocol header sent by the load balancer.
+type ProxyHeader struct {
+	// Version represents the version of the PROXY protocol, 1 or 2.
+	Version int
+
+	// Source represents the address of the client, nil if the header is for the load balancer itself, i.e. LOCAL or UNKNOWN.
+	Source net.Addr
+
+	// Destination represents the address of the load balancer the client connected to, nil if Source is nil.
+	Destination net.Addr
+
+	// Authority represents the host name sent by the client, e.g. the SNI. Only available in v2.
+	Authority string
+
+	// TLS represents the TLS connection terminated by the load balancer, nil if the client did not use TLS. Only available in v2.
+	TLS *ProxyTLS
+}
+
+// ProxyTLS represents the TLS connection terminated by the load balancer.
+type ProxyTLS struct {
+	// Version represents the TLS version, e.g. "TLSv1.3".
+	Version string
+
+	// CipherSuite represents the cipher suite name, e.g. "ECDHE-RSA-AES128-GCM-SHA256".
+	CipherSuite string
+
+	// CommonName represents the common name of the client certificate.
+	CommonName string
+
+	// ClientCert represents whether the client presented a certificate on the connection.
+	ClientCert bool
+
+	// Verified represents whether the client certificate is verified by the load balancer.
+	Verified bool
+}
+
+// proxyConnKey is the context key of the connection with the PROXY protocol header.
+type proxyConnKey struct{}
+
+// ProxyHeaderFromContext returns the PROXY protocol header of the connection of the HTTP request or the gRPC call, or nil if it is not sent.
+func ProxyHeaderFromContext(ctx context.Context) *ProxyHeader {
+	if c, ok := ctx.Value(proxyConnKey{}).(*proxyProtocolConn); ok {
+		c.init()
+		return c.header
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		if a, ok := p.Addr.(*proxyAddr); ok {
+			return a.header
+		}
+	}
+	return nil
+}
+
+// proxyHeaderConnContext returns the context with the connection, which is used as http.Server.ConnContext.
+// It is called by the accept loop, so the header is read later by ProxyHeaderFromContext.
+func proxyHeaderConnContext(ctx context.Context, c net.Conn) context.Context {
+	if tc, ok := c.(*tls.Conn); ok {
+		c = tc.NetConn()
+	}
+	if pc, ok := c.(*proxyProtocolConn); ok {
+		return context.WithValue(ctx, proxyConnKey{}, pc)
+	}
+	return ctx
+}
+
+// proxyAddr represents the client address recovered from the PROXY protocol header, which carries the header to the gRPC peer.
+type proxyAddr struct {
+	net.Addr
+	header *ProxyHeader
+}
+
+// proxyProtocolListener accepts the connections with the PROXY protocol header from the trusted sources.
+type proxyProtocolListener struct {
+	net.Listener
+	trusted  []*net.IPNet
+	required bool
+	timeout  time.Duration
+}
+
+// NewProxyProtocolListener returns the listener which reads the PROXY protocol header of the connections from the trusted sources,
+// or the given listener if the PROXY protocol is disabled.
+// The header is read on the first use of the connection, so that a slow client does not block the others.
+func NewProxyProtocolListener(l net.Listener, cfg config.ProxyProtocol) (net.Listener, error) {
+	if !cfg.Enable {
+		return l, nil
+	}
+	pl := &proxyProtocolListener{
+		Listener: l,
+		trusted:  make([]*net.IPNet, 0, len(cfg.TrustedCIDRs)),
+		required: cfg.Required,
+		timeout:  parseDuration(cfg.HeaderTimeout, defaultProxyHeaderTimeout),
+	}
+	for _, c := range cfg.TrustedCIDRs {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid trusted CIDR: %s", c)
+		}
+		pl.trusted = append(pl.trusted, n)
+	}
+	if pl.timeout == 0 {
+		pl.timeout = defaultProxyHeaderTimeout
+	}
+	return pl, nil
+}
+
+// Accept returns the connection which reads the PROXY protocol header if the source is trusted.
+func (l *proxyProtocolListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil || !l.isTrusted(c.RemoteAddr()) {
+		return c, err
+	}
+	return &proxyProtocolConn{
+		Conn:     c,
+		br:       bufio.NewReader(c),
+		required: l.required,
+		timeout:  l.timeout,
+	}, nil
+}
+
+// isTrusted returns whether the source is allowed to send the header. The sources without the IP address, i.e. Unix sockets, are trusted.
+func (l *proxyProtocolListener) isTrusted(addr net.Addr) bool {
+	var ip net.IP
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		ip = a.IP
+	default:
+		return true
+	}
+	for _, n := range l.trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// proxyProtocolConn represents the connection from the trusted source, and the addresses are replaced by the ones in the header.
+type proxyProtocolConn struct {
+	net.Conn
+	br       *bufio.Reader
+	required bool
+	timeout  time.Duration
+
+	once   sync.Once
+	header *ProxyHeader
+	err    error
+}
+
+// init reads the PROXY protocol header once.
+func (c *proxyProtocolConn) init() {
+	c.once.Do(func() {
+		c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+		c.header, c.err = readProxyHeader(c.br)
+		c.Conn.SetReadDeadline(time.Time{})
+		if c.err == nil && c.header == nil && c.required {
+			c.err = ErrProxyHeaderRequired
+		}
+		if c.err != nil {
+			glg.Debugf("PROXY protocol header from %s rejected: %v", c.Conn.RemoteAddr(), c.err)
+		}
+	})
+}
+
+// Read reads the data after the header.
+func (c *proxyProtocolConn) Read(b []byte) (int, error) {
+	c.init()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.br.Read(b)
+}
+
+// RemoteAddr returns the client address in the header, or the address of the connection.
+func (c *proxyProtocolConn) RemoteAddr() net.Addr {
+	c.init()
+	if c.header == nil {
+		return c.Conn.RemoteAddr()
+	}
+	if c.header.Source == nil {
+		return &proxyAddr{Addr: c.Conn.RemoteAddr(), header: c.header}
+	}
+	return &proxyAddr{Addr: c.header.Source, header: c.header}
+}
+
+// LocalAddr returns the destination address in the header, or the address of the connection.
+func (c *proxyProtocolConn) LocalAddr() net.Addr {
+	c.init()
+	if c.header == nil || c.header.Destination == nil {
+		return c.Conn.LocalAddr()
+	}
+	return c.header.Destination
+}
+
+// readProxyHeader returns the PROXY protocol header, or nil if the connection does not start with the header.
+func readProxyHeader(br *bufio.Reader) (*ProxyHeader, error) {
+	// peek byte by byte, the client may send less bytes than the signature, e.g. a short HTTP/1.0 request
+	for n := 1; n <= len(proxyV2Signature); n++ {
+		b, err := br.Peek(n)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case bytes.Equal(b, proxyV1Signature):
+			return readProxyHeaderV1(br)
+		case bytes.Equal(b, proxyV2Signature):
+			return readProxyHeaderV2(br)
+		case !bytes.HasPrefix(proxyV1Signature, b) && !bytes.HasPrefix(proxyV2Signature, b):
+			return nil, nil
+		}
+	}
+	return nil, nil
+}
+
+// readProxyHeaderV1 returns the PROXY protocol v1 header, e.g. "PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\n".
+func readProxyHeaderV1(br *bufio.Reader) (*ProxyHeader, error) {
+	var line []byte
+	for len(line) < proxyV1MaxLength {
+		b, err := br.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, errors.New("PROXY protocol v1 header is too long")
+	}
+	fs := strings.Split(string(line[:len(line)-2]), " ")
+	h := &ProxyHeader{Version: 1}
+	if len(fs) >= 2 && fs[1] == "UNKNOWN" {
+		return h, nil
+	}
+	if len(fs) != 6 || (fs[1] != "TCP4" && fs[1] != "TCP6") {
+		return nil, errors.Errorf("invalid PROXY protocol v1 header: %q", line)
+	}
+	src, dst := net.ParseIP(fs[2]), net.ParseIP(fs[3])
+	if src == nil || dst == nil || (src.To4() != nil) != (fs[1] == "TCP4") || (dst.To4() != nil) != (fs[1] == "TCP4") {
+		return nil, errors.Errorf("invalid PROXY protocol v1 address: %q", line)
+	}
+	sp, err1 := strconv.ParseUint(fs[4], 10, 16)
+	dp, err2 := strconv.ParseUint(fs[5], 10, 16)
+	if err1 != nil || err2 != nil {
+		return nil, errors.Errorf("invalid PROXY protocol v1 port: %q", line)
+	}
+	h.Source = &net.TCPAddr{IP: src, Port: int(sp)}
+	h.Destination = &net.TCPAddr{IP: dst, Port: int(dp)}
+	return h, nil
+}
+
+// readProxyHeaderV2 returns the PROXY protocol v2 header, which is the binary format with the TLVs.
+func readProxyHeaderV2(br *bufio.Reader) (*ProxyHeader, error) {
+	hdr := make([]byte, len(proxyV2Signature)+4)
+	if _, err := io.ReadFull(br, hdr); err != nil {
+		return nil, err
+	}
+	verCmd, fam := hdr[12], hdr[13]
+	if verCmd>>4 != 2 {
+		return nil, errors.Errorf("invalid PROXY protocol v2 version: %d", verCmd>>4)
+	}
+	body := make([]byte, binary.BigEndian.Uint16(hdr[14:16]))
+	if _, err := io.ReadFull(br, body); err != nil {
+		return nil, err
+	}
+
+	h := &ProxyHeader{Version: 2}
+	n := addrLength(fam)
+	switch verCmd & 0x0f {
+	case 0x00: // LOCAL, the connection is established by the load balancer itself, and the address block is ignored
+		if n > len(body) {
+			n = len(body)
+		}
+	case 0x01: // PROXY
+		if err := h.setAddrs(fam, body); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.Errorf("invalid PROXY protocol v2 command: %d", verCmd&0x0f)
+	}
+	if err := h.setTLVs(body[n:]); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// addrLength returns the length of the address block of the address family.
+func addrLength(fam byte) int {
+	switch fam >> 4 {
+	case 0x1:
+		return 12
+	case 0x2:
+		return 36
+	case 0x3:
+		return 216
+	}
+	return 0
+}
+
+// setAddrs sets the addresses of the v2 header.
+func (h *ProxyHeader) setAddrs(fam byte, b []byte) error {
+	if len(b) < addrLength(fam) {
+		return errors.New("PROXY protocol v2 address block is too short")
+	}
+	switch fam {
+	case 0x11: // TCP over IPv4
+		h.Source = &net.TCPAddr{IP: net.IP(b[0:4]), Port: int(binary.BigEndian.Uint16(b[8:10]))}
+		h.Destination = &net.TCPAddr{IP: net.IP(b[4:8]), Port: int(binary.BigEndian.Uint16(b[10:12]))}
+	case 0x21: // TCP over IPv6
+		h.Source = &net.TCPAddr{IP: net.IP(b[0:16]), Port: int(binary.BigEndian.Uint16(b[32:34]))}
+		h.Destination = &net.TCPAddr{IP: net.IP(b[16:32]), Port: int(binary.BigEndian.Uint16(b[34:36]))}
+	case 0x31: // Unix stream
+		h.Source = &net.UnixAddr{Name: string(bytes.TrimRight(b[0:108], "\x00")), Net: "unix"}
+		h.Destination = &net.UnixAddr{Name: string(bytes.TrimRight(b[108:216], "\x00")), Net: "unix"}
+	case 0x00: // UNSPEC, the addresses are unknown
+	default:
+		return errors.Errorf("unsupported PROXY protocol v2 address family: 0x%02x", fam)
+	}
+	return nil
+}
+
+// setTLVs sets the authority and the TLS information of the v2 header. The unknown TLVs are ignored.
+func (h *ProxyHeader) setTLVs(b []byte) error {
+	return eachTLV(b, func(typ byte, v []byte) error {
+		switch typ {
+		case pp2TypeAuthority:
+			h.Authority = string(v)
+		case pp2TypeSSL:
+			if len(v) < 5 {
+				return errors.New("PROXY protocol v2 SSL TLV is too short")
+			}
+			if v[0]&pp2ClientSSL == 0 {
+				return nil
+			}
+			t := &ProxyTLS{
+				ClientCert: v[0]&pp2ClientCertConn != 0,
+				Verified:   binary.BigEndian.Uint32(v[1:5]) == 0,
+			}
+			if err := eachTLV(v[5:], func(typ byte, v []byte) error {
+				switch typ {
+				case pp2SubtypeSSLVersion:
+					t.Version = string(v)
+				case pp2SubtypeSSLCN:
+					t.CommonName = string(v)
+				case pp2SubtypeSSLCipher:
+					t.CipherSuite = string(v)
+				}
+				return nil
+			}); err != nil {
+				return err
+			}
+			t.Verified = t.Verified && t.ClientCert
+			h.TLS = t
+		}
+		return nil
+	})
+}
+
+// eachTLV calls the function for each type-length-value of the v2 header.
+func eachTLV(b []byte, f func(typ byte, v []byte) error) error {
+	for len(b) > 0 {
+		if len(b) < 3 {
+			return errors.New("PROXY protocol v2 TLV is truncated")
+		}
+		n := int(binary.BigEndian.Uint16(b[1:3]))
+		if len(b) < 3+n {
+			return errors.New("PROXY protocol v2 TLV is truncated")
+		}
+		if err := f(b[0], b[3:3+n]); err != nil {
+			return err
+		}
+		b = b[3+n:]
+	}
+	return nil
+}
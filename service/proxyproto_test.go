@@ -0,0 +1,271 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/peer"
+
+	"github.com/yahoojapan/authorization-proxy/v4/config"
+)
+
+// proxyV2Header returns the PROXY protocol v2 header of the TCP over IPv4 connection with the TLVs.
+func proxyV2Header(cmd byte, src, dst string, sport, dport uint16, tlvs []byte) []byte {
+	body := make([]byte, 12)
+	copy(body[0:4], net.ParseIP(src).To4())
+	copy(body[4:8], net.ParseIP(dst).To4())
+	binary.BigEndian.PutUint16(body[8:10], sport)
+	binary.BigEndian.PutUint16(body[10:12], dport)
+	body = append(body, tlvs...)
+
+	b := append([]byte{}, proxyV2Signature...)
+	b = append(b, 0x20|cmd, 0x11, 0, 0)
+	binary.BigEndian.PutUint16(b[14:16], uint16(len(body)))
+	return append(b, body...)
+}
+
+// tlv returns the type-length-value of the PROXY protocol v2 header.
+func tlv(typ byte, v []byte) []byte {
+	b := []byte{typ, 0, 0}
+	binary.BigEndian.PutUint16(b[1:3], uint16(len(v)))
+	return append(b, v...)
+}
+
+func Test_readProxyHeader(t *testing.T) {
+	ssl := append([]byte{pp2ClientSSL | pp2ClientCertConn, 0, 0, 0, 0}, tlv(pp2SubtypeSSLVersion, []byte("TLSv1.3"))...)
+	ssl = append(ssl, tlv(pp2SubtypeSSLCN, []byte("client.example.com"))...)
+	ssl = append(ssl, tlv(pp2SubtypeSSLCipher, []byte("TLS_AES_128_GCM_SHA256"))...)
+
+	tests := []struct {
+		name     string
+		input    []byte
+		want     *ProxyHeader
+		wantRest string
+		wantErr  bool
+	}{
+		{
+			name:     "read v1 TCP4 header",
+			input:    []byte("PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\nGET / HTTP/1.1\r\n"),
+			want:     &ProxyHeader{Version: 1, Source: &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 56324}, Destination: &net.TCPAddr{IP: net.ParseIP("192.0.2.2"), Port: 443}},
+			wantRest: "GET / HTTP/1.1\r\n",
+		},
+		{
+			name:     "read v1 TCP6 header",
+			input:    []byte("PROXY TCP6 2001:db8::1 2001:db8::2 56324 443\r\nGET"),
+			want:     &ProxyHeader{Version: 1, Source: &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 56324}, Destination: &net.TCPAddr{IP: net.ParseIP("2001:db8::2"), Port: 443}},
+			wantRest: "GET",
+		},
+		{
+			name:     "read v1 UNKNOWN header",
+			input:    []byte("PROXY UNKNOWN\r\nGET"),
+			want:     &ProxyHeader{Version: 1},
+			wantRest: "GET",
+		},
+		{
+			name:     "read v2 PROXY header with TLVs",
+			input:    append(proxyV2Header(0x01, "192.0.2.1", "192.0.2.2", 56324, 443, append(tlv(pp2TypeAuthority, []byte("proxy.example.com")), tlv(pp2TypeSSL, ssl)...)), "PRI"...),
+			wantRest: "PRI",
+			want: &ProxyHeader{
+				Version:     2,
+				Source:      &net.TCPAddr{IP: net.IP{192, 0, 2, 1}, Port: 56324},
+				Destination: &net.TCPAddr{IP: net.IP{192, 0, 2, 2}, Port: 443},
+				Authority:   "proxy.example.com",
+				TLS: &ProxyTLS{
+					Version:     "TLSv1.3",
+					CipherSuite: "TLS_AES_128_GCM_SHA256",
+					CommonName:  "client.example.com",
+					ClientCert:  true,
+					Verified:    true,
+				},
+			},
+		},
+		{
+			name:     "read v2 LOCAL header",
+			input:    append(proxyV2Header(0x00, "192.0.2.1", "192.0.2.2", 56324, 443, nil), "GET"...),
+			want:     &ProxyHeader{Version: 2},
+			wantRest: "GET",
+		},
+		{
+			name:     "return nil without the header",
+			input:    []byte("POST / HTTP/1.1\r\n"),
+			wantRest: "POST / HTTP/1.1\r\n",
+		},
+		{
+			name:     "return nil for the HTTP/2 preface",
+			input:    []byte("PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"),
+			wantRest: "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n",
+		},
+		{
+			name:    "error for the invalid v1 protocol",
+			input:   []byte("PROXY UDP4 192.0.2.1 192.0.2.2 56324 443\r\n"),
+			wantErr: true,
+		},
+		{
+			name:    "error for the mismatched v1 address family",
+			input:   []byte("PROXY TCP4 2001:db8::1 192.0.2.2 56324 443\r\n"),
+			wantErr: true,
+		},
+		{
+			name:    "error for the too long v1 header",
+			input:   []byte("PROXY TCP4 " + strings.Repeat("1", 120) + "\r\n"),
+			wantErr: true,
+		},
+		{
+			name:    "error for the truncated v2 TLV",
+			input:   proxyV2Header(0x01, "192.0.2.1", "192.0.2.2", 56324, 443, []byte{pp2TypeAuthority, 0, 10, 'a'}),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			br := bufio.NewReader(bytes.NewReader(tt.input))
+			got, err := readProxyHeader(br)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readProxyHeader() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readProxyHeader() = %+v, want %+v", got, tt.want)
+			}
+			rest, _ := ioutil.ReadAll(br)
+			if string(rest) != tt.wantRest {
+				t.Errorf("readProxyHeader() rest = %q, want %q", rest, tt.wantRest)
+			}
+		})
+	}
+}
+
+func TestNewProxyProtocolListener(t *testing.T) {
+	echo := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authority := ""
+		if h := ProxyHeaderFromContext(r.Context()); h != nil {
+			authority = h.Authority
+		}
+		fmt.Fprintf(w, "%s %s", r.RemoteAddr, authority)
+	})
+	tests := []struct {
+		name    string
+		cfg     config.ProxyProtocol
+		header  []byte
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "recover the client address from the trusted source",
+			cfg: config.ProxyProtocol{
+				Enable:       true,
+				TrustedCIDRs: []string{"127.0.0.0/8"},
+			},
+			header: proxyV2Header(0x01, "192.0.2.1", "192.0.2.2", 56324, 443, tlv(pp2TypeAuthority, []byte("proxy.example.com"))),
+			want:   "192.0.2.1:56324 proxy.example.com",
+		},
+		{
+			name: "accept the connection without the header from the trusted source",
+			cfg: config.ProxyProtocol{
+				Enable:       true,
+				TrustedCIDRs: []string{"127.0.0.0/8"},
+			},
+			want: "127.0.0.1:",
+		},
+		{
+			name: "reject the connection without the header if required",
+			cfg: config.ProxyProtocol{
+				Enable:       true,
+				TrustedCIDRs: []string{"127.0.0.0/8"},
+				Required:     true,
+			},
+			wantErr: true,
+		},
+		{
+			name: "ignore the header from the untrusted source",
+			cfg: config.ProxyProtocol{
+				Enable:       true,
+				TrustedCIDRs: []string{"192.0.2.0/24"},
+			},
+			header:  []byte("PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\n"),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			pl, err := NewProxyProtocolListener(l, tt.cfg)
+			if err != nil {
+				t.Fatalf("NewProxyProtocolListener() error = %v", err)
+			}
+			srv := &http.Server{
+				Handler:     echo,
+				ConnContext: proxyHeaderConnContext,
+			}
+			go srv.Serve(pl)
+			defer srv.Close()
+
+			conn, err := net.Dial("tcp", l.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(5 * time.Second))
+			conn.Write(append(tt.header, "GET / HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n"...))
+			res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+			if tt.wantErr {
+				if err == nil && res.StatusCode == http.StatusOK {
+					t.Errorf("request want error, got status %d", res.StatusCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("request error = %v", err)
+			}
+			body, _ := ioutil.ReadAll(res.Body)
+			if !strings.HasPrefix(string(body), tt.want) {
+				t.Errorf("response = %s, want %s", body, tt.want)
+			}
+		})
+	}
+}
+
+func TestProxyHeaderFromContext(t *testing.T) {
+	h := &ProxyHeader{Version: 2, Authority: "proxy.example.com"}
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want *ProxyHeader
+	}{
+		{
+			name: "return the header of the gRPC peer",
+			ctx: peer.NewContext(context.Background(), &peer.Peer{
+				Addr: &proxyAddr{Addr: &net.TCPAddr{}, header: h},
+			}),
+			want: h,
+		},
+		{
+			name: "return nil without the header",
+			ctx: peer.NewContext(context.Background(), &peer.Peer{
+				Addr: &net.TCPAddr{},
+			}),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ProxyHeaderFromContext(tt.ctx); got != tt.want {
+				t.Errorf("ProxyHeaderFromContext() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
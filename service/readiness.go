@@ -0,0 +1,94 @@
+/*
+Copyright (C)  2018 Yahoo Japan Corporation Athenz team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/kpango/glg"
+)
+
+const (
+	// DefaultReadinessEndpoint represents the default readiness check endpoint on the health check server.
+	DefaultReadinessEndpoint = "/readyz"
+
+	// DefaultUpstreamHealthEndpoint represents the default upstream health check endpoint on the health check server.
+	DefaultUpstreamHealthEndpoint = "/healthz/upstream"
+
+	// ReadinessReady represents that the authorizer components have loaded the data, and the caches are fresh.
+	ReadinessReady = "ready"
+	// ReadinessDegraded represents that the cache of an authorizer component is older than the max age.
+	ReadinessDegraded = "degraded"
+)
+
+// ReadinessReport represents the readiness of the authorizer components.
+type ReadinessReport struct {
+	Status     string                        `json:"status"`
+	Components map[string]ComponentReadiness `json:"components"`
+}
+
+// ComponentReadiness represents the readiness of an authorizer component.
+type ComponentReadiness struct {
+	Status          string     `json:"status"`
+	LastSuccess     *time.Time `json:"lastSuccess,omitempty"`
+	LastError       string     `json:"lastError,omitempty"`
+	CacheAgeSeconds float64    `json:"cacheAgeSeconds"`
+	MaxAgeSeconds   float64    `json:"maxAgeSeconds"`
+}
+
+// Readiness returns the readiness of the authorizer components.
+// The data is loaded by the daemon initialization before the health check server starts, so it is degraded only if the cache of a component is older than the max age.
+func (st *AuthorizerStatus) Readiness() ReadinessReport {
+	r := ReadinessReport{
+		Status:     ReadinessReady,
+		Components: make(map[string]ComponentReadiness),
+	}
+	for name, cs := range st.Report().Components {
+		cr := ComponentReadiness{
+			Status:          ReadinessReady,
+			LastSuccess:     cs.LastSuccess,
+			LastError:       cs.LastError,
+			CacheAgeSeconds: cs.CacheAgeSeconds,
+			MaxAgeSeconds:   cs.MaxAgeSeconds,
+		}
+		if cs.CacheAgeSeconds > cs.MaxAgeSeconds {
+			cr.Status = ReadinessDegraded
+			r.Status = ReadinessDegraded
+		}
+		r.Components[name] = cr
+	}
+	return r
+}
+
+// ReadinessHandler returns the handler of the readiness check.
+// If failOnDegraded is true, it responds 503 Service Unavailable when the components are degraded.
+func (st *AuthorizerStatus) ReadinessHandler(failOnDegraded bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rr := st.Readiness()
+		code := http.StatusOK
+		if rr.Status == ReadinessDegraded && failOnDegraded {
+			code = http.StatusServiceUnavailable
+		}
+		w.Header().Set(ContentType, ApplicationJSON+";"+CharsetUTF8)
+		w.WriteHeader(code)
+		if err := json.NewEncoder(w).Encode(rr); err != nil {
+			glg.Errorf("cannot encode readiness: %v", err)
+		}
+	})
+}
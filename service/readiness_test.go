@@ -0,0 +1,142 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/yahoojapan/authorization-proxy/v4/config"
+)
+
+func TestAuthorizerStatus_Readiness(t *testing.T) {
+	tests := []struct {
+		name           string
+		st             func() *AuthorizerStatus
+		want           string
+		wantComponents map[string]string
+	}{
+		{
+			name: "ready before the first refresh within the max age",
+			st: func() *AuthorizerStatus {
+				return NewAuthorizerStatus(config.Authorization{
+					AthenzDomains: []string{"domain1", "domain2"},
+				})
+			},
+			want: ReadinessReady,
+			wantComponents: map[string]string{
+				ComponentPolicyd: ReadinessReady,
+				ComponentPubkeyd: ReadinessReady,
+			},
+		},
+		{
+			name: "ready after all domains are fetched",
+			st: func() *AuthorizerStatus {
+				st := NewAuthorizerStatus(config.Authorization{
+					AthenzDomains: []string{"domain1", "domain2"},
+				})
+				st.fetched(ComponentPubkeyd, "sys.auth/zts", "")
+				st.fetched(ComponentPolicyd, "domain1", "")
+				st.fetched(ComponentPolicyd, "domain2", "")
+				// fetch failures after loaded keep the component ready
+				st.fetched(ComponentPolicyd, "domain2", "503 Service Unavailable")
+				return st
+			},
+			want: ReadinessReady,
+			wantComponents: map[string]string{
+				ComponentPolicyd: ReadinessReady,
+				ComponentPubkeyd: ReadinessReady,
+			},
+		},
+		{
+			name: "degraded when the cache is older than the max age",
+			st: func() *AuthorizerStatus {
+				st := NewAuthorizerStatus(config.Authorization{
+					Policy: config.Policy{
+						Disable: true,
+					},
+					Status: config.AuthorizerStatus{
+						PubkeyMaxAge: "1h",
+					},
+				})
+				st.fetched(ComponentPubkeyd, "sys.auth/zts", "")
+				st.components[ComponentPubkeyd].targets["sys.auth/zts"].lastSuccess = time.Now().Add(-2 * time.Hour)
+				return st
+			},
+			want: ReadinessDegraded,
+			wantComponents: map[string]string{
+				ComponentPubkeyd: ReadinessDegraded,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.st().Readiness()
+			if got.Status != tt.want {
+				t.Errorf("Readiness() status = %s, want %s", got.Status, tt.want)
+			}
+			if len(got.Components) != len(tt.wantComponents) {
+				t.Errorf("Readiness() components = %v, want %v", got.Components, tt.wantComponents)
+			}
+			for name, want := range tt.wantComponents {
+				if got.Components[name].Status != want {
+					t.Errorf("Readiness() %s status = %s, want %s", name, got.Components[name].Status, want)
+				}
+			}
+		})
+	}
+}
+
+func TestAuthorizerStatus_ReadinessHandler(t *testing.T) {
+	degraded := func() *AuthorizerStatus {
+		st := NewAuthorizerStatus(config.Authorization{
+			Policy: config.Policy{
+				Disable: true,
+			},
+		})
+		st.fetched(ComponentPubkeyd, "sys.auth/zts", "")
+		st.components[ComponentPubkeyd].maxAge = 0
+		return st
+	}
+	tests := []struct {
+		name           string
+		st             *AuthorizerStatus
+		failOnDegraded bool
+		wantStatus     int
+		want           string
+	}{
+		{
+			name:       "respond 200 when ready",
+			st:         NewAuthorizerStatus(config.Authorization{}),
+			wantStatus: http.StatusOK,
+			want:       ReadinessReady,
+		},
+		{
+			name:       "respond 200 when degraded",
+			st:         degraded(),
+			wantStatus: http.StatusOK,
+			want:       ReadinessDegraded,
+		},
+		{
+			name:           "respond 503 when degraded and failOnDegraded is true",
+			st:             degraded(),
+			failOnDegraded: true,
+			wantStatus:     http.StatusServiceUnavailable,
+			want:           ReadinessDegraded,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			tt.st.ReadinessHandler(tt.failOnDegraded).ServeHTTP(w, httptest.NewRequest(http.MethodGet, DefaultReadinessEndpoint, nil))
+			if w.Code != tt.wantStatus {
+				t.Errorf("ReadinessHandler() status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			var got ReadinessReport
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil || got.Status != tt.want {
+				t.Errorf("ReadinessHandler() body = %s, error = %v", w.Body.String(), err)
+			}
+		})
+	}
+}
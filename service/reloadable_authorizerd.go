@@ -0,0 +1,160 @@
+/*
+Copyright (C)  2018 Yahoo Japan Corporation Athenz team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"context"
+	"crypto/x509"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+	authorizerd "github.com/yahoojapan/athenz-authorizer/v5"
+)
+
+// ReloadableAuthorizationd delegates to the current authorization daemon, which can be replaced on the configuration reload.
+// The in-flight authorization checks complete on the previous daemon, and the background updater of the previous daemon is stopped on replace.
+type ReloadableAuthorizationd struct {
+	cur atomic.Value // *authorizationdHolder
+
+	mu      sync.Mutex
+	ctx     context.Context
+	cancel  context.CancelFunc
+	ech     chan error
+	wg      sync.WaitGroup
+	stopped bool
+}
+
+// authorizationdHolder holds the daemon, since atomic.Value requires the same concrete type.
+type authorizationdHolder struct {
+	Authorizationd
+}
+
+// NewReloadableAuthorizationd returns the ReloadableAuthorizationd delegating to the given daemon.
+func NewReloadableAuthorizationd(a Authorizationd) *ReloadableAuthorizationd {
+	r := new(ReloadableAuthorizationd)
+	r.cur.Store(&authorizationdHolder{a})
+	return r
+}
+
+// current returns the current daemon.
+func (r *ReloadableAuthorizationd) current() Authorizationd {
+	return r.cur.Load().(*authorizationdHolder).Authorizationd
+}
+
+// Swap replaces the current daemon with the initialized daemon.
+// If the background updater has started, it starts the updater of the new daemon, and then stops the updater of the previous daemon.
+func (r *ReloadableAuthorizationd) Swap(a Authorizationd) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	prev := r.cancel
+	r.cur.Store(&authorizationdHolder{a})
+	if r.ctx == nil || r.stopped {
+		return
+	}
+	r.start(a)
+	prev()
+}
+
+// Init initializes the current daemon synchronously.
+func (r *ReloadableAuthorizationd) Init(ctx context.Context) error {
+	return r.current().Init(ctx)
+}
+
+// Start starts the background updater of the current daemon, and returns the errors of the current and the following daemons.
+// The channel is closed after the context is done and the updaters stop.
+func (r *ReloadableAuthorizationd) Start(ctx context.Context) <-chan error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ctx = ctx
+	r.ech = make(chan error)
+	r.start(r.current())
+
+	go func() {
+		<-ctx.Done()
+		r.mu.Lock()
+		r.stopped = true
+		r.mu.Unlock()
+		r.wg.Wait()
+		close(r.ech)
+	}()
+	return r.ech
+}
+
+// start starts the background updater of the daemon, and forwards the errors. It must be called with the lock.
+// The cancellation error of the daemon replaced by Swap is not forwarded, since it is not a failure.
+func (r *ReloadableAuthorizationd) start(a Authorizationd) {
+	ctx, cancel := context.WithCancel(r.ctx)
+	r.cancel = cancel
+	pch := a.Start(ctx)
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		for err := range pch {
+			if errors.Is(err, context.Canceled) && ctx.Err() != nil && r.ctx.Err() == nil {
+				continue
+			}
+			r.ech <- err
+		}
+	}()
+}
+
+// Verify delegates to the current daemon.
+func (r *ReloadableAuthorizationd) Verify(req *http.Request, act, res string) error {
+	return r.current().Verify(req, act, res)
+}
+
+// Authorize delegates to the current daemon.
+func (r *ReloadableAuthorizationd) Authorize(req *http.Request, act, res string) (authorizerd.Principal, error) {
+	return r.current().Authorize(req, act, res)
+}
+
+// VerifyAccessToken delegates to the current daemon.
+func (r *ReloadableAuthorizationd) VerifyAccessToken(ctx context.Context, tok, act, res string, cert *x509.Certificate) error {
+	return r.current().VerifyAccessToken(ctx, tok, act, res, cert)
+}
+
+// AuthorizeAccessToken delegates to the current daemon.
+func (r *ReloadableAuthorizationd) AuthorizeAccessToken(ctx context.Context, tok, act, res string, cert *x509.Certificate) (authorizerd.Principal, error) {
+	return r.current().AuthorizeAccessToken(ctx, tok, act, res, cert)
+}
+
+// VerifyRoleToken delegates to the current daemon.
+func (r *ReloadableAuthorizationd) VerifyRoleToken(ctx context.Context, tok, act, res string) error {
+	return r.current().VerifyRoleToken(ctx, tok, act, res)
+}
+
+// AuthorizeRoleToken delegates to the current daemon.
+func (r *ReloadableAuthorizationd) AuthorizeRoleToken(ctx context.Context, tok, act, res string) (authorizerd.Principal, error) {
+	return r.current().AuthorizeRoleToken(ctx, tok, act, res)
+}
+
+// VerifyRoleCert delegates to the current daemon.
+func (r *ReloadableAuthorizationd) VerifyRoleCert(ctx context.Context, peerCerts []*x509.Certificate, act, res string) error {
+	return r.current().VerifyRoleCert(ctx, peerCerts, act, res)
+}
+
+// AuthorizeRoleCert delegates to the current daemon.
+func (r *ReloadableAuthorizationd) AuthorizeRoleCert(ctx context.Context, peerCerts []*x509.Certificate, act, res string) (authorizerd.Principal, error) {
+	return r.current().AuthorizeRoleCert(ctx, peerCerts, act, res)
+}
+
+// GetPolicyCache delegates to the current daemon.
+func (r *ReloadableAuthorizationd) GetPolicyCache(ctx context.Context) map[string]interface{} {
+	return r.current().GetPolicyCache(ctx)
+}
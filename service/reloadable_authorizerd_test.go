@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	authorizerd "github.com/yahoojapan/athenz-authorizer/v5"
+)
+
+// newTestAuthorizerd returns the mock which fails the authorization with the error, and reports the error until the context is done.
+func newTestAuthorizerd(err error, stopped chan<- struct{}) *AuthorizerdMock {
+	return &AuthorizerdMock{
+		StartFunc: func(ctx context.Context) <-chan error {
+			ech := make(chan error)
+			go func() {
+				defer close(ech)
+				ech <- err
+				<-ctx.Done()
+				close(stopped)
+			}()
+			return ech
+		},
+		VerifyFunc: func(r *http.Request, act, res string) (authorizerd.Principal, error) {
+			return nil, err
+		},
+	}
+}
+
+func TestReloadableAuthorizationd(t *testing.T) {
+	errFirst, errSecond := errors.New("first"), errors.New("second")
+	firstStopped, secondStopped := make(chan struct{}), make(chan struct{})
+	r := NewReloadableAuthorizationd(newTestAuthorizerd(errFirst, firstStopped))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ech := r.Start(ctx)
+	if err := <-ech; err != errFirst {
+		t.Errorf("Start() error = %v, want %v", err, errFirst)
+	}
+	if _, err := r.Authorize(nil, "", ""); err != errFirst {
+		t.Errorf("Authorize() error = %v, want %v", err, errFirst)
+	}
+
+	// the updater of the new daemon starts, and the previous one stops
+	r.Swap(newTestAuthorizerd(errSecond, secondStopped))
+	if err := <-ech; err != errSecond {
+		t.Errorf("Start() error = %v, want %v", err, errSecond)
+	}
+	if err := r.Verify(nil, "", ""); err != errSecond {
+		t.Errorf("Verify() error = %v, want %v", err, errSecond)
+	}
+	select {
+	case <-firstStopped:
+	case <-time.After(time.Second):
+		t.Error("previous daemon is not stopped")
+	}
+
+	cancel()
+	select {
+	case <-secondStopped:
+	case <-time.After(time.Second):
+		t.Error("current daemon is not stopped")
+	}
+	for range ech {
+	}
+}
+
+func TestReloadableAuthorizationd_Swap_canceled(t *testing.T) {
+	// the daemon reports the cancellation error when the context is done, as athenz-authorizer does
+	newCanceledAuthorizerd := func() *AuthorizerdMock {
+		return &AuthorizerdMock{
+			StartFunc: func(ctx context.Context) <-chan error {
+				ech := make(chan error)
+				go func() {
+					defer close(ech)
+					<-ctx.Done()
+					ech <- ctx.Err()
+				}()
+				return ech
+			},
+		}
+	}
+	r := NewReloadableAuthorizationd(newCanceledAuthorizerd())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ech := r.Start(ctx)
+	r.Swap(newCanceledAuthorizerd())
+	select {
+	case err := <-ech:
+		t.Errorf("Start() error = %v after Swap, want no error", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// the cancellation on stop is still reported
+	cancel()
+	if err := <-ech; !errors.Is(err, context.Canceled) {
+		t.Errorf("Start() error = %v, want %v", err, context.Canceled)
+	}
+	for range ech {
+	}
+}
+
+func TestReloadableAuthorizationd_Swap_beforeStart(t *testing.T) {
+	errFirst, errSecond := errors.New("first"), errors.New("second")
+	r := NewReloadableAuthorizationd(newTestAuthorizerd(errFirst, make(chan struct{})))
+	r.Swap(newTestAuthorizerd(errSecond, make(chan struct{})))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ech := r.Start(ctx)
+	if err := <-ech; err != errSecond {
+		t.Errorf("Start() error = %v, want %v", err, errSecond)
+	}
+	cancel()
+	for range ech {
+	}
+}
@@ -0,0 +1,440 @@
+/*
+Copyright (C)  2018 Yahoo Japan Corporation Athenz team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kpango/glg"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ocsp"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/yahoojapan/authorization-proxy/v4/config"
+)
+
+const (
+	defaultCRLReloadPeriod = time.Minute
+	defaultOCSPTimeout     = 5 * time.Second
+	defaultOCSPCacheTTL    = time.Hour
+
+	// ocspErrorCacheTTL represents the duration to cache the failed OCSP check, so that the handshakes do not wait for the unreachable responder one by one.
+	ocspErrorCacheTTL = 10 * time.Second
+
+	// maxOCSPResponseSize represents the maximum size of the OCSP response body.
+	maxOCSPResponseSize = 1 << 20
+
+	// ocspClockSkew represents the allowed clock skew between the proxy and the OCSP responder.
+	ocspClockSkew = 5 * time.Minute
+)
+
+// revocationStatus represents the revocation status of a certificate.
+type revocationStatus int
+
+const (
+	revocationUnknown revocationStatus = iota
+	revocationGood
+	revocationRevoked
+)
+
+// RevocationChecker checks the revocation status of the verified client certificates by the CRLs and OCSP.
+// A certificate is rejected if it is revoked by any of the checks, and accepted if any of the checks confirms it is not revoked.
+// Otherwise, the status is unknown, and the certificate is accepted only in fail-open mode.
+type RevocationChecker struct {
+	crlPaths []string
+	period   time.Duration
+	failOpen bool
+
+	ocspEnable bool
+	responder  string
+	timeout    time.Duration
+	cacheTTL   time.Duration
+	client     *http.Client
+	group      singleflight.Group
+
+	mu     sync.RWMutex
+	crls   []*crl
+	stamps map[string]fileStamp
+
+	ocspMu    sync.Mutex
+	ocspCache map[string]ocspResult
+}
+
+// crl represents a loaded CRL.
+type crl struct {
+	path    string
+	list    *x509.RevocationList
+	revoked map[string]time.Time
+
+	// verified caches the signature check result by the issuer certificate
+	verified sync.Map
+}
+
+// ocspResult represents a cached OCSP check result.
+type ocspResult struct {
+	status  revocationStatus
+	reason  string
+	expires time.Time
+}
+
+// NewRevocationChecker returns a RevocationChecker which has loaded the CRLs, or nil if the revocation check is disabled.
+func NewRevocationChecker(cfg config.Revocation) (*RevocationChecker, error) {
+	if !cfg.Enabled() {
+		return nil, nil
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	r := &RevocationChecker{
+		crlPaths:   make([]string, 0, len(cfg.CRLPaths)),
+		period:     parseDuration(cfg.ReloadPeriod, defaultCRLReloadPeriod),
+		failOpen:   cfg.FailOpen,
+		ocspEnable: cfg.OCSP.Enable,
+		responder:  cfg.OCSP.Responder,
+		timeout:    parseDuration(cfg.OCSP.Timeout, defaultOCSPTimeout),
+		cacheTTL:   parseDuration(cfg.OCSP.CacheTTL, defaultOCSPCacheTTL),
+		ocspCache:  make(map[string]ocspResult),
+	}
+	r.client = &http.Client{
+		Timeout: r.timeout,
+	}
+	for _, p := range cfg.CRLPaths {
+		r.crlPaths = append(r.crlPaths, config.GetActualValue(p))
+	}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Apply sets the revocation check to the TLS configuration, which is run after the client certificate is verified.
+func (r *RevocationChecker) Apply(t *tls.Config) {
+	if r == nil || t == nil {
+		return
+	}
+	t.VerifyPeerCertificate = r.verifyPeerCertificate
+}
+
+// Start checks the CRL files for changes periodically, and returns when the context is done.
+func (r *RevocationChecker) Start(ctx context.Context) {
+	if r == nil || len(r.crlPaths) == 0 {
+		return
+	}
+	ticker := time.NewTicker(r.period)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.mu.RLock()
+			changed := stampsChanged(r.stamps, statFiles(r.crlPaths...))
+			r.mu.RUnlock()
+			if !changed {
+				continue
+			}
+			if err := r.Reload(); err != nil {
+				glg.Errorf("failed to reload CRL, keep the previous one: %v", err)
+			}
+		}
+	}
+}
+
+// Reload loads the CRLs from the files. The previous CRLs are kept if any of them fails to load.
+func (r *RevocationChecker) Reload() error {
+	if r == nil || len(r.crlPaths) == 0 {
+		return nil
+	}
+	stamps := statFiles(r.crlPaths...)
+	crls := make([]*crl, 0, len(r.crlPaths))
+	for _, path := range r.crlPaths {
+		c, err := loadCRL(path)
+		if err != nil {
+			return errors.Wrapf(err, "cannot load CRL: %s", path)
+		}
+		crls = append(crls, c...)
+	}
+
+	r.mu.Lock()
+	reloaded := r.crls != nil
+	r.crls = crls
+	r.stamps = stamps
+	r.mu.Unlock()
+
+	if reloaded {
+		glg.Infof("CRL reloaded, %d CRLs", len(crls))
+	}
+	return nil
+}
+
+// loadCRL returns the CRLs in the file, which is PEM encoded "X509 CRL" blocks or a DER encoded CRL.
+func loadCRL(path string) ([]*crl, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	ders := make([][]byte, 0, 1)
+	for rest := b; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type == "X509 CRL" {
+			ders = append(ders, block.Bytes)
+		}
+	}
+	if len(ders) == 0 {
+		ders = append(ders, b)
+	}
+
+	crls := make([]*crl, 0, len(ders))
+	for _, der := range ders {
+		list, err := x509.ParseRevocationList(der)
+		if err != nil {
+			return nil, err
+		}
+		c := &crl{
+			path:    path,
+			list:    list,
+			revoked: make(map[string]time.Time, len(list.RevokedCertificates)),
+		}
+		for _, rc := range list.RevokedCertificates {
+			c.revoked[rc.SerialNumber.String()] = rc.RevocationTime
+		}
+		crls = append(crls, c)
+	}
+	return crls, nil
+}
+
+// verifyPeerCertificate rejects the client certificate if every verified chain has a revoked certificate, or a certificate with the unknown status in fail-closed mode.
+func (r *RevocationChecker) verifyPeerCertificate(_ [][]byte, chains [][]*x509.Certificate) error {
+	// no client certificate is given, or the client certificate is not verified
+	if len(chains) == 0 {
+		return nil
+	}
+
+	var err error
+	for _, chain := range chains {
+		if err = r.checkChain(chain); err == nil {
+			return nil
+		}
+	}
+	leaf := chains[0][0]
+	glg.Warnf("client certificate rejected, subject: %s, serial: %s, reason: %v", leaf.Subject, leaf.SerialNumber, err)
+	return err
+}
+
+// checkChain returns an error if any certificate in the chain is revoked, or its status is unknown in fail-closed mode.
+// The root certificate at the end of the chain is not checked.
+func (r *RevocationChecker) checkChain(chain []*x509.Certificate) error {
+	for i := 0; i < len(chain)-1; i++ {
+		cert, issuer := chain[i], chain[i+1]
+		switch status, reason := r.check(cert, issuer); status {
+		case revocationRevoked:
+			return errors.Errorf("certificate revoked: %s: %s", cert.Subject, reason)
+		case revocationUnknown:
+			if !r.failOpen {
+				return errors.Errorf("revocation status unknown: %s: %s", cert.Subject, reason)
+			}
+			glg.Debugf("revocation status unknown, accepted in fail-open mode: %s: %s", cert.Subject, reason)
+		}
+	}
+	return nil
+}
+
+// check returns the revocation status of the certificate, and the reason if it is not good.
+func (r *RevocationChecker) check(cert, issuer *x509.Certificate) (revocationStatus, string) {
+	status := revocationUnknown
+	reasons := make([]string, 0, 2)
+	if len(r.crlPaths) > 0 {
+		s, reason := r.checkCRL(cert, issuer)
+		if s == revocationRevoked {
+			return s, reason
+		}
+		if s == revocationGood {
+			status = s
+		} else {
+			reasons = append(reasons, reason)
+		}
+	}
+	if r.ocspEnable {
+		s, reason := r.checkOCSP(cert, issuer)
+		if s == revocationRevoked {
+			return s, reason
+		}
+		if s == revocationGood {
+			status = s
+		} else {
+			reasons = append(reasons, reason)
+		}
+	}
+	if status == revocationGood {
+		return status, ""
+	}
+	return status, strings.Join(reasons, ", ")
+}
+
+// checkCRL returns the revocation status of the certificate by the CRL signed by the issuer.
+// The certificate listed in an expired CRL is still revoked, while the other certificates are unknown.
+func (r *RevocationChecker) checkCRL(cert, issuer *x509.Certificate) (revocationStatus, string) {
+	r.mu.RLock()
+	crls := r.crls
+	r.mu.RUnlock()
+
+	now := time.Now()
+	for _, c := range crls {
+		if !bytes.Equal(c.list.RawIssuer, cert.RawIssuer) || !c.signedBy(issuer) {
+			continue
+		}
+		if t, ok := c.revoked[cert.SerialNumber.String()]; ok {
+			return revocationRevoked, "revoked by CRL at " + t.UTC().Format(time.RFC3339)
+		}
+		if !c.list.NextUpdate.IsZero() && now.After(c.list.NextUpdate) {
+			return revocationUnknown, "CRL expired at " + c.list.NextUpdate.UTC().Format(time.RFC3339) + ": " + c.path
+		}
+		return revocationGood, ""
+	}
+	return revocationUnknown, "no CRL of the issuer: " + issuer.Subject.String()
+}
+
+// signedBy returns whether the CRL is signed by the issuer.
+func (c *crl) signedBy(issuer *x509.Certificate) bool {
+	key := string(issuer.Raw)
+	if v, ok := c.verified.Load(key); ok {
+		return v.(bool)
+	}
+	ok := c.list.CheckSignatureFrom(issuer) == nil
+	c.verified.Store(key, ok)
+	return ok
+}
+
+// checkOCSP returns the revocation status of the certificate by the OCSP responder, which is cached until the next update of the response.
+func (r *RevocationChecker) checkOCSP(cert, issuer *x509.Certificate) (revocationStatus, string) {
+	sum := sha256.Sum256(issuer.Raw)
+	key := hex.EncodeToString(sum[:]) + "/" + cert.SerialNumber.String()
+
+	r.ocspMu.Lock()
+	res, ok := r.ocspCache[key]
+	r.ocspMu.Unlock()
+	if ok && time.Now().Before(res.expires) {
+		return res.status, res.reason
+	}
+
+	v, _, _ := r.group.Do(key, func() (interface{}, error) {
+		res := r.fetchOCSP(cert, issuer)
+		r.ocspMu.Lock()
+		// drop the expired results, so that the cache does not grow with the certificates no longer used
+		now := time.Now()
+		for k, v := range r.ocspCache {
+			if now.After(v.expires) {
+				delete(r.ocspCache, k)
+			}
+		}
+		r.ocspCache[key] = res
+		r.ocspMu.Unlock()
+		return res, nil
+	})
+	res = v.(ocspResult)
+	return res.status, res.reason
+}
+
+// fetchOCSP requests the OCSP response of the certificate to the responder.
+func (r *RevocationChecker) fetchOCSP(cert, issuer *x509.Certificate) ocspResult {
+	failed := func(reason string) ocspResult {
+		glg.Warnf("OCSP check failed: %s: %s", cert.Subject, reason)
+		return ocspResult{
+			status:  revocationUnknown,
+			reason:  reason,
+			expires: time.Now().Add(ocspErrorCacheTTL),
+		}
+	}
+
+	responder := r.responder
+	if responder == "" {
+		if len(cert.OCSPServer) == 0 {
+			return failed("no OCSP responder")
+		}
+		responder = cert.OCSPServer[0]
+	}
+
+	req, err := ocsp.CreateRequest(cert, issuer, nil)
+	if err != nil {
+		return failed("cannot create OCSP request: " + err.Error())
+	}
+	hreq, err := http.NewRequest(http.MethodPost, responder, bytes.NewReader(req))
+	if err != nil {
+		return failed("cannot create OCSP request: " + err.Error())
+	}
+	hreq.Header.Set(ContentType, "application/ocsp-request")
+	hres, err := r.client.Do(hreq)
+	if err != nil {
+		return failed("OCSP request failed: " + err.Error())
+	}
+	defer hres.Body.Close()
+	if hres.StatusCode != http.StatusOK {
+		return failed("OCSP responder returned " + hres.Status)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(hres.Body, maxOCSPResponseSize))
+	if err != nil {
+		return failed("cannot read OCSP response: " + err.Error())
+	}
+	resp, err := ocsp.ParseResponseForCert(body, cert, issuer)
+	if err != nil {
+		return failed("invalid OCSP response: " + err.Error())
+	}
+	// the parser does not check the freshness, the replayed old response must not be trusted. The revoked status never becomes good, so it is kept
+	now := time.Now()
+	if resp.Status != ocsp.Revoked {
+		if resp.ThisUpdate.After(now.Add(ocspClockSkew)) {
+			return failed("OCSP response is not yet valid, thisUpdate: " + resp.ThisUpdate.UTC().Format(time.RFC3339))
+		}
+		if !resp.NextUpdate.IsZero() && now.After(resp.NextUpdate.Add(ocspClockSkew)) {
+			return failed("OCSP response is stale, nextUpdate: " + resp.NextUpdate.UTC().Format(time.RFC3339))
+		}
+	}
+
+	expires := now.Add(r.cacheTTL)
+	if !resp.NextUpdate.IsZero() && resp.NextUpdate.Before(expires) {
+		expires = resp.NextUpdate
+	}
+	switch resp.Status {
+	case ocsp.Good:
+		return ocspResult{status: revocationGood, expires: expires}
+	case ocsp.Revoked:
+		return ocspResult{
+			status:  revocationRevoked,
+			reason:  "revoked by OCSP at " + resp.RevokedAt.UTC().Format(time.RFC3339),
+			expires: expires,
+		}
+	default:
+		return ocspResult{status: revocationUnknown, reason: "OCSP status unknown", expires: expires}
+	}
+}
@@ -0,0 +1,536 @@
+package service
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/yahoojapan/authorization-proxy/v4/config"
+)
+
+// testPKI represents a CA issuing the client certificates for the revocation tests.
+type testPKI struct {
+	t    *testing.T
+	key  *ecdsa.PrivateKey
+	cert *x509.Certificate
+}
+
+func newTestPKI(t *testing.T, cn string) *testPKI {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testPKI{t: t, key: key, cert: cert}
+}
+
+// issue returns a client certificate with the serial number and its private key.
+func (p *testPKI) issue(serial int64, ocspServer string) (*x509.Certificate, *ecdsa.PrivateKey) {
+	p.t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if ocspServer != "" {
+		tmpl.OCSPServer = []string{ocspServer}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, p.cert, &key.PublicKey, p.key)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return cert, key
+}
+
+// writeCRL writes the PEM encoded CRL which revokes the serial numbers, and returns the path.
+func (p *testPKI) writeCRL(path string, nextUpdate time.Time, revoked ...int64) string {
+	p.t.Helper()
+	rcs := make([]pkix.RevokedCertificate, 0, len(revoked))
+	for _, s := range revoked {
+		rcs = append(rcs, pkix.RevokedCertificate{
+			SerialNumber:   big.NewInt(s),
+			RevocationTime: time.Now().Add(-time.Minute),
+		})
+	}
+	der, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:              big.NewInt(time.Now().UnixNano()),
+		ThisUpdate:          time.Now().Add(-time.Hour),
+		NextUpdate:          nextUpdate,
+		RevokedCertificates: rcs,
+	}, p.cert, p.key)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der}), 0600); err != nil {
+		p.t.Fatal(err)
+	}
+	return path
+}
+
+// ocspResponder returns a stub OCSP responder which answers the status of the serial numbers, and the number of the requests.
+func (p *testPKI) ocspResponder(statuses map[int64]int) (*httptest.Server, *int32) {
+	return p.ocspResponderAt(statuses, time.Now().Add(-time.Minute), time.Now().Add(time.Hour))
+}
+
+// ocspResponderAt returns a stub OCSP responder which answers the status with the update times.
+func (p *testPKI) ocspResponderAt(statuses map[int64]int, thisUpdate, nextUpdate time.Time) (*httptest.Server, *int32) {
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		b, _ := ioutil.ReadAll(r.Body)
+		req, err := ocsp.ParseRequest(b)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		status, ok := statuses[req.SerialNumber.Int64()]
+		if !ok {
+			status = ocsp.Unknown
+		}
+		res, err := ocsp.CreateResponse(p.cert, p.cert, ocsp.Response{
+			Status:       status,
+			SerialNumber: req.SerialNumber,
+			ThisUpdate:   thisUpdate,
+			NextUpdate:   nextUpdate,
+			RevokedAt:    time.Now().Add(-time.Minute),
+		}, crypto.Signer(p.key))
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set(ContentType, "application/ocsp-response")
+		w.Write(res)
+	}))
+	p.t.Cleanup(srv.Close)
+	return srv, &hits
+}
+
+func TestNewRevocationChecker(t *testing.T) {
+	dir := t.TempDir()
+	pki := newTestPKI(t, "ca")
+	crlPath := pki.writeCRL(filepath.Join(dir, "ca.crl"), time.Now().Add(time.Hour), 3)
+	invalid := filepath.Join(dir, "invalid.crl")
+	ioutil.WriteFile(invalid, []byte("invalid"), 0600)
+
+	tests := []struct {
+		name    string
+		cfg     config.Revocation
+		wantNil bool
+		wantErr string
+	}{
+		{
+			name: "load the CRL",
+			cfg: config.Revocation{
+				CRLPaths: []string{crlPath},
+			},
+		},
+		{
+			name: "enable OCSP only",
+			cfg: config.Revocation{
+				OCSP: config.OCSP{
+					Enable: true,
+				},
+			},
+		},
+		{
+			name:    "return nil when disabled",
+			cfg:     config.Revocation{},
+			wantNil: true,
+		},
+		{
+			name: "return error when the CRL cannot be parsed",
+			cfg: config.Revocation{
+				CRLPaths: []string{crlPath, invalid},
+			},
+			wantErr: "cannot load CRL: " + invalid,
+		},
+		{
+			name: "return error when the configuration is invalid",
+			cfg: config.Revocation{
+				OCSP: config.OCSP{
+					Enable:    true,
+					Responder: "localhost:8080",
+				},
+			},
+			wantErr: "invalid ocsp.responder: localhost:8080",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewRevocationChecker(tt.cfg)
+			if (err == nil && tt.wantErr != "") || (err != nil && !strings.HasPrefix(err.Error(), tt.wantErr)) {
+				t.Errorf("NewRevocationChecker() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr == "" && (got == nil) != tt.wantNil {
+				t.Errorf("NewRevocationChecker() = %v, wantNil %v", got, tt.wantNil)
+			}
+		})
+	}
+}
+
+func TestRevocationChecker_verifyPeerCertificate(t *testing.T) {
+	dir := t.TempDir()
+	pki := newTestPKI(t, "ca")
+	other := newTestPKI(t, "ca")
+	crlPath := pki.writeCRL(filepath.Join(dir, "ca.crl"), time.Now().Add(time.Hour), 3)
+	expiredCRL := pki.writeCRL(filepath.Join(dir, "expired.crl"), time.Now().Add(-time.Minute), 3)
+	otherCRL := other.writeCRL(filepath.Join(dir, "other.crl"), time.Now().Add(time.Hour))
+
+	responder, _ := pki.ocspResponder(map[int64]int{
+		2: ocsp.Good,
+		3: ocsp.Revoked,
+	})
+	stale, _ := pki.ocspResponderAt(map[int64]int{2: ocsp.Good}, time.Now().Add(-2*time.Hour), time.Now().Add(-time.Hour))
+	future, _ := pki.ocspResponderAt(map[int64]int{2: ocsp.Good}, time.Now().Add(time.Hour), time.Now().Add(2*time.Hour))
+	down := closedTestURL(t)
+
+	good, _ := pki.issue(2, "")
+	revoked, _ := pki.issue(3, "")
+	goodWithAIA, _ := pki.issue(2, responder.URL)
+
+	tests := []struct {
+		name    string
+		cfg     config.Revocation
+		cert    *x509.Certificate
+		wantErr string
+	}{
+		{
+			name: "accept the certificate not in the CRL",
+			cfg: config.Revocation{
+				CRLPaths: []string{crlPath},
+			},
+			cert: good,
+		},
+		{
+			name: "reject the certificate in the CRL",
+			cfg: config.Revocation{
+				CRLPaths: []string{crlPath},
+			},
+			cert:    revoked,
+			wantErr: "certificate revoked: CN=client: revoked by CRL at ",
+		},
+		{
+			name: "reject the certificate in the expired CRL even in fail-open mode",
+			cfg: config.Revocation{
+				CRLPaths: []string{expiredCRL},
+				FailOpen: true,
+			},
+			cert:    revoked,
+			wantErr: "certificate revoked: CN=client: revoked by CRL at ",
+		},
+		{
+			name: "reject the certificate when the CRL is expired",
+			cfg: config.Revocation{
+				CRLPaths: []string{expiredCRL},
+			},
+			cert:    good,
+			wantErr: "revocation status unknown: CN=client: CRL expired at ",
+		},
+		{
+			name: "reject the certificate when the CRL is not signed by the issuer",
+			cfg: config.Revocation{
+				CRLPaths: []string{otherCRL},
+			},
+			cert:    good,
+			wantErr: "revocation status unknown: CN=client: no CRL of the issuer: CN=ca",
+		},
+		{
+			name: "accept the certificate with unknown status in fail-open mode",
+			cfg: config.Revocation{
+				CRLPaths: []string{otherCRL},
+				FailOpen: true,
+			},
+			cert: good,
+		},
+		{
+			name: "accept the good certificate by OCSP",
+			cfg: config.Revocation{
+				OCSP: config.OCSP{
+					Enable:    true,
+					Responder: responder.URL,
+				},
+			},
+			cert: good,
+		},
+		{
+			name: "reject the revoked certificate by OCSP",
+			cfg: config.Revocation{
+				OCSP: config.OCSP{
+					Enable:    true,
+					Responder: responder.URL,
+				},
+			},
+			cert:    revoked,
+			wantErr: "certificate revoked: CN=client: revoked by OCSP at ",
+		},
+		{
+			name: "reject the certificate when the OCSP response is stale",
+			cfg: config.Revocation{
+				OCSP: config.OCSP{
+					Enable:    true,
+					Responder: stale.URL,
+				},
+			},
+			cert:    good,
+			wantErr: "revocation status unknown: CN=client: OCSP response is stale, nextUpdate: ",
+		},
+		{
+			name: "reject the certificate when the OCSP response is not yet valid",
+			cfg: config.Revocation{
+				OCSP: config.OCSP{
+					Enable:    true,
+					Responder: future.URL,
+				},
+			},
+			cert:    good,
+			wantErr: "revocation status unknown: CN=client: OCSP response is not yet valid, thisUpdate: ",
+		},
+		{
+			name: "use the OCSP responder in the certificate",
+			cfg: config.Revocation{
+				OCSP: config.OCSP{
+					Enable: true,
+				},
+			},
+			cert: goodWithAIA,
+		},
+		{
+			name: "reject the certificate without OCSP responder",
+			cfg: config.Revocation{
+				OCSP: config.OCSP{
+					Enable: true,
+				},
+			},
+			cert:    good,
+			wantErr: "revocation status unknown: CN=client: no OCSP responder",
+		},
+		{
+			name: "reject the certificate when the OCSP responder is unreachable",
+			cfg: config.Revocation{
+				OCSP: config.OCSP{
+					Enable:    true,
+					Responder: down,
+					Timeout:   "1s",
+				},
+			},
+			cert:    good,
+			wantErr: "revocation status unknown: CN=client: OCSP request failed: ",
+		},
+		{
+			name: "accept the certificate when the OCSP responder is unreachable in fail-open mode",
+			cfg: config.Revocation{
+				OCSP: config.OCSP{
+					Enable:    true,
+					Responder: down,
+				},
+				FailOpen: true,
+			},
+			cert: good,
+		},
+		{
+			name: "accept the certificate in the CRL when the OCSP responder is unreachable",
+			cfg: config.Revocation{
+				CRLPaths: []string{crlPath},
+				OCSP: config.OCSP{
+					Enable:    true,
+					Responder: down,
+				},
+			},
+			cert: good,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewRevocationChecker(tt.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = r.verifyPeerCertificate(nil, [][]*x509.Certificate{{tt.cert, pki.cert}})
+			if (err == nil && tt.wantErr != "") || (err != nil && (tt.wantErr == "" || !strings.HasPrefix(err.Error(), tt.wantErr))) {
+				t.Errorf("verifyPeerCertificate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("accept when no certificate is verified", func(t *testing.T) {
+		r, _ := NewRevocationChecker(config.Revocation{CRLPaths: []string{otherCRL}})
+		if err := r.verifyPeerCertificate(nil, nil); err != nil {
+			t.Errorf("verifyPeerCertificate() error = %v", err)
+		}
+	})
+}
+
+// closedTestURL returns a URL which refuses the connection.
+func closedTestURL(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	return "http://" + addr
+}
+
+func TestRevocationChecker_checkOCSP(t *testing.T) {
+	pki := newTestPKI(t, "ca")
+	responder, hits := pki.ocspResponder(map[int64]int{
+		2: ocsp.Good,
+	})
+	cert, _ := pki.issue(2, "")
+	r, err := NewRevocationChecker(config.Revocation{
+		OCSP: config.OCSP{
+			Enable:    true,
+			Responder: responder.URL,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if status, reason := r.checkOCSP(cert, pki.cert); status != revocationGood {
+			t.Errorf("checkOCSP() = %v, %s", status, reason)
+		}
+	}
+	if got := atomic.LoadInt32(hits); got != 1 {
+		t.Errorf("OCSP requests = %d, want 1", got)
+	}
+}
+
+func TestRevocationChecker_Start(t *testing.T) {
+	dir := t.TempDir()
+	pki := newTestPKI(t, "ca")
+	crlPath := pki.writeCRL(filepath.Join(dir, "ca.crl"), time.Now().Add(time.Hour))
+	r, err := NewRevocationChecker(config.Revocation{
+		CRLPaths:     []string{crlPath},
+		ReloadPeriod: "5ms",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := pki.issue(3, "")
+	if status, _ := r.checkCRL(cert, pki.cert); status != revocationGood {
+		t.Fatalf("checkCRL() = %v, want good", status)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		r.Start(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	pki.writeCRL(crlPath, time.Now().Add(time.Hour), 3)
+	mt := time.Now().Add(time.Minute)
+	os.Chtimes(crlPath, mt, mt)
+	deadline := time.Now().Add(time.Second)
+	for {
+		if status, _ := r.checkCRL(cert, pki.cert); status == revocationRevoked {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Start() does not reload the CRL")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRevocationChecker_Apply(t *testing.T) {
+	dir := t.TempDir()
+	pki := newTestPKI(t, "ca")
+	crlPath := pki.writeCRL(filepath.Join(dir, "ca.crl"), time.Now().Add(time.Hour), 3)
+	r, err := NewRevocationChecker(config.Revocation{
+		CRLPaths: []string{crlPath},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverCert, serverKey := writeTestCert(t, dir, "server")
+	crt, err := tls.LoadX509KeyPair(serverCert, serverKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(pki.cert)
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{crt},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	}
+	r.Apply(cfg)
+
+	handshake := func(serial int64) error {
+		cert, key := pki.issue(serial, "")
+		c, s := net.Pipe()
+		defer c.Close()
+		defer s.Close()
+		go tls.Server(s, cfg).Handshake()
+		conn := tls.Client(c, &tls.Config{
+			InsecureSkipVerify: true,
+			MaxVersion:         tls.VersionTLS12,
+			Certificates: []tls.Certificate{{
+				Certificate: [][]byte{cert.Raw},
+				PrivateKey:  key,
+			}},
+		})
+		return conn.Handshake()
+	}
+	if err := handshake(2); err != nil {
+		t.Errorf("handshake with the good certificate error = %v", err)
+	}
+	if err := handshake(3); err == nil {
+		t.Error("handshake with the revoked certificate succeeded")
+	}
+
+	// nil checker does nothing
+	var nr *RevocationChecker
+	nr.Apply(cfg)
+	if cfg.VerifyPeerCertificate == nil {
+		t.Error("nil RevocationChecker changed the configuration")
+	}
+}
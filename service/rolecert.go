@@ -0,0 +1,192 @@
+/*
+Copyright (C)  2018 Yahoo Japan Corporation Athenz team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+	authorizerd "github.com/yahoojapan/athenz-authorizer/v5"
+)
+
+const (
+	// DefaultRoleCertURIPrefix represents the default prefix of the SAN URI containing the role.
+	DefaultRoleCertURIPrefix = "athenz://role/"
+
+	// roleInCNDelimiter represents the delimiter between the domain and the role in the subject common name.
+	roleInCNDelimiter = ":role."
+)
+
+// roleCertAuthorizationd verifies the role certificate on mTLS before the other credentials.
+type roleCertAuthorizationd struct {
+	Authorizationd
+
+	uriPrefix string
+}
+
+// roleCertPrincipal represents the principal authorized by the role certificate.
+type roleCertPrincipal struct {
+	name       string
+	domain     string
+	roles      []string
+	issueTime  int64
+	expiryTime int64
+}
+
+// NewRoleCertAuthorizationd returns an Authorizationd which authorizes the request by the role certificate on mTLS.
+// If the request has no peer certificate, or the role certificate is unauthorized, the request is authorized by the given Authorizationd.
+func NewRoleCertAuthorizationd(a Authorizationd, uriPrefix string) Authorizationd {
+	if uriPrefix == "" {
+		uriPrefix = DefaultRoleCertURIPrefix
+	}
+	return &roleCertAuthorizationd{
+		Authorizationd: a,
+		uriPrefix:      uriPrefix,
+	}
+}
+
+// Authorize returns the principal of the role certificate if the peer certificate is authorized, or the result of the other credentials.
+func (a *roleCertAuthorizationd) Authorize(r *http.Request, act, res string) (authorizerd.Principal, error) {
+	if certs := VerifiedPeerCertificates(r.TLS); len(certs) != 0 {
+		if p, err := a.AuthorizeRoleCert(r.Context(), certs, act, res); err == nil {
+			return p, nil
+		}
+	}
+	return a.Authorizationd.Authorize(r, act, res)
+}
+
+// VerifiedPeerCertificates returns the verified leaf certificate of the TLS peer, or nil if the peer certificate is not verified.
+// The other peer certificates are only the candidates of the intermediates, which must not be trusted for the roles.
+func VerifiedPeerCertificates(state *tls.ConnectionState) []*x509.Certificate {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return state.VerifiedChains[0][:1]
+}
+
+// AuthorizeRoleCert verifies the role certificate for specific resource and returns the principal of the certificate.
+// The roles are read from the first certificate only, which must be the verified leaf certificate, see VerifiedPeerCertificates.
+// The roles of each domain are verified separately, and the principal has the domain authorized for the resource.
+func (a *roleCertAuthorizationd) AuthorizeRoleCert(ctx context.Context, peerCerts []*x509.Certificate, act, res string) (authorizerd.Principal, error) {
+	if len(peerCerts) == 0 {
+		return nil, errors.New("peer certificate not found")
+	}
+	domains, roles := roleCertRoles(peerCerts[0], a.uriPrefix)
+	if len(domains) == 0 {
+		return nil, errors.New("invalid role certificate")
+	}
+	var err error
+	for _, domain := range domains {
+		// the leaf certificate is verified on the TLS handshake, so the roles of the domain are checked by the policy as the common names
+		if err = a.VerifyRoleCert(ctx, domainRoleCerts(domain, roles[domain]), act, res); err == nil {
+			return newRoleCertPrincipal(peerCerts[0], domain, roles[domain]), nil
+		}
+	}
+	return nil, err
+}
+
+// roleCertRoles returns the domains in the order found and the roles of each domain in the certificate.
+// The roles are read from the same places as the authorizer does.
+func roleCertRoles(cert *x509.Certificate, uriPrefix string) ([]string, map[string][]string) {
+	var domains []string
+	roles := make(map[string][]string)
+	seen := make(map[[2]string]struct{})
+	add := func(dr []string) {
+		if len(dr) != 2 || dr[0] == "" || dr[1] == "" {
+			return
+		}
+		if _, ok := seen[[2]string{dr[0], dr[1]}]; ok {
+			return
+		}
+		seen[[2]string{dr[0], dr[1]}] = struct{}{}
+		if _, ok := roles[dr[0]]; !ok {
+			domains = append(domains, dr[0])
+		}
+		roles[dr[0]] = append(roles[dr[0]], dr[1])
+	}
+	add(strings.SplitN(cert.Subject.CommonName, roleInCNDelimiter, 2))
+	for _, uri := range cert.URIs {
+		if s := uri.String(); strings.HasPrefix(s, uriPrefix) {
+			add(strings.SplitN(strings.TrimPrefix(s, uriPrefix), "/", 2))
+		}
+	}
+	return domains, roles
+}
+
+// domainRoleCerts returns the certificates representing the roles of the domain in the common names, to check the policy of the domain only.
+func domainRoleCerts(domain string, roles []string) []*x509.Certificate {
+	certs := make([]*x509.Certificate, 0, len(roles))
+	for _, role := range roles {
+		certs = append(certs, &x509.Certificate{
+			Subject: pkix.Name{
+				CommonName: domain + roleInCNDelimiter + role,
+			},
+		})
+	}
+	return certs
+}
+
+// newRoleCertPrincipal returns the principal of the role certificate with the roles of the domain.
+func newRoleCertPrincipal(cert *x509.Certificate, domain string, roles []string) *roleCertPrincipal {
+	// Athenz role certificate contains the principal in the SAN email, e.g. domain.service@dns.suffix
+	name := cert.Subject.CommonName
+	if len(cert.EmailAddresses) != 0 {
+		name = strings.SplitN(cert.EmailAddresses[0], "@", 2)[0]
+	}
+	return &roleCertPrincipal{
+		name:       name,
+		domain:     domain,
+		roles:      roles,
+		issueTime:  cert.NotBefore.Unix(),
+		expiryTime: cert.NotAfter.Unix(),
+	}
+}
+
+// Name returns the principal name of the role certificate.
+func (p *roleCertPrincipal) Name() string {
+	return p.name
+}
+
+// Roles returns the roles in the role certificate.
+func (p *roleCertPrincipal) Roles() []string {
+	return p.roles
+}
+
+// Domain returns the domain of the roles in the role certificate.
+func (p *roleCertPrincipal) Domain() string {
+	return p.domain
+}
+
+// IssueTime returns the time the role certificate becomes valid.
+func (p *roleCertPrincipal) IssueTime() int64 {
+	return p.issueTime
+}
+
+// ExpiryTime returns the time the role certificate expires.
+func (p *roleCertPrincipal) ExpiryTime() int64 {
+	return p.expiryTime
+}
+
+// AuthorizedRoles returns the roles in the role certificate.
+func (p *roleCertPrincipal) AuthorizedRoles() []string {
+	return p.roles
+}
@@ -0,0 +1,304 @@
+package service
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	authorizerd "github.com/yahoojapan/athenz-authorizer/v5"
+)
+
+func newRoleCert(cn string, uris []string, emails []string) *x509.Certificate {
+	c := &x509.Certificate{
+		Subject: pkix.Name{
+			CommonName: cn,
+		},
+		EmailAddresses: emails,
+		NotBefore:      time.Unix(1600000000, 0),
+		NotAfter:       time.Unix(1700000000, 0),
+	}
+	for _, u := range uris {
+		parsed, _ := url.Parse(u)
+		c.URIs = append(c.URIs, parsed)
+	}
+	return c
+}
+
+func Test_roleCertRoles(t *testing.T) {
+	type args struct {
+		cert      *x509.Certificate
+		uriPrefix string
+	}
+	tests := []struct {
+		name        string
+		args        args
+		wantDomains []string
+		wantRoles   map[string][]string
+	}{
+		{
+			name: "return role in common name",
+			args: args{
+				cert:      newRoleCert("domain:role.reader", nil, []string{"client.service@athenz.cloud"}),
+				uriPrefix: DefaultRoleCertURIPrefix,
+			},
+			wantDomains: []string{"domain"},
+			wantRoles: map[string][]string{
+				"domain": {"reader"},
+			},
+		},
+		{
+			name: "return roles in SAN URI by the domain",
+			args: args{
+				cert: newRoleCert("client.service", []string{
+					"spiffe://domain/sa/service",
+					"athenz://role/domain/reader",
+					"athenz://role/other/admin",
+					"athenz://role/domain/writer",
+					"athenz://role/domain/reader",
+				}, nil),
+				uriPrefix: DefaultRoleCertURIPrefix,
+			},
+			wantDomains: []string{"domain", "other"},
+			wantRoles: map[string][]string{
+				"domain": {"reader", "writer"},
+				"other":  {"admin"},
+			},
+		},
+		{
+			name: "return roles with custom prefix",
+			args: args{
+				cert:      newRoleCert("client.service", []string{"role://domain/reader"}, nil),
+				uriPrefix: "role://",
+			},
+			wantDomains: []string{"domain"},
+			wantRoles: map[string][]string{
+				"domain": {"reader"},
+			},
+		},
+		{
+			name: "return no role when role not found",
+			args: args{
+				cert:      newRoleCert("client.service", []string{"role://domain/reader"}, nil),
+				uriPrefix: DefaultRoleCertURIPrefix,
+			},
+			wantRoles: map[string][]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotDomains, gotRoles := roleCertRoles(tt.args.cert, tt.args.uriPrefix)
+			if !reflect.DeepEqual(gotDomains, tt.wantDomains) {
+				t.Errorf("roleCertRoles() domains = %v, want %v", gotDomains, tt.wantDomains)
+			}
+			if !reflect.DeepEqual(gotRoles, tt.wantRoles) {
+				t.Errorf("roleCertRoles() roles = %v, want %v", gotRoles, tt.wantRoles)
+			}
+		})
+	}
+}
+
+func Test_newRoleCertPrincipal(t *testing.T) {
+	tests := []struct {
+		name string
+		cert *x509.Certificate
+		want *roleCertPrincipal
+	}{
+		{
+			name: "return principal in SAN email",
+			cert: newRoleCert("domain:role.reader", nil, []string{"client.service@athenz.cloud"}),
+			want: &roleCertPrincipal{
+				name:       "client.service",
+				domain:     "domain",
+				roles:      []string{"reader"},
+				issueTime:  1600000000,
+				expiryTime: 1700000000,
+			},
+		},
+		{
+			name: "return principal in common name",
+			cert: newRoleCert("client.service", nil, nil),
+			want: &roleCertPrincipal{
+				name:       "client.service",
+				domain:     "domain",
+				roles:      []string{"reader"},
+				issueTime:  1600000000,
+				expiryTime: 1700000000,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newRoleCertPrincipal(tt.cert, "domain", []string{"reader"}); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("newRoleCertPrincipal() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_roleCertAuthorizationd_Authorize(t *testing.T) {
+	cert := newRoleCert("domain:role.reader", nil, nil)
+	leaf := newRoleCert("client.service", nil, nil)
+	forged := newRoleCert("victim:role.admin", []string{"athenz://role/victim/admin"}, nil)
+	fallback := &roleCertPrincipal{name: "fallback"}
+	newAuthorizationd := func(verifyErr error) Authorizationd {
+		return NewRoleCertAuthorizationd(&AuthorizerdMock{
+			VerifyRoleCertFunc: func(ctx context.Context, peerCerts []*x509.Certificate, act, res string) (authorizerd.Principal, error) {
+				if act != "GET" || res != "/path" {
+					return nil, errors.Errorf("unexpected action and resource: %s %s", act, res)
+				}
+				for _, c := range peerCerts {
+					if c.Subject.CommonName == "victim:role.admin" {
+						// the policy allows the forged role
+						return nil, nil
+					}
+				}
+				return nil, verifyErr
+			},
+			VerifyFunc: func(r *http.Request, act, res string) (authorizerd.Principal, error) {
+				return fallback, nil
+			},
+		}, "")
+	}
+	tests := []struct {
+		name     string
+		a        Authorizationd
+		tls      *tls.ConnectionState
+		wantName string
+	}{
+		{
+			name: "authorize by role certificate",
+			a:    newAuthorizationd(nil),
+			tls: &tls.ConnectionState{
+				PeerCertificates: []*x509.Certificate{cert},
+				VerifiedChains:   [][]*x509.Certificate{{cert}},
+			},
+			wantName: "domain:role.reader",
+		},
+		{
+			name: "fallback when role certificate is unauthorized",
+			a:    newAuthorizationd(errors.New("role certificates unauthorized")),
+			tls: &tls.ConnectionState{
+				PeerCertificates: []*x509.Certificate{cert},
+				VerifiedChains:   [][]*x509.Certificate{{cert}},
+			},
+			wantName: "fallback",
+		},
+		{
+			name:     "fallback when peer certificate is not verified",
+			a:        newAuthorizationd(nil),
+			tls:      &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}},
+			wantName: "fallback",
+		},
+		{
+			name: "fallback when unverified role certificate is appended behind the verified leaf",
+			a:    newAuthorizationd(errors.New("role certificates unauthorized")),
+			tls: &tls.ConnectionState{
+				PeerCertificates: []*x509.Certificate{leaf, forged},
+				VerifiedChains:   [][]*x509.Certificate{{leaf}},
+			},
+			wantName: "fallback",
+		},
+		{
+			name:     "fallback when peer certificate not found",
+			a:        newAuthorizationd(nil),
+			tls:      nil,
+			wantName: "fallback",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/path", nil)
+			r.TLS = tt.tls
+			got, err := tt.a.Authorize(r, r.Method, r.URL.Path)
+			if err != nil {
+				t.Errorf("Authorize() error = %v", err)
+				return
+			}
+			if got.Name() != tt.wantName {
+				t.Errorf("Authorize() principal = %s, want %s", got.Name(), tt.wantName)
+			}
+		})
+	}
+}
+
+func Test_roleCertAuthorizationd_AuthorizeRoleCert(t *testing.T) {
+	// the policy allows only the roles of the other domain
+	a := NewRoleCertAuthorizationd(&AuthorizerdMock{
+		VerifyRoleCertFunc: func(ctx context.Context, peerCerts []*x509.Certificate, act, res string) (authorizerd.Principal, error) {
+			for _, c := range peerCerts {
+				if c.Subject.CommonName == "other:role.admin" {
+					return nil, nil
+				}
+			}
+			return nil, errors.New("role certificates unauthorized")
+		},
+	}, "")
+	tests := []struct {
+		name       string
+		peerCerts  []*x509.Certificate
+		wantDomain string
+		wantRoles  []string
+		wantErr    string
+	}{
+		{
+			name: "return principal of the domain authorized for the resource",
+			peerCerts: []*x509.Certificate{
+				newRoleCert("client.service", []string{
+					"athenz://role/domain/reader",
+					"athenz://role/other/admin",
+				}, nil),
+			},
+			wantDomain: "other",
+			wantRoles:  []string{"admin"},
+		},
+		{
+			name: "return error when no domain is authorized",
+			peerCerts: []*x509.Certificate{
+				newRoleCert("domain:role.reader", nil, nil),
+			},
+			wantErr: "role certificates unauthorized",
+		},
+		{
+			name:    "return error when peer certificate not found",
+			wantErr: "peer certificate not found",
+		},
+		{
+			name: "return error when role is only in the certificate behind the leaf",
+			peerCerts: []*x509.Certificate{
+				newRoleCert("client.service", nil, nil),
+				newRoleCert("other:role.admin", []string{"athenz://role/other/admin"}, nil),
+			},
+			wantErr: "invalid role certificate",
+		},
+		{
+			name: "return error when role not found",
+			peerCerts: []*x509.Certificate{
+				newRoleCert("client.service", nil, nil),
+			},
+			wantErr: "invalid role certificate",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := a.AuthorizeRoleCert(context.Background(), tt.peerCerts, "grpc", "/method")
+			if (err == nil && tt.wantErr != "") || (err != nil && err.Error() != tt.wantErr) {
+				t.Errorf("AuthorizeRoleCert() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				return
+			}
+			if got.Domain() != tt.wantDomain || !reflect.DeepEqual(got.Roles(), tt.wantRoles) {
+				t.Errorf("AuthorizeRoleCert() domain = %s, roles = %v, want %s, %v", got.Domain(), got.Roles(), tt.wantDomain, tt.wantRoles)
+			}
+		})
+	}
+}
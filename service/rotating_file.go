@@ -0,0 +1,147 @@
+/*
+Copyright (C)  2018 Yahoo Japan Corporation Athenz team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat represents the time format of the rotated file suffix, which sorts in the rotated order.
+const backupTimeFormat = "20060102T150405.000000000"
+
+// rotatingFile writes to a local file, and rotates the file by size and age.
+// The rotated files are renamed with the rotated time suffix, and the oldest ones beyond the maximum number of backups are removed.
+type rotatingFile struct {
+	path       string
+	perm       os.FileMode
+	maxSize    int64
+	maxAge     time.Duration
+	maxBackups int
+	// warnf reports the rotation errors, which do not stop the writes to the current file
+	warnf func(format string, args ...interface{})
+
+	mu     sync.Mutex
+	f      *os.File
+	size   int64
+	opened time.Time
+}
+
+// newRotatingFile opens the file for appending. maxSize is in megabytes, and zero maxAge or maxBackups disables the limit.
+func newRotatingFile(path string, perm os.FileMode, maxSize int, maxAge time.Duration, maxBackups int, warnf func(string, ...interface{})) (*rotatingFile, error) {
+	r := &rotatingFile{
+		path:       path,
+		perm:       perm,
+		maxSize:    int64(maxSize) * 1024 * 1024,
+		maxAge:     maxAge,
+		maxBackups: maxBackups,
+		warnf:      warnf,
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// open opens the file, and replaces the current file only if it succeeds.
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, r.perm)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.f = f
+	r.size = fi.Size()
+	r.opened = time.Now()
+	return nil
+}
+
+// Write writes the data, and rotates the file before writing if the file would exceed the maximum size or age.
+// If the rotation fails, the data is written to the current file.
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return 0, os.ErrClosed
+	}
+	if r.size > 0 && (r.size+int64(len(p)) > r.maxSize || (r.maxAge > 0 && time.Since(r.opened) > r.maxAge)) {
+		if err := r.rotate(); err != nil {
+			r.warnf("cannot rotate %s: %v", r.path, err)
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// rotate renames the file and opens a new one. The current file is kept open until the new one is opened,
+// so that the writes continue to the current file, even after it is renamed, if the rotation fails.
+func (r *rotatingFile) rotate() error {
+	if err := os.Rename(r.path, r.path+"."+time.Now().UTC().Format(backupTimeFormat)); err != nil {
+		return err
+	}
+	prev := r.f
+	if err := r.open(); err != nil {
+		return err
+	}
+	if err := prev.Close(); err != nil {
+		r.warnf("cannot close rotated file: %v", err)
+	}
+
+	if r.maxBackups > 0 {
+		backups := r.backups()
+		for len(backups) > r.maxBackups {
+			if err := os.Remove(backups[0]); err != nil {
+				r.warnf("cannot remove rotated file: %v", err)
+			}
+			backups = backups[1:]
+		}
+	}
+	return nil
+}
+
+// backups returns the rotated files in the rotated order.
+func (r *rotatingFile) backups() []string {
+	files, _ := filepath.Glob(r.path + ".*")
+	backups := files[:0]
+	for _, f := range files {
+		if _, err := time.Parse(backupTimeFormat, f[len(r.path)+1:]); err == nil {
+			backups = append(backups, f)
+		}
+	}
+	sort.Strings(backups)
+	return backups
+}
+
+// Close closes the file.
+func (r *rotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return nil
+	}
+	err := r.f.Close()
+	r.f = nil
+	return err
+}
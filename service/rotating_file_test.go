@@ -0,0 +1,117 @@
+package service
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_rotatingFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "authorization-proxy.log")
+	var warns []string
+	f, err := newRotatingFile(path, 0o644, 1, 0, 2, func(format string, args ...interface{}) {
+		warns = append(warns, fmt.Sprintf(format, args...))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.maxSize = 10
+
+	for _, line := range []string{"line1\n", "line2\n", "line3\n", "line4\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+	backups := f.backups()
+	if len(backups) != 2 {
+		t.Fatalf("backups = %v, want 2 files", backups)
+	}
+	for i, want := range []string{"line2\n", "line3\n"} {
+		if b, _ := ioutil.ReadFile(backups[i]); string(b) != want {
+			t.Errorf("backup %d = %q, want %q", i, b, want)
+		}
+	}
+
+	// rotate by age
+	f.maxSize = 1024
+	f.maxAge = time.Millisecond
+	time.Sleep(2 * time.Millisecond)
+	if _, err := f.Write([]byte("line5\n")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if b, _ := ioutil.ReadFile(path); string(b) != "line5\n" {
+		t.Errorf("log file = %q, want line5", b)
+	}
+
+	f.Close()
+	if _, err := f.Write([]byte("line6\n")); err != os.ErrClosed {
+		t.Errorf("Write() after Close error = %v, want %v", err, os.ErrClosed)
+	}
+	if len(warns) != 0 {
+		t.Errorf("warnings = %v, want none", warns)
+	}
+}
+
+func Test_rotatingFile_rotate_error(t *testing.T) {
+	t.Run("write to the new file when the current file cannot be closed", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "audit.log")
+		var warns []string
+		f, err := newRotatingFile(path, 0o600, 1, 0, 0, func(format string, args ...interface{}) {
+			warns = append(warns, fmt.Sprintf(format, args...))
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		f.maxSize = 10
+		if _, err := f.Write([]byte("line1\n")); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+		// the close of the current file fails on rotate
+		f.f.Close()
+
+		for _, line := range []string{"line2\n", "line3\n"} {
+			if _, err := f.Write([]byte(line)); err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+		}
+		if len(warns) != 1 {
+			t.Errorf("warnings = %v, want 1", warns)
+		}
+	})
+
+	t.Run("keep writing to the current file when the file cannot be renamed", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "log")
+		if err := os.Mkdir(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		var warns []string
+		f, err := newRotatingFile(filepath.Join(dir, "authorization-proxy.log"), 0o644, 1, 0, 0, func(format string, args ...interface{}) {
+			warns = append(warns, fmt.Sprintf(format, args...))
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		f.maxSize = 10
+		if _, err := f.Write([]byte("line1\n")); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+		// the rename fails without the directory
+		if err := os.RemoveAll(dir); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := f.Write([]byte("line2\n")); err != nil {
+			t.Errorf("Write() error = %v", err)
+		}
+		if len(warns) != 1 {
+			t.Errorf("warnings = %v, want 1", warns)
+		}
+	})
+}
@@ -18,18 +18,23 @@ package service
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
-	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/mwitkow/grpc-proxy/proxy"
 	"github.com/pkg/errors"
+	"github.com/quic-go/quic-go/http3"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
 
 	"github.com/kpango/glg"
 	"github.com/yahoojapan/authorization-proxy/v4/config"
@@ -51,6 +56,36 @@ type server struct {
 	grpcSrvRunning bool
 	grpcCloser     io.Closer
 
+	// serve HTTP and gRPC requests on the same listener
+	mixedMode bool
+
+	// additional listeners of the authorization proxy server
+	listeners []*apiListener
+
+	// HTTP/3 server of the authorization proxy server, nil if disabled
+	h3srv *http3.Server
+
+	// Prometheus metrics, nil if disabled
+	metrics *Metrics
+
+	// tracker of the in-flight requests for draining on shutdown
+	drainer *drainer
+
+	// limit of the open connections shared by the listeners, nil if disabled
+	connLimit *connLimit
+
+	// live status of the authorizer components
+	authzStatus *AuthorizerStatus
+
+	// deep health check of the proxy destination, nil if disabled
+	upstreamHealth http.Handler
+
+	// reloader of the server certificate, nil if disabled
+	tlsReloader *TLSReloader
+
+	// revocation check of the client certificates, nil if disabled
+	revocation *RevocationChecker
+
 	// Health Check server
 	hcsrv     *http.Server
 	hcRunning bool
@@ -79,8 +114,22 @@ const (
 	// TextPlain represents a HTTP content type "text/plain"
 	TextPlain = "text/plain"
 
+	// ApplicationJSON represents a HTTP content type "application/json"
+	ApplicationJSON = "application/json"
+
 	// CharsetUTF8 represents a UTF-8 charset for HTTP response "charset=UTF-8"
 	CharsetUTF8 = "charset=UTF-8"
+
+	// GRPCContentType represents a HTTP content type prefix of gRPC requests "application/grpc"
+	GRPCContentType = "application/grpc"
+)
+
+const (
+	// DefaultReadHeaderTimeout represents the default maximum duration to read the request headers.
+	DefaultReadHeaderTimeout = 10 * time.Second
+
+	// DefaultIdleTimeout represents the default maximum duration to wait for the next request on a keep-alive connection.
+	DefaultIdleTimeout = 2 * time.Minute
 )
 
 // ErrContextClosed represents a error that the context is closed
@@ -92,51 +141,118 @@ var ErrContextClosed = errors.New("context Closed")
 //
 // The health check server is a http.Server instance, which the port number is read from "config.Server.HealthCheck.Port"
 // , and the handler is as follow - Handle HTTP GET request and always return HTTP Status OK (200) response.
+//
+// In mixed mode, the gRPC server is served by the authorization proxy server, which routes the requests by protocol on the same listener.
 func NewServer(opts ...Option) (Server, error) {
 	var err error
 
-	s := &server{}
+	s := &server{
+		drainer: newDrainer(),
+	}
 	for _, o := range opts {
 		o(s)
 	}
 
+	// the open connections of all the listeners are limited together
+	s.connLimit = newConnLimit(s.cfg.Overload, s.metrics)
+	for _, lc := range s.cfg.Listeners {
+		l, err := newAPIListener(lc)
+		if err != nil {
+			return nil, err
+		}
+		s.listeners = append(s.listeners, l)
+	}
+
 	if s.grpcSrvEnable() {
-		gopts := []grpc.ServerOption{
+		gopts := append([]grpc.ServerOption{
 			grpc.CustomCodec(proxy.Codec()),
 			grpc.UnknownServiceHandler(s.grpcHandler),
+			grpc.ChainStreamInterceptor(s.drainer.StreamInterceptor()),
+		}, grpcServerOptions(s.cfg.GRPC)...)
+		if h := s.metrics.GRPCStatsHandler(); h != nil {
+			gopts = append(gopts, grpc.StatsHandler(h))
 		}
 
-		if s.cfg.TLS.Enable {
-			cfg, err := NewTLSConfig(s.cfg.TLS)
+		// in mixed mode, TLS is terminated by the HTTP server
+		var creds credentials.TransportCredentials
+		if s.cfg.TLS.Enable && !s.mixedModeEnable() {
+			cfg, err := s.tlsConfig()
 			if err != nil {
 				return nil, err
 			}
+			// credentials.NewTLS adds h2 to a copy, while the reloaded configuration is cloned from this one
+			if !containsString(cfg.NextProtos, http2.NextProtoTLS) {
+				cfg.NextProtos = append(cfg.NextProtos, http2.NextProtoTLS)
+			}
 
-			gopts = append(gopts, grpc.Creds(credentials.NewTLS(cfg)))
+			creds = credentials.NewTLS(cfg)
+		}
+		if len(s.listeners) > 0 && !s.mixedModeEnable() {
+			// the connections of the additional listeners are handshaked with their own credentials
+			for _, l := range s.listeners {
+				if l.creds, err = l.grpcCredentials(); err != nil {
+					return nil, err
+				}
+			}
+			if creds == nil {
+				creds = insecure.NewCredentials()
+			}
+			creds = &listenerCredentials{
+				TransportCredentials: creds,
+			}
+		}
+		if creds != nil {
+			gopts = append(gopts, grpc.Creds(creds))
 		}
 
 		s.grpcSrv = grpc.NewServer(gopts...)
-	} else {
-		s.srv = &http.Server{
-			Addr:    fmt.Sprintf(":%d", s.cfg.Port),
-			Handler: s.srvHandler,
+	}
+
+	if !s.grpcSrvEnable() || s.mixedModeEnable() {
+		s.srv = s.newAPIServer(listenAddr(s.cfg.Listener, s.cfg.Port), s.cfg.TLS.Enable)
+		for _, l := range s.listeners {
+			l.srv = s.newAPIServer(l.cfg.Address, l.cfg.TLS.Enable)
 		}
-		s.srv.SetKeepAlivesEnabled(true)
+		if s.cfg.HTTP3.Enable && s.cfg.TLS.Enable {
+			// gRPC is not served over HTTP/3. HTTP/3 shares the TLS configuration of the main listener only,
+			// therefore the additional listeners with their own TLS configuration do not advertise it
+			s.h3srv = newHTTP3Server(http3Addr(s.cfg), s.cfg.HTTP3, s.cfg.Timeouts, s.drainer.Handler(s.srvHandler))
+			s.srv.Handler = s.altSvcHandler(s.srv.Handler)
+		}
+	} else if s.cfg.HTTP3.Enable {
+		glg.Warn("HTTP/3 is not supported in gRPC mode")
 	}
 
 	if s.hcSrvEnable() {
+		mux := createHealthCheckServiceMux(s.cfg.HealthCheck.Endpoint)
+		if s.metrics.OnServer(config.MetricsOnHealthCheck) {
+			mux.Handle(s.metrics.Path(), s.metrics.Handler())
+		}
+		if s.authzStatus != nil {
+			mux.Handle(AuthorizerStatusPath, s.authzStatus.Handler())
+			if ep := s.readinessEndpoint(); ep != s.cfg.HealthCheck.Endpoint {
+				mux.Handle(ep, s.authzStatus.ReadinessHandler(s.cfg.HealthCheck.Readiness.FailOnDegraded))
+			} else {
+				glg.Warnf("readiness endpoint is disabled, since it conflicts with the health check endpoint: %s", ep)
+			}
+		}
+		if s.upstreamHealth != nil {
+			mux.Handle(s.upstreamHealthEndpoint(), s.upstreamHealth)
+		}
 		s.hcsrv = &http.Server{
-			Addr:    fmt.Sprintf(":%d", s.cfg.HealthCheck.Port),
-			Handler: createHealthCheckServiceMux(s.cfg.HealthCheck.Endpoint),
+			Addr:    listenAddr(s.cfg.HealthCheck.Listener, s.cfg.HealthCheck.Port),
+			Handler: mux,
 		}
+		applyTimeouts(s.hcsrv, s.cfg.Timeouts)
 		s.hcsrv.SetKeepAlivesEnabled(true)
 	}
 
 	if s.debugSrvEnable() {
 		s.dsrv = &http.Server{
-			Addr:    fmt.Sprintf(":%d", s.cfg.Debug.Port),
+			Addr:    listenAddr(s.cfg.Debug.Listener, s.cfg.Debug.Port),
 			Handler: s.dsHandler,
 		}
+		applyTimeouts(s.dsrv, s.cfg.Timeouts)
 		s.dsrv.SetKeepAlivesEnabled(true)
 	}
 
@@ -169,8 +285,14 @@ func (s *server) ListenAndServe(ctx context.Context) <-chan []error {
 
 	wg := new(sync.WaitGroup)
 
+	// reload the certificates and the CRLs of the additional listeners, return on context done
+	for _, l := range s.listeners {
+		go l.reloader.Start(ctx)
+		go l.revocation.Start(ctx)
+	}
+
 	wg.Add(1)
-	if s.grpcSrvEnable() {
+	if s.grpcSrvEnable() && !s.mixedModeEnable() {
 		go func() {
 			s.mu.Lock()
 			s.grpcSrvRunning = true
@@ -180,7 +302,7 @@ func (s *server) ListenAndServe(ctx context.Context) <-chan []error {
 			glg.Info("authorization grpc proxy api server starting")
 			select {
 			case <-ctx.Done():
-			case gsech <- s.listenAndServeGRPCAPI():
+			case gsech <- s.serveGRPCAPI():
 			}
 			glg.Info("authorization grpc proxy api server closed")
 			close(gsech)
@@ -199,7 +321,7 @@ func (s *server) ListenAndServe(ctx context.Context) <-chan []error {
 			glg.Info("authorization proxy api server starting")
 			select {
 			case <-ctx.Done():
-			case sech <- s.listenAndServeAPI():
+			case sech <- s.serveAPI():
 			}
 			glg.Info("authorization proxy api server closed")
 			close(sech)
@@ -223,7 +345,7 @@ func (s *server) ListenAndServe(ctx context.Context) <-chan []error {
 			glg.Info("authorization proxy health check server starting")
 			select {
 			case <-ctx.Done():
-			case hech <- s.hcsrv.ListenAndServe():
+			case hech <- serve(s.hcsrv, s.cfg.HealthCheck.Listener):
 			}
 			glg.Info("authorization proxy health check server closed")
 			close(hech)
@@ -247,7 +369,7 @@ func (s *server) ListenAndServe(ctx context.Context) <-chan []error {
 			glg.Info("authorization proxy debug server starting")
 			select {
 			case <-ctx.Done():
-			case dech <- s.dsrv.ListenAndServe():
+			case dech <- serve(s.dsrv, s.cfg.Debug.Listener):
 			}
 			glg.Info("authorization proxy debug server closed")
 			close(dech)
@@ -365,24 +487,129 @@ func (s *server) dShutdown(ctx context.Context) error {
 }
 
 // apiShutdown returns any error when shutdown the authorization proxy server.
-// Before shutdown the authorization proxy server, it will sleep config.ShutdownDelay to prevent any issue from K8s
+// Before shutdown the authorization proxy server, it will sleep config.ShutdownDelay to prevent any issue from K8s.
+// During the delay, the server drains the keep-alive connections by asking the clients to close them.
+// The in-flight requests and the upgraded connections still remaining after config.ShutdownTimeout are closed forcibly.
 func (s *server) apiShutdown(ctx context.Context) error {
+	s.drainer.Start()
 	time.Sleep(s.sdd)
 	sctx, scancel := context.WithTimeout(ctx, s.sdt)
 	defer scancel()
-	return s.srv.Shutdown(sctx)
+	go s.drainer.Report(sctx, DrainReportInterval)
+
+	srvs := []*http.Server{s.srv}
+	for _, l := range s.listeners {
+		srvs = append(srvs, l.srv)
+	}
+	var err error
+	for _, srv := range srvs {
+		if serr := srv.Shutdown(sctx); serr != nil && err == nil {
+			err = serr
+		}
+	}
+	// http.Server.Shutdown does not wait for the hijacked connections
+	if derr := s.drainer.Wait(sctx); derr != nil {
+		glg.Warn(errors.Wrap(derr, "authorization proxy api server closes the remaining connections"))
+		for _, srv := range srvs {
+			srv.Close()
+		}
+		s.drainer.CloseUpgraded()
+		if err == nil {
+			err = derr
+		}
+	}
+	if s.h3srv != nil {
+		// the HTTP/3 connections are closed after the in-flight requests complete
+		if herr := s.h3srv.Close(); herr != nil && err == nil {
+			err = herr
+		}
+	}
+	if s.mixedModeEnable() {
+		// the gRPC streams are served by the HTTP server in mixed mode, only the remaining streams, the h2c connections and the upstream connections need to be closed
+		s.grpcSrv.Stop()
+		s.drainer.CloseH2C()
+		if s.grpcCloser != nil {
+			s.grpcCloser.Close()
+		}
+	}
+	return err
 }
 
-// apiShutdown returns any error when shutdown the authorization proxy server.
-// Before shutdown the authorization proxy server, it will sleep config.ShutdownDelay to prevent any issue from K8s
+// grpcShutdown shutdown the gRPC server of the authorization proxy server.
+// Before shutdown the gRPC server, it will sleep config.ShutdownDelay to prevent any issue from K8s.
+// GOAWAY is not sent during the delay, since grpc.Server sends it only on GracefulStop, which also closes the listener.
+// The gRPC server stops gracefully, and stops forcibly if the streams still remain after config.ShutdownTimeout.
 func (s *server) grpcShutdown() {
+	s.drainer.Start()
 	time.Sleep(s.sdd)
-	s.grpcSrv.GracefulStop()
+	sctx, scancel := context.WithTimeout(context.Background(), s.sdt)
+	defer scancel()
+	go s.drainer.Report(sctx, DrainReportInterval)
+
+	done := make(chan struct{})
+	go func() {
+		s.grpcSrv.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-sctx.Done():
+		glg.Warnf("authorization grpc proxy api server stops forcibly, %s", s.drainer.Status())
+		s.grpcSrv.Stop()
+		<-done
+	}
 	if s.grpcCloser != nil {
 		s.grpcCloser.Close()
 	}
 }
 
+// newAPIServer returns the HTTP server of the authorization proxy server on the address.
+func (s *server) newAPIServer(addr string, tlsEnable bool) *http.Server {
+	srv := &http.Server{
+		Addr:      addr,
+		Handler:   s.apiHandlerFor(tlsEnable),
+		ConnState: s.metrics.ConnState("api"),
+	}
+	applyTimeouts(srv, s.cfg.Timeouts)
+	if s.cfg.ProxyProtocol.Enable {
+		srv.ConnContext = proxyHeaderConnContext
+	}
+	srv.SetKeepAlivesEnabled(true)
+	return srv
+}
+
+// apiHandler returns the handler of the authorization proxy server.
+func (s *server) apiHandler() http.Handler {
+	return s.apiHandlerFor(s.cfg.TLS.Enable)
+}
+
+// apiHandlerFor returns the handler of the authorization proxy server on the listener with or without TLS.
+// In mixed mode, gRPC requests are routed to the gRPC server, and the other requests are routed to the REST handler.
+func (s *server) apiHandlerFor(tlsEnable bool) http.Handler {
+	if !s.mixedModeEnable() {
+		return s.drainer.Handler(s.srvHandler)
+	}
+
+	h := s.drainer.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isGRPCRequest(r) {
+			s.grpcSrv.ServeHTTP(w, r)
+			return
+		}
+		s.srvHandler.ServeHTTP(w, r)
+	}))
+	if tlsEnable {
+		return h
+	}
+
+	// plaintext gRPC clients use HTTP/2 with prior knowledge (h2c), the hijacked connections are closed on shutdown
+	return s.drainer.H2CHandler(h2c.NewHandler(h, http2Server(s.cfg.GRPC)))
+}
+
+// isGRPCRequest returns whether the request is a gRPC request, i.e. HTTP/2 with content-type application/grpc.
+func isGRPCRequest(r *http.Request) bool {
+	return r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get(ContentType), GRPCContentType)
+}
+
 // createHealthCheckServiceMux return a *http.ServeMux object
 // The function will register the health check server handler for given pattern, and return
 func createHealthCheckServiceMux(pattern string) *http.ServeMux {
@@ -391,6 +618,22 @@ func createHealthCheckServiceMux(pattern string) *http.ServeMux {
 	return mux
 }
 
+// readinessEndpoint returns the readiness check endpoint, or the default endpoint if it is not configured.
+func (s *server) readinessEndpoint() string {
+	if s.cfg.HealthCheck.Readiness.Endpoint == "" {
+		return DefaultReadinessEndpoint
+	}
+	return s.cfg.HealthCheck.Readiness.Endpoint
+}
+
+// upstreamHealthEndpoint returns the upstream health check endpoint, or the default endpoint if it is not configured.
+func (s *server) upstreamHealthEndpoint() string {
+	if s.cfg.HealthCheck.Upstream.Endpoint == "" {
+		return DefaultUpstreamHealthEndpoint
+	}
+	return s.cfg.HealthCheck.Upstream.Endpoint
+}
+
 // handleHealthCheckRequest is a handler function for and health check request, which always a HTTP Status OK (200) result
 func handleHealthCheckRequest(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodGet {
@@ -403,26 +646,105 @@ func handleHealthCheckRequest(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// serve returns any error occurred when start the HTTP server on the listener of the configuration, or on the address of the server.
+func serve(srv *http.Server, cfg config.Listener) error {
+	l, err := Listen(cfg, srv.Addr)
+	if err != nil {
+		return err
+	}
+	return srv.Serve(l)
+}
+
+// serveAPI serves the authorization proxy server on the listener, the additional listeners and the HTTP/3 listener, and returns the first error.
+func (s *server) serveAPI() error {
+	ech := make(chan error, len(s.listeners)+2)
+	for _, l := range s.listeners {
+		go func(l *apiListener) {
+			ech <- s.serveHTTPAPI(l.srv, l.cfg.Listener, l.cfg.TLS, l.tlsConfig)
+		}(l)
+	}
+	if s.h3srv != nil {
+		go func() {
+			ech <- s.serveHTTP3()
+		}()
+	}
+	go func() {
+		ech <- s.listenAndServeAPI()
+	}()
+	return <-ech
+}
+
 // listenAndServeAPI return any error occurred when start a HTTPS server, including any error when loading TLS certificate
 func (s *server) listenAndServeAPI() error {
-	if !s.cfg.TLS.Enable {
-		return s.srv.ListenAndServe()
+	return s.serveHTTPAPI(s.srv, s.cfg.Listener, s.cfg.TLS, s.tlsConfig)
+}
+
+// serveHTTPAPI return any error occurred when start the HTTP server on the listener, including any error when loading TLS certificate
+func (s *server) serveHTTPAPI(srv *http.Server, lcfg config.Listener, tcfg config.TLS, tlsConfig func() (*tls.Config, error)) error {
+	if !tcfg.Enable {
+		l, err := s.listenAPI(lcfg, srv.Addr)
+		if err != nil {
+			return err
+		}
+		return srv.Serve(l)
 	}
 
-	cfg, err := NewTLSConfig(s.cfg.TLS)
+	cfg, err := tlsConfig()
 	if err == nil && cfg != nil {
-		s.srv.TLSConfig = cfg
+		srv.TLSConfig = cfg
 	}
 	if err != nil {
 		glg.Error(errors.Wrap(err, "cannot NewTLSConfig(s.cfg.TLS)"))
 	}
-	return s.srv.ListenAndServeTLS("", "")
+	if s.mixedModeEnable() {
+		// ConfigureServer adds h2 to the ALPN protocols of the TLS configuration set above
+		if err = http2.ConfigureServer(srv, http2Server(s.cfg.GRPC)); err != nil {
+			return errors.Wrap(err, "cannot http2.ConfigureServer()")
+		}
+	} else if len(tcfg.ALPNProtocols) > 0 && !containsString(tcfg.ALPNProtocols, http2.NextProtoTLS) {
+		// a non-nil empty map disables HTTP/2, which is enabled by default
+		srv.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+	}
+	l, err := s.listenAPI(lcfg, srv.Addr)
+	if err != nil {
+		return err
+	}
+	// ServeTLS does not close the listener when the certificate is not loaded
+	defer l.Close()
+	return srv.ServeTLS(l, "", "")
+}
+
+// tlsConfig returns the TLS configuration of the authorization proxy server, which serves the reloaded certificate if the reloader is set,
+// and checks the revocation of the client certificates if the revocation checker is set.
+func (s *server) tlsConfig() (*tls.Config, error) {
+	return newServerTLSConfig(s.cfg.TLS, s.tlsReloader, s.revocation)
+}
+
+// serveGRPCAPI serves the gRPC server on the listener and the additional listeners, and returns the first error.
+func (s *server) serveGRPCAPI() error {
+	ech := make(chan error, len(s.listeners)+1)
+	for _, l := range s.listeners {
+		go func(l *apiListener) {
+			ln, err := s.listenAPI(l.cfg.Listener, l.cfg.Address)
+			if err != nil {
+				ech <- err
+				return
+			}
+			ech <- s.grpcSrv.Serve(&credsListener{
+				Listener: ln,
+				creds:    l.creds,
+			})
+		}(l)
+	}
+	go func() {
+		ech <- s.listenAndServeGRPCAPI()
+	}()
+	return <-ech
 }
 
 // listenAndGRPCServeAPI return any error occurred when start a HTTPS server, including any error when loading TLS certificate
 func (s *server) listenAndServeGRPCAPI() error {
-	port := strconv.Itoa(s.cfg.Port)
-	l, err := net.Listen("tcp", ":"+port)
+	l, err := s.listenAPI(s.cfg.Listener, listenAddr(s.cfg.Listener, s.cfg.Port))
 	if err != nil {
 		return err
 	}
@@ -430,14 +752,63 @@ func (s *server) listenAndServeGRPCAPI() error {
 	return s.grpcSrv.Serve(l)
 }
 
+// listenAPI returns the listener of the authorization proxy server, which limits the open connections and reads the PROXY protocol header if enabled.
+func (s *server) listenAPI(cfg config.Listener, addr string) (net.Listener, error) {
+	l, err := Listen(cfg, addr)
+	if err != nil {
+		return nil, err
+	}
+	// the connections beyond the limit are closed before reading the PROXY protocol header
+	l = newConnLimitListener(l, s.connLimit)
+	pl, err := NewProxyProtocolListener(l, s.cfg.ProxyProtocol)
+	if err != nil {
+		l.Close()
+		return nil, err
+	}
+	return pl, nil
+}
+
+// applyTimeouts sets the timeouts and the request header size limit to the HTTP server.
+func applyTimeouts(srv *http.Server, cfg config.ServerTimeouts) {
+	srv.ReadHeaderTimeout = parseDuration(cfg.ReadHeaderTimeout, DefaultReadHeaderTimeout)
+	srv.ReadTimeout = parseDuration(cfg.ReadTimeout, 0)
+	srv.WriteTimeout = parseDuration(cfg.WriteTimeout, 0)
+	srv.IdleTimeout = parseDuration(cfg.IdleTimeout, DefaultIdleTimeout)
+	srv.MaxHeaderBytes = cfg.MaxHeaderBytes
+}
+
+// parseDuration returns the duration of the string, or the default value if the string is empty, invalid or negative.
+// Zero is returned as is, which disables the timeouts and the limits, e.g. the server timeouts and the maximum age of the log files.
+// The durations which must be positive are validated by the configuration.
+func parseDuration(s string, def time.Duration) time.Duration {
+	if d, err := time.ParseDuration(s); err == nil && d >= 0 {
+		return d
+	}
+	return def
+}
+
+// containsString returns whether the slice contains the string.
+func containsString(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
 func (s *server) hcSrvEnable() bool {
-	return s.cfg.HealthCheck.Port > 0
+	return s.cfg.HealthCheck.Port > 0 || s.cfg.HealthCheck.Listener.Enabled()
 }
 
 func (s *server) grpcSrvEnable() bool {
 	return s.grpcHandler != nil
 }
 
+func (s *server) mixedModeEnable() bool {
+	return s.mixedMode && s.grpcHandler != nil
+}
+
 func (s *server) debugSrvEnable() bool {
 	return s.cfg.Debug.Enable
 }
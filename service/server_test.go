@@ -64,6 +64,188 @@ func TestNewServer(t *testing.T) {
 				return nil
 			},
 		},
+		func() struct {
+			name      string
+			args      args
+			want      Server
+			wantErr   error
+			checkFunc func(got, want Server, gotErr, wantErr error) error
+		} {
+			st := NewAuthorizerStatus(config.Authorization{
+				Policy: config.Policy{
+					Disable: true,
+				},
+			})
+			return struct {
+				name      string
+				args      args
+				want      Server
+				wantErr   error
+				checkFunc func(got, want Server, gotErr, wantErr error) error
+			}{
+				name: "Check readiness endpoint on health check server",
+				args: args{
+					opts: []Option{
+						WithServerConfig(config.Server{
+							HealthCheck: config.HealthCheck{
+								Port:     8080,
+								Endpoint: "/healthz",
+							},
+						}),
+						WithAuthorizerStatus(st),
+					},
+				},
+				checkFunc: func(got, want Server, gotErr, wantErr error) error {
+					if gotErr != nil {
+						return gotErr
+					}
+					h := got.(*server).hcsrv.Handler
+					for _, tc := range []struct {
+						path string
+						want int
+					}{
+						{"/healthz", http.StatusOK},
+						{DefaultReadinessEndpoint, http.StatusOK},
+						{AuthorizerStatusPath, http.StatusOK},
+					} {
+						w := httptest.NewRecorder()
+						h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.path, nil))
+						if w.Code != tc.want {
+							return errors.Errorf("%s status = %d, want %d", tc.path, w.Code, tc.want)
+						}
+					}
+					return nil
+				},
+			}
+		}(),
+		{
+			name: "Check timeouts of the servers",
+			args: args{
+				opts: []Option{
+					WithServerConfig(config.Server{
+						Port: 8082,
+						HealthCheck: config.HealthCheck{
+							Port:     8080,
+							Endpoint: "/healthz",
+						},
+						Debug: config.Debug{
+							Enable: true,
+							Port:   8083,
+						},
+						Timeouts: config.ServerTimeouts{
+							ReadTimeout:    "30s",
+							WriteTimeout:   "1m",
+							IdleTimeout:    "0",
+							MaxHeaderBytes: 8192,
+						},
+					}),
+					WithRestHandler(http.NotFoundHandler()),
+				},
+			},
+			checkFunc: func(got, want Server, gotErr, wantErr error) error {
+				if gotErr != nil {
+					return gotErr
+				}
+				s := got.(*server)
+				for _, srv := range []*http.Server{s.srv, s.hcsrv, s.dsrv} {
+					if srv.ReadHeaderTimeout != DefaultReadHeaderTimeout || srv.ReadTimeout != 30*time.Second || srv.WriteTimeout != time.Minute || srv.IdleTimeout != 0 || srv.MaxHeaderBytes != 8192 {
+						return errors.Errorf("unexpected timeouts of %s: %v %v %v %v %d", srv.Addr, srv.ReadHeaderTimeout, srv.ReadTimeout, srv.WriteTimeout, srv.IdleTimeout, srv.MaxHeaderBytes)
+					}
+				}
+				return nil
+			},
+		},
+		{
+			name: "Check listeners of the servers",
+			args: args{
+				opts: []Option{
+					WithServerConfig(config.Server{
+						Port: 8082,
+						Listener: config.Listener{
+							Address: "127.0.0.1:8082",
+						},
+						HealthCheck: config.HealthCheck{
+							Endpoint: "/healthz",
+							Listener: config.Listener{
+								Network: config.ListenerUnix,
+								Address: "/run/authorization-proxy/health.sock",
+							},
+						},
+					}),
+					WithRestHandler(http.NotFoundHandler()),
+				},
+			},
+			checkFunc: func(got, want Server, gotErr, wantErr error) error {
+				if gotErr != nil {
+					return gotErr
+				}
+				s := got.(*server)
+				if s.srv.Addr != "127.0.0.1:8082" {
+					return errors.Errorf("unexpected address: %s", s.srv.Addr)
+				}
+				if s.hcsrv == nil || s.hcsrv.Addr != "/run/authorization-proxy/health.sock" {
+					return errors.New("health check server is not enabled by the listener")
+				}
+				return nil
+			},
+		},
+		{
+			name: "Check default timeouts of the servers",
+			args: args{
+				opts: []Option{
+					WithServerConfig(config.Server{
+						Port: 8082,
+					}),
+					WithRestHandler(http.NotFoundHandler()),
+				},
+			},
+			checkFunc: func(got, want Server, gotErr, wantErr error) error {
+				if gotErr != nil {
+					return gotErr
+				}
+				srv := got.(*server).srv
+				if srv.ReadHeaderTimeout != DefaultReadHeaderTimeout || srv.IdleTimeout != DefaultIdleTimeout || srv.ReadTimeout != 0 || srv.WriteTimeout != 0 || srv.MaxHeaderBytes != 0 {
+					return errors.Errorf("unexpected default timeouts: %v %v %v %v %d", srv.ReadHeaderTimeout, srv.IdleTimeout, srv.ReadTimeout, srv.WriteTimeout, srv.MaxHeaderBytes)
+				}
+				return nil
+			},
+		},
+		{
+			name: "Check upstream health endpoint on health check server",
+			args: args{
+				opts: []Option{
+					WithServerConfig(config.Server{
+						HealthCheck: config.HealthCheck{
+							Port:     8080,
+							Endpoint: "/healthz",
+						},
+					}),
+					WithUpstreamHealthHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+						w.WriteHeader(http.StatusServiceUnavailable)
+					})),
+				},
+			},
+			checkFunc: func(got, want Server, gotErr, wantErr error) error {
+				if gotErr != nil {
+					return gotErr
+				}
+				h := got.(*server).hcsrv.Handler
+				for _, tc := range []struct {
+					path string
+					want int
+				}{
+					{"/healthz", http.StatusOK},
+					{DefaultUpstreamHealthEndpoint, http.StatusServiceUnavailable},
+				} {
+					w := httptest.NewRecorder()
+					h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.path, nil))
+					if w.Code != tc.want {
+						return errors.Errorf("%s status = %d, want %d", tc.path, w.Code, tc.want)
+					}
+				}
+				return nil
+			},
+		},
 		{
 			name: "Check debug server address",
 			args: args{
@@ -202,6 +384,38 @@ func TestNewServer(t *testing.T) {
 				return nil
 			},
 		},
+		{
+			name: "Check mixed mode server shares HTTP listener",
+			args: args{
+				opts: []Option{
+					WithServerConfig(config.Server{
+						Port: 8082,
+					}),
+					WithRestHandler(http.NotFoundHandler()),
+					WithGRPCHandler(func(srv interface{}, stream grpc.ServerStream) error {
+						return nil
+					}),
+					WithMixedMode(true),
+				},
+			},
+			want: &server{
+				srv: &http.Server{
+					Addr: fmt.Sprintf(":%d", 8082),
+				},
+			},
+			checkFunc: func(got, want Server, gotErr, wantErr error) error {
+				if !errors.Is(gotErr, wantErr) {
+					return errors.Errorf("got error is not matched with want error, got: %s, want: %s", gotErr, wantErr)
+				}
+				if got.(*server).grpcSrv == nil {
+					return fmt.Errorf("GRPC server is nil")
+				}
+				if got.(*server).srv.Addr != want.(*server).srv.Addr {
+					return fmt.Errorf("Server Addr not equals\tgot: %s\twant: %s", got.(*server).srv.Addr, want.(*server).srv.Addr)
+				}
+				return nil
+			},
+		},
 		{
 			name: "return error when grpc TLS cert invalid",
 			args: args{
@@ -246,9 +460,11 @@ func Test_server_ListenAndServe(t *testing.T) {
 		grpcSrv     *grpc.Server
 		grpcHandler grpc.StreamHandler
 		srv         *http.Server
+		srvHandler  http.Handler
 		hcsrv       *http.Server
 		dsrv        *http.Server
 		cfg         config.Server
+		mixedMode   bool
 	}
 	type args struct {
 		ctx context.Context
@@ -403,6 +619,93 @@ func Test_server_ListenAndServe(t *testing.T) {
 		func() test {
 			ctx, cancelFunc := context.WithCancel(context.Background())
 
+			grpcHandler := func(srv interface{}, stream grpc.ServerStream) error {
+				return stream.SendMsg(new(emptypb.Empty))
+			}
+
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(200)
+				fmt.Fprintln(w, "Hello, client")
+			})
+
+			apiSrvPort := 9998
+			hcSrvPort := 9999
+			apiSrvAddr := fmt.Sprintf("http://127.0.0.1:%v", apiSrvPort)
+			grpcSrvAddr := fmt.Sprintf("127.0.0.1:%v", apiSrvPort)
+			hcSrvAddr := fmt.Sprintf("http://127.0.0.1:%v", hcSrvPort)
+
+			return test{
+				name: "Test mixed mode server serves HTTP and gRPC on the same port",
+				fields: fields{
+					grpcSrv: grpc.NewServer(
+						grpc.CustomCodec(proxy.Codec()),
+						grpc.UnknownServiceHandler(grpcHandler),
+					),
+					grpcHandler: grpcHandler,
+					srv: func() *http.Server {
+						s := &http.Server{
+							Addr: fmt.Sprintf(":%d", apiSrvPort),
+						}
+						s.SetKeepAlivesEnabled(true)
+						return s
+					}(),
+					srvHandler: handler,
+					hcsrv: func() *http.Server {
+						s := &http.Server{
+							Addr:    fmt.Sprintf(":%d", hcSrvPort),
+							Handler: handler,
+						}
+						s.SetKeepAlivesEnabled(true)
+						return s
+					}(),
+					cfg: config.Server{
+						Port: apiSrvPort,
+						HealthCheck: config.HealthCheck{
+							Port: hcSrvPort,
+						},
+					},
+					mixedMode: true,
+				},
+				args: args{
+					ctx: ctx,
+				},
+				checkFunc: func(s *server, got <-chan []error, want error) error {
+					time.Sleep(time.Millisecond * 150)
+
+					if err := checkSrvRunning(apiSrvAddr); err != nil {
+						return fmt.Errorf("Server not running, err: %s", err)
+					}
+					if err := checkGRPCSrvRunning(grpcSrvAddr); err != nil {
+						return fmt.Errorf("GRPC Server not running, err: %s", err)
+					}
+					if err := checkSrvRunning(hcSrvAddr); err != nil {
+						return fmt.Errorf("Health Check server not running")
+					}
+
+					cancelFunc()
+					time.Sleep(time.Millisecond * 250)
+
+					if err := checkSrvRunning(apiSrvAddr); err == nil {
+						return fmt.Errorf("Server running")
+					}
+					if err := checkGRPCSrvRunning(grpcSrvAddr); err == nil {
+						return fmt.Errorf("GRPC Server running")
+					}
+					if err := checkSrvRunning(hcSrvAddr); err == nil {
+						return fmt.Errorf("Health Check server running")
+					}
+
+					return nil
+				},
+				afterFunc: func() error {
+					cancelFunc()
+					return nil
+				},
+			}
+		}(),
+		func() test {
+			ctx, cancelFunc := context.WithCancel(context.Background())
+
 			keyKey := "dummy_key"
 			key := "../test/data/dummyServer.key"
 			certKey := "dummy_cert"
@@ -1119,11 +1422,16 @@ func Test_server_ListenAndServe(t *testing.T) {
 
 			s := &server{
 				srv:         tt.fields.srv,
+				srvHandler:  tt.fields.srvHandler,
 				grpcSrv:     tt.fields.grpcSrv,
 				grpcHandler: tt.fields.grpcHandler,
 				hcsrv:       tt.fields.hcsrv,
 				dsrv:        tt.fields.dsrv,
 				cfg:         tt.fields.cfg,
+				mixedMode:   tt.fields.mixedMode,
+			}
+			if s.mixedModeEnable() {
+				s.srv.Handler = s.apiHandler()
 			}
 
 			e := s.ListenAndServe(tt.args.ctx)
@@ -1549,6 +1857,61 @@ func Test_server_handleHealthCheckRequest(t *testing.T) {
 	}
 }
 
+func Test_isGRPCRequest(t *testing.T) {
+	type args struct {
+		r *http.Request
+	}
+	tests := []struct {
+		name string
+		args args
+		want bool
+	}{
+		{
+			name: "return true when HTTP/2 request with gRPC content type",
+			args: args{
+				r: &http.Request{
+					ProtoMajor: 2,
+					Header: http.Header{
+						ContentType: []string{"application/grpc+proto"},
+					},
+				},
+			},
+			want: true,
+		},
+		{
+			name: "return false when HTTP/1.1 request with gRPC content type",
+			args: args{
+				r: &http.Request{
+					ProtoMajor: 1,
+					Header: http.Header{
+						ContentType: []string{"application/grpc"},
+					},
+				},
+			},
+			want: false,
+		},
+		{
+			name: "return false when HTTP/2 request without gRPC content type",
+			args: args{
+				r: &http.Request{
+					ProtoMajor: 2,
+					Header: http.Header{
+						ContentType: []string{"application/json"},
+					},
+				},
+			},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isGRPCRequest(tt.args.r); got != tt.want {
+				t.Errorf("isGRPCRequest() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func Test_server_listenAndServeAPI(t *testing.T) {
 	type fields struct {
 		srv   *http.Server
@@ -1718,3 +2081,24 @@ func Test_server_listenAndServeGRPCAPI(t *testing.T) {
 		})
 	}
 }
+
+func Test_parseDuration(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		want time.Duration
+	}{
+		{name: "valid duration", s: "3s", want: 3 * time.Second},
+		{name: "zero is kept", s: "0s", want: 0},
+		{name: "empty is the default", s: "", want: time.Minute},
+		{name: "invalid is the default", s: "invalid", want: time.Minute},
+		{name: "negative is the default", s: "-1s", want: time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseDuration(tt.s, time.Minute); got != tt.want {
+				t.Errorf("parseDuration() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
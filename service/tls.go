@@ -29,7 +29,14 @@ import (
 // It reads TLS configuration and initializes *tls.Config struct.
 // It initializes TLS configuration, for example the CA certificate and key to start TLS server.
 // Server and CA Certificate, and private key will read from files from file paths defined in environment variables.
+// The TLS versions, cipher suites, curves, session tickets, ALPN protocols and client authentication mode are read from the configuration,
+// and the defaults are TLS 1.2 or later, the secure cipher suites of Go, P521, P384, P256 and X25519, disabled session tickets,
+// and requiring the verified client certificate if the CA certificate is set.
 func NewTLSConfig(cfg config.TLS) (*tls.Config, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid TLS configuration")
+	}
+
 	t := &tls.Config{
 		MinVersion: tls.VersionTLS12,
 		CurvePreferences: []tls.CurveID{
@@ -38,34 +45,29 @@ func NewTLSConfig(cfg config.TLS) (*tls.Config, error) {
 			tls.CurveP256,
 			tls.X25519,
 		},
-		SessionTicketsDisabled: true,
-		// PreferServerCipherSuites: true,
-		// CipherSuites: []uint16{
-		// tls.TLS_RSA_WITH_RC4_128_SHA,
-		// tls.TLS_RSA_WITH_AES_128_CBC_SHA,
-		// tls.TLS_RSA_WITH_AES_256_CBC_SHA,
-		// tls.TLS_RSA_WITH_AES_128_CBC_SHA256,
-		// tls.TLS_RSA_WITH_AES_128_GCM_SHA256,
-		// tls.TLS_RSA_WITH_AES_256_GCM_SHA384,
-		// tls.TLS_ECDHE_ECDSA_WITH_RC4_128_SHA,
-		// tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA,
-		// tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA,
-		// tls.TLS_ECDHE_RSA_WITH_RC4_128_SHA,
-		// tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA,
-		// tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256,
-		// tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
-		// tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256,
-		// tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256,
-		// tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
-		// tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
-		// tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
-		// tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384, // Maybe this is work on TLS 1.2
-		// tls.TLS_RSA_WITH_3DES_EDE_CBC_SHA, // TLS1.3 Feature
-		// tls.TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA, // TLS1.3 Feature
-		// tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305, // Go 1.8 only
-		// tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305, // Go 1.8 only
-		// },
-		ClientAuth: tls.NoClientCert,
+		SessionTicketsDisabled: !cfg.SessionTickets,
+		NextProtos:             append([]string(nil), cfg.ALPNProtocols...),
+		ClientAuth:             tls.NoClientCert,
+	}
+	if cfg.MinVersion != "" {
+		t.MinVersion, _ = config.TLSVersion(cfg.MinVersion)
+	}
+	if cfg.MaxVersion != "" {
+		t.MaxVersion, _ = config.TLSVersion(cfg.MaxVersion)
+	}
+	if len(cfg.CipherSuites) > 0 {
+		t.CipherSuites = make([]uint16, 0, len(cfg.CipherSuites))
+		for _, name := range cfg.CipherSuites {
+			c, _ := config.TLSCipherSuite(name)
+			t.CipherSuites = append(t.CipherSuites, c.ID)
+		}
+	}
+	if len(cfg.Curves) > 0 {
+		t.CurvePreferences = make([]tls.CurveID, 0, len(cfg.Curves))
+		for _, name := range cfg.Curves {
+			c, _ := config.TLSCurve(name)
+			t.CurvePreferences = append(t.CurvePreferences, c)
+		}
 	}
 
 	cert := config.GetActualValue(cfg.CertPath)
@@ -89,6 +91,13 @@ func NewTLSConfig(cfg config.TLS) (*tls.Config, error) {
 		t.ClientCAs = pool
 		t.ClientAuth = tls.RequireAndVerifyClientCert
 	}
+	if cfg.ClientAuth != "" {
+		t.ClientAuth, _ = config.TLSClientAuth(cfg.ClientAuth)
+		// the system certificate pool is used to verify the client certificate if the pool is not set
+		if t.ClientAuth >= tls.VerifyClientCertIfGiven && t.ClientCAs == nil {
+			return nil, errors.Errorf("CA certificate is required for clientAuth: %s", cfg.ClientAuth)
+		}
+	}
 
 	return t, nil
 }
@@ -0,0 +1,228 @@
+/*
+Copyright (C)  2018 Yahoo Japan Corporation Athenz team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/kpango/glg"
+	"github.com/pkg/errors"
+
+	"github.com/yahoojapan/authorization-proxy/v4/config"
+)
+
+const defaultTLSReloadPeriod = time.Minute
+
+// TLSReloader reloads the server certificate, the private key and the client CA bundle when the files change.
+// The previous certificate is kept if the new one fails to load.
+type TLSReloader struct {
+	certPath string
+	keyPath  string
+	caPath   string
+	period   time.Duration
+	metrics  *Metrics
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	stamps    map[string]fileStamp
+}
+
+// fileStamp represents the modification time and the size of a file, which is used to detect the change.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// NewTLSReloader returns a TLSReloader which has loaded the files, or nil if TLS or the reload is disabled.
+func NewTLSReloader(cfg config.TLS, m *Metrics) (*TLSReloader, error) {
+	if !cfg.Enable {
+		return nil, nil
+	}
+	period := defaultTLSReloadPeriod
+	if cfg.ReloadPeriod != "" {
+		var err error
+		period, err = time.ParseDuration(cfg.ReloadPeriod)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid reload period")
+		}
+	}
+	if period <= 0 {
+		return nil, nil
+	}
+
+	r := &TLSReloader{
+		certPath: config.GetActualValue(cfg.CertPath),
+		keyPath:  config.GetActualValue(cfg.KeyPath),
+		caPath:   config.GetActualValue(cfg.CAPath),
+		period:   period,
+		metrics:  m,
+	}
+	if r.certPath == "" || r.keyPath == "" {
+		return nil, nil
+	}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Apply sets the callbacks to serve the latest certificate and client CA bundle to the TLS configuration.
+// The static certificates in the configuration are removed, since they take precedence over GetCertificate.
+func (r *TLSReloader) Apply(t *tls.Config) {
+	if r == nil || t == nil {
+		return
+	}
+	t.Certificates = nil
+	t.GetCertificate = r.getCertificate
+	if r.caPath == "" {
+		return
+	}
+	base := t
+	t.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		// clone on each handshake, so that the changes of the base configuration, e.g. the ALPN protocols, are respected
+		c := base.Clone()
+		c.GetConfigForClient = nil
+		r.mu.RLock()
+		c.ClientCAs = r.clientCAs
+		r.mu.RUnlock()
+		return c, nil
+	}
+}
+
+// Start checks the files for changes periodically, and returns when the context is done.
+func (r *TLSReloader) Start(ctx context.Context) {
+	if r == nil {
+		return
+	}
+	ticker := time.NewTicker(r.period)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !r.changed() {
+				continue
+			}
+			if err := r.Reload(); err != nil {
+				glg.Errorf("failed to reload TLS certificate, keep the previous one: %v", err)
+			}
+		}
+	}
+}
+
+// Reload loads the certificate, the private key and the client CA bundle from the files.
+// The previous ones are kept if any of them fails to load.
+func (r *TLSReloader) Reload() error {
+	if r == nil {
+		return nil
+	}
+	stamps := r.stat()
+
+	cert, err := tls.LoadX509KeyPair(r.certPath, r.keyPath)
+	if err != nil {
+		err = errors.Wrap(err, "tls.LoadX509KeyPair(cert, key)")
+		r.metrics.ObserveTLSReload(err, time.Time{})
+		return err
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		err = errors.Wrap(err, "x509.ParseCertificate(cert)")
+		r.metrics.ObserveTLSReload(err, time.Time{})
+		return err
+	}
+	cert.Leaf = leaf
+
+	var pool *x509.CertPool
+	if r.caPath != "" {
+		pool, err = NewX509CertPool(r.caPath)
+		if err != nil {
+			err = errors.Wrap(err, "NewX509CertPool(ca)")
+			r.metrics.ObserveTLSReload(err, time.Time{})
+			return err
+		}
+	}
+
+	r.mu.Lock()
+	reloaded := r.cert != nil
+	r.cert = &cert
+	r.clientCAs = pool
+	r.stamps = stamps
+	r.mu.Unlock()
+
+	r.metrics.ObserveTLSReload(nil, leaf.NotAfter)
+	if reloaded {
+		glg.Infof("TLS certificate reloaded, subject: %s, expires at: %s", leaf.Subject, leaf.NotAfter.Format(time.RFC3339))
+	}
+	return nil
+}
+
+func (r *TLSReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// changed returns whether any of the files has changed since the last successful load.
+// Failed loads are retried on the next check, since the stamps are updated only on success.
+func (r *TLSReloader) changed() bool {
+	stamps := r.stat()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return stampsChanged(r.stamps, stamps)
+}
+
+// stat returns the stamps of the certificate, key and CA files.
+func (r *TLSReloader) stat() map[string]fileStamp {
+	return statFiles(r.certPath, r.keyPath, r.caPath)
+}
+
+// statFiles returns the stamps of the files, the files which cannot be read and the empty paths are skipped.
+func statFiles(paths ...string) map[string]fileStamp {
+	stamps := make(map[string]fileStamp, len(paths))
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		// follow the symbolic links, e.g. the atomic update of the K8s secret volume
+		fi, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		stamps[path] = fileStamp{
+			modTime: fi.ModTime(),
+			size:    fi.Size(),
+		}
+	}
+	return stamps
+}
+
+// stampsChanged returns whether any of the current stamps differs from the previous ones.
+func stampsChanged(prev, cur map[string]fileStamp) bool {
+	for path, s := range cur {
+		if prev[path] != s {
+			return true
+		}
+	}
+	return false
+}
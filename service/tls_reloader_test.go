@@ -0,0 +1,284 @@
+package service
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/yahoojapan/authorization-proxy/v4/config"
+)
+
+// writeTestCert writes a self-signed certificate and its private key with the common name, and returns the paths.
+func writeTestCert(t *testing.T, dir, cn string) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kb, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, keyPath := filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key")
+	if err := ioutil.WriteFile(cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: kb}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// make sure the change is detected even if the files are written within the timestamp resolution
+	mt := time.Now().Add(time.Duration(len(cn)) * time.Second)
+	os.Chtimes(cert, mt, mt)
+	os.Chtimes(keyPath, mt, mt)
+	return cert, keyPath
+}
+
+// handshakeCN returns the common name of the certificate served by the TLS listener.
+func handshakeCN(t *testing.T, addr string) string {
+	t.Helper()
+	conn, err := tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatalf("tls.Dial() error = %v", err)
+	}
+	defer conn.Close()
+	return conn.ConnectionState().PeerCertificates[0].Subject.CommonName
+}
+
+func TestNewTLSReloader(t *testing.T) {
+	dir := t.TempDir()
+	cert, key := writeTestCert(t, dir, "first")
+	tests := []struct {
+		name    string
+		cfg     config.TLS
+		wantNil bool
+		wantErr string
+	}{
+		{
+			name: "load the certificate",
+			cfg: config.TLS{
+				Enable:   true,
+				CertPath: cert,
+				KeyPath:  key,
+				CAPath:   "../test/data/dummyCa.pem",
+			},
+		},
+		{
+			name: "return nil when TLS is disabled",
+			cfg: config.TLS{
+				CertPath: cert,
+				KeyPath:  key,
+			},
+			wantNil: true,
+		},
+		{
+			name: "return nil when the reload is disabled",
+			cfg: config.TLS{
+				Enable:       true,
+				CertPath:     cert,
+				KeyPath:      key,
+				ReloadPeriod: "0",
+			},
+			wantNil: true,
+		},
+		{
+			name: "return error when the certificate cannot be loaded",
+			cfg: config.TLS{
+				Enable:   true,
+				CertPath: "../test/data/invalid_dummyServer.crt",
+				KeyPath:  "../test/data/invalid_dummyServer.key",
+			},
+			wantErr: "tls.LoadX509KeyPair(cert, key): tls: failed to find any PEM data in certificate input",
+		},
+		{
+			name: "return error when the CA cannot be loaded",
+			cfg: config.TLS{
+				Enable:   true,
+				CertPath: cert,
+				KeyPath:  key,
+				CAPath:   "../test/data/invalid_dummyCa.pem",
+			},
+			wantErr: "NewX509CertPool(ca): x509.SystemCertPool(): Certification Failed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewTLSReloader(tt.cfg, nil)
+			if (err == nil && tt.wantErr != "") || (err != nil && err.Error() != tt.wantErr) {
+				t.Errorf("NewTLSReloader() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr != "" {
+				return
+			}
+			if (got == nil) != tt.wantNil {
+				t.Errorf("NewTLSReloader() = %v, wantNil %v", got, tt.wantNil)
+			}
+		})
+	}
+}
+
+func TestTLSReloader_Start(t *testing.T) {
+	dir := t.TempDir()
+	cert, key := writeTestCert(t, dir, "first")
+	m := NewMetrics(config.Metrics{
+		Enable: true,
+	})
+	r, err := NewTLSReloader(config.TLS{
+		Enable:       true,
+		CertPath:     cert,
+		KeyPath:      key,
+		ReloadPeriod: "5ms",
+	}, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := NewTLSConfig(config.TLS{
+		CertPath: "../test/data/dummyServer.crt",
+		KeyPath:  "../test/data/dummyServer.key",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Apply(cfg)
+	l, err := tls.Listen("tcp", "127.0.0.1:0", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func(c net.Conn) {
+				c.(*tls.Conn).Handshake()
+				c.Close()
+			}(conn)
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		r.Start(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	waitCN := func(want string) {
+		t.Helper()
+		deadline := time.Now().Add(time.Second)
+		for {
+			got := handshakeCN(t, l.Addr().String())
+			if got == want {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("served certificate = %s, want %s", got, want)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	// the static certificate is replaced
+	waitCN("first")
+
+	// the new certificate is served after the files change
+	writeTestCert(t, dir, "second")
+	waitCN("second")
+
+	// the previous certificate is kept when the new one is broken
+	failures := testutil.ToFloat64(m.tlsReloads.WithLabelValues("failure"))
+	if err := ioutil.WriteFile(key, []byte("broken"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	mt := time.Now().Add(time.Minute)
+	os.Chtimes(key, mt, mt)
+	deadline := time.Now().Add(time.Second)
+	for testutil.ToFloat64(m.tlsReloads.WithLabelValues("failure")) == failures {
+		if time.Now().After(deadline) {
+			t.Fatal("failed reload is not counted")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	waitCN("second")
+
+	if got := testutil.ToFloat64(m.tlsReloads.WithLabelValues("success")); got != 2 {
+		t.Errorf("successful reloads = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(m.tlsCertExpiry); got <= float64(time.Now().Unix()) {
+		t.Errorf("certificate expiry = %v", got)
+	}
+}
+
+func TestTLSReloader_Apply(t *testing.T) {
+	dir := t.TempDir()
+	cert, key := writeTestCert(t, dir, "first")
+	r, err := NewTLSReloader(config.TLS{
+		Enable:   true,
+		CertPath: cert,
+		KeyPath:  key,
+		CAPath:   "../test/data/dummyCa.pem",
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &tls.Config{
+		Certificates: make([]tls.Certificate, 1),
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	r.Apply(cfg)
+	cfg.NextProtos = []string{"h2"}
+
+	if len(cfg.Certificates) != 0 || cfg.GetCertificate == nil {
+		t.Fatal("Apply() does not replace the static certificates")
+	}
+	got, err := cfg.GetConfigForClient(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatalf("GetConfigForClient() error = %v", err)
+	}
+	if got.ClientCAs == nil || got.ClientAuth != tls.RequireAndVerifyClientCert || len(got.NextProtos) != 1 || got.GetConfigForClient != nil {
+		t.Errorf("GetConfigForClient() = %+v", got)
+	}
+
+	// nil reloader does nothing
+	var nr *TLSReloader
+	static := &tls.Config{Certificates: make([]tls.Certificate, 1)}
+	nr.Apply(static)
+	if len(static.Certificates) != 1 || static.GetCertificate != nil {
+		t.Error("nil TLSReloader changed the configuration")
+	}
+	if err := nr.Reload(); err != nil {
+		t.Errorf("nil TLSReloader Reload() error = %v", err)
+	}
+}
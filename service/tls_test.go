@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -266,6 +267,93 @@ func TestNewTLSConfig(t *testing.T) {
 				return nil
 			},
 		},
+		{
+			name: "return value of configured TLS policy test.",
+			args: args{
+				cfg: config.TLS{
+					CertPath:       defaultArgs.cfg.CertPath,
+					KeyPath:        defaultArgs.cfg.KeyPath,
+					CAPath:         defaultArgs.cfg.CAPath,
+					MinVersion:     "1.2",
+					MaxVersion:     "1.2",
+					CipherSuites:   []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", "TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384"},
+					Curves:         []string{"X25519", "P256"},
+					SessionTickets: true,
+					ALPNProtocols:  []string{"h2", "http/1.1"},
+					ClientAuth:     config.TLSClientAuthVerifyIfGiven,
+				},
+			},
+			want: &tls.Config{
+				MinVersion:       tls.VersionTLS12,
+				MaxVersion:       tls.VersionTLS12,
+				CipherSuites:     []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384},
+				CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256},
+				NextProtos:       []string{"h2", "http/1.1"},
+				ClientAuth:       tls.VerifyClientCertIfGiven,
+			},
+			checkFunc: func(got, want *tls.Config) error {
+				if got.MinVersion != want.MinVersion || got.MaxVersion != want.MaxVersion {
+					return fmt.Errorf("Version not Matched :\tgot %d-%d\twant %d-%d", got.MinVersion, got.MaxVersion, want.MinVersion, want.MaxVersion)
+				}
+				if !reflect.DeepEqual(got.CipherSuites, want.CipherSuites) {
+					return fmt.Errorf("CipherSuites not Matched :\tgot %v\twant %v", got.CipherSuites, want.CipherSuites)
+				}
+				if !reflect.DeepEqual(got.CurvePreferences, want.CurvePreferences) {
+					return fmt.Errorf("CurvePreferences not Matched :\tgot %v\twant %v", got.CurvePreferences, want.CurvePreferences)
+				}
+				if !reflect.DeepEqual(got.NextProtos, want.NextProtos) {
+					return fmt.Errorf("NextProtos not Matched :\tgot %v\twant %v", got.NextProtos, want.NextProtos)
+				}
+				if got.SessionTicketsDisabled {
+					return errors.New("SessionTicketsDisabled is true")
+				}
+				if got.ClientAuth != want.ClientAuth || got.ClientCAs == nil {
+					return fmt.Errorf("ClientAuth not Matched :\tgot %d\twant %d", got.ClientAuth, want.ClientAuth)
+				}
+				return nil
+			},
+		},
+		{
+			name: "return value of insecure TLS policy allowed test.",
+			args: args{
+				cfg: config.TLS{
+					MinVersion:    "1.0",
+					CipherSuites:  []string{"TLS_RSA_WITH_AES_128_CBC_SHA"},
+					ClientAuth:    config.TLSClientAuthRequireAny,
+					AllowInsecure: true,
+				},
+			},
+			want: &tls.Config{
+				MinVersion:   tls.VersionTLS10,
+				CipherSuites: []uint16{tls.TLS_RSA_WITH_AES_128_CBC_SHA},
+				ClientAuth:   tls.RequireAnyClientCert,
+			},
+			checkFunc: func(got, want *tls.Config) error {
+				if got.MinVersion != want.MinVersion || !reflect.DeepEqual(got.CipherSuites, want.CipherSuites) || got.ClientAuth != want.ClientAuth {
+					return fmt.Errorf("TLS policy not Matched :\tgot %d %v %d", got.MinVersion, got.CipherSuites, got.ClientAuth)
+				}
+				return nil
+			},
+		},
+		{
+			name: "return error when insecure TLS policy is not allowed.",
+			args: args{
+				cfg: config.TLS{
+					MinVersion: "1.1",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "return error when CA is not set for the verified client authentication.",
+			args: args{
+				cfg: config.TLS{
+					CAPath:     "_NOT_EXIST_ENV_",
+					ClientAuth: config.TLSClientAuthRequire,
+				},
+			},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -274,10 +362,13 @@ func TestNewTLSConfig(t *testing.T) {
 			}
 
 			got, err := NewTLSConfig(tt.args.cfg)
-			if err != nil {
+			if (err != nil) != tt.wantErr {
 				t.Errorf("NewTLSConfig() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
+			if err != nil {
+				return
+			}
 
 			if tt.checkFunc != nil {
 				err = tt.checkFunc(got, tt.want)
@@ -0,0 +1,150 @@
+/*
+Copyright (C)  2018 Yahoo Japan Corporation Athenz team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"github.com/kpango/glg"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+
+	"github.com/yahoojapan/authorization-proxy/v4/config"
+)
+
+// defaultServiceName represents the default service name of the spans.
+const defaultServiceName = "authorization-proxy"
+
+// Tracing represents the OpenTelemetry tracer provider of the authorization proxy.
+// All methods are safe to call on a nil *Tracing, which does nothing.
+type Tracing struct {
+	tp *sdktrace.TracerProvider
+
+	// output file of the file exporter
+	file io.Closer
+}
+
+// NewTracing creates the tracer provider from the configuration, and registers it with the W3C trace context and baggage propagators as the global ones.
+// It returns nil if tracing is disabled.
+func NewTracing(ctx context.Context, cfg config.Tracing) (*Tracing, error) {
+	if !cfg.Enable {
+		return nil, nil
+	}
+
+	t := new(Tracing)
+	exp, err := t.newExporter(ctx, cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create span exporter")
+	}
+
+	name := cfg.ServiceName
+	if name == "" {
+		name = defaultServiceName
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceNameKey.String(name)))
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create resource")
+	}
+
+	sampler := sdktrace.AlwaysSample()
+	if cfg.SampleRatio > 0 {
+		sampler = sdktrace.TraceIDRatioBased(cfg.SampleRatio)
+	}
+
+	t.tp = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sampler)),
+	)
+	otel.SetTracerProvider(t.tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		glg.Warnf("tracing: %v", err)
+	}))
+
+	glg.Infof("tracing enabled, exporter: %s, service name: %s", exporterName(cfg.Exporter), name)
+	return t, nil
+}
+
+func (t *Tracing) newExporter(ctx context.Context, cfg config.Tracing) (sdktrace.SpanExporter, error) {
+	switch exporterName(cfg.Exporter) {
+	case config.TracingOTLPHTTP:
+		opts := []otlptracehttp.Option{}
+		if cfg.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		if len(cfg.Headers) > 0 {
+			opts = append(opts, otlptracehttp.WithHeaders(cfg.Headers))
+		}
+		return otlptracehttp.New(ctx, opts...)
+	case config.TracingStdout:
+		return stdouttrace.New(stdouttrace.WithPrettyPrint())
+	case config.TracingFile:
+		f, err := os.OpenFile(cfg.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return nil, err
+		}
+		t.file = f
+		return stdouttrace.New(stdouttrace.WithWriter(f))
+	default:
+		opts := []otlptracegrpc.Option{}
+		if cfg.Endpoint != "" {
+			opts = append(opts, otlptracegrpc.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		if len(cfg.Headers) > 0 {
+			opts = append(opts, otlptracegrpc.WithHeaders(cfg.Headers))
+		}
+		return otlptracegrpc.New(ctx, opts...)
+	}
+}
+
+// Shutdown flushes the remaining spans and stops the exporter.
+func (t *Tracing) Shutdown(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	err := t.tp.Shutdown(ctx)
+	if t.file != nil {
+		if cerr := t.file.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+func exporterName(exporter string) string {
+	if exporter == "" {
+		return config.TracingOTLPGRPC
+	}
+	return exporter
+}
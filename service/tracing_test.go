@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+
+	"github.com/yahoojapan/authorization-proxy/v4/config"
+)
+
+func TestNewTracing(t *testing.T) {
+	tests := []struct {
+		name      string
+		cfg       func(dir string) config.Tracing
+		wantNil   bool
+		wantErr   bool
+		checkFunc func(dir string, tr *Tracing) error
+	}{
+		{
+			name: "return nil when tracing is disabled",
+			cfg: func(string) config.Tracing {
+				return config.Tracing{}
+			},
+			wantNil: true,
+		},
+		{
+			name: "return error when the output file cannot be opened",
+			cfg: func(dir string) config.Tracing {
+				return config.Tracing{
+					Enable:   true,
+					Exporter: config.TracingFile,
+					Path:     filepath.Join(dir, "not_exist", "traces.json"),
+				}
+			},
+			wantNil: true,
+			wantErr: true,
+		},
+		{
+			name: "write spans to the file on shutdown",
+			cfg: func(dir string) config.Tracing {
+				return config.Tracing{
+					Enable:      true,
+					Exporter:    config.TracingFile,
+					Path:        filepath.Join(dir, "traces.json"),
+					ServiceName: "test-proxy",
+				}
+			},
+			checkFunc: func(dir string, tr *Tracing) error {
+				_, span := otel.Tracer("test").Start(context.Background(), "test-span")
+				span.End()
+				if err := tr.Shutdown(context.Background()); err != nil {
+					return err
+				}
+				b, err := ioutil.ReadFile(filepath.Join(dir, "traces.json"))
+				if err != nil {
+					return err
+				}
+				if !strings.Contains(string(b), `"Name":"test-span"`) || !strings.Contains(string(b), "test-proxy") {
+					return fmt.Errorf("unexpected output: %s", b)
+				}
+				return nil
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			got, err := NewTracing(context.Background(), tt.cfg(dir))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewTracing() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if (got == nil) != tt.wantNil {
+				t.Errorf("NewTracing() = %v, wantNil %v", got, tt.wantNil)
+				return
+			}
+			if tt.checkFunc != nil {
+				if err := tt.checkFunc(dir, got); err != nil {
+					t.Errorf("NewTracing() error = %v", err)
+				}
+			}
+		})
+	}
+
+	// nil tracing does nothing
+	var tr *Tracing
+	if err := tr.Shutdown(context.Background()); err != nil {
+		t.Errorf("Shutdown() error = %v", err)
+	}
+}
@@ -20,6 +20,8 @@ import (
 	"context"
 	"crypto/tls"
 	"net/http"
+	"net/http/httputil"
+	"sync"
 	"time"
 
 	"github.com/kpango/glg"
@@ -35,10 +37,14 @@ import (
 	authorizerd "github.com/yahoojapan/athenz-authorizer/v5"
 )
 
+// tracingShutdownTimeout represents the maximum duration to flush the remaining spans on shutdown.
+const tracingShutdownTimeout = 5 * time.Second
+
 // AuthzProxyDaemon represents Authorization Proxy daemon behavior.
 type AuthzProxyDaemon interface {
 	Init(ctx context.Context) error
 	Start(ctx context.Context) <-chan []error
+	Reload(ctx context.Context) error
 }
 
 type authzProxyDaemon struct {
@@ -46,40 +52,265 @@ type authzProxyDaemon struct {
 	athenz     service.Authorizationd
 	server     service.Server
 	grpcServer service.Server
+	metrics    *service.Metrics
+	tracing    *service.Tracing
+	accessLog  *service.AccessLogger
+	audit      *service.AuditLogger
+	status     *service.AuthorizerStatus
+	logger     *service.Logger
+
+	tlsReloader *service.TLSReloader
+	revocation  *service.RevocationChecker
+
+	// reloadable parts of the configuration
+	cfgPath    string
+	reloader   *service.ConfigReloader
+	reloadMu   sync.Mutex
+	authorizer *service.ReloadableAuthorizationd
+	newAuthzD  func(config.Config, *service.Metrics, *service.AuthorizerStatus) (service.Authorizationd, error)
+	rest       *handler.ReloadableHandler
+	transport  *http.Transport
+	bp         httputil.BufferPool
+	limiter    *service.Limiter
 }
 
 // New returns a Authorization Proxy daemon, or error occurred.
 // The daemon contains a token service authentication and authorization server.
 // This function will also initialize the mapping rules for the authentication and authorization check.
-func New(cfg config.Config) (AuthzProxyDaemon, error) {
-	athenz, err := newAuthzD(cfg)
+func New(cfg config.Config, opts ...Option) (AuthzProxyDaemon, error) {
+	g := &authzProxyDaemon{
+		cfg:       cfg,
+		newAuthzD: newAuthzD,
+	}
+	for _, opt := range opts {
+		opt(g)
+	}
+
+	if err := validate(cfg); err != nil {
+		return nil, err
+	}
+
+	tracing, err := service.NewTracing(context.Background(), cfg.Tracing)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create tracing")
+	}
+
+	accessLog, err := service.NewAccessLogger(cfg.Log.AccessLog)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create access logger")
+	}
+
+	audit, err := service.NewAuditLogger(cfg.Audit)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create audit logger")
+	}
+
+	metrics := service.NewMetrics(cfg.Server.Metrics)
+	limiter := service.NewLimiter(cfg.Server.Overload, metrics)
+	tlsReloader, err := service.NewTLSReloader(cfg.Server.TLS, metrics)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot load TLS certificate")
+	}
+	var revocation *service.RevocationChecker
+	if cfg.Server.TLS.Enable {
+		revocation, err = service.NewRevocationChecker(cfg.Server.TLS.Revocation)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot create revocation checker")
+		}
+	}
+	status := service.NewAuthorizerStatus(cfg.Authorization)
+	authz, err := g.newAuthzD(cfg, metrics, status)
 	if err != nil {
 		return nil, errors.Wrap(err, "cannot newAuthzD(cfg)")
 	}
+	athenz := service.NewReloadableAuthorizationd(authz)
 
-	debugMux := router.NewDebugRouter(cfg.Server, athenz)
+	bp := infra.NewBuffer(cfg.Proxy.BufferSize)
+	if b, ok := bp.(interface{ Stats() infra.BufferStats }); ok {
+		metrics.RegisterBufferPool(func() service.BufferPoolStats {
+			st := b.Stats()
+			return service.BufferPoolStats{
+				Gets:        st.Gets,
+				Puts:        st.Puts,
+				Allocations: st.Allocations,
+				Size:        st.Size,
+			}
+		})
+	}
+
+	streams := handler.NewStreamTracker()
+	debugRoutes := append(router.NewGRPCStreamRoutes(cfg.Server.Debug, streams), router.NewMetricsRoutes(metrics)...)
+	debugRoutes = append(debugRoutes, router.NewAuthorizerStatusRoutes(status)...)
+	debugRoutes = append(debugRoutes, router.NewLogLevelRoutes(g.logger)...)
+	debugMux := router.NewDebugRouter(cfg.Server, athenz, debugRoutes...)
 	gh, closer := handler.NewGRPC(
 		handler.WithProxyConfig(cfg.Proxy),
 		handler.WithRoleTokenConfig(cfg.Authorization.RoleToken),
+		handler.WithRoleCertificateConfig(cfg.Authorization.RoleCertificate),
+		handler.WithGRPCStreamConfig(cfg.Authorization.GRPCStream),
+		handler.WithStreamTracker(streams),
 		handler.WithAuthorizationd(athenz),
+		handler.WithMetrics(metrics),
+		handler.WithLimiter(limiter),
+		handler.WithTracingConfig(cfg.Tracing),
+		handler.WithAccessLogger(accessLog),
+		handler.WithAuditLogger(audit),
 	)
 
+	g.athenz = athenz
+	g.authorizer = athenz
+	g.metrics = metrics
+	g.tracing = tracing
+	g.accessLog = accessLog
+	g.audit = audit
+	g.bp = bp
+	g.limiter = limiter
+	var rh http.Handler
+	rh, g.transport = g.restHandler(cfg)
+	g.rest = handler.NewReloadableHandler(rh)
+
 	srv, err := service.NewServer(
 		service.WithServerConfig(cfg.Server),
-		service.WithRestHandler(handler.New(cfg.Proxy, infra.NewBuffer(cfg.Proxy.BufferSize), athenz)),
+		service.WithRestHandler(g.rest),
 		service.WithDebugHandler(debugMux),
 		service.WithGRPCHandler(gh),
 		service.WithGRPCCloser(closer),
+		service.WithMixedMode(handler.IsGRPCMixedMode(cfg.Proxy)),
+		service.WithMetrics(metrics),
+		service.WithAuthorizerStatus(status),
+		service.WithUpstreamHealthHandler(handler.NewUpstreamHealthHandler(cfg.Proxy, cfg.Server.HealthCheck.Upstream)),
+		service.WithTLSReloader(tlsReloader),
+		service.WithRevocationChecker(revocation),
 	)
 	if err != nil {
 		return nil, err
 	}
 
-	return &authzProxyDaemon{
-		cfg:    cfg,
-		athenz: athenz,
-		server: srv,
-	}, nil
+	g.server = srv
+	g.status = status
+	g.tlsReloader = tlsReloader
+	g.revocation = revocation
+	g.reloader = service.NewConfigReloader(g.cfgPath, cfg.Reload, metrics, g.reload)
+	return g, nil
+}
+
+// restHandler returns the handler chain of the HTTP proxy for the configuration, and the transport to the proxy destination.
+func (g *authzProxyDaemon) restHandler(cfg config.Config) (http.Handler, *http.Transport) {
+	t := handler.NewTransport(cfg.Proxy.Transport)
+	rh := handler.New(cfg.Proxy, g.bp, g.athenz, handler.WithProxyAuditLogger(g.audit), handler.WithProxyTransport(t))
+	if cfg.Tracing.Enable {
+		rh = handler.NewTracingHandler(rh)
+	}
+
+	// validated in New
+	requestTimeout, _ := time.ParseDuration(cfg.Server.Timeouts.RequestTimeout)
+	// the request timeout includes the wait in the overload queue
+	rh = handler.NewOverloadHandler(rh, g.limiter)
+	rh = handler.NewTimeoutHandler(rh, requestTimeout)
+	rh = handler.NewMetricsHandler(rh, g.metrics)
+	rh = handler.NewAccessLogHandler(rh, g.accessLog)
+	return handler.NewRequestIDHandler(rh, cfg.Proxy.RequestID), t
+}
+
+// validate returns an error if the configuration is invalid.
+func validate(cfg config.Config) error {
+	if err := cfg.Server.TLS.Validate(); err != nil {
+		return errors.Wrap(err, "invalid server.tls configuration")
+	}
+	if err := cfg.Server.Timeouts.Validate(); err != nil {
+		return errors.Wrap(err, "invalid server.timeouts configuration")
+	}
+	for _, l := range []struct {
+		name string
+		cfg  config.Listener
+	}{
+		{"server.listener", cfg.Server.Listener},
+		{"server.healthCheck.listener", cfg.Server.HealthCheck.Listener},
+		{"server.debug.listener", cfg.Server.Debug.Listener},
+	} {
+		if err := l.cfg.Validate(); err != nil {
+			return errors.Wrapf(err, "invalid %s configuration", l.name)
+		}
+	}
+	for i, l := range cfg.Server.Listeners {
+		if err := l.Validate(); err != nil {
+			return errors.Wrapf(err, "invalid server.listeners[%d] configuration", i)
+		}
+	}
+	if err := cfg.Server.ProxyProtocol.Validate(); err != nil {
+		return errors.Wrap(err, "invalid server.proxyProtocol configuration")
+	}
+	if err := cfg.Server.HTTP3.Validate(); err != nil {
+		return errors.Wrap(err, "invalid server.http3 configuration")
+	}
+	if cfg.Server.HTTP3.Enable {
+		// QUIC always uses TLS 1.3
+		if v, ok := config.TLSVersion(cfg.Server.TLS.MaxVersion); !cfg.Server.TLS.Enable || (ok && v < tls.VersionTLS13) {
+			return errors.New("invalid server.http3 configuration: server.tls must be enabled with TLS 1.3")
+		}
+	}
+	if err := cfg.Server.Overload.Validate(); err != nil {
+		return errors.Wrap(err, "invalid server.overload configuration")
+	}
+	if err := cfg.Server.HealthCheck.Validate(); err != nil {
+		return errors.Wrap(err, "invalid server.healthCheck configuration")
+	}
+	if err := cfg.Server.GRPC.Validate(); err != nil {
+		return errors.Wrap(err, "invalid server.grpc configuration")
+	}
+	if err := cfg.Proxy.GRPCClient.Validate(); err != nil {
+		return errors.Wrap(err, "invalid proxy.grpcClient configuration")
+	}
+	if err := cfg.Proxy.RequestID.Validate(); err != nil {
+		return errors.Wrap(err, "invalid proxy.requestID configuration")
+	}
+	if err := cfg.Server.Metrics.Validate(); err != nil {
+		return errors.Wrap(err, "invalid server.metrics configuration")
+	}
+
+	if err := cfg.Tracing.Validate(); err != nil {
+		return errors.Wrap(err, "invalid tracing configuration")
+	}
+	if err := cfg.Log.AccessLog.Validate(); err != nil {
+		return errors.Wrap(err, "invalid log.accessLog configuration")
+	}
+	if err := cfg.Authorization.Status.Validate(); err != nil {
+		return errors.Wrap(err, "invalid authorization.status configuration")
+	}
+	if err := cfg.Audit.Validate(); err != nil {
+		return errors.Wrap(err, "invalid audit configuration")
+	}
+	if err := cfg.Reload.Validate(); err != nil {
+		return errors.Wrap(err, "invalid reload configuration")
+	}
+	if cfg.Authorization.RoleCertificate.Enable {
+		if err := validateRoleCertTLS(cfg.Server); err != nil {
+			return errors.Wrap(err, "invalid authorization.roleCertificate configuration")
+		}
+	}
+	return nil
+}
+
+// validateRoleCertTLS returns an error if no TLS listener verifies the client certificate,
+// or any TLS listener passes the client certificate without the verification, which must not be trusted as the role certificate.
+func validateRoleCertTLS(cfg config.Server) error {
+	verified := cfg.TLS.VerifiesClientCert()
+	if cfg.TLS.Enable && !verified {
+		return errors.New("server.tls must verify the client certificate, set caPath and clientAuth: verify-if-given or require")
+	}
+	for i, l := range cfg.Listeners {
+		if !l.TLS.Enable {
+			continue
+		}
+		if !l.TLS.VerifiesClientCert() {
+			return errors.Errorf("server.listeners[%d].tls must verify the client certificate, set caPath and clientAuth: verify-if-given or require", i)
+		}
+		verified = true
+	}
+	if !verified {
+		return errors.New("no TLS listener verifies the client certificate, enable server.tls with caPath")
+	}
+	return nil
 }
 
 // Init initializes child daemons synchronously.
@@ -103,6 +334,8 @@ func (g *authzProxyDaemon) Start(ctx context.Context) <-chan []error {
 		for err := range pch {
 			if err != nil {
 				glg.Errorf("pch: %v", err)
+				g.metrics.AuthorizerError()
+				g.status.AuthorizerError(err)
 				// count errors by cause
 				cause := errors.Cause(err).Error()
 				_, ok := emap[cause]
@@ -117,6 +350,30 @@ func (g *authzProxyDaemon) Start(ctx context.Context) <-chan []error {
 		return nil
 	})
 
+	// check the authorizer status thresholds, return on context done
+	eg.Go(func() error {
+		g.status.Start(ctx)
+		return nil
+	})
+
+	// reload the server certificate on change, return on context done
+	eg.Go(func() error {
+		g.tlsReloader.Start(ctx)
+		return nil
+	})
+
+	// reload the configuration file on change, return on context done
+	eg.Go(func() error {
+		g.reloader.Start(ctx)
+		return nil
+	})
+
+	// reload the CRLs on change, return on context done
+	eg.Go(func() error {
+		g.revocation.Start(ctx)
+		return nil
+	})
+
 	// handle proxy server error, return on server shutdown done
 	eg.Go(func() error {
 		errs := <-g.server.ListenAndServe(ctx)
@@ -144,6 +401,19 @@ func (g *authzProxyDaemon) Start(ctx context.Context) <-chan []error {
 		<-ctx.Done()
 		err := eg.Wait()
 
+		// flush the remaining spans
+		sctx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+		if terr := g.tracing.Shutdown(sctx); terr != nil {
+			glg.Warnf("failed to shutdown tracing: %v", terr)
+		}
+		cancel()
+		if aerr := g.accessLog.Close(); aerr != nil {
+			glg.Warnf("failed to close access log: %v", aerr)
+		}
+		if aerr := g.audit.Close(); aerr != nil {
+			glg.Warnf("failed to close audit log: %v", aerr)
+		}
+
 		/*
 			Read on emap is safe here, if and only if:
 			1. emap is not used in the parenet goroutine
@@ -163,8 +433,8 @@ func (g *authzProxyDaemon) Start(ctx context.Context) <-chan []error {
 	return ech
 }
 
-func newAuthzD(cfg config.Config) (service.Authorizationd, error) {
-	client := http.DefaultClient
+func newAuthzD(cfg config.Config, metrics *service.Metrics, status *service.AuthorizerStatus) (service.Authorizationd, error) {
+	client := &http.Client{}
 	if cfg.Athenz.Timeout != "" {
 		t, err := time.ParseDuration(cfg.Athenz.Timeout)
 		if err != nil {
@@ -183,6 +453,7 @@ func newAuthzD(cfg config.Config) (service.Authorizationd, error) {
 			},
 		}
 	}
+	client.Transport = status.RoundTripper(metrics.RoundTripper(client.Transport))
 
 	authzCfg := cfg.Authorization
 	sharedOpts := []authorizerd.Option{
@@ -230,8 +501,21 @@ func newAuthzD(cfg config.Config) (service.Authorizationd, error) {
 			authorizerd.WithDisableRoleToken(),
 		}
 	}
-	rcOpts := []authorizerd.Option{
-		authorizerd.WithDisableRoleCert(),
+	var rcOpts []authorizerd.Option
+	rcURIPrefix := authzCfg.RoleCertificate.URIPrefix
+	if rcURIPrefix == "" {
+		rcURIPrefix = service.DefaultRoleCertURIPrefix
+	}
+	if authzCfg.RoleCertificate.Enable {
+		// the TLS listeners are validated to verify the client certificate
+		rcOpts = []authorizerd.Option{
+			authorizerd.WithEnableRoleCert(),
+			authorizerd.WithRoleCertURIPrefix(rcURIPrefix),
+		}
+	} else {
+		rcOpts = []authorizerd.Option{
+			authorizerd.WithDisableRoleCert(),
+		}
 	}
 
 	var atOpts []authorizerd.Option
@@ -291,5 +575,14 @@ func newAuthzD(cfg config.Config) (service.Authorizationd, error) {
 	for _, opts := range authzOptss {
 		authzOpts = append(authzOpts, opts...)
 	}
-	return authorizerd.New(authzOpts...)
+	authz, err := authorizerd.New(authzOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	// athenz-authorizer does not return the principal of the role certificate, verify it before the other credentials
+	if authzCfg.RoleCertificate.Enable {
+		return service.NewRoleCertAuthorizationd(authz, rcURIPrefix), nil
+	}
+	return authz, nil
 }
@@ -94,6 +94,293 @@ func TestNew(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "new error when gRPC server parameters are invalid",
+			args: args{
+				cfg: config.Config{
+					Server: config.Server{
+						GRPC: config.GRPCServer{
+							MaxRecvMsgSize: -1,
+						},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "new error when gRPC client parameters are invalid",
+			args: args{
+				cfg: config.Config{
+					Proxy: config.Proxy{
+						GRPCClient: config.GRPCClient{
+							KeepaliveTime: time.Second,
+						},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "new error when metrics configuration is invalid",
+			args: args{
+				cfg: config.Config{
+					Server: config.Server{
+						Metrics: config.Metrics{
+							Enable: true,
+							Server: "api",
+						},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "new error when tracing configuration is invalid",
+			args: args{
+				cfg: config.Config{
+					Tracing: config.Tracing{
+						Enable:   true,
+						Exporter: "invalid",
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "new error when access log configuration is invalid",
+			args: args{
+				cfg: config.Config{
+					Log: config.Log{
+						AccessLog: config.AccessLog{
+							Enable: true,
+							Format: "xml",
+						},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "new error when request ID configuration is invalid",
+			args: args{
+				cfg: config.Config{
+					Proxy: config.Proxy{
+						RequestID: config.RequestID{
+							Header: "X Request ID",
+						},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "new error when additional listener configuration is invalid",
+			args: args{
+				cfg: config.Config{
+					Server: config.Server{
+						Listeners: []config.ProxyListener{
+							{
+								Listener: config.Listener{
+									Address: ":8443",
+								},
+								TLS: config.TLS{
+									Enable: true,
+								},
+							},
+						},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "new error when HTTP/3 is enabled without TLS",
+			args: args{
+				cfg: config.Config{
+					Server: config.Server{
+						HTTP3: config.HTTP3{
+							Enable: true,
+						},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "new error when HTTP/3 is enabled without TLS 1.3",
+			args: args{
+				cfg: config.Config{
+					Server: config.Server{
+						HTTP3: config.HTTP3{
+							Enable: true,
+						},
+						TLS: config.TLS{
+							Enable:     true,
+							MaxVersion: "1.2",
+						},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "new error when overload configuration is invalid",
+			args: args{
+				cfg: config.Config{
+					Server: config.Server{
+						Overload: config.Overload{
+							Enable:       true,
+							QueueTimeout: "invalid",
+						},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "new error when PROXY protocol configuration is invalid",
+			args: args{
+				cfg: config.Config{
+					Server: config.Server{
+						ProxyProtocol: config.ProxyProtocol{
+							Enable: true,
+						},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "new error when health check listener configuration is invalid",
+			args: args{
+				cfg: config.Config{
+					Server: config.Server{
+						HealthCheck: config.HealthCheck{
+							Listener: config.Listener{
+								Network: config.ListenerUnix,
+							},
+						},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "new error when server timeouts configuration is invalid",
+			args: args{
+				cfg: config.Config{
+					Server: config.Server{
+						Timeouts: config.ServerTimeouts{
+							RequestTimeout: "1",
+						},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "new error when TLS configuration is invalid",
+			args: args{
+				cfg: config.Config{
+					Server: config.Server{
+						TLS: config.TLS{
+							ReloadPeriod: "1",
+						},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "new error when TLS certificate cannot be loaded",
+			args: args{
+				cfg: config.Config{
+					Server: config.Server{
+						TLS: config.TLS{
+							Enable:   true,
+							CertPath: "../test/data/invalid_dummyServer.crt",
+							KeyPath:  "../test/data/invalid_dummyServer.key",
+						},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "new error when CRL cannot be loaded",
+			args: args{
+				cfg: config.Config{
+					Server: config.Server{
+						TLS: config.TLS{
+							Enable:       true,
+							CertPath:     "../test/data/dummyServer.crt",
+							KeyPath:      "../test/data/dummyServer.key",
+							CAPath:       "../test/data/dummyCa.pem",
+							ReloadPeriod: "0",
+							Revocation: config.Revocation{
+								CRLPaths: []string{"../test/data/not_exist.crl"},
+							},
+						},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "new error when health check configuration is invalid",
+			args: args{
+				cfg: config.Config{
+					Server: config.Server{
+						HealthCheck: config.HealthCheck{
+							Readiness: config.Readiness{
+								Endpoint: "ready",
+							},
+						},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "new error when upstream health check configuration is invalid",
+			args: args{
+				cfg: config.Config{
+					Server: config.Server{
+						HealthCheck: config.HealthCheck{
+							Upstream: config.UpstreamHealthCheck{
+								Enable: true,
+								Type:   "udp",
+							},
+						},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "new error when authorizer status configuration is invalid",
+			args: args{
+				cfg: config.Config{
+					Authorization: config.Authorization{
+						Status: config.AuthorizerStatus{
+							FailureThreshold: -1,
+						},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "new error when audit configuration is invalid",
+			args: args{
+				cfg: config.Config{
+					Audit: config.Audit{
+						Enable: true,
+					},
+				},
+			},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -112,6 +399,92 @@ func TestNew(t *testing.T) {
 	}
 }
 
+func Test_validateRoleCertTLS(t *testing.T) {
+	verified := config.TLS{
+		Enable: true,
+		CAPath: "ca.pem",
+	}
+	tests := []struct {
+		name    string
+		cfg     config.Server
+		wantErr string
+	}{
+		{
+			name: "verified server.tls",
+			cfg: config.Server{
+				TLS: verified,
+				Listeners: []config.ProxyListener{
+					{TLS: verified},
+					{},
+				},
+			},
+		},
+		{
+			name: "verified listener without server.tls",
+			cfg: config.Server{
+				Listeners: []config.ProxyListener{
+					{TLS: verified},
+				},
+			},
+		},
+		{
+			name: "TLS is not enabled",
+			cfg: config.Server{
+				Listeners: []config.ProxyListener{
+					{},
+				},
+			},
+			wantErr: "no TLS listener verifies the client certificate, enable server.tls with caPath",
+		},
+		{
+			name: "caPath is not set",
+			cfg: config.Server{
+				TLS: config.TLS{
+					Enable: true,
+				},
+			},
+			wantErr: "server.tls must verify the client certificate, set caPath and clientAuth: verify-if-given or require",
+		},
+		{
+			name: "server.tls passes the unverified client certificate",
+			cfg: config.Server{
+				TLS: config.TLS{
+					Enable:        true,
+					CAPath:        "ca.pem",
+					ClientAuth:    config.TLSClientAuthRequireAny,
+					AllowInsecure: true,
+				},
+			},
+			wantErr: "server.tls must verify the client certificate, set caPath and clientAuth: verify-if-given or require",
+		},
+		{
+			name: "listener passes the unverified client certificate",
+			cfg: config.Server{
+				TLS: verified,
+				Listeners: []config.ProxyListener{
+					{TLS: verified},
+					{
+						TLS: config.TLS{
+							Enable:        true,
+							ClientAuth:    config.TLSClientAuthRequest,
+							AllowInsecure: true,
+						},
+					},
+				},
+			},
+			wantErr: "server.listeners[1].tls must verify the client certificate, set caPath and clientAuth: verify-if-given or require",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateRoleCertTLS(tt.cfg)
+			if (err == nil && tt.wantErr != "") || (err != nil && err.Error() != tt.wantErr) {
+				t.Errorf("validateRoleCertTLS() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func Test_authzProxyDaemon_Init(t *testing.T) {
 	type fields struct {
 		athenz service.Authorizationd
@@ -752,6 +1125,23 @@ func Test_newAuthzD(t *testing.T) {
 			},
 			want: true,
 		},
+		{
+			name: "test success role certificate enable",
+			args: args{
+				cfg: config.Config{
+					Authorization: config.Authorization{
+						Policy: config.Policy{
+							Disable: true,
+						},
+						RoleCertificate: config.RoleCertificate{
+							Enable:    true,
+							URIPrefix: "athenz://role/",
+						},
+					},
+				},
+			},
+			want: true,
+		},
 		{
 			name: "test success mappingRules set",
 			args: args{
@@ -781,7 +1171,7 @@ func Test_newAuthzD(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := newAuthzD(tt.args.cfg)
+			got, err := newAuthzD(tt.args.cfg, nil, nil)
 
 			if (err == nil && tt.wantErrStr != "") || (err != nil && err.Error() != tt.wantErrStr) {
 				t.Errorf("newAuthzD() error = %v, wantErr %v", err, tt.wantErrStr)
@@ -0,0 +1,22 @@
+package usecase
+
+import (
+	"github.com/yahoojapan/authorization-proxy/v4/service"
+)
+
+// Option represents a functional option for the Authorization Proxy daemon
+type Option func(*authzProxyDaemon)
+
+// WithLogger returns a logger functional option, which exposes the log levels on the debug server
+func WithLogger(l *service.Logger) Option {
+	return func(g *authzProxyDaemon) {
+		g.logger = l
+	}
+}
+
+// WithConfigPath returns a configuration file path functional option, which enables the configuration reload
+func WithConfigPath(path string) Option {
+	return func(g *authzProxyDaemon) {
+		g.cfgPath = path
+	}
+}
@@ -0,0 +1,21 @@
+package usecase
+
+import (
+	"testing"
+
+	"github.com/yahoojapan/authorization-proxy/v4/config"
+	"github.com/yahoojapan/authorization-proxy/v4/service"
+)
+
+func TestWithLogger(t *testing.T) {
+	l, err := service.NewLogger(config.Log{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g := &authzProxyDaemon{}
+	WithLogger(l)(g)
+	if g.logger != l {
+		t.Error("logger not match")
+	}
+}
@@ -0,0 +1,136 @@
+/*
+Copyright (C)  2018 Yahoo Japan Corporation Athenz team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package usecase
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"time"
+
+	"github.com/kpango/glg"
+	"github.com/pkg/errors"
+
+	"github.com/yahoojapan/authorization-proxy/v4/config"
+	"github.com/yahoojapan/authorization-proxy/v4/service"
+)
+
+// reloadInitTimeout represents the maximum duration to initialize the authorizer of the reloaded configuration.
+const reloadInitTimeout = time.Minute
+
+// Reload reloads the configuration file, and applies the reloadable parts without dropping the in-flight requests.
+func (g *authzProxyDaemon) Reload(ctx context.Context) error {
+	return g.reloader.Reload(ctx)
+}
+
+// reload builds the authorizer and the HTTP handler of the configuration beside the current ones, and replaces them once all of them are ready.
+// The current configuration is kept if any of them fails.
+func (g *authzProxyDaemon) reload(ctx context.Context, next config.Config) error {
+	g.reloadMu.Lock()
+	defer g.reloadMu.Unlock()
+
+	cur := g.cfg
+	next = keepStatic(cur, next)
+	if err := validate(next); err != nil {
+		return err
+	}
+	if err := next.Log.Validate(); err != nil {
+		return errors.Wrap(err, "invalid log configuration")
+	}
+
+	var authz service.Authorizationd
+	if !reflect.DeepEqual(cur.Athenz, next.Athenz) || !reflect.DeepEqual(cur.Authorization, next.Authorization) {
+		a, err := g.newAuthzD(next, g.metrics, g.status)
+		if err != nil {
+			return errors.Wrap(err, "cannot newAuthzD(cfg)")
+		}
+		ictx, cancel := context.WithTimeout(ctx, reloadInitTimeout)
+		err = a.Init(ictx)
+		cancel()
+		if err != nil {
+			return errors.Wrap(err, "authorizer init error")
+		}
+		authz = a
+	}
+	var rh http.Handler
+	var transport *http.Transport
+	if !reflect.DeepEqual(cur.Proxy, next.Proxy) {
+		rh, transport = g.restHandler(next)
+	}
+
+	if authz != nil {
+		g.authorizer.Swap(authz)
+		g.status.Reconfigure(next.Authorization)
+		glg.Info("authorizer reloaded")
+	}
+	if rh != nil {
+		g.rest.Store(rh)
+		// the connections in use are kept for the in-flight requests
+		if g.transport != nil {
+			g.transport.CloseIdleConnections()
+		}
+		g.transport = transport
+		glg.Info("proxy handler reloaded")
+	}
+	if g.logger != nil && (cur.Log.Level != next.Log.Level || !reflect.DeepEqual(cur.Log.Packages, next.Log.Packages)) {
+		// validated above
+		_ = g.logger.Reconfigure(service.LogLevels{
+			Level:    next.Log.Level,
+			Packages: next.Log.Packages,
+		})
+		glg.Infof("log levels reloaded, level: %s, packages: %v", next.Log.Level, next.Log.Packages)
+	}
+	g.cfg = next
+	return nil
+}
+
+// keepStatic returns the next configuration with the fields which cannot be reloaded restored from the current configuration,
+// and logs the changed ones.
+func keepStatic(cur, next config.Config) config.Config {
+	for _, f := range []struct {
+		name      string
+		cur, next interface{}
+	}{
+		{"server", &cur.Server, &next.Server},
+		{"proxy.scheme", &cur.Proxy.Scheme, &next.Proxy.Scheme},
+		{"proxy.host", &cur.Proxy.Host, &next.Proxy.Host},
+		{"proxy.port", &cur.Proxy.Port, &next.Proxy.Port},
+		{"proxy.bufferSize", &cur.Proxy.BufferSize, &next.Proxy.BufferSize},
+		{"proxy.grpc", &cur.Proxy.GRPC, &next.Proxy.GRPC},
+		{"proxy.grpcClient", &cur.Proxy.GRPCClient, &next.Proxy.GRPCClient},
+		{"proxy.requestID", &cur.Proxy.RequestID, &next.Proxy.RequestID},
+		{"authorization.roleToken", &cur.Authorization.RoleToken, &next.Authorization.RoleToken},
+		{"authorization.roleCertificate", &cur.Authorization.RoleCertificate, &next.Authorization.RoleCertificate},
+		{"authorization.grpcStream", &cur.Authorization.GRPCStream, &next.Authorization.GRPCStream},
+		{"authorization.status", &cur.Authorization.Status, &next.Authorization.Status},
+		{"log.color", &cur.Log.Color, &next.Log.Color},
+		{"log.format", &cur.Log.Format, &next.Log.Format},
+		{"log.output", &cur.Log.Output, &next.Log.Output},
+		{"log.rotation", &cur.Log.Rotation, &next.Log.Rotation},
+		{"log.accessLog", &cur.Log.AccessLog, &next.Log.AccessLog},
+		{"tracing", &cur.Tracing, &next.Tracing},
+		{"audit", &cur.Audit, &next.Audit},
+		{"reload", &cur.Reload, &next.Reload},
+	} {
+		if reflect.DeepEqual(f.cur, f.next) {
+			continue
+		}
+		glg.Warnf("%s cannot be reloaded without restart, keep the current value", f.name)
+		reflect.ValueOf(f.next).Elem().Set(reflect.ValueOf(f.cur).Elem())
+	}
+	return next
+}
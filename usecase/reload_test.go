@@ -0,0 +1,223 @@
+package usecase
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/yahoojapan/authorization-proxy/v4/config"
+	"github.com/yahoojapan/authorization-proxy/v4/service"
+)
+
+func newTestReloadConfig() config.Config {
+	return config.Config{
+		Athenz: config.Athenz{
+			URL: "athenz.io",
+		},
+		Authorization: config.Authorization{
+			AthenzDomains: []string{"dummyDom1"},
+			AccessToken: config.AccessToken{
+				Enable: true,
+			},
+			PublicKey: config.PublicKey{
+				SysAuthDomain:   "dummy.sys.auth",
+				RefreshPeriod:   "10s",
+				ETagExpiry:      "10s",
+				ETagPurgePeriod: "10s",
+			},
+			Policy: config.Policy{
+				ExpiryMargin:  "10s",
+				RefreshPeriod: "10s",
+				PurgePeriod:   "10s",
+			},
+		},
+		Server: config.Server{
+			Port: 8082,
+			HealthCheck: config.HealthCheck{
+				Endpoint: "/dummy",
+			},
+		},
+		Proxy: config.Proxy{
+			BufferSize: 512,
+		},
+		Log: config.Log{
+			Level: "info",
+		},
+	}
+}
+
+func Test_authzProxyDaemon_reload(t *testing.T) {
+	tests := []struct {
+		name    string
+		next    func(config.Config) config.Config
+		want    func(config.Config) config.Config
+		wantErr bool
+	}{
+		{
+			name: "reload the proxy configuration and keep the server configuration",
+			next: func(cfg config.Config) config.Config {
+				cfg.Proxy.OriginHealthCheckPaths = []string{"/healthz"}
+				cfg.Server.Port = 9092
+				cfg.Log.Level = "debug"
+				return cfg
+			},
+			want: func(cfg config.Config) config.Config {
+				cfg.Proxy.OriginHealthCheckPaths = []string{"/healthz"}
+				cfg.Log.Level = "debug"
+				return cfg
+			},
+		},
+		{
+			name: "keep the current configuration when the log level is invalid",
+			next: func(cfg config.Config) config.Config {
+				cfg.Proxy.OriginHealthCheckPaths = []string{"/healthz"}
+				cfg.Log.Level = "invalid"
+				return cfg
+			},
+			want: func(cfg config.Config) config.Config {
+				return cfg
+			},
+			wantErr: true,
+		},
+		{
+			name: "keep the current configuration when the authorizer cannot be created",
+			next: func(cfg config.Config) config.Config {
+				cfg.Athenz.Timeout = "invalid"
+				return cfg
+			},
+			want: func(cfg config.Config) config.Config {
+				return cfg
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTestReloadConfig()
+			logger, err := service.NewLogger(cfg.Log)
+			if err != nil {
+				t.Fatal(err)
+			}
+			d, err := New(cfg, WithLogger(logger))
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			g := d.(*authzProxyDaemon)
+			rest := g.rest
+			err = g.reload(context.Background(), tt.next(newTestReloadConfig()))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("reload() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if want := tt.want(newTestReloadConfig()); !reflect.DeepEqual(g.cfg, want) {
+				t.Errorf("reload() cfg = %+v, want %+v", g.cfg, want)
+			}
+			if g.rest != rest {
+				t.Error("reload() replaced the handler served by the server")
+			}
+			if got := logger.Levels().Level; got != g.cfg.Log.Level {
+				t.Errorf("log level = %s, want %s", got, g.cfg.Log.Level)
+			}
+		})
+	}
+}
+
+func Test_authzProxyDaemon_reload_authorizer(t *testing.T) {
+	cfg := newTestReloadConfig()
+	cfg.Authorization.AthenzDomains = []string{"dummyDom1", "dummyDom2"}
+	d, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	g := d.(*authzProxyDaemon)
+	var created int
+	g.newAuthzD = func(cfg config.Config, m *service.Metrics, st *service.AuthorizerStatus) (service.Authorizationd, error) {
+		created++
+		return &service.AuthorizerdMock{
+			InitFunc: func(context.Context) error {
+				return nil
+			},
+		}, nil
+	}
+
+	next := newTestReloadConfig()
+	next.Authorization.AthenzDomains = []string{"dummyDom1"}
+	if err := g.reload(context.Background(), next); err != nil {
+		t.Fatalf("reload() error = %v", err)
+	}
+	if created != 1 {
+		t.Errorf("authorizer created %d times, want 1", created)
+	}
+	// the removed domain is no longer tracked, so that the status does not turn unhealthy
+	targets := g.status.Report().Components[service.ComponentPolicyd].Targets
+	if _, ok := targets["dummyDom2"]; ok || len(targets) != 1 {
+		t.Errorf("policyd targets = %v, want only dummyDom1", targets)
+	}
+}
+
+func Test_authzProxyDaemon_reload_transport(t *testing.T) {
+	closed := make(chan struct{}, 1)
+	upstream := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	upstream.Config.ConnState = func(c net.Conn, st http.ConnState) {
+		if st == http.StateClosed {
+			closed <- struct{}{}
+		}
+	}
+	upstream.Start()
+	defer upstream.Close()
+
+	d, err := New(newTestReloadConfig())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	g := d.(*authzProxyDaemon)
+	prev := g.transport
+	// keep an idle connection of the current transport
+	res, err := (&http.Client{Transport: prev}).Get(upstream.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	next := newTestReloadConfig()
+	next.Proxy.PreserveHost = true
+	if err := g.reload(context.Background(), next); err != nil {
+		t.Fatalf("reload() error = %v", err)
+	}
+	if g.transport == prev || g.transport == nil {
+		t.Error("reload() did not replace the transport")
+	}
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Error("idle connection of the previous transport is not closed")
+	}
+}
+
+func Test_keepStatic(t *testing.T) {
+	cur := newTestReloadConfig()
+	next := newTestReloadConfig()
+	next.Server.Port = 9092
+	next.Proxy.Host = "backend"
+	next.Proxy.PreserveHost = true
+	next.Authorization.RoleToken.Enable = true
+	next.Authorization.AthenzDomains = []string{"dummyDom2"}
+	next.Log.Format = config.LogJSON
+
+	want := newTestReloadConfig()
+	want.Proxy.PreserveHost = true
+	want.Authorization.AthenzDomains = []string{"dummyDom2"}
+	if got := keepStatic(cur, next); !reflect.DeepEqual(got, want) {
+		t.Errorf("keepStatic() = %+v, want %+v", got, want)
+	}
+}
+
+func Test_authzProxyDaemon_Reload(t *testing.T) {
+	g := &authzProxyDaemon{}
+	if err := g.Reload(context.Background()); err == nil {
+		t.Error("Reload() error = nil, want the path is not set")
+	}
+}